@@ -0,0 +1,32 @@
+-- Deploy ss2:function-block-orphan to pg
+-- requires: schema
+-- requires: table-block
+
+BEGIN;
+
+CREATE OR REPLACE FUNCTION <%=schema%>.block_orphan (
+    IN in_height <%=schema%>.block.height%TYPE
+) RETURNS INTEGER AS $$
+    DECLARE
+        var_orphaned_count INTEGER;
+    BEGIN
+        -- Orphan all non orphaned blocks from the fork height to tip
+        UPDATE block
+            SET (next_block_hash, is_orphaned) = ('', TRUE)
+            WHERE height >= in_height
+            AND is_orphaned = FALSE;
+
+        GET DIAGNOSTICS var_orphaned_count = ROW_COUNT;
+
+        -- Clear next_block_hash of the common ancestor so the new branch can be linked
+        UPDATE block
+            SET next_block_hash = ''
+            WHERE height = in_height - 1
+            AND is_orphaned = FALSE;
+
+        RETURN var_orphaned_count;
+    END
+$$ LANGUAGE PLPGSQL VOLATILE
+SET search_path=<%=schema%>;
+
+COMMIT;
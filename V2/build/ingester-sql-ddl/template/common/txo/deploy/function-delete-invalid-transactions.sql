@@ -1,6 +1,7 @@
 -- Deploy ss2:function-delete-invalid-transactions to pg
 -- requires: schema
 -- requires: table-transaction
+-- requires: function-output-unspend
 
 BEGIN;
 
@@ -11,6 +12,13 @@ CREATE OR REPLACE FUNCTION <%=schema%>.delete_invalid_txs(
     LANGUAGE plpgsql
 AS $$
     BEGIN
+        PERFORM output_unspend(ARRAY(
+            SELECT id
+            FROM transaction
+            WHERE id = ANY(in_ids)
+            AND block_id IS NULL
+        ));
+
         DELETE FROM transaction
         WHERE id = ANY(in_ids)
         AND block_id IS NULL;
@@ -4,6 +4,7 @@
 -- requires: table-transaction
 -- requires: table-input
 -- requires: table-output
+-- requires: function-output-unspend
 
 BEGIN;
 
@@ -12,6 +13,13 @@ CREATE OR REPLACE FUNCTION <%=schema%>.delete_orphans()
     LANGUAGE plpgsql
 AS $$
     BEGIN
+        PERFORM output_unspend(ARRAY(
+            SELECT transaction.id
+            FROM block
+            JOIN transaction ON block.id = transaction.block_id
+            WHERE is_orphaned = true
+        ));
+
         DELETE FROM input
         WHERE input.id IN (
             SELECT input.id
@@ -0,0 +1,57 @@
+-- Deploy ss2:function-output-spend to pg
+-- requires: schema
+-- requires: table-transaction
+-- requires: table-input
+-- requires: table-output-spending
+
+BEGIN;
+
+-- Mark the outputs spent by the inputs of the transactions. With in_find_spenders, outputs of the transactions are
+-- also matched with inputs written before them, e.g. a mempool transaction inserted before its parent. That lookup
+-- needs idx_spent_txid, so bulk loads skip it. Outputs already spent are left as they are.
+CREATE OR REPLACE FUNCTION <%=schema%>.output_spend (
+    IN in_transaction_ids BIGINT[],
+    IN in_find_spenders BOOLEAN
+) RETURNS INTEGER AS $$
+    DECLARE
+        var_spent_count INTEGER;
+        var_found_count INTEGER := 0;
+    BEGIN
+        UPDATE output
+            SET
+                spending_transaction_id = input.transaction_id,
+                spending_vin = input.vin
+            FROM
+                input
+                JOIN transaction AS spent ON spent.txid = input.spent_txid
+            WHERE
+                input.transaction_id = ANY(in_transaction_ids)
+                AND output.transaction_id = spent.id
+                AND output.vout = input.spent_vout
+                AND output.spending_transaction_id IS NULL;
+
+        GET DIAGNOSTICS var_spent_count = ROW_COUNT;
+
+        IF in_find_spenders THEN
+            UPDATE output
+                SET
+                    spending_transaction_id = input.transaction_id,
+                    spending_vin = input.vin
+                FROM
+                    transaction AS spent
+                    JOIN input ON input.spent_txid = spent.txid
+                WHERE
+                    spent.id = ANY(in_transaction_ids)
+                    AND output.transaction_id = spent.id
+                    AND output.vout = input.spent_vout
+                    AND output.spending_transaction_id IS NULL;
+
+            GET DIAGNOSTICS var_found_count = ROW_COUNT;
+        END IF;
+
+        RETURN var_spent_count + var_found_count;
+    END
+$$ LANGUAGE PLPGSQL VOLATILE
+SET search_path=<%=schema%>;
+
+COMMIT;
@@ -0,0 +1,37 @@
+-- Deploy ss2:function-output-unspend to pg
+-- requires: schema
+-- requires: table-transaction
+-- requires: table-input
+-- requires: table-output-spending
+
+BEGIN;
+
+-- Clear the spends of the transactions before they are deleted. An output that is also spent by another transaction,
+-- e.g. the mined side of a mempool double spend, is marked spent by that one instead.
+CREATE OR REPLACE FUNCTION <%=schema%>.output_unspend (
+    IN in_transaction_ids BIGINT[]
+) RETURNS void AS $$
+    BEGIN
+        UPDATE output
+            SET (spending_transaction_id, spending_vin) = (
+                SELECT
+                    input.transaction_id,
+                    input.vin
+                FROM
+                    transaction AS spent
+                    JOIN input ON input.spent_txid = spent.txid
+                WHERE
+                    spent.id = output.transaction_id
+                    AND input.spent_vout = output.vout
+                    AND input.transaction_id <> ALL(in_transaction_ids)
+                ORDER BY
+                    input.transaction_id
+                LIMIT 1
+            )
+            WHERE
+                spending_transaction_id = ANY(in_transaction_ids);
+    END
+$$ LANGUAGE PLPGSQL VOLATILE
+SET search_path=<%=schema%>;
+
+COMMIT;
@@ -4,16 +4,11 @@
 -- requires: table-transaction
 -- requires: function-input-insert
 -- requires: function-output-insert
+-- requires: function-address-transaction-insert
+-- requires: function-output-spend
 
 BEGIN;
 
-DROP FUNCTION <%=schema%>.transaction_insert (
-    <%=schema%>.block.id%TYPE,
-    jsonb,
-    <%=schema%>.transaction.raw_transaction%TYPE,
-    <%=schema%>.transaction.index%TYPE
-);
-
 CREATE OR REPLACE FUNCTION <%=schema%>.transaction_insert (
     IN in_block_id <%=schema%>.block.id%TYPE, 
     IN in_tx_def jsonb,
@@ -64,6 +59,8 @@ CREATE OR REPLACE FUNCTION <%=schema%>.transaction_insert (
 
                 PERFORM input_insert(var_transaction_id, in_tx_def->'inputs');
                 PERFORM output_insert(var_transaction_id, in_tx_def->'outputs');
+                PERFORM output_spend(ARRAY[var_transaction_id], TRUE);
+                PERFORM address_transaction_insert(ARRAY[var_transaction_id], TRUE);
             ELSE
                 IF in_block_id IS NOT NULL THEN
                     -- This is a mempool transaction that has been mined
@@ -74,6 +71,8 @@ CREATE OR REPLACE FUNCTION <%=schema%>.transaction_insert (
                             index = in_transaction_index
                         WHERE
                             id = var_transaction_id;
+
+                    PERFORM address_transaction_insert(ARRAY[var_transaction_id], FALSE);
                 END IF;
             END IF;
         ELSE
@@ -0,0 +1,130 @@
+-- Deploy ss2:function-transactions-insert to pg
+-- requires: schema
+-- requires: table-block
+-- requires: table-transaction
+-- requires: table-input
+-- requires: table-output
+-- requires: function-json-array-cast
+
+BEGIN;
+
+CREATE OR REPLACE FUNCTION <%=schema%>.transactions_insert (
+    IN in_block_id <%=schema%>.block.id%TYPE,
+    IN in_txs jsonb
+) RETURNS void AS $$
+    DECLARE
+        var_block_id block.id%TYPE := NULL;
+    BEGIN
+        IF in_block_id >= 0 THEN
+            var_block_id := in_block_id;
+        END IF;
+
+        IF EXISTS (SELECT 1 FROM jsonb_array_elements(in_txs) AS tx WHERE tx->'tx'->>'txid' IS NULL) THEN
+            RAISE EXCEPTION 'no txid supplied';
+        END IF;
+
+        WITH txs AS (
+            SELECT
+                tx->'tx' AS def,
+                tx->>'raw' AS raw,
+                (tx->>'index')::integer AS index
+            FROM
+                jsonb_array_elements(in_txs) AS tx
+        ), inserted AS (
+            -- Mempool transactions that have been mined are updated with the block information
+            INSERT INTO transaction (
+                index,
+                block_id,
+                txid,
+                hash,
+                version,
+                size,
+                v_size,
+                weight,
+                locktime,
+                raw_transaction
+            )
+            SELECT
+                CASE WHEN var_block_id IS NOT NULL AND txs.index >= 0 THEN txs.index END,
+                var_block_id,
+                def->>'txid',
+                def->>'hash',
+                (def->>'version')::integer,
+                (def->>'size')::integer,
+                (def->>'vsize')::integer,
+                (def->>'weight')::integer,
+                (def->>'locktime')::bigint,
+                raw
+            FROM
+                txs
+            ON CONFLICT (txid) DO UPDATE
+                SET
+                    block_id = EXCLUDED.block_id,
+                    index = EXCLUDED.index
+                WHERE
+                    EXCLUDED.block_id IS NOT NULL
+            -- xmax is only set on rows that existed before the insert
+            RETURNING id, txid, xmax = 0 AS is_new
+        ), inputs AS (
+            INSERT INTO input (
+                transaction_id,
+                vin,
+                spent_txid,
+                spent_vout,
+                asm,
+                hex,
+                sequence_num,
+                tx_in_witness,
+                coinbase
+            )
+            SELECT
+                inserted.id,
+                (var_input->>'vin')::integer,
+                var_input->>'spent_txid',
+                (var_input->>'spent_vout')::integer,
+                var_input->>'asm',
+                var_input->>'hex',
+                (var_input->>'sequence')::bigint,
+                var_input->>'txinwitness',
+                var_input->>'coinbase'
+            FROM
+                inserted
+                JOIN txs ON txs.def->>'txid' = inserted.txid
+                CROSS JOIN jsonb_array_elements(txs.def->'inputs') AS var_input
+            WHERE
+                inserted.is_new
+            ON CONFLICT (transaction_id, vin) DO NOTHING
+        )
+        INSERT INTO output (
+            transaction_id,
+            vout,
+            amount,
+            asm,
+            hex,
+            req_sigs,
+            output_type,
+            address,
+            addresses
+        )
+        SELECT
+            inserted.id,
+            (var_output->>'vout')::integer,
+            (var_output->>'amount')::bigint,
+            var_output->>'asm',
+            var_output->>'hex',
+            (var_output->>'reqSigs')::integer,
+            var_output->>'type',
+            (var_output->>'address')::varchar,
+            json_array_cast(var_output->'addresses')
+        FROM
+            inserted
+            JOIN txs ON txs.def->>'txid' = inserted.txid
+            CROSS JOIN jsonb_array_elements(txs.def->'outputs') AS var_output
+        WHERE
+            inserted.is_new
+        ON CONFLICT (transaction_id, vout) DO NOTHING;
+    END;
+$$ LANGUAGE PLPGSQL VOLATILE
+SET search_path=<%=schema%>;
+
+COMMIT;
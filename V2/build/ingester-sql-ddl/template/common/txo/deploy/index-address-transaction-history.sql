@@ -0,0 +1,11 @@
+-- Deploy ss2:index-address-transaction-history to pg
+-- requires: schema
+-- requires: table-address-transaction
+
+BEGIN;
+
+-- Orders the history of an address newest first, mempool transactions (NULL height) ahead of every block. Address
+-- history pages are read by keyset on (COALESCE(height, 2147483647), transaction_id).
+CREATE INDEX idx_address_transaction_history ON <%=schema%>.address_transaction(address, (COALESCE(height, 2147483647)) DESC, transaction_id DESC);
+
+COMMIT;
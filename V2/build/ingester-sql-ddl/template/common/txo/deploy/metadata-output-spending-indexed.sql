@@ -0,0 +1,18 @@
+-- Deploy ss2:metadata-output-spending-indexed to pg
+-- requires: schema
+-- requires: table-metadata
+-- requires: table-output-spending
+
+BEGIN;
+
+-- A schema without outputs has no spends to backfill, so the spending columns of output can be relied on right away.
+-- Otherwise the spends backfill sets the key once it has run.
+INSERT INTO <%=schema%>.metadata(key, value)
+SELECT
+    'outputSpendingIndexed',
+    'true'
+WHERE
+    NOT EXISTS (SELECT 1 FROM <%=schema%>.output)
+ON CONFLICT (key) DO NOTHING;
+
+COMMIT;
@@ -0,0 +1,19 @@
+-- Deploy ss2:table-address-transaction to pg
+-- requires: schema
+-- requires: table-transaction
+
+BEGIN;
+
+-- direction is a bit mask of how a transaction moves funds of an address: 1 received, 2 sent, 3 both.
+-- height is the height of the non orphaned block of the transaction, NULL while it is in the mempool.
+CREATE TABLE <%=schema%>.address_transaction(
+  address VARCHAR NOT NULL,
+  transaction_id BIGINT NOT NULL REFERENCES <%=schema%>.transaction(id) ON DELETE CASCADE,
+  height INTEGER,
+  direction SMALLINT NOT NULL,
+  PRIMARY KEY (address, transaction_id)
+);
+
+CREATE INDEX idx_address_transaction_transaction_id ON <%=schema%>.address_transaction(transaction_id);
+
+COMMIT;
@@ -0,0 +1,15 @@
+-- Deploy ss2:table-output-spending to pg
+-- requires: schema
+-- requires: table-transaction
+-- requires: table-output
+
+BEGIN;
+
+-- The input spending an output, NULL while it is unspent. Set by output_spend, cleared by output_unspend.
+ALTER TABLE <%=schema%>.output
+  ADD COLUMN spending_transaction_id BIGINT REFERENCES <%=schema%>.transaction(id) ON DELETE SET NULL,
+  ADD COLUMN spending_vin INTEGER;
+
+CREATE INDEX idx_output_spending_transaction_id ON <%=schema%>.output(spending_transaction_id);
+
+COMMIT;
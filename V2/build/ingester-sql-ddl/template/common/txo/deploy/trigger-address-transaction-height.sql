@@ -0,0 +1,31 @@
+-- Deploy ss2:trigger-address-transaction-height to pg
+-- requires: schema
+-- requires: table-block
+-- requires: table-transaction
+-- requires: table-address-transaction
+
+BEGIN;
+
+-- Blocks are orphaned and restored by block_insert and block_orphan, keep the height of their transactions in
+-- address_transaction in step so history reads don't have to join the block of every transaction
+CREATE OR REPLACE FUNCTION <%=schema%>.address_transaction_height()
+    RETURNS trigger AS $$
+    BEGIN
+        UPDATE address_transaction
+            SET height = CASE WHEN NEW.is_orphaned THEN NULL ELSE NEW.height END
+            FROM transaction
+            WHERE transaction.block_id = NEW.id
+            AND address_transaction.transaction_id = transaction.id;
+
+        RETURN NULL;
+    END
+$$ LANGUAGE PLPGSQL VOLATILE
+SET search_path=<%=schema%>;
+
+CREATE TRIGGER trigger_address_transaction_height
+    AFTER UPDATE OF is_orphaned ON <%=schema%>.block
+    FOR EACH ROW
+    WHEN (OLD.is_orphaned IS DISTINCT FROM NEW.is_orphaned)
+    EXECUTE PROCEDURE <%=schema%>.address_transaction_height();
+
+COMMIT;
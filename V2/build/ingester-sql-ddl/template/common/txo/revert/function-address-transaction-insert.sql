@@ -0,0 +1,76 @@
+-- Deploy ss2:function-address-transaction-insert to pg
+-- requires: schema
+-- requires: table-block
+-- requires: table-transaction
+-- requires: table-input
+-- requires: table-output
+-- requires: table-address-transaction
+
+BEGIN;
+
+DROP FUNCTION IF EXISTS <%=schema%>.address_transaction_insert(BIGINT[], BOOLEAN);
+
+-- Index the addresses each transaction receives funds on or spends funds from. Rows of transactions that were already
+-- indexed are recomputed, so the function can be run again on the same transactions, e.g. after they are mined.
+CREATE OR REPLACE FUNCTION <%=schema%>.address_transaction_insert (
+    IN in_transaction_ids BIGINT[]
+) RETURNS INTEGER AS $$
+    DECLARE
+        var_count INTEGER;
+    BEGIN
+        INSERT INTO address_transaction (
+            address,
+            transaction_id,
+            height,
+            direction
+        )
+        SELECT
+            addresses.address,
+            addresses.transaction_id,
+            MAX(block.height),
+            bit_or(addresses.direction)
+        FROM (
+            -- Outputs paying to an address
+            SELECT
+                output.address,
+                output.transaction_id,
+                1::SMALLINT AS direction
+            FROM
+                output
+            WHERE
+                output.transaction_id = ANY(in_transaction_ids)
+            UNION ALL
+            -- Inputs spending an output of an address
+            SELECT
+                output.address,
+                input.transaction_id,
+                2::SMALLINT AS direction
+            FROM
+                input
+                JOIN transaction AS spent ON spent.txid = input.spent_txid
+                JOIN output ON output.transaction_id = spent.id
+                AND output.vout = input.spent_vout
+            WHERE
+                input.transaction_id = ANY(in_transaction_ids)
+        ) AS addresses
+            JOIN transaction ON transaction.id = addresses.transaction_id
+            LEFT JOIN block ON transaction.block_id = block.id
+            AND block.is_orphaned = FALSE
+        WHERE
+            addresses.address <> ''
+        GROUP BY
+            addresses.address,
+            addresses.transaction_id
+        ON CONFLICT (address, transaction_id) DO UPDATE
+            SET
+                height = EXCLUDED.height,
+                direction = EXCLUDED.direction;
+
+        GET DIAGNOSTICS var_count = ROW_COUNT;
+
+        RETURN var_count;
+    END
+$$ LANGUAGE PLPGSQL VOLATILE
+SET search_path=<%=schema%>;
+
+COMMIT;
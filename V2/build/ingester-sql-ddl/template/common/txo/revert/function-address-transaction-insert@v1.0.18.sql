@@ -0,0 +1,4 @@
+-- Revert ss2:function-address-transaction-insert from pg
+-- requires: schema
+
+DROP FUNCTION IF EXISTS <%=schema%>.address_transaction_insert;
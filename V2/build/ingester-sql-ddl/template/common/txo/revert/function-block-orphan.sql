@@ -0,0 +1,4 @@
+-- Revert ss2:function-block-orphan from pg
+-- requires: schema
+
+DROP FUNCTION IF EXISTS <%=schema%>.block_orphan;
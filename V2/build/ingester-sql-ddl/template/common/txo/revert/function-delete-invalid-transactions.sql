@@ -12,15 +12,11 @@ CREATE OR REPLACE FUNCTION <%=schema%>.delete_invalid_txs(
 AS $$
     BEGIN
         DELETE FROM transaction
-        WHERE id IN (
-            SELECT id
-            FROM transaction
-            WHERE id = ANY(in_ids)
-            AND block_id IS NULL
-        );
+        WHERE id = ANY(in_ids)
+        AND block_id IS NULL;
     END
 $$
 
 SET search_path=<%=schema%>;
 
-COMMIT;
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,4 @@
+-- Revert ss2:function-output-unspend from pg
+-- requires: schema
+
+DROP FUNCTION IF EXISTS <%=schema%>.output_unspend;
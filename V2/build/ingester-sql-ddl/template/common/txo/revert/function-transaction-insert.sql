@@ -4,6 +4,8 @@
 -- requires: table-transaction
 -- requires: function-input-insert
 -- requires: function-output-insert
+-- requires: function-address-transaction-insert
+-- requires: function-output-spend
 
 BEGIN;
 
@@ -15,24 +17,21 @@ CREATE OR REPLACE FUNCTION <%=schema%>.transaction_insert (
 ) RETURNS void AS $$
     DECLARE
         var_transaction_id transaction.id%TYPE := NULL;
-        var_transaction_index transaction.index%TYPE := NULL;
-        var_block_id block.id%TYPE := NULL;
     BEGIN
         IF in_tx_def->>'txid' IS NOT NULL THEN
-            IF in_block_id >= 0 THEN
-                var_block_id := in_block_id;
+            IF in_block_id = -1 THEN
+                in_block_id := NULL;
             END IF;
 
-            IF in_transaction_index >= 0 THEN
-                var_transaction_index := in_transaction_index;
+            IF in_transaction_index = -1 THEN
+                in_transaction_index := NULL;
             END IF;
 
             SELECT id INTO var_transaction_id
                 FROM transaction
                 WHERE txid = in_tx_def->>'txid';
-
-            IF var_transaction_id IS NULL THEN
-                -- This is a new transaction we haven't seen before
+            IF NOT FOUND THEN
+                -- This is a new transaction
                 -- Insert it
                 INSERT INTO transaction (
                     index,
@@ -46,8 +45,8 @@ CREATE OR REPLACE FUNCTION <%=schema%>.transaction_insert (
                     locktime,
                     raw_transaction
                 ) VALUES (
-                    var_transaction_index,
-                    var_block_id,
+                    in_transaction_index,
+                    in_block_id,
                     in_tx_def->>'txid',
                     in_tx_def->>'hash',
                     (in_tx_def->>'version')::integer,
@@ -60,16 +59,20 @@ CREATE OR REPLACE FUNCTION <%=schema%>.transaction_insert (
 
                 PERFORM input_insert(var_transaction_id, in_tx_def->'inputs');
                 PERFORM output_insert(var_transaction_id, in_tx_def->'outputs');
+                PERFORM output_spend(ARRAY[var_transaction_id], TRUE);
+                PERFORM address_transaction_insert(ARRAY[var_transaction_id]);
             ELSE
-                IF var_block_id IS NOT NULL THEN
+                IF in_block_id IS NOT NULL THEN
                     -- This is a mempool transaction that has been mined
                     -- Update the block information
                     UPDATE transaction
                         SET
-                            block_id = var_block_id,
-                            index = var_transaction_index
+                            block_id = in_block_id,
+                            index = in_transaction_index
                         WHERE
                             id = var_transaction_id;
+
+                    PERFORM address_transaction_insert(ARRAY[var_transaction_id]);
                 END IF;
             END IF;
         ELSE
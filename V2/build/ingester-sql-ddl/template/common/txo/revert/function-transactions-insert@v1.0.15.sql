@@ -0,0 +1,4 @@
+-- Revert ss2:function-transactions-insert from pg
+-- requires: schema
+
+DROP FUNCTION IF EXISTS <%=schema%>.transactions_insert;
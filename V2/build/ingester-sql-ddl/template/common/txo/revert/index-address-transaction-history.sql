@@ -0,0 +1,8 @@
+-- Revert ss2:index-address-transaction-history from pg
+-- requires: schema
+
+BEGIN;
+
+DROP INDEX IF EXISTS <%=schema%>.idx_address_transaction_history;
+
+COMMIT;
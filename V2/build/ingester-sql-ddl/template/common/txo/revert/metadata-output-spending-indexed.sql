@@ -0,0 +1,8 @@
+-- Revert ss2:metadata-output-spending-indexed from pg
+-- requires: schema
+
+BEGIN;
+
+DELETE FROM <%=schema%>.metadata WHERE key = 'outputSpendingIndexed';
+
+COMMIT;
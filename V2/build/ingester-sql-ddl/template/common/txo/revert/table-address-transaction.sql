@@ -0,0 +1,8 @@
+-- Revert ss2:table-address-transaction from pg
+-- requires: schema
+
+BEGIN;
+
+DROP TABLE IF EXISTS <%=schema%>.address_transaction;
+
+COMMIT;
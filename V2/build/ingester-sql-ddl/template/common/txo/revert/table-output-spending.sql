@@ -0,0 +1,10 @@
+-- Revert ss2:table-output-spending from pg
+-- requires: schema
+
+BEGIN;
+
+ALTER TABLE <%=schema%>.output
+  DROP COLUMN IF EXISTS spending_transaction_id,
+  DROP COLUMN IF EXISTS spending_vin;
+
+COMMIT;
@@ -0,0 +1,9 @@
+-- Revert ss2:trigger-address-transaction-height from pg
+-- requires: schema
+
+BEGIN;
+
+DROP TRIGGER IF EXISTS trigger_address_transaction_height ON <%=schema%>.block;
+DROP FUNCTION IF EXISTS <%=schema%>.address_transaction_height;
+
+COMMIT;
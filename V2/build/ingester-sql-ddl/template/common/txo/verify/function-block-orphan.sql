@@ -0,0 +1,7 @@
+-- Verify ss2:function-block-orphan on pg
+
+BEGIN;
+
+-- XXX Add verifications here.
+
+ROLLBACK;
@@ -0,0 +1,7 @@
+-- Verify ss2:function-delete-invalid-transactions on pg
+
+BEGIN;
+
+-- XXX Add verifications here.
+
+ROLLBACK;
@@ -0,0 +1,7 @@
+-- Verify ss2:function-delete-orphans on pg
+
+BEGIN;
+
+-- XXX Add verifications here.
+
+ROLLBACK;
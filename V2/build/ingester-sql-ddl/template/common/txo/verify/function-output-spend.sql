@@ -0,0 +1,7 @@
+-- Verify ss2:function-output-spend on pg
+
+BEGIN;
+
+-- XXX Add verifications here.
+
+ROLLBACK;
@@ -0,0 +1,7 @@
+-- Verify ss2:function-output-unspend on pg
+
+BEGIN;
+
+-- XXX Add verifications here.
+
+ROLLBACK;
@@ -0,0 +1,7 @@
+-- Verify ss2:function-transaction-insert on pg
+
+BEGIN;
+
+-- XXX Add verifications here.
+
+ROLLBACK;
@@ -0,0 +1,7 @@
+-- Verify ss2:function-transactions-insert on pg
+
+BEGIN;
+
+-- XXX Add verifications here.
+
+ROLLBACK;
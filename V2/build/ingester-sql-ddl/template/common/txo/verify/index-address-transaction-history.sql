@@ -0,0 +1,7 @@
+-- Verify ss2:index-address-transaction-history on pg
+
+BEGIN;
+
+-- XXX Add verifications here.
+
+ROLLBACK;
@@ -0,0 +1,7 @@
+-- Verify ss2:metadata-output-spending-indexed on pg
+
+BEGIN;
+
+-- XXX Add verifications here.
+
+ROLLBACK;
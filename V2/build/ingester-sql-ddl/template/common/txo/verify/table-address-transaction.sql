@@ -0,0 +1,7 @@
+-- Verify ss2:table-address-transaction on pg
+
+BEGIN;
+
+-- XXX Add verifications here.
+
+ROLLBACK;
@@ -0,0 +1,7 @@
+-- Verify ss2:table-output-spending on pg
+
+BEGIN;
+
+-- XXX Add verifications here.
+
+ROLLBACK;
@@ -0,0 +1,7 @@
+-- Verify ss2:trigger-address-transaction-height on pg
+
+BEGIN;
+
+-- XXX Add verifications here.
+
+ROLLBACK;
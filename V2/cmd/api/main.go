@@ -13,13 +13,16 @@ import (
 	"github.com/go-chi/render"
 	"github.com/shapeshift-legacy/coinquery/V2/config"
 	"github.com/shapeshift-legacy/coinquery/V2/internal/log"
+	"github.com/shapeshift-legacy/coinquery/V2/internal/metrics"
 	"github.com/shapeshift-legacy/coinquery/V2/internal/middleware"
 	"github.com/shapeshift-legacy/coinquery/V2/pkg/api/etherscan"
 	"github.com/shapeshift-legacy/coinquery/V2/pkg/api/insight"
 	"github.com/shapeshift-legacy/coinquery/V2/pkg/api/server"
 	"github.com/shapeshift-legacy/coinquery/V2/pkg/blockchain/eth"
 	"github.com/shapeshift-legacy/coinquery/V2/pkg/blockchain/utxo"
-	"github.com/shapeshift-legacy/coinquery/V2/pkg/postgres"
+	rpc "github.com/shapeshift-legacy/coinquery/V2/pkg/http"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/storage"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/storage/backend"
 )
 
 var (
@@ -27,6 +30,9 @@ var (
 
 	conf = flag.String("config", "./config/local.json", "path to configuration json file")
 	coin = flag.String("coin", "btc", "coin for blockchain rpc")
+
+	record = flag.String("record", "", "directory to record node rpc calls to, one cassette per coin")
+	replay = flag.String("replay", "", "directory of cassettes to serve node rpc calls from instead of the node")
 )
 
 func newBaseRouter() *chi.Mux {
@@ -46,6 +52,7 @@ func newBaseRouter() *chi.Mux {
 		render.SetContentType(render.ContentTypeJSON), // set content-type headers as application/json
 
 		middleware.Logger,                    // log api request calls
+		middleware.Metrics,                   // record request latency by route
 		chiMiddleware.DefaultCompress,        // compress results, mostly gzipping assets and json
 		chiMiddleware.Recoverer,              // recover from panics without crashing server
 		chiMiddleware.Timeout(3*time.Second), // Stop processing after 3 seconds
@@ -73,6 +80,9 @@ func newETHRouter(bc *eth.Blockchain) *chi.Mux {
 	// AWS ECS health-check endpoint
 	r.Get("/ping", func(w http.ResponseWriter, r *http.Request) { render.JSON(w, r, "pong") })
 
+	// Prometheus scrape endpoint
+	r.Method("GET", "/metrics", metrics.Handler())
+
 	// Restful Routes
 	r.Route("/api", func(r chi.Router) {
 		r.Get("/", e.ActionRouter)
@@ -82,7 +92,7 @@ func newETHRouter(bc *eth.Blockchain) *chi.Mux {
 	return r
 }
 
-func newUTXORouter(db *postgres.Database, bc *utxo.Blockchain, c *config.Config) *chi.Mux {
+func newUTXORouter(db storage.Reader, bc *utxo.Blockchain, c *config.Config) *chi.Mux {
 	s := server.New(bc, db, c)
 	i := insight.New(bc, db, c)
 
@@ -106,6 +116,9 @@ func newUTXORouter(db *postgres.Database, bc *utxo.Blockchain, c *config.Config)
 	// AWS ECS health-check endpoint
 	r.Get("/ping", func(w http.ResponseWriter, r *http.Request) { render.JSON(w, r, "pong") })
 
+	// Prometheus scrape endpoint
+	r.Method("GET", "/metrics", metrics.Handler())
+
 	// Restful Routes
 	r.Route("/api", func(r chi.Router) {
 		r.Route("/{coin}", func(r chi.Router) {
@@ -127,6 +140,24 @@ func newUTXORouter(db *postgres.Database, bc *utxo.Blockchain, c *config.Config)
 					r.Use(i.BCHInterceptor)
 					r.Get("/addrs/{addrs}/txs", i.TxHistoryByAddrs)
 					r.Get("/addrs/{addrs}/utxo", i.UtxosByAddrs)
+					r.Get("/addr/{addrs}", i.Addr)
+					r.Get("/addr/{addrs}/balance", i.AddrBalance)
+					r.Get("/addr/{addrs}/totalReceived", i.AddrTotalReceived)
+					r.Get("/addr/{addrs}/totalSent", i.AddrTotalSent)
+					r.Get("/addr/{addrs}/unconfirmedBalance", i.AddrUnconfirmedBalance)
+				})
+				r.Group(func(r chi.Router) {
+					r.Use(i.AddressesBody)
+					r.Use(i.BCHInterceptor)
+					r.Post("/addrs/txs", i.TxHistoryByAddrs)
+					r.Post("/addrs/utxo", i.UtxosByAddrs)
+				})
+				r.Group(func(r chi.Router) {
+					r.Use(i.XpubCtx)
+					r.Get("/xpub/{xpub}/utxo", i.XpubUtxos)
+					r.Get("/xpub/{xpub}/txs", i.XpubTxs)
+					r.Get("/xpub/{xpub}/balance", i.XpubBalance)
+					r.Get("/xpub/{xpub}/next", i.XpubNext)
 				})
 				r.Post("/tx/send", i.SendRawTx)
 
@@ -140,6 +171,17 @@ func newUTXORouter(db *postgres.Database, bc *utxo.Blockchain, c *config.Config)
 					r.Use(i.BCHInterceptor)
 					r.Get("/api/addrs/{addrs}/txs", i.TxHistoryByAddrs)
 					r.Get("/api/addrs/{addrs}/utxo", i.UtxosByAddrs)
+					r.Get("/api/addr/{addrs}", i.Addr)
+					r.Get("/api/addr/{addrs}/balance", i.AddrBalance)
+					r.Get("/api/addr/{addrs}/totalReceived", i.AddrTotalReceived)
+					r.Get("/api/addr/{addrs}/totalSent", i.AddrTotalSent)
+					r.Get("/api/addr/{addrs}/unconfirmedBalance", i.AddrUnconfirmedBalance)
+				})
+				r.Group(func(r chi.Router) {
+					r.Use(i.AddressesBody)
+					r.Use(i.BCHInterceptor)
+					r.Post("/api/addrs/txs", i.TxHistoryByAddrs)
+					r.Post("/api/addrs/utxo", i.UtxosByAddrs)
 				})
 				r.Post("/api/tx/send", i.SendRawTx)
 			})
@@ -165,6 +207,12 @@ func main() {
 	}
 
 	rpcConfig := c.GetRPCConfig(cc)
+	if *record != "" {
+		rpcConfig.Record = rpc.CassettePath(*record, *coin)
+	}
+	if *replay != "" {
+		rpcConfig.Replay = rpc.CassettePath(*replay, *coin)
+	}
 
 	var router *chi.Mux
 	if *coin == "eth" || *coin == "ethrinkeby" || *coin == "ethropsten" {
@@ -176,7 +224,7 @@ func main() {
 			log.Fatal(err, "main")
 		}
 
-		dbConn, err := postgres.New(dbConfig, *coin)
+		dbConn, err := backend.New(dbConfig, *coin)
 		if err != nil {
 			log.Fatal(err, "main")
 		}
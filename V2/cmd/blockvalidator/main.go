@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"strconv"
@@ -11,12 +12,16 @@ import (
 	"github.com/shapeshift-legacy/coinquery/V2/config"
 	"github.com/shapeshift-legacy/coinquery/V2/internal/log"
 	"github.com/shapeshift-legacy/coinquery/V2/pkg/blockchain/utxo"
-	"github.com/shapeshift-legacy/coinquery/V2/pkg/postgres"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/http"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/storage"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/storage/backend"
 )
 
 var (
 	coin             = flag.String("coin", "", "coin to validate")
 	conf             = flag.String("config", "./config/local.json", "path to configuration json file")
+	record           = flag.String("record", "", "directory to record node rpc calls to, one cassette per coin")
+	replay           = flag.String("replay", "", "directory of cassettes to serve node rpc calls from instead of the node")
 	revalidateOffset = map[string]int{
 		"bch":  10,
 		"btc":  10,
@@ -33,7 +38,7 @@ type blockValidator struct {
 	blocksValidated int
 	// read write mutex to keep blocksValidated thread safe
 	bvMutex    sync.RWMutex
-	db         *postgres.Database
+	db         storage.Store
 	dbThreads  int
 	doneChan   chan struct{}
 	rpcThreads int
@@ -49,12 +54,6 @@ type blockResult struct {
 	nodeBlock *utxo.Block
 }
 
-type txResult struct {
-	blockID int
-	index   int
-	*utxo.Tx
-}
-
 func newBlockValidator() *blockValidator {
 	c, err := config.Get(*conf)
 	if err != nil {
@@ -71,12 +70,19 @@ func newBlockValidator() *blockValidator {
 		log.Fatal(err, "main")
 	}
 
-	dbConn, err := postgres.New(dbConfig, *coin)
+	dbConn, err := backend.New(dbConfig, *coin)
 	if err != nil {
 		log.Fatal(err, "main")
 	}
 
 	rpcConfig := c.GetRPCConfig(cc)
+	if *record != "" {
+		rpcConfig.Record = http.CassettePath(*record, *coin)
+	}
+	if *replay != "" {
+		rpcConfig.Replay = http.CassettePath(*replay, *coin)
+	}
+
 	chainConn := utxo.New(rpcConfig, *coin)
 
 	return &blockValidator{
@@ -158,7 +164,7 @@ func main() {
 
 // generateBlockHeights will queue up block heights from last validated block to current height in the database
 func (v *blockValidator) generateBlockHeights() chan int {
-	value, err := v.db.Get("validatedBlock")
+	value, err := v.db.Get(context.Background(), "validatedBlock")
 	if err != nil {
 		log.Fatal(err, "main", "failed to get start block")
 	}
@@ -168,7 +174,7 @@ func (v *blockValidator) generateBlockHeights() chan int {
 		log.Fatal(err, "main", "failed to convert block")
 	}
 
-	blk, err := v.db.LastBlock()
+	blk, err := v.db.LastBlock(context.Background())
 	if err != nil {
 		log.Fatal(err, "main", "failed to get end block")
 	}
@@ -207,13 +213,13 @@ func (v *blockValidator) getBlock(blocksChan chan<- *utxo.Block, blockHeightsCha
 // readBlock will get the database block at the same height as the nodeBlock and queue up a *blockResult that we can use to validate. If no block is found in the database the block will be repaired.
 func (v *blockValidator) readBlock(resultChan chan<- *blockResult, repairChan chan<- *utxo.Block, blocksChan chan *utxo.Block) {
 	for nodeBlock := range blocksChan {
-		dbBlock, err := v.db.GetBlock(nodeBlock.Height)
+		dbBlock, err := v.db.GetBlock(context.Background(), nodeBlock.Height)
 		if err != nil {
 			log.Fatal(err, "main", "failed to read block")
 		}
 
 		// TODO: if this fails often, look into how to requeue the block for validation
-		dbTxHashes, err := v.db.GetTxHashesByBlockHash(dbBlock.Hash, "", "")
+		dbTxHashes, err := v.db.GetTxHashesByBlockHash(context.Background(), dbBlock.Hash, storage.Page{})
 		if err != nil {
 			log.Fatal(err, "main", "failed to read block")
 		}
@@ -312,9 +318,6 @@ func (v *blockValidator) repairBlock(repairChan chan *utxo.Block) {
 		log.Infof("main", "repairing block: %d", nodeBlock.Height)
 		log.Infof("main", "repairing transactions: %d", len(nodeBlock.Txs))
 
-		rwm := sync.RWMutex{}
-		failedRepair := false
-
 		blockID, err := v.db.InsertBlock(nodeBlock, true)
 		if err != nil {
 			log.Warnf(err, "main", "retrying repair of block: %d", nodeBlock.Height)
@@ -322,47 +325,24 @@ func (v *blockValidator) repairBlock(repairChan chan *utxo.Block) {
 			continue
 		}
 
-		// add all of the transactions to be repaired to a buffered channel to be processed concurrently below
-		txsChan := make(chan txResult, len(nodeBlock.Txs))
+		txs := make([]*utxo.Tx, len(nodeBlock.Txs))
 		for i := range nodeBlock.Txs {
-			txsChan <- txResult{blockID, i, &nodeBlock.Txs[i]}
-		}
-		close(txsChan)
-
-		var twg sync.WaitGroup
-		twg.Add(v.dbThreads)
-		for i := 0; i < v.dbThreads; i++ {
-			go func() {
-				defer twg.Done()
-
-				for tx := range txsChan {
-					if tx.Hash == "" {
-						tx.Hash = tx.TxID
-					}
-
-					// mark the repair as failed if we fail to insert a transaction so it can be requeued (thread safe)
-					if err := v.db.InsertTx(tx.Tx, tx.index, tx.blockID); err != nil {
-						log.Warn(err, "main", "failed to repair transaction")
-						rwm.Lock()
-						failedRepair = true
-						rwm.Unlock()
-					}
-				}
-			}()
+			txs[i] = &nodeBlock.Txs[i]
+			if txs[i].Hash == "" {
+				txs[i].Hash = txs[i].TxID
+			}
 		}
-		go func(b utxo.Block) {
-			twg.Wait()
 
-			if failedRepair {
-				log.Warnf(err, "main", "retrying repair of block: %v", b.Height)
-				go func() { repairChan <- &b }()
-				return
-			}
+		// transactions are inserted in a single db transaction, so a failed repair does not leave the block partially written
+		if err := v.db.InsertTxs(blockID, txs); err != nil {
+			log.Warnf(err, "main", "retrying repair of block: %d", nodeBlock.Height)
+			go func(b utxo.Block) { repairChan <- &b }(*nodeBlock)
+			continue
+		}
 
-			// consider block valid if repair succeeds
-			log.Infof("main", "finished repairing block: %v", b.Height)
-			v.blockValidated()
-		}(*nodeBlock)
+		// consider block valid if repair succeeds
+		log.Infof("main", "finished repairing block: %v", nodeBlock.Height)
+		v.blockValidated()
 	}
 }
 
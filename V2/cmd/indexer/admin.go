@@ -0,0 +1,385 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi"
+	chiMiddleware "github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"github.com/pkg/errors"
+	"github.com/shapeshift-legacy/coinquery/V2/internal/log"
+	"github.com/shapeshift-legacy/coinquery/V2/internal/middleware"
+)
+
+// indexer phases reported by the admin api
+const (
+	phaseStarting    = "starting"
+	phaseInitialSync = "initialSync"
+	phaseStaySynced  = "staySynced"
+	phaseStopped     = "stopped"
+)
+
+// queue is a pipeline channel whose depth is reported by the admin api
+type queue struct {
+	name string
+	len  func() int
+	cap  int
+}
+
+// queueStatus is the depth of a pipeline channel
+type queueStatus struct {
+	Len int `json:"len"`
+	Cap int `json:"cap"`
+}
+
+// reindexStatus is the progress of a reindex started from the admin api
+type reindexStatus struct {
+	From    int       `json:"from"`
+	To      int       `json:"to"`
+	Height  int       `json:"height"` // last height written, from - 1 until the first block is written
+	Started time.Time `json:"started"`
+	Done    bool      `json:"done"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// indexerStatus is the state of an indexer reported by the admin api
+type indexerStatus struct {
+	Coin            string                 `json:"coin"`
+	Phase           string                 `json:"phase"`
+	Paused          bool                   `json:"paused"`
+	CommittedHeight int                    `json:"committedHeight"`
+	Queues          map[string]queueStatus `json:"queues"`
+	Reindex         *reindexStatus         `json:"reindex,omitempty"`
+}
+
+// gate blocks ingestion while paused. The zero value is not paused.
+type gate struct {
+	mu      sync.Mutex
+	resumed chan struct{} // closed on resume, nil while not paused
+}
+
+// pause makes wait block until resume is called
+func (g *gate) pause() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.resumed == nil {
+		g.resumed = make(chan struct{})
+	}
+}
+
+// resume releases any waiters
+func (g *gate) resume() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.resumed != nil {
+		close(g.resumed)
+		g.resumed = nil
+	}
+}
+
+// paused reports if the gate is paused
+func (g *gate) paused() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.resumed != nil
+}
+
+// wait blocks while the gate is paused. Returns false if ctx was cancelled first.
+func (g *gate) wait(ctx context.Context) bool {
+	g.mu.Lock()
+	resumed := g.resumed
+	g.mu.Unlock()
+
+	if resumed == nil {
+		return ctx.Err() == nil
+	}
+
+	select {
+	case <-resumed:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// setPhase records the current phase of the indexer and the pipeline channels to report queue depths for
+func (idxr *Indexer) setPhase(phase string, queues ...queue) {
+	idxr.mu.Lock()
+	defer idxr.mu.Unlock()
+
+	idxr.phase = phase
+	idxr.queues = queues
+}
+
+// setCheckpoint records height as the last fully committed block
+func (idxr *Indexer) setCheckpoint(height int) {
+	idxr.mu.Lock()
+	defer idxr.mu.Unlock()
+
+	idxr.checkpoint = height
+}
+
+// status returns a snapshot of the indexer state
+func (idxr *Indexer) status() *indexerStatus {
+	idxr.mu.Lock()
+	defer idxr.mu.Unlock()
+
+	s := &indexerStatus{
+		Coin:            idxr.coin,
+		Phase:           idxr.phase,
+		Paused:          idxr.ingest.paused(),
+		CommittedHeight: idxr.checkpoint,
+		Queues:          make(map[string]queueStatus),
+	}
+
+	if s.Phase == "" {
+		s.Phase = phaseStarting
+	}
+
+	for _, q := range idxr.queues {
+		s.Queues[q.name] = queueStatus{Len: q.len(), Cap: q.cap}
+	}
+
+	if idxr.reindexing != nil {
+		r := *idxr.reindexing
+		s.Reindex = &r
+	}
+
+	return s
+}
+
+// startReindex rewrites the blocks from height from to to through the recover path in the background, alongside
+// the running pipeline. Only blocks at or below the committed height can be reindexed, newer blocks are written by
+// the pipeline. Only one reindex runs at a time.
+func (idxr *Indexer) startReindex(from, to int) error {
+	idxr.mu.Lock()
+	defer idxr.mu.Unlock()
+
+	if to > idxr.checkpoint {
+		return errors.Errorf("range ends above committed height: %d", idxr.checkpoint)
+	}
+
+	if idxr.reindexing != nil && !idxr.reindexing.Done {
+		return errors.Errorf("reindex of %d to %d already running", idxr.reindexing.From, idxr.reindexing.To)
+	}
+
+	idxr.reindexing = &reindexStatus{From: from, To: to, Height: from - 1, Started: time.Now()}
+
+	go idxr.reindex(from, to)
+
+	return nil
+}
+
+// reindex fetches the blocks from height from to to from the node and writes them through the recover path
+func (idxr *Indexer) reindex(from, to int) {
+	idxr.logger.Infof("main", "reindexing blocks %d to %d", from, to)
+
+	err := func() error {
+		for i := from; i <= to; i += idxr.batchSize {
+			if idxr.ctx.Err() != nil {
+				return idxr.ctx.Err()
+			}
+
+			heights := []int{}
+			for h := i; h < i+idxr.batchSize && h <= to; h++ {
+				heights = append(heights, h)
+			}
+
+			blocks, err := idxr.bc.GetBlocks(heights)
+			if err != nil {
+				return err
+			}
+
+			for _, b := range blocks {
+				if err := idxr.insertBlock(b, true); err != nil {
+					return err
+				}
+			}
+
+			idxr.mu.Lock()
+			idxr.reindexing.Height = heights[len(heights)-1]
+			idxr.mu.Unlock()
+		}
+
+		return nil
+	}()
+
+	idxr.mu.Lock()
+	defer idxr.mu.Unlock()
+
+	idxr.reindexing.Done = true
+
+	if err != nil {
+		idxr.reindexing.Error = err.Error()
+		idxr.logger.Warnf(err, "main", "reindex of blocks %d to %d stopped at block: %d", from, to, idxr.reindexing.Height)
+		return
+	}
+
+	idxr.logger.Infof("main", "reindexed blocks %d to %d in %s", from, to, time.Since(idxr.reindexing.Started))
+}
+
+// admin serves the admin api for the indexers running in the process
+type admin struct {
+	mu       sync.Mutex
+	indexers map[string]*Indexer
+}
+
+func newAdmin() *admin {
+	return &admin{indexers: make(map[string]*Indexer)}
+}
+
+// register makes idxr available to the admin api, replacing any previous indexer of the same coin.
+// A restarted indexer stays paused if its predecessor was paused.
+func (a *admin) register(idxr *Indexer) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if prev, ok := a.indexers[idxr.coin]; ok && prev.ingest.paused() {
+		idxr.ingest.pause()
+	}
+
+	a.indexers[idxr.coin] = idxr
+}
+
+// router returns the admin api routes
+func (a *admin) router() http.Handler {
+	r := chi.NewRouter()
+
+	r.Use(
+		render.SetContentType(render.ContentTypeJSON), // set content-type headers as application/json
+
+		middleware.Logger,       // log api request calls
+		chiMiddleware.Recoverer, // recover from panics without crashing server
+	)
+
+	r.Route("/admin", func(r chi.Router) {
+		r.Get("/status", a.statusAll)
+
+		r.Route("/{coin}", func(r chi.Router) {
+			r.Get("/status", a.status)
+			r.Post("/pause", a.pause)
+			r.Post("/resume", a.resume)
+			r.Post("/reindex", a.reindex)
+		})
+	})
+
+	return r
+}
+
+// serve serves the admin api on addr in the background
+func (a *admin) serve(addr string) {
+	go func() {
+		log.Infof("main", "serving admin api on: %s", addr)
+
+		if err := http.ListenAndServe(addr, a.router()); err != nil {
+			log.Error(err, "main", "error serving admin api")
+		}
+	}()
+}
+
+// indexer returns the indexer of the coin in the request path, writing a 404 if it isn't running
+func (a *admin) indexer(w http.ResponseWriter, r *http.Request) *Indexer {
+	coin := chi.URLParam(r, "coin")
+
+	a.mu.Lock()
+	idxr, ok := a.indexers[coin]
+	a.mu.Unlock()
+
+	if !ok {
+		http.Error(w, fmt.Sprintf("coin not indexed: %s", coin), 404)
+		return nil
+	}
+
+	return idxr
+}
+
+func (a *admin) statusAll(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	statuses := []*indexerStatus{}
+	for _, idxr := range a.indexers {
+		statuses = append(statuses, idxr.status())
+	}
+	a.mu.Unlock()
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Coin < statuses[j].Coin
+	})
+
+	render.Respond(w, r, statuses)
+}
+
+func (a *admin) status(w http.ResponseWriter, r *http.Request) {
+	idxr := a.indexer(w, r)
+	if idxr == nil {
+		return
+	}
+
+	render.Respond(w, r, idxr.status())
+}
+
+func (a *admin) pause(w http.ResponseWriter, r *http.Request) {
+	idxr := a.indexer(w, r)
+	if idxr == nil {
+		return
+	}
+
+	idxr.ingest.pause()
+	idxr.logger.Info("main", "block ingestion paused")
+
+	render.Respond(w, r, idxr.status())
+}
+
+func (a *admin) resume(w http.ResponseWriter, r *http.Request) {
+	idxr := a.indexer(w, r)
+	if idxr == nil {
+		return
+	}
+
+	idxr.ingest.resume()
+	idxr.logger.Info("main", "block ingestion resumed")
+
+	render.Respond(w, r, idxr.status())
+}
+
+func (a *admin) reindex(w http.ResponseWriter, r *http.Request) {
+	idxr := a.indexer(w, r)
+	if idxr == nil {
+		return
+	}
+
+	req := struct {
+		From *int `json:"from"`
+		To   *int `json:"to"`
+	}{}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("error decoding request: %v\n", err), 400)
+		return
+	}
+
+	if req.From == nil || req.To == nil {
+		http.Error(w, "from and to heights expected", 400)
+		return
+	}
+
+	if *req.From < 0 || *req.To < *req.From {
+		http.Error(w, fmt.Sprintf("invalid range: %d to %d", *req.From, *req.To), 400)
+		return
+	}
+
+	if err := idxr.startReindex(*req.From, *req.To); err != nil {
+		http.Error(w, fmt.Sprintf("%v\n", err), 409)
+		return
+	}
+
+	render.Respond(w, r, idxr.status())
+}
@@ -0,0 +1,191 @@
+// +build unit
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/blockchain/utxo"
+)
+
+func TestGate_wait(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	g := gate{}
+
+	if !g.wait(ctx) {
+		t.Fatal("gate.wait() = false, want true when not paused")
+	}
+
+	g.pause()
+
+	done := make(chan bool)
+	go func() { done <- g.wait(ctx) }()
+
+	select {
+	case <-done:
+		t.Fatal("gate.wait() returned while paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	g.resume()
+
+	if got := <-done; !got {
+		t.Errorf("gate.wait() = %v, want true after resume", got)
+	}
+
+	g.pause()
+	cancel()
+
+	if g.wait(ctx) {
+		t.Errorf("gate.wait() = true, want false after cancel")
+	}
+}
+
+func TestAdmin_reindex(t *testing.T) {
+	tests := []struct {
+		name       string
+		coin       string
+		body       string
+		checkpoint int
+		wantCode   int
+		want       []int
+	}{
+		{
+			name:       "Reindex",
+			coin:       "btc",
+			body:       `{"from": 2, "to": 6}`,
+			checkpoint: 10,
+			wantCode:   http.StatusOK,
+			want:       []int{2, 3, 4, 5, 6},
+		},
+		{
+			name:       "Above Committed Height",
+			coin:       "btc",
+			body:       `{"from": 2, "to": 11}`,
+			checkpoint: 10,
+			wantCode:   http.StatusConflict,
+		},
+		{
+			name:       "Invalid Range",
+			coin:       "btc",
+			body:       `{"from": 6, "to": 2}`,
+			checkpoint: 10,
+			wantCode:   http.StatusBadRequest,
+		},
+		{
+			name:       "Missing Height",
+			coin:       "btc",
+			body:       `{"from": 6}`,
+			checkpoint: 10,
+			wantCode:   http.StatusBadRequest,
+		},
+		{
+			name:       "Unknown Coin",
+			coin:       "ltc",
+			body:       `{"from": 2, "to": 6}`,
+			checkpoint: 10,
+			wantCode:   http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			var mu sync.Mutex
+			got := []int{}
+
+			idxr := &Indexer{
+				coin:      "btc",
+				batchSize: 2,
+				bc:        newMockBlockchain(nil),
+				db: newMockPostgres(&mockPostgres{
+					insertBlockFunc: func(b *utxo.Block, recover bool) (int, error) {
+						if !recover {
+							t.Errorf("InsertBlock() recover = false, want true")
+						}
+
+						mu.Lock()
+						got = append(got, b.Height)
+						mu.Unlock()
+
+						return 0, nil
+					},
+				}),
+				ctx:        ctx,
+				cancel:     cancel,
+				checkpoint: tt.checkpoint,
+			}
+
+			a := newAdmin()
+			a.register(idxr)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("POST", "/admin/"+tt.coin+"/reindex", strings.NewReader(tt.body))
+			a.router().ServeHTTP(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("reindex code = %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+
+			if tt.want == nil {
+				return
+			}
+
+			deadline := time.Now().Add(time.Second)
+			for !idxr.status().Reindex.Done && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+
+			s := idxr.status()
+			if !s.Reindex.Done || s.Reindex.Error != "" || s.Reindex.Height != tt.want[len(tt.want)-1] {
+				t.Errorf("reindex status = %+v", s.Reindex)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("reindexed heights = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdmin_pause(t *testing.T) {
+	idxr := &Indexer{coin: "btc", checkpoint: -1}
+
+	a := newAdmin()
+	a.register(idxr)
+
+	w := httptest.NewRecorder()
+	a.router().ServeHTTP(w, httptest.NewRequest("POST", "/admin/btc/pause", nil))
+
+	if w.Code != http.StatusOK || !idxr.status().Paused {
+		t.Fatalf("pause code = %d, paused = %v", w.Code, idxr.status().Paused)
+	}
+
+	// a restarted indexer stays paused
+	restarted := &Indexer{coin: "btc", checkpoint: -1}
+	a.register(restarted)
+
+	if !restarted.status().Paused {
+		t.Errorf("restarted indexer paused = false, want true")
+	}
+
+	w = httptest.NewRecorder()
+	a.router().ServeHTTP(w, httptest.NewRequest("POST", "/admin/btc/resume", nil))
+
+	if w.Code != http.StatusOK || restarted.status().Paused {
+		t.Errorf("resume code = %d, paused = %v", w.Code, restarted.status().Paused)
+	}
+}
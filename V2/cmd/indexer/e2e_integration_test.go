@@ -0,0 +1,96 @@
+// +build integration
+
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shapeshift-legacy/coinquery/V2/config"
+	"github.com/shapeshift-legacy/coinquery/V2/internal/fakenode"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/blockchain/utxo"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/http"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/postgres"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/zmq"
+)
+
+// TestReorgDeepZMQ indexes a fake node, follows new blocks published over zmq and recovers from a reorg deeper than
+// the blocks written since the last notification
+func TestReorgDeepZMQ(t *testing.T) {
+	idx := mockIndexer()
+
+	n, err := fakenode.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	n.Mine(10)
+
+	idx.coin = fakenode.Coin
+	idx.bc = utxo.New(n.RPCConfig(), fakenode.Coin)
+	idx.source = zmq.New(idx.ctx, n.Config())
+	// monitor notifications are rejected by the node, which the indexer ignores
+	idx.monitor = http.NewClient(&config.RPC{CoinRPC: config.CoinRPC{URL: n.URL()}})
+	idx.rpcThreads = 2
+	idx.dbThreads = 2
+	idx.batchSize = 3
+	idx.syncTip = true
+
+	idx.initialSync()
+	if idx.err != nil {
+		t.Fatal(idx.err)
+	}
+
+	f, err := idx.startSource()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		idx.staySynced(f)
+		wg.Done()
+	}()
+
+	defer func() {
+		idx.cancel()
+		wg.Wait()
+	}()
+
+	if err := n.WaitSubscribed("hashblock", 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	// synced waits for the last block of the db to be the tip of the node
+	synced := func() {
+		deadline := time.Now().Add(10 * time.Second)
+		for {
+			last, err := idx.db.LastBlock(context.Background())
+			if err == nil && last != nil && last.Hash == n.BlockHash(n.Height()) {
+				return
+			}
+
+			if time.Now().After(deadline) {
+				t.Fatalf("db not synced to node tip: %s", n.BlockHash(n.Height()))
+			}
+
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+
+	old := n.Mine(6)
+	synced()
+
+	branch, err := n.Reorg(6, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	synced()
+
+	assertNotOrphaned(t, loadBlocksByHash(t, idx.db.(*postgres.Database), branch...))
+	assertOrphaned(t, loadBlocksByHash(t, idx.db.(*postgres.Database), old...))
+}
@@ -0,0 +1,162 @@
+// +build unit
+
+package main
+
+import (
+	"context"
+	nethttp "net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shapeshift-legacy/coinquery/V2/config"
+	"github.com/shapeshift-legacy/coinquery/V2/internal/fakenode"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/blockchain/utxo"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/http"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/poll"
+)
+
+// waitFor fails the test if cond is not met within timeout
+func waitFor(t *testing.T, timeout time.Duration, msg string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out after %s waiting for %s", timeout, msg)
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// indexed reports if the non orphaned blocks of db match the main chain of n and all of them are checkpointed
+func indexed(n *fakenode.Node, db *mockStatefulPostgres) bool {
+	height := n.Height()
+
+	chain := db.chain()
+	if len(chain) != height+1 {
+		return false
+	}
+
+	for h, b := range chain {
+		if b.Hash != n.BlockHash(h) {
+			return false
+		}
+	}
+
+	checkpoint, err := db.Get(context.Background(), checkpointKey)
+
+	return err == nil && checkpoint == strconv.Itoa(height)
+}
+
+// TestIndexer_e2e indexes a fake node from genesis, follows new blocks and mempool transactions using the poll block
+// source and recovers from a deep reorg
+func TestIndexer_e2e(t *testing.T) {
+	n, err := fakenode.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	n.Mine(20)
+
+	// added before the indexer starts so it is found by the initial mempool process
+	tx, err := n.NewTx()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txid, err := n.AddTx(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var notified int32
+	monitor := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		atomic.AddInt32(&notified, 1)
+	}))
+	defer monitor.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bc := utxo.New(n.RPCConfig(), fakenode.Coin)
+	db := newMockStatefulPostgres()
+
+	idxr := &Indexer{
+		coin:       fakenode.Coin,
+		bc:         bc,
+		db:         db,
+		source:     poll.New(ctx, n.Config(), bc),
+		monitor:    http.NewClient(&config.RPC{CoinRPC: config.CoinRPC{URL: monitor.URL}}),
+		rpcThreads: 2,
+		dbThreads:  2,
+		batchSize:  3,
+		syncTip:    true,
+		ctx:        ctx,
+		cancel:     cancel,
+		checkpoint: -1,
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- idxr.run()
+	}()
+
+	waitFor(t, 10*time.Second, "initial sync", func() bool { return indexed(n, db) })
+	waitFor(t, 10*time.Second, "initial mempool tx", func() bool { return db.mempoolTx(txid) })
+
+	mined := n.Mine(2)
+
+	waitFor(t, 10*time.Second, "new blocks", func() bool { return indexed(n, db) })
+
+	if txs := db.blockTxs(mined[0]); len(txs) != 2 || txs[1].TxID != txid {
+		t.Errorf("block txs = %+v, want coinbase and %s", txs, txid)
+	}
+
+	tx, err = n.NewTx()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pendingID, err := n.AddTx(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, 10*time.Second, "new mempool tx", func() bool { return db.mempoolTx(pendingID) })
+
+	// replaces the block txid was mined in, which returns to the mempool and is mined again with pendingID
+	branch, err := n.Reorg(8, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, 10*time.Second, "reorg", func() bool { return indexed(n, db) })
+
+	if orphaned := db.orphaned(); orphaned != 8 {
+		t.Errorf("orphaned blocks = %d, want 8", orphaned)
+	}
+
+	if txs := db.blockTxs(branch[0]); len(txs) != 3 || txs[1].TxID != txid || txs[2].TxID != pendingID {
+		t.Errorf("branch block txs = %+v, want coinbase, %s and %s", txs, txid, pendingID)
+	}
+
+	cancel()
+
+	select {
+	case err := <-errChan:
+		if err != nil {
+			t.Errorf("run() error = %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("run() did not return after cancel")
+	}
+
+	if atomic.LoadInt32(&notified) == 0 {
+		t.Error("monitor was not notified of new blocks")
+	}
+}
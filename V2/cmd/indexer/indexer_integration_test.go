@@ -3,6 +3,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 	"testing"
@@ -20,7 +21,9 @@ func mockIndexer() *Indexer {
 		log.Fatal(err)
 	}
 
-	return &Indexer{db: db}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Indexer{db: db, ctx: ctx, cancel: cancel, checkpoint: -1}
 }
 
 func cleanDatabase() error {
@@ -69,10 +72,12 @@ func TestReorgForkSameHeight(t *testing.T) {
 
 	blockHashChan := make(chan interface{})
 	txResultChan := make(chan *txResult)
+	committedChan := make(chan *pendingBlock)
 	blockChan := make(chan *utxo.Block)
 
 	go idx.syncToTip(blockChan, blockHashChan)
-	go idx.writeBlock(txResultChan, blockChan)
+	go idx.writeBlock(txResultChan, committedChan, blockChan)
+	go idx.checkpointBlocks(committedChan)
 	go idx.writeTx(txResultChan)
 
 	// load start block
@@ -114,10 +119,12 @@ func TestReorgForkNewTip(t *testing.T) {
 
 	blockHashChan := make(chan interface{})
 	txResultChan := make(chan *txResult)
+	committedChan := make(chan *pendingBlock)
 	blockChan := make(chan *utxo.Block)
 
 	go idx.syncToTip(blockChan, blockHashChan)
-	go idx.writeBlock(txResultChan, blockChan)
+	go idx.writeBlock(txResultChan, committedChan, blockChan)
+	go idx.checkpointBlocks(committedChan)
 	go idx.writeTx(txResultChan)
 
 	// load start block
@@ -185,10 +192,12 @@ func TestReorgSkipBlock(t *testing.T) {
 
 	blockHashChan := make(chan interface{})
 	txResultChan := make(chan *txResult)
+	committedChan := make(chan *pendingBlock)
 	blockChan := make(chan *utxo.Block)
 
 	go idx.syncToTip(blockChan, blockHashChan)
-	go idx.writeBlock(txResultChan, blockChan)
+	go idx.writeBlock(txResultChan, committedChan, blockChan)
+	go idx.checkpointBlocks(committedChan)
 	go idx.writeTx(txResultChan)
 
 	// load start block
@@ -232,10 +241,12 @@ func TestReorgDGB(t *testing.T) {
 
 	blockHashChan := make(chan interface{})
 	txResultChan := make(chan *txResult)
+	committedChan := make(chan *pendingBlock)
 	blockChan := make(chan *utxo.Block)
 
 	go idx.syncToTip(blockChan, blockHashChan)
-	go idx.writeBlock(txResultChan, blockChan)
+	go idx.writeBlock(txResultChan, committedChan, blockChan)
+	go idx.checkpointBlocks(committedChan)
 	go idx.writeTx(txResultChan)
 
 	// load start block
@@ -295,10 +306,12 @@ func TestReorgDGB2(t *testing.T) {
 
 	blockHashChan := make(chan interface{})
 	txResultChan := make(chan *txResult)
+	committedChan := make(chan *pendingBlock)
 	blockChan := make(chan *utxo.Block)
 
 	go idx.syncToTip(blockChan, blockHashChan)
-	go idx.writeBlock(txResultChan, blockChan)
+	go idx.writeBlock(txResultChan, committedChan, blockChan)
+	go idx.checkpointBlocks(committedChan)
 	go idx.writeTx(txResultChan)
 
 	// load start block
@@ -345,7 +358,7 @@ func TestReorgDGB2(t *testing.T) {
 	assertNotOrphaned(t, loadBlocksByHash(t, idx.db.(*postgres.Database), blk9468618.Hash, blk9468619.Hash, blk9468620.Hash, blk9468621a.Hash, blk9468622.Hash))
 	assertOrphaned(t, loadBlocksByHash(t, idx.db.(*postgres.Database), blk9468620a.Hash, blk9468621.Hash))
 
-	blk, _ := idx.db.GetBlock(9468619)
+	blk, _ := idx.db.GetBlock(context.Background(), 9468619)
 	hash := "7d59abfdcc7b2a08286f50ec8d5988ff8f92d19fee9437d325b483d46fcad9f1"
 
 	if blk.NextHash != hash {
@@ -365,10 +378,12 @@ func TestReorgDGB3(t *testing.T) {
 
 	blockHashChan := make(chan interface{})
 	txResultChan := make(chan *txResult)
+	committedChan := make(chan *pendingBlock)
 	blockChan := make(chan *utxo.Block)
 
 	go idx.syncToTip(blockChan, blockHashChan)
-	go idx.writeBlock(txResultChan, blockChan)
+	go idx.writeBlock(txResultChan, committedChan, blockChan)
+	go idx.checkpointBlocks(committedChan)
 	go idx.writeTx(txResultChan)
 
 	// load start block
@@ -409,7 +424,7 @@ func TestReorgDGB3(t *testing.T) {
 	assertNotOrphaned(t, loadBlocksByHash(t, idx.db.(*postgres.Database), blk9468618.Hash, blk9468619.Hash, blk9468620.Hash, blk9468621a.Hash, blk9468622.Hash))
 	assertOrphaned(t, loadBlocksByHash(t, idx.db.(*postgres.Database), blk9468621.Hash))
 
-	blk, _ := idx.db.GetBlock(9468620)
+	blk, _ := idx.db.GetBlock(context.Background(), 9468620)
 	hash := "b8b181627f1095879f3cf8d8c72569a49b353a286cb635cc4f175502ec5b1b17"
 
 	if blk.NextHash != hash {
@@ -429,10 +444,12 @@ func TestReorgDGB3a(t *testing.T) {
 
 	blockHashChan := make(chan interface{})
 	txResultChan := make(chan *txResult)
+	committedChan := make(chan *pendingBlock)
 	blockChan := make(chan *utxo.Block)
 
 	go idx.syncToTip(blockChan, blockHashChan)
-	go idx.writeBlock(txResultChan, blockChan)
+	go idx.writeBlock(txResultChan, committedChan, blockChan)
+	go idx.checkpointBlocks(committedChan)
 	go idx.writeTx(txResultChan)
 
 	// load start block
@@ -480,7 +497,7 @@ func TestReorgDGB3a(t *testing.T) {
 	assertNotOrphaned(t, loadBlocksByHash(t, idx.db.(*postgres.Database), blk9468618.Hash, blk9468619.Hash, blk9468620.Hash, blk9468621a.Hash, blk9468622.Hash, blk9468623.Hash))
 	assertOrphaned(t, loadBlocksByHash(t, idx.db.(*postgres.Database), blk9468621.Hash))
 
-	blk, _ := idx.db.GetBlock(9468620)
+	blk, _ := idx.db.GetBlock(context.Background(), 9468620)
 	hash := "b8b181627f1095879f3cf8d8c72569a49b353a286cb635cc4f175502ec5b1b17"
 
 	if blk.NextHash != hash {
@@ -508,7 +525,7 @@ func assertNotOrphaned(t *testing.T, blocks []*utxo.Block) {
 func loadBlocksByHash(t *testing.T, conn *postgres.Database, hashes ...string) []*utxo.Block {
 	blocks := make([]*utxo.Block, 0)
 	for _, n := range hashes {
-		b, err := conn.GetBlock(n)
+		b, err := conn.GetBlock(context.Background(), n)
 		if err != nil {
 			t.Fatalf("unable to fetch block %s from db", n)
 			continue
@@ -1,122 +1,266 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	_ "net/http/pprof"
 	"os"
+	"os/signal"
 	"runtime/pprof"
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/shapeshift-legacy/coinquery/V2/config"
 	"github.com/shapeshift-legacy/coinquery/V2/internal/log"
+	"github.com/shapeshift-legacy/coinquery/V2/internal/metrics"
 	"github.com/shapeshift-legacy/coinquery/V2/pkg/blockchain/utxo"
 	"github.com/shapeshift-legacy/coinquery/V2/pkg/http"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/poll"
 	"github.com/shapeshift-legacy/coinquery/V2/pkg/postgres"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/storage"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/storage/backend"
 	"github.com/shapeshift-legacy/coinquery/V2/pkg/zmq"
 )
 
 var (
-	conf       = flag.String("config", "./config/local.json", "path to configuration json file")
-	coin       = flag.String("coin", "", "coin to index")
-	startBlock = flag.Int("start", 0, "block to start sync from")
-	endBlock   = flag.Int("end", 0, "block to end sync from")
-	syncTip    = flag.Bool("sync", false, "synchronizes until tip")
-	debug      = flag.Bool("debug", false, "verbose debug output")
-	cpuprofile = flag.String("cpuprofile", "", "write cpu profile to file")
-	batchSize  = flag.Int("batch", 1, "rpc request batch size")
-	recover    = flag.Bool("recover", false, "if set, allows to write blocks older than latest in database")
+	conf        = flag.String("config", "./config/local.json", "path to configuration json file")
+	coin        = flag.String("coin", "", "coin to index")
+	coins       = flag.String("coins", "", "comma separated coins to index concurrently, or all for every configured coin, overrides coin")
+	startBlock  = flag.Int("start", 0, "block to start sync from")
+	endBlock    = flag.Int("end", 0, "block to end sync from")
+	syncTip     = flag.Bool("sync", false, "synchronizes until tip")
+	debug       = flag.Bool("debug", false, "verbose debug output")
+	cpuprofile  = flag.String("cpuprofile", "", "write cpu profile to file")
+	batchSize   = flag.Int("batch", 1, "rpc request batch size")
+	recover     = flag.Bool("recover", false, "if set, allows to write blocks older than latest in database")
+	bulk        = flag.Bool("bulk", false, "load blocks with postgres COPY during initial sync until within bulkTip blocks of tip")
+	bulkTip     = flag.Int("bulkTip", 1000, "distance from tip at which bulk loading switches to regular inserts")
+	metricsAddr = flag.String("metrics", ":9100", "address to serve prometheus metrics on, empty to disable")
+	adminAddr   = flag.String("admin", "", "address to serve the admin api on, empty to disable")
+	election    = flag.Bool("election", false, "stand by until holding the schema lock so that redundant replicas can take over")
+	record      = flag.String("record", "", "directory to record node rpc calls to, one cassette per coin")
+	replay      = flag.String("replay", "", "directory of cassettes to serve node rpc calls from instead of the node")
 )
 
+// checkpointKey is the metadata key holding the height of the last block with all transactions committed
+const checkpointKey = "indexedBlock"
+
+// bulkBatchTxs is the number of transactions buffered before bulk loading them in a single db transaction
+const bulkBatchTxs = 20000
+
+// defaultFallbackTimeout is how long zmq can go without a block while the node advances before falling back to polling
+const defaultFallbackTimeout = 5 * time.Minute
+
+// coinRestartDelay is how long a failed coin waits before restarting when indexing multiple coins
+const coinRestartDelay = 30 * time.Second
+
 // Blockchain interface
 type Blockchain interface {
 	GetBlocks(val interface{}) ([]*utxo.Block, error)
+	GetBlockHeader(hash string) (*utxo.BlockHeaderVerbose, error)
 	GetChainInfo() (*utxo.ChainInfo, error)
 	GetMempool() ([]string, error)
 	GetRawTransactions(txids []string) ([]*utxo.Tx, error)
 }
 
+// BlockSource interface for notifications of new blocks and mempool transactions
+type BlockSource interface {
+	Connect() error
+	Start(blockHashChan chan<- interface{}, mempoolTxChan chan<- *utxo.MempoolTx, signalMempoolChan chan struct{})
+}
+
 // Database interface
 type Database interface {
-	LastBlock() (*utxo.Block, error)
+	LastBlock(ctx context.Context) (*utxo.Block, error)
 	InsertBlock(b *utxo.Block, recover bool) (int, error)
-	GetBlock(val interface{}) (*utxo.Block, error)
-	InsertTx(tx *utxo.Tx, txIndex int, blockId int) error
+	GetBlock(ctx context.Context, val interface{}) (*utxo.Block, error)
+	InsertTxs(blockId int, txs []*utxo.Tx) error
+	OrphanBlocks(height int) (int, error)
+	Get(ctx context.Context, key string) (string, error)
+	Set(key, value string) error
 	Close() error
 }
 
 // Indexer struct containing configuration and connections
 type Indexer struct {
-	dbThreads     int
-	rpcThreads    int
-	bc            Blockchain
-	db            Database
-	mq            *zmq.ZMQ
-	monitor       *http.Client
-	startBlock    int
-	endBlock      int
-	syncTip       bool
-	batchSize     int
-	recover       bool
-	notifyMonitor bool
-	doneChan      chan struct{}
-	errChan       chan error
+	coin            string
+	logger          log.Logger
+	dbThreads       int
+	rpcThreads      int
+	bc              Blockchain
+	db              Database
+	source          BlockSource
+	fallback        BlockSource // used if source is silent for fallbackTimeout while the node advances
+	fallbackTimeout time.Duration
+	blocksDir       string // node blocks directory read during initial sync, empty to get blocks from rpc
+	monitor         *http.Client
+	startBlock      int
+	endBlock        int
+	syncTip         bool
+	batchSize       int
+	recover         bool
+	bulk            bool // bulk load initial sync until within bulkTip blocks of tip
+	bulkTip         int
+	election        bool // wait for the schema lock before writing
+	notifyMonitor   bool
+	detectReorgs    bool
+	ctx             context.Context // cancelled on shutdown signal or the first pipeline error
+	cancel          context.CancelFunc
+	err             error // first error reported by a pipeline stage
+	errOnce         sync.Once
+	checkpoint      int // height of the last block recorded as fully committed
+	resumeHeight    int // blocks at or below this height may be partially written from a previous run
+	ingest          gate
+	mu              sync.Mutex // guards phase, queues, reindexing and writes of checkpoint for the admin api
+	phase           string
+	queues          []queue
+	reindexing      *reindexStatus
 }
 
+// txResult is a batch of transactions to insert. Block transactions are inserted together in block order.
 type txResult struct {
-	tx      *utxo.Tx
-	index   int
-	blockId int
+	txs     []*utxo.Tx
+	blockId int           // -1 for mempool transactions
+	block   *pendingBlock // nil for mempool transactions
+}
+
+// pendingBlock tracks the transactions of a block that have not yet been committed to the db
+type pendingBlock struct {
+	height int
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+	failed bool
+	rewind bool // checkpoint moves back to height after a reorg
+}
+
+// reorg describes a chain reorganization detected against the blocks stored in the db
+type reorg struct {
+	ancestor int           // height of the common ancestor
+	oldTip   *utxo.Block   // last non orphaned block in the db before rollback
+	branch   []*utxo.Block // blocks of the new branch in ascending order, ending with the received block
+}
+
+// done marks the transactions of the block as processed, flagging the block as failed if the insert errored
+func (b *pendingBlock) done(err error) {
+	if err != nil {
+		b.mu.Lock()
+		b.failed = true
+		b.mu.Unlock()
+	}
+
+	b.wg.Done()
 }
 
-func newIndexer(c *config.Config, cc *config.Coin) *Indexer {
-	doneChan := make(chan struct{})
-	errChan := make(chan error)
+// committed waits for the transactions of the block to be processed and reports if they were inserted
+func (b *pendingBlock) committed() bool {
+	b.wg.Wait()
 
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return !b.failed
+}
+
+// newIndexer creates an indexer for cc with its own db pool, node client and block source. The indexer stops once
+// parent is cancelled.
+func newIndexer(parent context.Context, c *config.Config, cc *config.Coin) (*Indexer, error) {
 	dbConfig, err := c.GetDBConfig(config.ReadWrite, cc)
 	if err != nil {
-		log.Fatal(err, "main")
+		return nil, err
 	}
 
-	dbConn, err := postgres.New(dbConfig, *coin)
+	dbConn, err := backend.New(dbConfig, cc.Name)
 	if err != nil {
-		log.Fatal(err, "main")
+		return nil, err
 	}
 
-	mqConn := zmq.New(cc, doneChan, errChan)
+	// bulk loading and leader election are only supported by some backends, see storage.BulkLoader and storage.Locker
+	if _, ok := dbConn.(storage.BulkLoader); *bulk && !ok {
+		dbConn.Close()
+		return nil, errors.Errorf("storage backend of %s doesn't support -bulk", cc.Name)
+	}
+
+	if _, ok := dbConn.(storage.Locker); *election && !ok {
+		dbConn.Close()
+		return nil, errors.Errorf("storage backend of %s doesn't support -election", cc.Name)
+	}
+
+	ctx, cancel := context.WithCancel(parent)
 
 	rpcConfig := c.GetRPCConfig(cc)
-	chainConn := utxo.New(rpcConfig, *coin)
+	if *record != "" {
+		rpcConfig.Record = http.CassettePath(*record, cc.Name)
+	}
+	if *replay != "" {
+		rpcConfig.Replay = http.CassettePath(*replay, cc.Name)
+	}
+
+	chainConn := utxo.New(rpcConfig, cc.Name)
+
+	var source, fallback BlockSource
+
+	poller := poll.New(ctx, cc, chainConn)
+
+	switch cc.Sync.Source {
+	case "poll":
+		source = poller
+	default:
+		source = zmq.New(ctx, cc)
+		fallback = poller
+	}
+
+	fallbackTimeout := time.Duration(cc.Sync.FallbackTimeout) * time.Second
+	if fallbackTimeout <= 0 {
+		fallbackTimeout = defaultFallbackTimeout
+	}
 
 	monitorClient := http.NewClient(&config.RPC{
 		CoinRPC: config.CoinRPC{
-			URL: fmt.Sprintf("%s-monitor", *coin),
+			URL: fmt.Sprintf("%s-monitor", cc.Name),
 		},
 	})
 
 	return &Indexer{
-		dbThreads:  dbConfig.Threads,
-		rpcThreads: rpcConfig.Threads,
-		bc:         chainConn,
-		db:         dbConn,
-		mq:         mqConn,
-		monitor:    monitorClient,
-		startBlock: *startBlock,
-		endBlock:   *endBlock,
-		syncTip:    *syncTip,
-		batchSize:  *batchSize,
-		recover:    *recover,
-		doneChan:   doneChan,
-		errChan:    errChan,
-	}
+		coin:            cc.Name,
+		logger:          log.New(cc.Name),
+		dbThreads:       dbConfig.Threads,
+		rpcThreads:      rpcConfig.Threads,
+		bc:              chainConn,
+		db:              dbConn,
+		source:          source,
+		fallback:        fallback,
+		fallbackTimeout: fallbackTimeout,
+		blocksDir:       cc.Sync.BlocksDir,
+		monitor:         monitorClient,
+		startBlock:      *startBlock,
+		endBlock:        *endBlock,
+		syncTip:         *syncTip,
+		batchSize:       *batchSize,
+		recover:         *recover,
+		bulk:            *bulk,
+		bulkTip:         *bulkTip,
+		election:        *election,
+		ctx:             ctx,
+		cancel:          cancel,
+		checkpoint:      -1,
+	}, nil
 }
 
 func main() {
 	flag.Parse()
 
-	log.Initialize("coinquery-indexer", *coin)
+	names := []string{*coin}
+	if *coins != "" {
+		names = strings.Split(*coins, ",")
+	}
+
+	log.Initialize("coinquery-indexer", strings.Join(names, ","))
 
 	if *cpuprofile != "" {
 		f, err := os.Create(*cpuprofile)
@@ -132,40 +276,194 @@ func main() {
 		log.Fatal(err, "main")
 	}
 
-	cc, err := c.GetCoin(*coin)
-	if err != nil {
-		log.Fatal(err, "main")
+	if *coins == "all" {
+		names = c.ListCoins()
 	}
 
-	idxr := newIndexer(c, cc)
-	defer func() {
-		err := idxr.db.Close()
-		if err != nil {
-			log.Fatal(err, "main", "error closing db")
+	ccs := make([]*config.Coin, len(names))
+	for i, name := range names {
+		if ccs[i], err = c.GetCoin(strings.TrimSpace(name)); err != nil {
+			log.Fatal(err, "main")
 		}
-	}()
+	}
 
-	log.Info("main", "start initial sync")
-	idxr.initialSync()
-	log.Info("main", "finished initial sync")
+	if *metricsAddr != "" {
+		metrics.Serve(*metricsAddr)
+	}
 
-	if !idxr.recover && idxr.syncTip {
-		err = idxr.mq.Connect()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go handleSignals(ctx, cancel)
+
+	adm := newAdmin()
+	if *adminAddr != "" {
+		adm.serve(*adminAddr)
+	}
+
+	if len(ccs) == 1 {
+		idxr, err := newIndexer(ctx, c, ccs[0])
 		if err != nil {
 			log.Fatal(err, "main")
 		}
 
-		idxr.staySynced()
+		adm.register(idxr)
+
+		if err := idxr.run(); err != nil {
+			log.Fatal(err, "main", "indexer stopped")
+		}
+
+		return
+	}
+
+	if err := runCoins(ctx, c, ccs, adm); err != nil {
+		log.Fatal(err, "main", "indexer stopped")
+	}
+}
+
+// runCoins indexes each coin concurrently until all have stopped. A failing coin doesn't affect the others and is
+// restarted after coinRestartDelay while syncing to tip. Returns an error listing the coins that stopped on an error.
+func runCoins(ctx context.Context, c *config.Config, ccs []*config.Coin, adm *admin) error {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var failed []string
+
+	for _, cc := range ccs {
+		wg.Add(1)
+
+		go func(cc *config.Coin) {
+			defer wg.Done()
+
+			if err := runCoin(ctx, c, cc, adm); err != nil {
+				log.New(cc.Name).Error(err, "main", "indexer stopped")
+
+				mu.Lock()
+				failed = append(failed, cc.Name)
+				mu.Unlock()
+			}
+		}(cc)
+	}
+
+	wg.Wait()
+
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return errors.Errorf("%d of %d coins failed: %s", len(failed), len(ccs), strings.Join(failed, ","))
+	}
+
+	return nil
+}
+
+// runCoin runs an indexer for cc, starting a new one after coinRestartDelay if it fails while syncing to tip
+func runCoin(ctx context.Context, c *config.Config, cc *config.Coin, adm *admin) error {
+	logger := log.New(cc.Name)
+
+	for {
+		idxr, err := newIndexer(ctx, c, cc)
+		if err == nil {
+			adm.register(idxr)
+			err = idxr.run()
+		}
+
+		if err == nil || ctx.Err() != nil || !*syncTip {
+			return err
+		}
+
+		logger.Warnf(err, "main", "restarting indexer in %s", coinRestartDelay)
+
+		select {
+		case <-time.After(coinRestartDelay):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// run performs the initial sync and, if syncing to tip, stays synced until the indexer is stopped.
+// Returns the first error reported by a pipeline stage, or nil on a clean shutdown.
+func (idxr *Indexer) run() error {
+	var f *feed
+	var w *warmer
+
+	if idxr.election {
+		f, w = idxr.standby()
+	}
+
+	if idxr.ctx.Err() == nil {
+		idxr.logger.Info("main", "start initial sync")
+		idxr.initialSync()
+	}
+
+	if idxr.ctx.Err() == nil {
+		idxr.logger.Info("main", "finished initial sync")
+
+		if !idxr.recover && idxr.syncTip {
+			var err error
+			if f == nil {
+				f, err = idxr.startSource()
+			}
+
+			if err != nil {
+				idxr.fail(err)
+			} else {
+				if w != nil {
+					w.replay(idxr.ctx, f)
+				}
+
+				idxr.staySynced(f)
+			}
+		}
+	}
+
+	// release the context of an indexer that finished without being stopped
+	idxr.cancel()
+	idxr.setPhase(phaseStopped)
+
+	if err := idxr.db.Close(); err != nil {
+		idxr.logger.Error(err, "main", "error closing db")
+	}
+
+	if idxr.err != nil {
+		return idxr.err
+	}
+
+	idxr.logger.Infof("main", "shutdown complete at block: %d", idxr.checkpoint)
+
+	return nil
+}
+
+// handleSignals cancels ctx on SIGINT or SIGTERM so the pipelines of all indexers can drain in-flight blocks
+func handleSignals(ctx context.Context, cancel context.CancelFunc) {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+
+	select {
+	case sig := <-sigChan:
+		log.Infof("main", "received %s, shutting down", sig)
+		cancel()
+	case <-ctx.Done():
 	}
 }
 
+// fail records the first error reported by a pipeline stage and cancels the indexer context to begin shutdown
+func (idxr *Indexer) fail(err error) {
+	idxr.errOnce.Do(func() {
+		idxr.logger.Error(err, "main", "stopping indexer")
+		idxr.err = err
+	})
+
+	idxr.cancel()
+}
+
 // setStartBlock sets startBlock to the last block in db or 0 if no blocks are in the db if syncTip is true,
 // otherwise startBlock will be the value of the flag passed in, or default value if no flag is passed.
-func (idxr *Indexer) setStartBlock() {
+// If a checkpoint below the last block in db was recorded, sync resumes from the block after the checkpoint.
+func (idxr *Indexer) setStartBlock() error {
 	if idxr.syncTip {
-		blk, err := idxr.db.LastBlock()
+		blk, err := idxr.db.LastBlock(context.Background())
 		if err != nil {
-			log.Fatal(err, "main", "failed to set start block")
+			return errors.Wrap(err, "failed to set start block")
 		}
 
 		if blk == nil {
@@ -174,38 +472,100 @@ func (idxr *Indexer) setStartBlock() {
 			idxr.startBlock = int(blk.Height)
 		}
 
-		log.Info("main", "setting startBlock to: ", idxr.startBlock)
+		if err := idxr.loadCheckpoint(); err != nil {
+			idxr.logger.Warn(err, "main", "no checkpoint found, starting from last block")
+		} else if blk != nil && idxr.checkpoint < blk.Height {
+			idxr.startBlock = idxr.checkpoint + 1
+			idxr.resumeHeight = blk.Height
+		}
+
+		idxr.logger.Info("main", "setting startBlock to: ", idxr.startBlock)
 	}
+
+	return nil
 }
 
 // setEndBlock sets the endBlock to the current height of the blockchain if syncTip is true
 // otherwise endBlock will be the value of the flag passed in, or equal to start if not provided
-func (idxr *Indexer) setEndBlock() {
+func (idxr *Indexer) setEndBlock() error {
 	if idxr.syncTip {
 		info, err := idxr.bc.GetChainInfo()
 		if err != nil {
-			log.Fatal(err, "main", "failed to set end block")
+			return errors.Wrap(err, "failed to set end block")
 		}
 
+		metrics.NodeHeight.WithLabelValues(idxr.coin).Set(float64(info.Blocks))
+
 		idxr.endBlock = info.Blocks
-		log.Info("main", "setting endBlock to: ", idxr.endBlock)
+		idxr.logger.Info("main", "setting endBlock to: ", idxr.endBlock)
 	} else if idxr.endBlock < idxr.startBlock {
 		idxr.endBlock = idxr.startBlock
 	}
+
+	return nil
+}
+
+// loadCheckpoint reads the height of the last fully committed block from the db metadata
+func (idxr *Indexer) loadCheckpoint() error {
+	value, err := idxr.db.Get(context.Background(), checkpointKey)
+	if err != nil {
+		return err
+	}
+
+	height, err := strconv.Atoi(value)
+	if err != nil {
+		return errors.Wrapf(err, "invalid checkpoint: %s", value)
+	}
+
+	idxr.setCheckpoint(height)
+
+	return nil
 }
 
 // initialSync syncs the blockchain from start to end flags if syncTip is false
 // otherwise it syncs from last block in db to tip of chain
 func (idxr *Indexer) initialSync() {
-	blockHeightsChan := make(chan interface{})
-	txResultChan := make(chan *txResult)
-	blocksChan := make(chan []*utxo.Block)
-	orderedBlockChan := make(chan *utxo.Block)
+	blockHeightsChan := make(chan interface{}, idxr.rpcThreads)
+	txResultChan := make(chan *txResult, idxr.dbThreads)
+	blocksChan := make(chan []*utxo.Block, idxr.rpcThreads)
+	orderedBlockChan := make(chan *utxo.Block, idxr.dbThreads)
+	committedChan := make(chan *pendingBlock, idxr.dbThreads)
 
 	idxr.notifyMonitor = false
+	idxr.detectReorgs = false
+
+	idxr.setPhase(phaseInitialSync,
+		queue{name: "blockHeights", len: func() int { return len(blockHeightsChan) }, cap: cap(blockHeightsChan)},
+		queue{name: "blocks", len: func() int { return len(blocksChan) }, cap: cap(blocksChan)},
+		queue{name: "orderedBlocks", len: func() int { return len(orderedBlockChan) }, cap: cap(orderedBlockChan)},
+		queue{name: "txResults", len: func() int { return len(txResultChan) }, cap: cap(txResultChan)},
+		queue{name: "committed", len: func() int { return len(committedChan) }, cap: cap(committedChan)},
+	)
+
+	if err := idxr.setStartBlock(); err != nil {
+		idxr.fail(err)
+		return
+	}
+
+	if err := idxr.setEndBlock(); err != nil {
+		idxr.fail(err)
+		return
+	}
+
+	var blocks utxo.BlockGetter = idxr.bc
+
+	if idxr.blocksDir != "" {
+		files, err := utxo.NewBlockFiles(idxr.blocksDir, idxr.coin, idxr.bc)
+		if err != nil {
+			idxr.fail(err)
+			return
+		}
+		defer files.Close()
 
-	idxr.setStartBlock()
-	idxr.setEndBlock()
+		idxr.logger.Infof("main", "reading blocks up to %d from block files: %s", files.Height(), idxr.blocksDir)
+
+		blocks = files
+	}
 
 	go idxr.processBlockHeights(blockHeightsChan)
 
@@ -213,7 +573,7 @@ func (idxr *Indexer) initialSync() {
 	bwg.Add(idxr.rpcThreads)
 	for i := 0; i < idxr.rpcThreads; i++ {
 		go func() {
-			idxr.getBlocks(blocksChan, blockHeightsChan)
+			idxr.getBlocks(blocks, blocksChan, blockHeightsChan)
 			bwg.Done()
 		}()
 	}
@@ -223,7 +583,25 @@ func (idxr *Indexer) initialSync() {
 	}()
 
 	go idxr.orderBlock(orderedBlockChan, blocksChan)
-	go idxr.writeBlock(txResultChan, orderedBlockChan)
+
+	writeBlockChan := orderedBlockChan
+	if idxr.bulk && !idxr.recover {
+		bulkBlockChan := make(chan *utxo.Block)
+		go idxr.bulkWriteBlock(bulkBlockChan, committedChan, orderedBlockChan)
+		writeBlockChan = bulkBlockChan
+	}
+
+	go func() {
+		idxr.writeBlock(txResultChan, committedChan, writeBlockChan)
+		close(txResultChan)
+	}()
+
+	var cwg sync.WaitGroup
+	cwg.Add(1)
+	go func() {
+		idxr.checkpointBlocks(committedChan)
+		cwg.Done()
+	}()
 
 	var twg sync.WaitGroup
 	twg.Add(idxr.dbThreads)
@@ -234,38 +612,177 @@ func (idxr *Indexer) initialSync() {
 		}()
 	}
 	twg.Wait()
+	cwg.Wait()
 }
 
-// staySynced will continue syncing broadcasted transactions and confirmed blocks as they are received from zmq and mempool
-func (idxr *Indexer) staySynced() {
-	mempoolTxChan := make(chan *utxo.MempoolTx)
-	blockHashChan := make(chan interface{})
-	txResultChan := make(chan *txResult)
-	blockChan := make(chan *utxo.Block)
-	signalMempoolChan := make(chan struct{})
+// feed holds the channels a started block source delivers new blocks and mempool transactions to
+type feed struct {
+	blockHashChan     chan interface{}
+	mempoolTxChan     chan *utxo.MempoolTx
+	signalMempoolChan chan struct{}
+}
 
-	idxr.notifyMonitor = true
+// startSource connects and starts the block source, watched by the fallback source if there is one, and signals an
+// initial process of the mempool
+func (idxr *Indexer) startSource() (*feed, error) {
+	if err := idxr.source.Connect(); err != nil {
+		return nil, err
+	}
+
+	f := &feed{
+		blockHashChan:     make(chan interface{}),
+		mempoolTxChan:     make(chan *utxo.MempoolTx, idxr.rpcThreads),
+		signalMempoolChan: make(chan struct{}),
+	}
 
-	go idxr.processMempool(mempoolTxChan, signalMempoolChan)
+	go idxr.processMempool(f.mempoolTxChan, f.signalMempoolChan)
 
-	idxr.mq.Start(blockHashChan, mempoolTxChan, signalMempoolChan)
+	if idxr.fallback != nil {
+		sourceHashChan := make(chan interface{})
+		idxr.source.Start(sourceHashChan, f.mempoolTxChan, f.signalMempoolChan)
+		go idxr.watchBlockSource(sourceHashChan, f.blockHashChan, f.mempoolTxChan, f.signalMempoolChan)
+	} else {
+		idxr.source.Start(f.blockHashChan, f.mempoolTxChan, f.signalMempoolChan)
+	}
 
-	signalMempoolChan <- struct{}{} // signal for initial process of mempool
+	select {
+	case f.signalMempoolChan <- struct{}{}: // signal for initial process of mempool
+	case <-idxr.ctx.Done():
+	}
+
+	return f, nil
+}
 
+// staySynced will continue syncing broadcasted transactions and confirmed blocks as they are received from the block source and mempool
+// until the indexer context is cancelled, at which point in-flight blocks and transactions are drained before returning
+func (idxr *Indexer) staySynced(f *feed) {
+	mempoolTxChan := f.mempoolTxChan
+	blockHashChan := f.blockHashChan
+	txResultChan := make(chan *txResult, idxr.dbThreads)
+	blockChan := make(chan *utxo.Block)
+	committedChan := make(chan *pendingBlock, idxr.dbThreads)
+
+	idxr.notifyMonitor = true
+	idxr.detectReorgs = true
+
+	idxr.setPhase(phaseStaySynced,
+		queue{name: "mempoolTxs", len: func() int { return len(mempoolTxChan) }, cap: cap(mempoolTxChan)},
+		queue{name: "txResults", len: func() int { return len(txResultChan) }, cap: cap(txResultChan)},
+		queue{name: "committed", len: func() int { return len(committedChan) }, cap: cap(committedChan)},
+	)
+
+	var pwg sync.WaitGroup
+	pwg.Add(idxr.rpcThreads + 1)
 	for i := 0; i < idxr.rpcThreads; i++ {
-		go idxr.getMempoolTxs(txResultChan, mempoolTxChan)
+		go func() {
+			idxr.getMempoolTxs(txResultChan, mempoolTxChan)
+			pwg.Done()
+		}()
 	}
 
 	go idxr.syncToTip(blockChan, blockHashChan)
-	go idxr.writeBlock(txResultChan, blockChan)
+	go func() {
+		idxr.writeBlock(txResultChan, committedChan, blockChan)
+		pwg.Done()
+	}()
 
+	// txResultChan has multiple producers, close it once all of them have stopped
+	go func() {
+		pwg.Wait()
+		close(txResultChan)
+	}()
+
+	var cwg sync.WaitGroup
+	cwg.Add(1)
+	go func() {
+		idxr.checkpointBlocks(committedChan)
+		cwg.Done()
+	}()
+
+	var twg sync.WaitGroup
+	twg.Add(idxr.dbThreads)
 	for i := 0; i < idxr.dbThreads; i++ {
-		go idxr.writeTx(txResultChan)
+		go func() {
+			idxr.writeTx(txResultChan)
+			twg.Done()
+		}()
 	}
+	twg.Wait()
+	cwg.Wait()
+}
 
-	for err := range idxr.errChan {
-		close(idxr.doneChan)
-		log.Fatal(err, "main")
+// watchBlockSource forwards block hashes from the block source to blockHashChan. If no block hash is received for
+// fallbackTimeout while the node height has advanced, the fallback block source is started and a full mempool and
+// tip sync is signaled to recover anything missed.
+func (idxr *Indexer) watchBlockSource(sourceHashChan <-chan interface{}, blockHashChan chan<- interface{}, mempoolTxChan chan<- *utxo.MempoolTx, signalMempoolChan chan struct{}) {
+	ticker := time.NewTicker(idxr.fallbackTimeout)
+	defer ticker.Stop()
+
+	lastHeight := -1
+	if info, err := idxr.bc.GetChainInfo(); err != nil {
+		idxr.logger.Warn(err, "main", "failed to get node height")
+	} else {
+		lastHeight = info.Blocks
+		metrics.NodeHeight.WithLabelValues(idxr.coin).Set(float64(info.Blocks))
+	}
+
+	received := false
+	fellBack := false
+
+	for {
+		select {
+		case hash := <-sourceHashChan:
+			received = true
+
+			select {
+			case blockHashChan <- hash:
+			case <-idxr.ctx.Done():
+				return
+			}
+		case <-ticker.C:
+			if fellBack {
+				continue
+			}
+
+			info, err := idxr.bc.GetChainInfo()
+			if err != nil {
+				idxr.logger.Warn(err, "main", "failed to get node height")
+				continue
+			}
+
+			metrics.NodeHeight.WithLabelValues(idxr.coin).Set(float64(info.Blocks))
+
+			if !received && lastHeight >= 0 && info.Blocks > lastHeight {
+				err := errors.Errorf("no block received for %s while node advanced from %d to %d", idxr.fallbackTimeout, lastHeight, info.Blocks)
+				idxr.logger.Warn(err, "main", "falling back to polling")
+
+				if err := idxr.fallback.Connect(); err != nil {
+					idxr.logger.Warn(err, "main", "failed to start fallback block source")
+					continue
+				}
+
+				idxr.fallback.Start(blockHashChan, mempoolTxChan, signalMempoolChan)
+				fellBack = true
+
+				// recover any blocks or transactions missed while the block source was silent
+				select {
+				case signalMempoolChan <- struct{}{}:
+				case <-idxr.ctx.Done():
+					return
+				}
+
+				select {
+				case blockHashChan <- struct{}{}:
+				case <-idxr.ctx.Done():
+					return
+				}
+			}
+
+			lastHeight = info.Blocks
+			received = false
+		case <-idxr.ctx.Done():
+			return
+		}
 	}
 }
 
@@ -276,19 +793,20 @@ func (idxr *Indexer) processMempool(mempoolTxChan chan<- *utxo.MempoolTx, signal
 		case <-signalMempoolChan:
 			txids, err := idxr.bc.GetMempool()
 			if err != nil {
-				idxr.errChan <- err
+				idxr.fail(err)
+				return
 			}
 
-			log.Info("main", "start mempool process: ", len(txids))
+			idxr.logger.Info("main", "start mempool process: ", len(txids))
 			for _, id := range txids {
 				select {
 				case mempoolTxChan <- &utxo.MempoolTx{Hash: id, Fails: 0}:
-				case <-idxr.doneChan:
+				case <-idxr.ctx.Done():
 					return
 				}
 			}
-			log.Info("main", "end mempool process")
-		case <-idxr.doneChan:
+			idxr.logger.Info("main", "end mempool process")
+		case <-idxr.ctx.Done():
 			return
 		}
 	}
@@ -296,16 +814,39 @@ func (idxr *Indexer) processMempool(mempoolTxChan chan<- *utxo.MempoolTx, signal
 
 // getTransaction reads from mempoolTxChan to get a raw transaction and write to the txResultChan
 func (idxr *Indexer) getMempoolTxs(txResultChan chan<- *txResult, mempoolTxChan chan *utxo.MempoolTx) {
-	for mTx := range mempoolTxChan {
+	for {
+		var mTx *utxo.MempoolTx
+
+		select {
+		case mTx = <-mempoolTxChan:
+		case <-idxr.ctx.Done():
+			return
+		}
+
+		// transaction was decoded from a rawtx notification
+		if mTx.Tx != nil {
+			select {
+			case txResultChan <- &txResult{txs: []*utxo.Tx{mTx.Tx}, blockId: -1}:
+			case <-idxr.ctx.Done():
+				return
+			}
+
+			continue
+		}
+
 		txs, err := idxr.bc.GetRawTransactions([]string{mTx.Hash})
 		if err != nil {
 			if mTx.Fails < 10 {
 				go func(mTx *utxo.MempoolTx) {
 					mTx.Fails++
-					mempoolTxChan <- mTx
+
+					select {
+					case mempoolTxChan <- mTx:
+					case <-idxr.ctx.Done():
+					}
 				}(mTx)
 			} else {
-				log.Warn(err, "main")
+				idxr.logger.Warn(err, "main")
 			}
 
 			continue
@@ -313,8 +854,8 @@ func (idxr *Indexer) getMempoolTxs(txResultChan chan<- *txResult, mempoolTxChan
 
 		for _, tx := range txs {
 			select {
-			case txResultChan <- &txResult{tx: tx, index: -1, blockId: -1}:
-			case <-idxr.doneChan:
+			case txResultChan <- &txResult{txs: []*utxo.Tx{tx}, blockId: -1}:
+			case <-idxr.ctx.Done():
 				return
 			}
 		}
@@ -330,7 +871,7 @@ func (idxr *Indexer) processBlockHeights(blockHeightsChan chan<- interface{}) {
 
 	block := 0
 
-	log.Info("main", "starting initial sync at block: ", idxr.startBlock)
+	idxr.logger.Info("main", "starting initial sync at block: ", idxr.startBlock)
 
 	// Logs block sync status every 2 minutes, until stopTickerChan is close when function returns
 	go func(b *int) {
@@ -338,7 +879,7 @@ func (idxr *Indexer) processBlockHeights(blockHeightsChan chan<- interface{}) {
 		for {
 			select {
 			case <-ticker.C:
-				log.Info("main", "syncing block: ", *b)
+				idxr.logger.Info("main", "syncing block: ", *b)
 			case <-stopTickerChan:
 				return
 			}
@@ -348,7 +889,14 @@ func (idxr *Indexer) processBlockHeights(blockHeightsChan chan<- interface{}) {
 	for i := idxr.startBlock; i <= idxr.endBlock; i += idxr.batchSize {
 		// Checks and updates endBlock to current node block height on final batch until caught up
 		if i >= idxr.endBlock-idxr.batchSize && i <= idxr.endBlock {
-			idxr.setEndBlock()
+			if err := idxr.setEndBlock(); err != nil {
+				idxr.fail(err)
+				return
+			}
+		}
+
+		if !idxr.ingest.wait(idxr.ctx) {
+			return
 		}
 
 		// Constructs heights array by batch size
@@ -363,23 +911,24 @@ func (idxr *Indexer) processBlockHeights(blockHeightsChan chan<- interface{}) {
 
 		select {
 		case blockHeightsChan <- heights:
-		case <-idxr.doneChan:
+		case <-idxr.ctx.Done():
 			return
 		}
 	}
 }
 
-// getBlocks reads heights ([]int) or hashes([]string) from the valChan, get the blocks from rpc and writes them to the blocksChan
-func (idxr *Indexer) getBlocks(blocksChan chan<- []*utxo.Block, valChan <-chan interface{}) {
+// getBlocks reads heights ([]int) or hashes([]string) from the valChan, get the blocks from blocks and writes them to the blocksChan
+func (idxr *Indexer) getBlocks(blocks utxo.BlockGetter, blocksChan chan<- []*utxo.Block, valChan <-chan interface{}) {
 	for v := range valChan {
-		b, err := idxr.bc.GetBlocks(v)
+		b, err := blocks.GetBlocks(v)
 		if err != nil {
-			log.Fatal(err, "main")
+			idxr.fail(err)
+			return
 		}
 
 		select {
 		case blocksChan <- b:
-		case <-idxr.doneChan:
+		case <-idxr.ctx.Done():
 			return
 		}
 	}
@@ -387,30 +936,90 @@ func (idxr *Indexer) getBlocks(blocksChan chan<- []*utxo.Block, valChan <-chan i
 
 // syncToTip is signaled by an incoming blockhash from zmq and will then sync all block from the last block in the
 // db to the tip of chain. This logic will also handle reorg recovery as we will be returned the last non orphaned
-// block from the db and sync current valid blocks from the node until tip.
+// block from the db and sync current valid blocks from the node until tip. Blocks decoded from a rawblock
+// notification are used in place of fetching them from the node.
 func (idxr *Indexer) syncToTip(blockChan chan<- *utxo.Block, blockHashChan <-chan interface{}) {
-	for range blockHashChan {
+	defer close(blockChan)
+
+	for {
+		var raw *utxo.Block
+
+		select {
+		case v := <-blockHashChan:
+			if b, ok := v.(*utxo.Block); ok {
+				raw = idxr.completeBlock(b)
+			}
+		case <-idxr.ctx.Done():
+			return
+		}
+
+		if !idxr.ingest.wait(idxr.ctx) {
+			return
+		}
+
 		info, err := idxr.bc.GetChainInfo()
 		if err != nil {
-			log.Fatal(err, "main", "failed to set end block")
+			idxr.fail(errors.Wrap(err, "failed to set end block"))
+			return
 		}
 
-		lastBlock, err := idxr.db.LastBlock()
+		metrics.NodeHeight.WithLabelValues(idxr.coin).Set(float64(info.Blocks))
+
+		lastBlock, err := idxr.db.LastBlock(idxr.ctx)
 		if err != nil {
-			log.Fatal(err, "main")
+			idxr.fail(err)
+			return
 		}
 
 		for i := int(lastBlock.Height); i <= info.Blocks; i++ {
+			if raw != nil && raw.Height == i {
+				select {
+				case blockChan <- raw:
+				case <-idxr.ctx.Done():
+					return
+				}
+
+				continue
+			}
+
 			b, err := idxr.bc.GetBlocks([]int{i})
 			if err != nil {
-				log.Fatal(err, "main")
+				idxr.fail(err)
+				return
 			}
 
-			blockChan <- b[0]
+			select {
+			case blockChan <- b[0]:
+			case <-idxr.ctx.Done():
+				return
+			}
 		}
 	}
 }
 
+// completeBlock sets the chain dependent fields of a block decoded from a rawblock notification from its block header.
+// Returns nil if the header can't be fetched or the block is no longer on the main chain, so the block is fetched
+// from the node instead.
+func (idxr *Indexer) completeBlock(b *utxo.Block) *utxo.Block {
+	header, err := idxr.bc.GetBlockHeader(b.Hash)
+	if err != nil {
+		idxr.logger.Warn(err, "main", "failed to get header for raw block")
+		return nil
+	}
+
+	if header.Confirmations < 0 {
+		return nil
+	}
+
+	b.Height = header.Height
+	b.MedianTime = header.MedianTime
+	b.Difficulty = header.Difficulty
+	b.Chainwork = header.Chainwork
+	b.NextHash = header.NextHash
+
+	return b
+}
+
 // orderBlock sorts blocks read from the blocksChan in ascending order and writes them to orderedBlockChan
 // since block order is not guaranteed due to concurrent fetching of blocks
 func (idxr *Indexer) orderBlock(orderedBlockChan chan<- *utxo.Block, blocksChan <-chan []*utxo.Block) {
@@ -435,7 +1044,7 @@ func (idxr *Indexer) orderBlock(orderedBlockChan chan<- *utxo.Block, blocksChan
 					nextBlock = block.Height + 1
 					blockSentCount++
 					continue
-				case <-idxr.doneChan:
+				case <-idxr.ctx.Done():
 					return
 				}
 			}
@@ -446,44 +1055,361 @@ func (idxr *Indexer) orderBlock(orderedBlockChan chan<- *utxo.Block, blocksChan
 	}
 }
 
-// writeBlock inserts Block into db and then writes transactions to the txResultChan
-func (idxr *Indexer) writeBlock(txResultChan chan<- *txResult, blockChan <-chan *utxo.Block) {
-	defer close(txResultChan)
+// writeBlock inserts Block into db and then writes transactions to the txResultChan. Once all transactions of a block
+// have been queued, the block is passed to committedChan to be checkpointed after its transactions are written.
+// A block that has been received is always queued in full so that shutdown never leaves a partially queued block.
+// If reorg detection is enabled, a block not extending the stored chain rolls back to the common ancestor
+// and the new branch is written in its place.
+func (idxr *Indexer) writeBlock(txResultChan chan<- *txResult, committedChan chan<- *pendingBlock, blockChan <-chan *utxo.Block) {
+	defer close(committedChan)
 
 	for block := range blockChan {
-		blockId, err := idxr.db.InsertBlock(block, idxr.recover)
-		if err != nil {
-			log.Fatal(err, "main")
+		blocks := []*utxo.Block{block}
+
+		if idxr.detectReorgs {
+			r, err := idxr.detectReorg(block)
+			if err != nil {
+				idxr.fail(err)
+				return
+			}
+
+			if r != nil {
+				if err := idxr.rollback(r, committedChan); err != nil {
+					idxr.fail(err)
+					return
+				}
+
+				blocks = r.branch
+			}
 		}
 
-		for i := range block.Txs {
-			select {
-			case txResultChan <- &txResult{&block.Txs[i], i, blockId}:
-			case <-idxr.doneChan:
+		for _, b := range blocks {
+			blockId, err := idxr.db.InsertBlock(b, idxr.recovering(b.Height))
+			if err != nil {
+				idxr.fail(err)
 				return
 			}
+
+			metrics.IndexedBlocks.WithLabelValues(idxr.coin).Inc()
+
+			pending := &pendingBlock{height: b.Height}
+			pending.wg.Add(1)
+
+			txs := make([]*utxo.Tx, len(b.Txs))
+			for i := range b.Txs {
+				txs[i] = &b.Txs[i]
+			}
+
+			txResultChan <- &txResult{txs: txs, blockId: blockId, block: pending}
+
+			committedChan <- pending
+
+			if idxr.notifyMonitor {
+				go idxr.monitor.CallRest("POST", fmt.Sprintf("monitor/%s/notify/newBlock", idxr.coin), b, nil)
+			}
 		}
+	}
+}
+
+// bulkWriteBlock bulk loads blocks read from orderedBlockChan until within bulkTip blocks of the node tip, then rebuilds
+// the secondary indexes and forwards the remaining blocks to blockChan to be written by writeBlock. Blocks that conflict
+// with existing rows or may have been partially written by a previous run are written through the regular insert path.
+func (idxr *Indexer) bulkWriteBlock(blockChan chan<- *utxo.Block, committedChan chan<- *pendingBlock, orderedBlockChan <-chan *utxo.Block) {
+	defer close(blockChan)
+
+	loading := true
+	indexesDropped := false
+	tip := -1
+	batch := []*utxo.Block{}
+	numTxs := 0
+
+	loader, ok := idxr.db.(storage.BulkLoader)
+	if !ok {
+		idxr.fail(errors.New("storage backend doesn't support bulk loading"))
+		return
+	}
 
-		if idxr.notifyMonitor {
-			go idxr.monitor.CallRest("POST", fmt.Sprintf("monitor/%s/notify/newBlock", *coin), block, nil)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		if !indexesDropped {
+			idxr.logger.Info("main", "dropping secondary indexes for bulk load")
+
+			if err := loader.DropIndexes(); err != nil {
+				return err
+			}
+
+			indexesDropped = true
+		}
+
+		err := loader.InsertBlocksBulk(batch)
+		if errors.Cause(err) == postgres.ErrBulkConflict {
+			idxr.logger.Warn(err, "main", "writing blocks individually")
+
+			for _, b := range batch {
+				if err := idxr.insertBlock(b, idxr.recovering(b.Height)); err != nil {
+					return err
+				}
+			}
+		} else if err != nil {
+			return err
+		} else {
+			metrics.IndexedBlocks.WithLabelValues(idxr.coin).Add(float64(len(batch)))
+			metrics.IndexedTxs.WithLabelValues(idxr.coin).Add(float64(numTxs))
+		}
+
+		committedChan <- &pendingBlock{height: batch[len(batch)-1].Height}
+
+		batch = []*utxo.Block{}
+		numTxs = 0
+
+		return nil
+	}
+
+	finish := func() error {
+		if err := flush(); err != nil {
+			return err
+		}
+
+		loading = false
+
+		if !indexesDropped {
+			return nil
+		}
+
+		if idxr.ctx.Err() != nil {
+			idxr.logger.Warn(idxr.ctx.Err(), "main", "secondary indexes not rebuilt, restart with -bulk to finish loading")
+			return nil
+		}
+
+		idxr.logger.Info("main", "rebuilding secondary indexes after bulk load")
+
+		return loader.CreateIndexes()
+	}
+
+	for b := range orderedBlockChan {
+		if loading && b.Height+idxr.bulkTip >= tip {
+			info, err := idxr.bc.GetChainInfo()
+			if err != nil {
+				idxr.fail(errors.Wrap(err, "failed to get tip for bulk load"))
+				return
+			}
+
+			tip = info.Blocks
+			metrics.NodeHeight.WithLabelValues(idxr.coin).Set(float64(tip))
+		}
+
+		if loading && b.Height+idxr.bulkTip >= tip {
+			idxr.logger.Infof("main", "within %d blocks of tip, switching from bulk load at block: %d", idxr.bulkTip, b.Height)
+
+			if err := finish(); err != nil {
+				idxr.fail(err)
+				return
+			}
+		}
+
+		if !loading {
+			blockChan <- b
+			continue
+		}
+
+		// may have been partially written by a previous run
+		if idxr.resumeHeight > 0 && b.Height <= idxr.resumeHeight {
+			if err := flush(); err != nil {
+				idxr.fail(err)
+				return
+			}
+
+			if err := idxr.insertBlock(b, idxr.recovering(b.Height)); err != nil {
+				idxr.fail(err)
+				return
+			}
+
+			committedChan <- &pendingBlock{height: b.Height}
+			continue
+		}
+
+		batch = append(batch, b)
+		numTxs += len(b.Txs)
+
+		if numTxs >= bulkBatchTxs {
+			if err := flush(); err != nil {
+				idxr.fail(err)
+				return
+			}
+		}
+	}
+
+	if loading {
+		if err := finish(); err != nil {
+			idxr.fail(err)
 		}
 	}
 }
 
-// writeTx inserts txResult into db
-func (idxr *Indexer) writeTx(txs <-chan *txResult) {
-	for tx := range txs {
-		if tx.tx.Hash == "" {
-			tx.tx.Hash = tx.tx.TxID
+// recovering reports if a block at height must be written through the recover path of block_insert,
+// either because recover is set or because it may have been partially written by a previous run
+func (idxr *Indexer) recovering(height int) bool {
+	return idxr.recover || height <= idxr.resumeHeight
+}
+
+// insertBlock writes a block and all of its transactions through the regular insert path
+func (idxr *Indexer) insertBlock(b *utxo.Block, recover bool) error {
+	blockId, err := idxr.db.InsertBlock(b, recover)
+	if err != nil {
+		return err
+	}
+
+	metrics.IndexedBlocks.WithLabelValues(idxr.coin).Inc()
+
+	txs := make([]*utxo.Tx, len(b.Txs))
+	for i := range b.Txs {
+		txs[i] = &b.Txs[i]
+		if txs[i].Hash == "" {
+			txs[i].Hash = txs[i].TxID
 		}
+	}
 
-		select {
-		case <-idxr.doneChan:
-			return
-		default:
-			if err := idxr.db.InsertTx(tx.tx, tx.index, tx.blockId); err != nil {
-				log.Fatal(err, "main")
+	if err := idxr.db.InsertTxs(blockId, txs); err != nil {
+		return err
+	}
+
+	metrics.IndexedTxs.WithLabelValues(idxr.coin).Add(float64(len(txs)))
+
+	return nil
+}
+
+// detectReorg compares the previousblockhash of block with its stored parent. On a mismatch it walks back through the
+// node's chain until a parent matching the db is found. A block replacing a stored block at the same height is also
+// treated as a reorg. Returns nil if block extends the stored chain.
+func (idxr *Indexer) detectReorg(block *utxo.Block) (*reorg, error) {
+	if block.Height == 0 {
+		return nil, nil
+	}
+
+	// reads on the write path aren't cancelled with idxr.ctx, in-flight blocks are finished on shutdown
+	tip, err := idxr.db.LastBlock(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	// nothing stored at or below the block height to conflict with
+	if tip == nil || block.Height > tip.Height+1 {
+		return nil, nil
+	}
+
+	branch := []*utxo.Block{block}
+	current := block
+
+	for current.Height > 0 {
+		parent, err := idxr.db.GetBlock(context.Background(), current.Height-1)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get parent of block: %s", current.Hash)
+		}
+
+		if parent.Hash == current.PrevHash {
+			break
+		}
+
+		blks, err := idxr.bc.GetBlocks([]string{current.PrevHash})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get parent of block: %s from node", current.Hash)
+		}
+
+		current = blks[0]
+		branch = append([]*utxo.Block{current}, branch...)
+	}
+
+	if len(branch) == 1 {
+		if block.Height > tip.Height {
+			return nil, nil
+		}
+
+		stored, err := idxr.db.GetBlock(context.Background(), block.Height)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get block at height: %d", block.Height)
+		}
+
+		// block was already written, e.g. last block resent by syncToTip
+		if stored.Hash == block.Hash {
+			return nil, nil
+		}
+	}
+
+	return &reorg{ancestor: current.Height - 1, oldTip: tip, branch: branch}, nil
+}
+
+// rollback orphans all blocks above the common ancestor of a reorg in a single db transaction, emits a reorg event,
+// and moves the checkpoint back to the common ancestor once all previously queued blocks have been committed
+func (idxr *Indexer) rollback(r *reorg, committedChan chan<- *pendingBlock) error {
+	orphaned, err := idxr.db.OrphanBlocks(r.ancestor + 1)
+	if err != nil {
+		return err
+	}
+
+	newTip := r.branch[len(r.branch)-1]
+
+	idxr.logger.WithFields(log.Fields{
+		"event":          "reorg",
+		"depth":          r.oldTip.Height - r.ancestor,
+		"ancestorHeight": r.ancestor,
+		"oldTipHeight":   r.oldTip.Height,
+		"oldTipHash":     r.oldTip.Hash,
+		"newTipHeight":   newTip.Height,
+		"newTipHash":     newTip.Hash,
+		"orphanedBlocks": orphaned,
+	}).Infof("main", "reorg detected, rolled back to block: %d", r.ancestor)
+
+	committedChan <- &pendingBlock{height: r.ancestor, rewind: true}
+
+	return nil
+}
+
+// writeTx inserts txResult into db until txs is closed, draining any queued transactions on shutdown
+func (idxr *Indexer) writeTx(txs <-chan *txResult) {
+	for r := range txs {
+		for _, tx := range r.txs {
+			if tx.Hash == "" {
+				tx.Hash = tx.TxID
 			}
 		}
+
+		err := idxr.db.InsertTxs(r.blockId, r.txs)
+		if err != nil {
+			idxr.fail(err)
+		} else {
+			metrics.IndexedTxs.WithLabelValues(idxr.coin).Add(float64(len(r.txs)))
+		}
+
+		if r.block != nil {
+			r.block.done(err)
+		}
+	}
+}
+
+// checkpointBlocks records the height of each block in metadata once all of its transactions have been committed.
+// Blocks are received in write order, so a failed block stops the checkpoint from advancing past it.
+// A rewind block moves the checkpoint back to the common ancestor of a reorg.
+func (idxr *Indexer) checkpointBlocks(committedChan <-chan *pendingBlock) {
+	failed := false
+
+	for block := range committedChan {
+		if !block.committed() {
+			failed = true
+		}
+
+		if failed || (block.height <= idxr.checkpoint && !block.rewind) {
+			continue
+		}
+
+		if err := idxr.db.Set(checkpointKey, strconv.Itoa(block.height)); err != nil {
+			idxr.logger.Warnf(err, "main", "failed to record checkpoint at block: %d", block.height)
+			continue
+		}
+
+		idxr.setCheckpoint(block.height)
+		metrics.IndexedHeight.WithLabelValues(idxr.coin).Set(float64(block.height))
 	}
 }
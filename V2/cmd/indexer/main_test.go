@@ -3,6 +3,8 @@
 package main
 
 import (
+	"context"
+	"errors"
 	_ "net/http/pprof"
 	"os"
 	"reflect"
@@ -10,7 +12,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/shapeshift-legacy/coinquery/V2/config"
 	"github.com/shapeshift-legacy/coinquery/V2/pkg/blockchain/utxo"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/postgres"
 )
 
 func TestMain(m *testing.M) {
@@ -61,6 +65,19 @@ func TestIndexer_setStartBlock(t *testing.T) {
 			},
 			want: 0,
 		},
+		{
+			name: "SyncTip true, Resume From Checkpoint",
+			fields: fields{
+				startBlock: 0,
+				db: newMockPostgres(&mockPostgres{
+					getFunc: func(key string) (string, error) {
+						return "65", nil
+					},
+				}),
+				syncTip: true,
+			},
+			want: 66,
+		},
 		{
 			name: "SyncTip false",
 			fields: fields{
@@ -77,9 +94,12 @@ func TestIndexer_setStartBlock(t *testing.T) {
 				startBlock: tt.fields.startBlock,
 				syncTip:    tt.fields.syncTip,
 				db:         tt.fields.db,
+				checkpoint: -1,
 			}
 
-			idxr.setStartBlock()
+			if err := idxr.setStartBlock(); err != nil {
+				t.Fatal(err)
+			}
 			got := idxr.startBlock
 
 			if tt.want != got {
@@ -127,7 +147,9 @@ func TestIndexer_setEndBlock(t *testing.T) {
 				bc:       tt.fields.bc,
 			}
 
-			idxr.setEndBlock()
+			if err := idxr.setEndBlock(); err != nil {
+				t.Fatal(err)
+			}
 			got := idxr.endBlock
 
 			if tt.want != got {
@@ -188,7 +210,7 @@ func TestIndexer_processBlockHeights(t *testing.T) {
 		startBlock int
 		endBlock   int
 		batchSize  int
-		doneChan   chan struct{}
+		cancel     bool
 	}
 	tests := []struct {
 		name   string
@@ -203,7 +225,7 @@ func TestIndexer_processBlockHeights(t *testing.T) {
 				startBlock: 0,
 				endBlock:   4,
 				batchSize:  2,
-				doneChan:   nil,
+				cancel:     false,
 			},
 			want: [][]int{[]int{0, 1}, []int{2, 3}, []int{4}},
 		},
@@ -215,7 +237,7 @@ func TestIndexer_processBlockHeights(t *testing.T) {
 				startBlock: 0,
 				endBlock:   8,
 				batchSize:  3,
-				doneChan:   nil,
+				cancel:     false,
 			},
 			want: [][]int{[]int{0, 1, 2}, []int{3, 4, 5}, []int{6, 7, 8}, []int{9}},
 		},
@@ -227,32 +249,36 @@ func TestIndexer_processBlockHeights(t *testing.T) {
 				startBlock: 0,
 				endBlock:   20,
 				batchSize:  10,
-				doneChan:   make(chan struct{}),
+				cancel:     true,
 			},
 			want: [][]int{[]int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
 			idxr := &Indexer{
 				bc:         tt.fields.bc,
 				syncTip:    tt.fields.syncTip,
 				startBlock: tt.fields.startBlock,
 				endBlock:   tt.fields.endBlock,
 				batchSize:  tt.fields.batchSize,
-				doneChan:   tt.fields.doneChan,
+				ctx:        ctx,
+				cancel:     cancel,
 			}
 
 			got := [][]int{}
 			gotChan := make(chan interface{})
 			go idxr.processBlockHeights(gotChan)
 
-			// test done channel if it is not nil
-			if idxr.doneChan != nil {
+			// test cancelling the context if requested
+			if tt.fields.cancel {
 				if g, ok := <-gotChan; ok {
 					got = append(got, g.([]int))
 				}
-				close(idxr.doneChan)
+				cancel()
 				time.Sleep(200 * time.Millisecond)
 				if g, ok := <-gotChan; ok {
 					got = append(got, g.([]int))
@@ -274,8 +300,8 @@ func TestIndexer_processBlockHeights(t *testing.T) {
 // it will return an array containing that number of blocks with their block info
 func TestIndexer_getBlocks(t *testing.T) {
 	type fields struct {
-		bc       Blockchain
-		doneChan chan struct{}
+		bc     Blockchain
+		cancel bool
 	}
 	type args struct {
 		blocks chan []*utxo.Block
@@ -290,8 +316,8 @@ func TestIndexer_getBlocks(t *testing.T) {
 		{
 			name: "Success",
 			fields: fields{
-				bc:       newMockBlockchain(nil),
-				doneChan: nil,
+				bc:     newMockBlockchain(nil),
+				cancel: false,
 			},
 			args: args{
 				blocks: make(chan []*utxo.Block),
@@ -302,8 +328,8 @@ func TestIndexer_getBlocks(t *testing.T) {
 		{
 			name: "Done Case",
 			fields: fields{
-				bc:       newMockBlockchain(nil),
-				doneChan: make(chan struct{}),
+				bc:     newMockBlockchain(nil),
+				cancel: true,
 			},
 			args: args{
 				blocks: make(chan []*utxo.Block),
@@ -314,9 +340,13 @@ func TestIndexer_getBlocks(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
 			idxr := &Indexer{
-				bc:       tt.fields.bc,
-				doneChan: tt.fields.doneChan,
+				bc:     tt.fields.bc,
+				ctx:    ctx,
+				cancel: cancel,
 			}
 
 			go func() { tt.args.val <- tt.pipelineSeed }()
@@ -324,19 +354,19 @@ func TestIndexer_getBlocks(t *testing.T) {
 			var wg sync.WaitGroup
 			wg.Add(1)
 			go func() {
-				idxr.getBlocks(tt.args.blocks, tt.args.val)
+				idxr.getBlocks(idxr.bc, tt.args.blocks, tt.args.val)
 				wg.Done()
 			}()
 
-			// test done channel if it is not nil
-			if idxr.doneChan != nil {
-				close(idxr.doneChan)
+			// test cancelling the context if requested
+			if tt.fields.cancel {
+				cancel()
 				timeout := doneTimeout(&wg, 2)
 
 				select {
 				case to := <-timeout:
 					if to {
-						t.Error("Closing done channel did not kill process before timeout")
+						t.Error("Cancelling context did not kill process before timeout")
 					}
 					return
 				}
@@ -353,7 +383,7 @@ func TestIndexer_getBlocks(t *testing.T) {
 
 func TestIndexer_orderBlock(t *testing.T) {
 	type fields struct {
-		doneChan chan struct{}
+		cancel bool
 	}
 	type args struct {
 		blocks chan []*utxo.Block
@@ -368,7 +398,7 @@ func TestIndexer_orderBlock(t *testing.T) {
 		{
 			name: "Success",
 			fields: fields{
-				doneChan: nil,
+				cancel: false,
 			},
 			args: args{
 				blocks: make(chan []*utxo.Block),
@@ -383,7 +413,7 @@ func TestIndexer_orderBlock(t *testing.T) {
 		{
 			name: "Done",
 			fields: fields{
-				doneChan: make(chan struct{}),
+				cancel: true,
 			},
 			args: args{
 				blocks: make(chan []*utxo.Block),
@@ -398,9 +428,13 @@ func TestIndexer_orderBlock(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
 			idxr := &Indexer{
 				startBlock: 0,
-				doneChan:   tt.fields.doneChan,
+				ctx:        ctx,
+				cancel:     cancel,
 			}
 
 			go func() { tt.args.blocks <- tt.seedBlocks }()
@@ -408,8 +442,8 @@ func TestIndexer_orderBlock(t *testing.T) {
 			gotChan := make(chan *utxo.Block)
 			go idxr.orderBlock(gotChan, tt.args.blocks)
 
-			if idxr.doneChan != nil {
-				close(idxr.doneChan)
+			if tt.fields.cancel {
+				cancel()
 
 				timeout := make(chan bool, 1)
 				go func() { time.Sleep(2 * time.Second); timeout <- true }()
@@ -425,7 +459,7 @@ func TestIndexer_orderBlock(t *testing.T) {
 				select {
 				case to := <-timeout:
 					if to {
-						t.Error("Closing done channel did not kill process before timeout")
+						t.Error("Cancelling context did not kill process before timeout")
 					}
 					return
 				}
@@ -441,103 +475,96 @@ func TestIndexer_orderBlock(t *testing.T) {
 
 func TestIndexer_writeBlock(t *testing.T) {
 	type fields struct {
-		db       Database
-		doneChan chan struct{}
+		db     Database
+		cancel bool
 	}
 	type args struct {
 		blocks chan *utxo.Block
 	}
 	tests := []struct {
-		name     string
-		fields   fields
-		args     args
-		testFunc func(b *utxo.Block) (int, error)
-		want     *txResult
+		name   string
+		fields fields
+		args   args
+		want   *txResult
 	}{
 		{
 			name: "Success",
 			fields: fields{
-				db:       newMockPostgres(nil),
-				doneChan: nil,
+				db:     newMockPostgres(nil),
+				cancel: false,
 			},
 			args: args{
 				blocks: make(chan *utxo.Block),
 			},
 			want: &txResult{
-				tx:      &utxo.Tx{Hex: "1234"},
-				index:   0,
+				txs:     []*utxo.Tx{{Hex: "1234"}},
 				blockId: 0,
 			},
 		},
 		{
-			name: "Done Case",
+			name: "Drains In-Flight Block",
 			fields: fields{
-				db:       newMockPostgres(nil),
-				doneChan: make(chan struct{}),
+				db:     newMockPostgres(nil),
+				cancel: true,
 			},
 			args: args{
 				blocks: make(chan *utxo.Block),
 			},
 			want: &txResult{
-				tx:      &utxo.Tx{Hex: "1234"},
-				index:   0,
-				blockId: 1,
+				txs:     []*utxo.Tx{{Hex: "1234"}},
+				blockId: 0,
 			},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
 			idxr := &Indexer{
-				db:       tt.fields.db,
-				doneChan: tt.fields.doneChan,
+				db:     tt.fields.db,
+				ctx:    ctx,
+				cancel: cancel,
 			}
 
 			gotChan := make(chan *txResult)
-			go idxr.writeBlock(gotChan, tt.args.blocks)
+			committedChan := make(chan *pendingBlock, 1)
+			go idxr.writeBlock(gotChan, committedChan, tt.args.blocks)
 			insertBlock := &utxo.Block{
-				BlockHeader: utxo.BlockHeader{},
+				BlockHeader: utxo.BlockHeader{Height: 7},
 				Txs:         []utxo.Tx{utxo.Tx{Hex: "1234"}},
 			}
 			tt.args.blocks <- insertBlock
 
-			// test done channel if it is not nil
-			if idxr.doneChan != nil {
-				close(idxr.doneChan)
+			// a block already received must be queued in full even after the context is cancelled
+			if tt.fields.cancel {
+				cancel()
+				time.Sleep(200 * time.Millisecond)
+			}
 
-				timeout := make(chan bool, 1)
-				go func() { time.Sleep(2 * time.Second); timeout <- true }()
-				go func() {
-					// defer takes longer to close than we thought :-O
-					// TODO remove sleep PARKER
-					time.Sleep(200 * time.Millisecond)
-					if _, ok := <-gotChan; !ok {
-						timeout <- false
-					}
-				}()
+			got := <-gotChan
+			close(tt.args.blocks)
 
-				select {
-				case to := <-timeout:
-					if to {
-						t.Error("Closing done channel did not kill process before timeout")
-					}
-					return
-				}
+			if !reflect.DeepEqual(tt.want.txs, got.txs) || tt.want.blockId != got.blockId {
+				t.Errorf("writeBlock() = %+v, want %+v", got, tt.want)
 			}
 
-			got := <-gotChan
+			block, ok := <-committedChan
+			if !ok || block.height != insertBlock.Height || got.block != block {
+				t.Errorf("writeBlock() did not pass block %d to committed channel", insertBlock.Height)
+			}
 
-			if !reflect.DeepEqual(tt.want, got) {
-				t.Error("want", tt.want.blockId, "but got", got.blockId)
+			if _, ok := <-committedChan; ok {
+				t.Error("writeBlock() did not close committed channel")
 			}
 		})
 	}
 }
 
-// TODO fix test to test default case. It's hard to test default case
 func TestIndexer_writeTx(t *testing.T) {
 	type fields struct {
-		db       Database
-		doneChan chan struct{}
+		db     Database
+		cancel bool
 	}
 	type args struct {
 		txs chan *txResult
@@ -550,18 +577,16 @@ func TestIndexer_writeTx(t *testing.T) {
 		{
 			name: "Success",
 			fields: fields{
-				db:       newMockPostgres(nil),
-				doneChan: nil,
+				cancel: false,
 			},
 			args: args{
 				txs: make(chan *txResult),
 			},
 		},
 		{
-			name: "Done Case",
+			name: "Drains After Cancel",
 			fields: fields{
-				db:       newMockPostgres(nil),
-				doneChan: make(chan struct{}),
+				cancel: true,
 			},
 			args: args{
 				txs: make(chan *txResult),
@@ -570,16 +595,27 @@ func TestIndexer_writeTx(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			doneSeed := make(chan struct{})
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			var inserted, calls int
 			idxr := &Indexer{
-				db:       tt.fields.db,
-				doneChan: tt.fields.doneChan,
+				db: newMockPostgres(&mockPostgres{
+					insertTxsFunc: func(blockId int, txs []*utxo.Tx) error {
+						for _, tx := range txs {
+							if tx.Hash != tx.TxID {
+								t.Errorf("writeTx() hash = %s, want %s", tx.Hash, tx.TxID)
+							}
+						}
+						inserted += len(txs)
+						calls++
+						return nil
+					},
+				}),
+				ctx:    ctx,
+				cancel: cancel,
 			}
 
-			tx := &utxo.Tx{Hash: "test123", TxID: "test123"}
-
-			go func() { tt.args.txs <- &txResult{tx: tx}; close(doneSeed) }()
-
 			var wg sync.WaitGroup
 			wg.Add(1)
 			go func() {
@@ -587,24 +623,586 @@ func TestIndexer_writeTx(t *testing.T) {
 				wg.Done()
 			}()
 
-			// test done channel if it is not nil
-			if idxr.doneChan != nil {
-				close(idxr.doneChan)
-				tt.args.txs <- &txResult{tx: tx}
-				timeout := doneTimeout(&wg, 2)
+			// transactions queued after cancel must still be written
+			if tt.fields.cancel {
+				cancel()
+			}
 
-				select {
-				case to := <-timeout:
-					if to {
-						t.Error("Closing done channel did not kill process before timeout")
+			block := &pendingBlock{height: 1}
+			block.wg.Add(2)
+			tt.args.txs <- &txResult{txs: []*utxo.Tx{{TxID: "test123"}}, block: block}
+			tt.args.txs <- &txResult{txs: []*utxo.Tx{{Hash: "test456", TxID: "test456"}, {TxID: "test789"}}, block: block}
+			close(tt.args.txs)
+
+			if <-doneTimeout(&wg, 2) {
+				t.Fatal("writeTx did not return after channel was closed")
+			}
+
+			if inserted != 3 || calls != 2 {
+				t.Errorf("writeTx() inserted %d txs in %d calls, want %d in %d", inserted, calls, 3, 2)
+			}
+
+			if !block.committed() {
+				t.Error("writeTx() did not mark block as committed")
+			}
+		})
+	}
+}
+
+func TestIndexer_checkpointBlocks(t *testing.T) {
+	tests := []struct {
+		name       string
+		checkpoint int
+		failed     []bool
+		rewind     []bool
+		want       []string
+	}{
+		{
+			name:       "Success",
+			checkpoint: -1,
+			failed:     []bool{false, false, false},
+			want:       []string{"0", "1", "2"},
+		},
+		{
+			name:       "Skips Already Checkpointed",
+			checkpoint: 1,
+			failed:     []bool{false, false, false},
+			want:       []string{"2"},
+		},
+		{
+			name:       "Rewinds After Reorg",
+			checkpoint: 5,
+			failed:     []bool{false, false, false},
+			rewind:     []bool{false, true, false},
+			want:       []string{"1", "2"},
+		},
+		{
+			name:       "Stops At Failed Block",
+			checkpoint: -1,
+			failed:     []bool{false, true, false},
+			want:       []string{"0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			idxr := &Indexer{
+				db: newMockPostgres(&mockPostgres{
+					setFunc: func(key, value string) error {
+						if key != checkpointKey {
+							t.Errorf("checkpointBlocks() set key %s, want %s", key, checkpointKey)
+						}
+						got = append(got, value)
+						return nil
+					},
+				}),
+				checkpoint: tt.checkpoint,
+			}
+
+			committedChan := make(chan *pendingBlock, len(tt.failed))
+			for i, failed := range tt.failed {
+				block := &pendingBlock{height: i}
+				if tt.rewind != nil {
+					block.rewind = tt.rewind[i]
+				}
+				block.wg.Add(1)
+				if failed {
+					block.done(errors.New("insert failed"))
+				} else {
+					block.done(nil)
+				}
+				committedChan <- block
+			}
+			close(committedChan)
+
+			idxr.checkpointBlocks(committedChan)
+
+			if !reflect.DeepEqual(tt.want, got) {
+				t.Errorf("checkpointBlocks() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndexer_detectReorg(t *testing.T) {
+	// stored chain: 0-a, 1-b, 2-c, 3-d
+	stored := map[int]*utxo.Block{
+		0: &utxo.Block{BlockHeader: utxo.BlockHeader{Height: 0, Hash: "a"}},
+		1: &utxo.Block{BlockHeader: utxo.BlockHeader{Height: 1, Hash: "b", PrevHash: "a"}},
+		2: &utxo.Block{BlockHeader: utxo.BlockHeader{Height: 2, Hash: "c", PrevHash: "b"}},
+		3: &utxo.Block{BlockHeader: utxo.BlockHeader{Height: 3, Hash: "d", PrevHash: "c"}},
+	}
+	// node chain: 0-a, 1-b, 2-c', 3-d'
+	node := map[string]*utxo.Block{
+		"c'": &utxo.Block{BlockHeader: utxo.BlockHeader{Height: 2, Hash: "c'", PrevHash: "b"}},
+		"d'": &utxo.Block{BlockHeader: utxo.BlockHeader{Height: 3, Hash: "d'", PrevHash: "c'"}},
+	}
+
+	tests := []struct {
+		name         string
+		block        *utxo.Block
+		wantAncestor int
+		wantBranch   []string
+	}{
+		{
+			name:  "Extends Chain",
+			block: &utxo.Block{BlockHeader: utxo.BlockHeader{Height: 4, Hash: "e", PrevHash: "d"}},
+		},
+		{
+			name:  "Block Already Stored",
+			block: stored[3],
+		},
+		{
+			name:         "Sibling At Tip",
+			block:        &utxo.Block{BlockHeader: utxo.BlockHeader{Height: 3, Hash: "d'", PrevHash: "c"}},
+			wantAncestor: 2,
+			wantBranch:   []string{"d'"},
+		},
+		{
+			name:         "Multi Block Fork",
+			block:        &utxo.Block{BlockHeader: utxo.BlockHeader{Height: 4, Hash: "e'", PrevHash: "d'"}},
+			wantAncestor: 1,
+			wantBranch:   []string{"c'", "d'", "e'"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idxr := &Indexer{
+				db: newMockPostgres(&mockPostgres{
+					lastBlockFunc: func() (*utxo.Block, error) {
+						return stored[3], nil
+					},
+					getBlockFunc: func(val interface{}) (*utxo.Block, error) {
+						return stored[val.(int)], nil
+					},
+				}),
+				bc: newMockBlockchain(&mockBlockchain{
+					getBlocksFunc: func(val interface{}) ([]*utxo.Block, error) {
+						return []*utxo.Block{node[val.([]string)[0]]}, nil
+					},
+				}),
+			}
+
+			got, err := idxr.detectReorg(tt.block)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.wantBranch == nil {
+				if got != nil {
+					t.Errorf("detectReorg() = %+v, want nil", got)
+				}
+				return
+			}
+
+			if got == nil {
+				t.Fatal("detectReorg() = nil, want reorg")
+			}
+
+			gotBranch := []string{}
+			for _, b := range got.branch {
+				gotBranch = append(gotBranch, b.Hash)
+			}
+
+			if tt.wantAncestor != got.ancestor || !reflect.DeepEqual(tt.wantBranch, gotBranch) || got.oldTip != stored[3] {
+				t.Errorf("detectReorg() = ancestor %d branch %v, want ancestor %d branch %v", got.ancestor, gotBranch, tt.wantAncestor, tt.wantBranch)
+			}
+		})
+	}
+}
+
+func TestIndexer_watchBlockSource(t *testing.T) {
+	tests := []struct {
+		name         string
+		sourceBlocks bool
+		nodeAdvances bool
+		wantFallback bool
+	}{
+		{
+			name:         "Source Receiving Blocks",
+			sourceBlocks: true,
+			nodeAdvances: true,
+			wantFallback: false,
+		},
+		{
+			name:         "Source Silent, Node Idle",
+			sourceBlocks: false,
+			nodeAdvances: false,
+			wantFallback: false,
+		},
+		{
+			name:         "Source Silent, Node Advancing",
+			sourceBlocks: false,
+			nodeAdvances: true,
+			wantFallback: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			var mu sync.Mutex
+			height := 10
+			advances := tt.nodeAdvances
+
+			started := make(chan struct{}, 1)
+			idxr := &Indexer{
+				bc: newMockBlockchain(&mockBlockchain{
+					getChainInfoFunc: func() (*utxo.ChainInfo, error) {
+						mu.Lock()
+						defer mu.Unlock()
+						if advances {
+							height++
+						}
+						return &utxo.ChainInfo{Blocks: height}, nil
+					},
+				}),
+				fallback: &mockBlockSource{
+					connectFunc: func() error { return nil },
+					startFunc: func(chan<- interface{}, chan<- *utxo.MempoolTx, chan struct{}) {
+						started <- struct{}{}
+					},
+				},
+				fallbackTimeout: 50 * time.Millisecond,
+				ctx:             ctx,
+				cancel:          cancel,
+			}
+
+			sourceHashChan := make(chan interface{})
+			blockHashChan := make(chan interface{}, 100)
+			signalMempoolChan := make(chan struct{}, 1)
+			go idxr.watchBlockSource(sourceHashChan, blockHashChan, make(chan *utxo.MempoolTx), signalMempoolChan)
+
+			if tt.sourceBlocks {
+				go func() {
+					for i := 0; i < 20; i++ {
+						select {
+						case sourceHashChan <- []string{"hash"}:
+						case <-ctx.Done():
+							return
+						}
+						time.Sleep(10 * time.Millisecond)
 					}
-					return
+				}()
+			}
+
+			select {
+			case <-started:
+				if !tt.wantFallback {
+					t.Error("watchBlockSource() started fallback, want no fallback")
+				}
+				if <-blockHashChan == nil || len(signalMempoolChan) != 1 {
+					t.Error("watchBlockSource() did not signal resync after fallback")
+				}
+			case <-time.After(180 * time.Millisecond):
+				if tt.wantFallback {
+					t.Error("watchBlockSource() did not start fallback")
 				}
 			}
-			// without this writeTx exits before it actually can run....
-			<-doneSeed
-			close(tt.args.txs)
-			wg.Wait()
 		})
 	}
 }
+
+func TestIndexer_syncToTip(t *testing.T) {
+	tests := []struct {
+		name          string
+		signal        interface{}
+		confirmations int
+		wantRaw       bool
+	}{
+		{
+			name:    "Block Hash",
+			signal:  []string{"hash"},
+			wantRaw: false,
+		},
+		{
+			name:          "Raw Block",
+			signal:        &utxo.Block{BlockHeader: utxo.BlockHeader{Hash: "raw"}},
+			confirmations: 1,
+			wantRaw:       true,
+		},
+		{
+			name:          "Raw Block Not On Main Chain",
+			signal:        &utxo.Block{BlockHeader: utxo.BlockHeader{Hash: "raw"}},
+			confirmations: -1,
+			wantRaw:       false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			confirmations := tt.confirmations
+			idxr := &Indexer{
+				bc: newMockBlockchain(&mockBlockchain{
+					getBlockHeaderFunc: func(hash string) (*utxo.BlockHeaderVerbose, error) {
+						return &utxo.BlockHeaderVerbose{
+							BlockHeader:   utxo.BlockHeader{Hash: hash, Height: 9, Chainwork: "work"},
+							Confirmations: confirmations,
+						}, nil
+					},
+				}),
+				db: newMockPostgres(&mockPostgres{
+					lastBlockFunc: func() (*utxo.Block, error) {
+						return &utxo.Block{BlockHeader: utxo.BlockHeader{Height: 8}}, nil
+					},
+				}),
+				ctx:    ctx,
+				cancel: cancel,
+			}
+
+			blockChan := make(chan *utxo.Block)
+			blockHashChan := make(chan interface{}, 1)
+			go idxr.syncToTip(blockChan, blockHashChan)
+
+			blockHashChan <- tt.signal
+
+			if b := <-blockChan; b.Height != 8 || b.Hash != "" {
+				t.Errorf("syncToTip() = %+v, want block 8 from node", b.BlockHeader)
+			}
+
+			b := <-blockChan
+			if b.Height != 9 {
+				t.Errorf("syncToTip() height = %d, want 9", b.Height)
+			}
+
+			if gotRaw := b.Hash == "raw"; gotRaw != tt.wantRaw {
+				t.Errorf("syncToTip() used raw block = %v, want %v", gotRaw, tt.wantRaw)
+			}
+
+			if tt.wantRaw && b.Chainwork != "work" {
+				t.Error("syncToTip() did not complete raw block from header")
+			}
+		})
+	}
+}
+
+func TestIndexer_getMempoolTxs(t *testing.T) {
+	tests := []struct {
+		name      string
+		mTx       *utxo.MempoolTx
+		wantCalls int
+	}{
+		{
+			name:      "Tx Hash",
+			mTx:       &utxo.MempoolTx{Hash: "hash"},
+			wantCalls: 1,
+		},
+		{
+			name:      "Raw Tx",
+			mTx:       &utxo.MempoolTx{Hash: "hash", Tx: &utxo.Tx{TxID: "hash"}},
+			wantCalls: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			calls := 0
+			idxr := &Indexer{
+				bc: newMockBlockchain(&mockBlockchain{
+					getRawTransactionsFunc: func(txids []string) ([]*utxo.Tx, error) {
+						calls++
+						return []*utxo.Tx{{TxID: txids[0]}}, nil
+					},
+				}),
+				ctx:    ctx,
+				cancel: cancel,
+			}
+
+			txResultChan := make(chan *txResult)
+			mempoolTxChan := make(chan *utxo.MempoolTx, 1)
+			go idxr.getMempoolTxs(txResultChan, mempoolTxChan)
+
+			mempoolTxChan <- tt.mTx
+
+			r := <-txResultChan
+			if len(r.txs) != 1 || r.txs[0].TxID != "hash" || r.blockId != -1 {
+				t.Errorf("getMempoolTxs() = %+v, want mempool tx hash", r)
+			}
+
+			if calls != tt.wantCalls {
+				t.Errorf("getMempoolTxs() rpc calls = %d, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestIndexer_bulkWriteBlock(t *testing.T) {
+	tests := []struct {
+		name          string
+		resumeHeight  int
+		bulkErr       error
+		wantBulk      []int
+		wantInserted  []int
+		wantForwarded []int
+		wantCommitted []int
+	}{
+		{
+			name:          "Bulk Until Tip",
+			wantBulk:      []int{0, 1, 2, 3, 4, 5, 6},
+			wantInserted:  []int{},
+			wantForwarded: []int{7, 8, 9, 10},
+			wantCommitted: []int{6},
+		},
+		{
+			name:          "Conflict Writes Individually",
+			bulkErr:       postgres.ErrBulkConflict,
+			wantBulk:      []int{0, 1, 2, 3, 4, 5, 6},
+			wantInserted:  []int{0, 1, 2, 3, 4, 5, 6},
+			wantForwarded: []int{7, 8, 9, 10},
+			wantCommitted: []int{6},
+		},
+		{
+			name:          "Resume Writes Individually",
+			resumeHeight:  2,
+			wantBulk:      []int{3, 4, 5, 6},
+			wantInserted:  []int{0, 1, 2},
+			wantForwarded: []int{7, 8, 9, 10},
+			wantCommitted: []int{0, 1, 2, 6},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			bulk := []int{}
+			inserted := []int{}
+			dropped, created := 0, 0
+			bulkErr := tt.bulkErr
+
+			idxr := &Indexer{
+				bc: newMockBlockchain(&mockBlockchain{
+					getChainInfoFunc: func() (*utxo.ChainInfo, error) {
+						return &utxo.ChainInfo{Blocks: 10}, nil
+					},
+				}),
+				db: newMockPostgres(&mockPostgres{
+					insertBulkFunc: func(blocks []*utxo.Block) error {
+						for _, b := range blocks {
+							bulk = append(bulk, b.Height)
+						}
+						return bulkErr
+					},
+					insertBlockFunc: func(b *utxo.Block, recover bool) (int, error) {
+						inserted = append(inserted, b.Height)
+						return b.Height, nil
+					},
+					dropIndexesFunc: func() error {
+						dropped++
+						return nil
+					},
+					createIdxFunc: func() error {
+						created++
+						return nil
+					},
+				}),
+				bulkTip:      3,
+				resumeHeight: tt.resumeHeight,
+				ctx:          ctx,
+				cancel:       cancel,
+			}
+
+			orderedBlockChan := make(chan *utxo.Block, 11)
+			for i := 0; i <= 10; i++ {
+				orderedBlockChan <- &utxo.Block{BlockHeader: utxo.BlockHeader{Height: i}, Txs: []utxo.Tx{{TxID: "tx"}}}
+			}
+			close(orderedBlockChan)
+
+			blockChan := make(chan *utxo.Block)
+			committedChan := make(chan *pendingBlock, 11)
+			go idxr.bulkWriteBlock(blockChan, committedChan, orderedBlockChan)
+
+			forwarded := []int{}
+			for b := range blockChan {
+				forwarded = append(forwarded, b.Height)
+			}
+			close(committedChan)
+
+			committed := []int{}
+			for b := range committedChan {
+				committed = append(committed, b.height)
+			}
+
+			if !reflect.DeepEqual(bulk, tt.wantBulk) {
+				t.Errorf("bulkWriteBlock() bulk loaded = %v, want %v", bulk, tt.wantBulk)
+			}
+			if !reflect.DeepEqual(inserted, tt.wantInserted) {
+				t.Errorf("bulkWriteBlock() inserted = %v, want %v", inserted, tt.wantInserted)
+			}
+			if !reflect.DeepEqual(forwarded, tt.wantForwarded) {
+				t.Errorf("bulkWriteBlock() forwarded = %v, want %v", forwarded, tt.wantForwarded)
+			}
+			if !reflect.DeepEqual(committed, tt.wantCommitted) {
+				t.Errorf("bulkWriteBlock() committed = %v, want %v", committed, tt.wantCommitted)
+			}
+			if dropped != 1 || created != 1 {
+				t.Errorf("bulkWriteBlock() dropped indexes %d times and created %d times, want 1", dropped, created)
+			}
+		})
+	}
+}
+
+// TestIndexer_initialSyncReplay tests that initial sync indexes mainnet genesis from a cassette of node rpc calls,
+// without a node
+func TestIndexer_initialSyncReplay(t *testing.T) {
+	rpcConfig := &config.RPC{
+		CoinRPC: config.CoinRPC{URL: "http://localhost:8332"},
+		Replay:  "../../pkg/blockchain/utxo/testdata/rpc/btc.jsonl",
+	}
+
+	var mu sync.Mutex
+	blocks := []*utxo.Block{}
+	txs := []*utxo.Tx{}
+
+	db := newMockPostgres(&mockPostgres{
+		insertBlockFunc: func(b *utxo.Block, recover bool) (int, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			blocks = append(blocks, b)
+			return 1, nil
+		},
+		insertTxsFunc: func(blockId int, t []*utxo.Tx) error {
+			mu.Lock()
+			defer mu.Unlock()
+			txs = append(txs, t...)
+			return nil
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	idxr := &Indexer{
+		coin:       "btc",
+		bc:         utxo.New(rpcConfig, "btc"),
+		db:         db,
+		rpcThreads: 1,
+		dbThreads:  1,
+		batchSize:  1,
+		startBlock: 0,
+		endBlock:   0,
+		ctx:        ctx,
+		cancel:     cancel,
+		checkpoint: -1,
+	}
+
+	idxr.initialSync()
+
+	if idxr.err != nil {
+		t.Fatal(idxr.err)
+	}
+
+	genesis := "000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f"
+	if len(blocks) != 1 || blocks[0].Hash != genesis || len(txs) != 1 || txs[0].TxID != blocks[0].MerkleRoot {
+		t.Errorf("initialSync() blocks = %+v, txs = %+v", blocks, txs)
+	}
+
+	if idxr.checkpoint != 0 {
+		t.Errorf("initialSync() checkpoint = %d, want 0", idxr.checkpoint)
+	}
+}
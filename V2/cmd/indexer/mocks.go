@@ -1,11 +1,14 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/shapeshift-legacy/coinquery/V2/pkg/blockchain/utxo"
 )
@@ -54,6 +57,14 @@ func (m *mockStatefulBlockchain) setAtHeight(h int, b *utxo.Block) {
 	m.blocksByHeight[h] = b
 }
 
+// implements indexer.Blockchain
+func (m *mockStatefulBlockchain) GetBlockHeader(hash string) (*utxo.BlockHeaderVerbose, error) {
+	if b, ok := m.blocksByHash[hash]; ok {
+		return &utxo.BlockHeaderVerbose{BlockHeader: b.BlockHeader}, nil
+	}
+	return nil, errors.New(fmt.Sprintf("No block for hash: %s", hash))
+}
+
 // implements indexer.Blockchain
 func (m *mockStatefulBlockchain) GetChainInfo() (*utxo.ChainInfo, error) {
 	return &utxo.ChainInfo{Blocks: m.currentHeight}, nil
@@ -71,6 +82,7 @@ func (m *mockStatefulBlockchain) GetRawTransactions(txids []string) ([]*utxo.Tx,
 
 type mockBlockchain struct {
 	getBlocksFunc          func(val interface{}) ([]*utxo.Block, error)
+	getBlockHeaderFunc     func(hash string) (*utxo.BlockHeaderVerbose, error)
 	getChainInfoFunc       func() (*utxo.ChainInfo, error)
 	getMempoolFunc         func() ([]string, error)
 	getRawTransactionsFunc func(txids []string) ([]*utxo.Tx, error)
@@ -91,6 +103,9 @@ func newMockBlockchain(mock *mockBlockchain) *mockBlockchain {
 		}
 		return blocks, nil
 	}
+	getBlockHeader := func(hash string) (*utxo.BlockHeaderVerbose, error) {
+		return &utxo.BlockHeaderVerbose{BlockHeader: utxo.BlockHeader{Hash: hash}}, nil
+	}
 	getChainInfo := func() (*utxo.ChainInfo, error) {
 		return &utxo.ChainInfo{Blocks: 9}, nil
 	}
@@ -109,6 +124,9 @@ func newMockBlockchain(mock *mockBlockchain) *mockBlockchain {
 		if mock.getBlocksFunc != nil {
 			getBlocks = mock.getBlocksFunc
 		}
+		if mock.getBlockHeaderFunc != nil {
+			getBlockHeader = mock.getBlockHeaderFunc
+		}
 		if mock.getChainInfoFunc != nil {
 			getChainInfo = mock.getChainInfoFunc
 		}
@@ -122,6 +140,7 @@ func newMockBlockchain(mock *mockBlockchain) *mockBlockchain {
 
 	return &mockBlockchain{
 		getBlocksFunc:          getBlocks,
+		getBlockHeaderFunc:     getBlockHeader,
 		getChainInfoFunc:       getChainInfo,
 		getMempoolFunc:         getMempool,
 		getRawTransactionsFunc: getRawTransactions,
@@ -132,6 +151,10 @@ func (m *mockBlockchain) GetBlocks(val interface{}) ([]*utxo.Block, error) {
 	return m.getBlocksFunc(val)
 }
 
+func (m *mockBlockchain) GetBlockHeader(hash string) (*utxo.BlockHeaderVerbose, error) {
+	return m.getBlockHeaderFunc(hash)
+}
+
 func (m *mockBlockchain) GetChainInfo() (*utxo.ChainInfo, error) {
 	return m.getChainInfoFunc()
 }
@@ -145,10 +168,18 @@ func (m *mockBlockchain) GetRawTransactions(txids []string) ([]*utxo.Tx, error)
 }
 
 type mockPostgres struct {
-	insertBlockFunc func(b *utxo.Block, recover bool) (int, error)
-	lastBlockFunc   func() (*utxo.Block, error)
-	getBlockFunc    func(val interface{}) (*utxo.Block, error)
-	insertTxFunc    func(tx *utxo.Tx, txIndex int, blockId int) error
+	insertBlockFunc  func(b *utxo.Block, recover bool) (int, error)
+	lastBlockFunc    func() (*utxo.Block, error)
+	getBlockFunc     func(val interface{}) (*utxo.Block, error)
+	insertTxsFunc    func(blockId int, txs []*utxo.Tx) error
+	insertBulkFunc   func(blocks []*utxo.Block) error
+	dropIndexesFunc  func() error
+	createIdxFunc    func() error
+	orphanBlocksFunc func(height int) (int, error)
+	getFunc          func(key string) (string, error)
+	setFunc          func(key, value string) error
+	acquireLockFunc  func(ctx context.Context, interval time.Duration) error
+	lockLost         chan struct{}
 }
 
 func newMockPostgres(mock *mockPostgres) *mockPostgres {
@@ -161,9 +192,31 @@ func newMockPostgres(mock *mockPostgres) *mockPostgres {
 	getBlock := func(val interface{}) (*utxo.Block, error) {
 		return &utxo.Block{BlockHeader: utxo.BlockHeader{Height: 69}}, nil
 	}
-	insertTx := func(tx *utxo.Tx, txIndex int, blockId int) error {
+	insertTxs := func(blockId int, txs []*utxo.Tx) error {
+		return nil
+	}
+	insertBulk := func(blocks []*utxo.Block) error {
+		return nil
+	}
+	dropIndexes := func() error {
+		return nil
+	}
+	createIndexes := func() error {
+		return nil
+	}
+	orphanBlocks := func(height int) (int, error) {
+		return 0, nil
+	}
+	get := func(key string) (string, error) {
+		return "", fmt.Errorf("no value for key: %s", key)
+	}
+	set := func(key, value string) error {
 		return nil
 	}
+	acquireLock := func(ctx context.Context, interval time.Duration) error {
+		return nil
+	}
+	var lockLost chan struct{}
 
 	if mock != nil {
 		if mock.insertBlockFunc != nil {
@@ -175,31 +228,316 @@ func newMockPostgres(mock *mockPostgres) *mockPostgres {
 		if mock.getBlockFunc != nil {
 			getBlock = mock.getBlockFunc
 		}
-		if mock.insertTxFunc != nil {
-			insertTx = mock.insertTxFunc
+		if mock.insertTxsFunc != nil {
+			insertTxs = mock.insertTxsFunc
+		}
+		if mock.insertBulkFunc != nil {
+			insertBulk = mock.insertBulkFunc
+		}
+		if mock.dropIndexesFunc != nil {
+			dropIndexes = mock.dropIndexesFunc
+		}
+		if mock.createIdxFunc != nil {
+			createIndexes = mock.createIdxFunc
+		}
+		if mock.orphanBlocksFunc != nil {
+			orphanBlocks = mock.orphanBlocksFunc
+		}
+		if mock.getFunc != nil {
+			get = mock.getFunc
 		}
+		if mock.setFunc != nil {
+			set = mock.setFunc
+		}
+		if mock.acquireLockFunc != nil {
+			acquireLock = mock.acquireLockFunc
+		}
+		lockLost = mock.lockLost
 	}
 
 	return &mockPostgres{
-		insertBlockFunc: insertBlock,
-		lastBlockFunc:   lastBlock,
-		getBlockFunc:    getBlock,
-		insertTxFunc:    insertTx,
+		insertBlockFunc:  insertBlock,
+		lastBlockFunc:    lastBlock,
+		getBlockFunc:     getBlock,
+		insertTxsFunc:    insertTxs,
+		insertBulkFunc:   insertBulk,
+		dropIndexesFunc:  dropIndexes,
+		createIdxFunc:    createIndexes,
+		orphanBlocksFunc: orphanBlocks,
+		getFunc:          get,
+		setFunc:          set,
+		acquireLockFunc:  acquireLock,
+		lockLost:         lockLost,
 	}
 }
 
 func (m *mockPostgres) InsertBlock(b *utxo.Block, recover bool) (int, error) {
 	return m.insertBlockFunc(b, recover)
 }
-func (m *mockPostgres) LastBlock() (*utxo.Block, error) {
+func (m *mockPostgres) LastBlock(ctx context.Context) (*utxo.Block, error) {
 	return m.lastBlockFunc()
 }
-func (m *mockPostgres) GetBlock(val interface{}) (*utxo.Block, error) {
+func (m *mockPostgres) GetBlock(ctx context.Context, val interface{}) (*utxo.Block, error) {
 	return m.getBlockFunc(val)
 }
-func (m *mockPostgres) InsertTx(tx *utxo.Tx, txIndex int, blockId int) error {
-	return m.insertTxFunc(tx, txIndex, blockId)
+func (m *mockPostgres) InsertTxs(blockId int, txs []*utxo.Tx) error {
+	return m.insertTxsFunc(blockId, txs)
+}
+func (m *mockPostgres) InsertBlocksBulk(blocks []*utxo.Block) error {
+	return m.insertBulkFunc(blocks)
+}
+func (m *mockPostgres) DropIndexes() error {
+	return m.dropIndexesFunc()
+}
+func (m *mockPostgres) CreateIndexes() error {
+	return m.createIdxFunc()
+}
+func (m *mockPostgres) OrphanBlocks(height int) (int, error) {
+	return m.orphanBlocksFunc(height)
+}
+func (m *mockPostgres) Get(ctx context.Context, key string) (string, error) {
+	return m.getFunc(key)
+}
+func (m *mockPostgres) Set(key, value string) error {
+	return m.setFunc(key, value)
+}
+func (m *mockPostgres) AcquireLock(ctx context.Context, interval time.Duration) error {
+	return m.acquireLockFunc(ctx, interval)
+}
+func (m *mockPostgres) LockLost() <-chan struct{} {
+	return m.lockLost
 }
 func (m *mockPostgres) Close() error {
 	return nil
 }
+
+type mockBlockSource struct {
+	connectFunc func() error
+	startFunc   func(blockHashChan chan<- interface{}, mempoolTxChan chan<- *utxo.MempoolTx, signalMempoolChan chan struct{})
+}
+
+func (m *mockBlockSource) Connect() error {
+	return m.connectFunc()
+}
+func (m *mockBlockSource) Start(blockHashChan chan<- interface{}, mempoolTxChan chan<- *utxo.MempoolTx, signalMempoolChan chan struct{}) {
+	m.startFunc(blockHashChan, mempoolTxChan, signalMempoolChan)
+}
+
+// Mock database implementation keeping blocks and transactions in memory, orphaning blocks like the db does.
+// Useful in end-to-end tests against a fake node.
+type mockStatefulPostgres struct {
+	mu      sync.Mutex
+	blocks  []*utxo.Block // in insert order, the block id is the index + 1
+	orphans map[int]bool  // orphaned block ids
+	txs     map[int][]*utxo.Tx
+	mempool []*utxo.Tx
+	meta    map[string]string
+}
+
+func newMockStatefulPostgres() *mockStatefulPostgres {
+	return &mockStatefulPostgres{
+		orphans: make(map[int]bool),
+		txs:     make(map[int][]*utxo.Tx),
+		meta:    make(map[string]string),
+	}
+}
+
+// chain returns the non orphaned blocks by height
+func (m *mockStatefulPostgres) chain() map[int]*utxo.Block {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	chain := make(map[int]*utxo.Block)
+	for i, b := range m.blocks {
+		if !m.orphans[i+1] {
+			chain[b.Height] = b
+		}
+	}
+
+	return chain
+}
+
+// blockTxs returns the transactions inserted for the block with hash
+func (m *mockStatefulPostgres) blockTxs(hash string) []*utxo.Tx {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, b := range m.blocks {
+		if b.Hash == hash {
+			return m.txs[i+1]
+		}
+	}
+
+	return nil
+}
+
+// mempoolTx reports if the mempool transaction txid was inserted
+func (m *mockStatefulPostgres) mempoolTx(txid string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, tx := range m.mempool {
+		if tx.TxID == txid {
+			return true
+		}
+	}
+
+	return false
+}
+
+// orphaned returns the number of orphaned blocks
+func (m *mockStatefulPostgres) orphaned() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.orphans)
+}
+
+func (m *mockStatefulPostgres) InsertBlock(b *utxo.Block, recover bool) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// like block_insert, a block is inserted once and orphans any other block at its height
+	id := 0
+	for i, stored := range m.blocks {
+		if stored.Height != b.Height {
+			continue
+		}
+
+		if stored.Hash == b.Hash {
+			id = i + 1
+			delete(m.orphans, id)
+		} else {
+			m.orphans[i+1] = true
+		}
+	}
+
+	if id == 0 {
+		m.blocks = append(m.blocks, b)
+		id = len(m.blocks)
+	}
+
+	return id, nil
+}
+func (m *mockStatefulPostgres) LastBlock(ctx context.Context) (*utxo.Block, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var last *utxo.Block
+	for i, b := range m.blocks {
+		if !m.orphans[i+1] && (last == nil || b.Height > last.Height) {
+			last = b
+		}
+	}
+
+	return last, nil
+}
+func (m *mockStatefulPostgres) GetBlock(ctx context.Context, val interface{}) (*utxo.Block, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, b := range m.blocks {
+		switch v := val.(type) {
+		case int:
+			if !m.orphans[i+1] && b.Height == v {
+				return b, nil
+			}
+		case string:
+			if b.Hash == v {
+				return b, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("no block for val: %v", val)
+}
+func (m *mockStatefulPostgres) InsertTxs(blockId int, txs []*utxo.Tx) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if blockId == -1 {
+		m.mempool = append(m.mempool, txs...)
+		return nil
+	}
+
+	// transactions of a block written again are only inserted once
+	for _, tx := range txs {
+		inserted := false
+		for _, stored := range m.txs[blockId] {
+			inserted = inserted || stored.TxID == tx.TxID
+		}
+
+		if !inserted {
+			m.txs[blockId] = append(m.txs[blockId], tx)
+		}
+	}
+
+	return nil
+}
+func (m *mockStatefulPostgres) InsertBlocksBulk(blocks []*utxo.Block) error {
+	for _, b := range blocks {
+		id, err := m.InsertBlock(b, false)
+		if err != nil {
+			return err
+		}
+
+		txs := make([]*utxo.Tx, len(b.Txs))
+		for i := range b.Txs {
+			txs[i] = &b.Txs[i]
+		}
+
+		if err := m.InsertTxs(id, txs); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+func (m *mockStatefulPostgres) DropIndexes() error {
+	return nil
+}
+func (m *mockStatefulPostgres) CreateIndexes() error {
+	return nil
+}
+func (m *mockStatefulPostgres) OrphanBlocks(height int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count := 0
+	for i, b := range m.blocks {
+		if !m.orphans[i+1] && b.Height >= height {
+			m.orphans[i+1] = true
+			count++
+		}
+	}
+
+	return count, nil
+}
+func (m *mockStatefulPostgres) Get(ctx context.Context, key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	value, ok := m.meta[key]
+	if !ok {
+		return "", fmt.Errorf("no value for key: %s", key)
+	}
+
+	return value, nil
+}
+func (m *mockStatefulPostgres) Set(key, value string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.meta[key] = value
+
+	return nil
+}
+func (m *mockStatefulPostgres) AcquireLock(ctx context.Context, interval time.Duration) error {
+	return nil
+}
+func (m *mockStatefulPostgres) LockLost() <-chan struct{} {
+	return nil
+}
+func (m *mockStatefulPostgres) Close() error {
+	return nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/blockchain/utxo"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/postgres"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/storage"
+)
+
+// phaseStandby is reported by the admin api while waiting for the schema lock
+const phaseStandby = "standby"
+
+// lockInterval is how often a standby tries to take the schema lock, and how often the leader checks it still holds it
+const lockInterval = time.Second
+
+// maxWarmTxs bounds the mempool transactions held by a standby. Once exceeded the mempool is processed in full on takeover.
+const maxWarmTxs = 100000
+
+// warmer consumes a feed while the indexer is standing by, holding mempool transactions to write on takeover
+type warmer struct {
+	txs      map[string]*utxo.MempoolTx
+	overflow bool // transactions were dropped once maxWarmTxs was reached
+	blocks   bool // a block was received, so the tip needs syncing on takeover
+	stopChan chan struct{}
+	done     chan struct{}
+}
+
+// standby starts the block source and waits for the schema lock before the indexer writes anything. While waiting,
+// the source is consumed by a warmer so that a takeover doesn't need to reconnect or process the mempool from scratch.
+// Once the lock is held, the indexer fails if it is lost.
+func (idxr *Indexer) standby() (*feed, *warmer) {
+	idxr.setPhase(phaseStandby)
+
+	var f *feed
+	var w *warmer
+
+	if idxr.syncTip && !idxr.recover {
+		var err error
+		if f, err = idxr.startSource(); err != nil {
+			idxr.fail(err)
+			return nil, nil
+		}
+
+		w = idxr.warm(f)
+	}
+
+	locker, ok := idxr.db.(storage.Locker)
+	if !ok {
+		idxr.fail(errors.New("storage backend doesn't support leader election"))
+		return f, w
+	}
+
+	idxr.logger.Info("main", "standing by for schema lock")
+
+	if err := locker.AcquireLock(idxr.ctx, lockInterval); err != nil {
+		if idxr.ctx.Err() == nil {
+			idxr.fail(err)
+		}
+
+		return f, w
+	}
+
+	idxr.logger.Info("main", "acquired schema lock, taking over")
+
+	go func() {
+		select {
+		case <-locker.LockLost():
+			idxr.fail(postgres.ErrNotLeader)
+		case <-idxr.ctx.Done():
+		}
+	}()
+
+	return f, w
+}
+
+// warm consumes f until replay is called
+func (idxr *Indexer) warm(f *feed) *warmer {
+	w := &warmer{
+		txs:      make(map[string]*utxo.MempoolTx),
+		stopChan: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	go func() {
+		defer close(w.done)
+
+		for {
+			select {
+			case <-f.blockHashChan:
+				w.blocks = true
+			case mTx := <-f.mempoolTxChan:
+				if len(w.txs) < maxWarmTxs {
+					w.txs[mTx.Hash] = mTx
+				} else {
+					w.overflow = true
+				}
+			case <-w.stopChan:
+				return
+			case <-idxr.ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return w
+}
+
+// replay stops consuming f and sends the held transactions, and a tip sync if a block was received, back into f
+// to be processed once staySynced starts consuming it
+func (w *warmer) replay(ctx context.Context, f *feed) {
+	close(w.stopChan)
+	<-w.done
+
+	go func() {
+		if w.blocks {
+			select {
+			case f.blockHashChan <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		if w.overflow {
+			select {
+			case f.signalMempoolChan <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		for _, mTx := range w.txs {
+			select {
+			case f.mempoolTxChan <- mTx:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
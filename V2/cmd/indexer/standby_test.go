@@ -0,0 +1,140 @@
+// +build unit
+
+package main
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/blockchain/utxo"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/postgres"
+)
+
+func TestIndexer_standby(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	lockChan := make(chan struct{})
+	lockLost := make(chan struct{})
+
+	idxr := &Indexer{
+		rpcThreads: 1,
+		syncTip:    true,
+		bc:         newMockBlockchain(nil),
+		db: newMockPostgres(&mockPostgres{
+			acquireLockFunc: func(ctx context.Context, interval time.Duration) error {
+				select {
+				case <-lockChan:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			},
+			lockLost: lockLost,
+		}),
+		source: &mockBlockSource{
+			connectFunc: func() error { return nil },
+			startFunc: func(blockHashChan chan<- interface{}, mempoolTxChan chan<- *utxo.MempoolTx, signalMempoolChan chan struct{}) {
+				go func() {
+					mempoolTxChan <- &utxo.MempoolTx{Hash: "4"}
+					blockHashChan <- []string{"hash"}
+				}()
+			},
+		},
+		ctx:        ctx,
+		cancel:     cancel,
+		checkpoint: -1,
+	}
+
+	type result struct {
+		f *feed
+		w *warmer
+	}
+
+	standby := make(chan result)
+	go func() {
+		f, w := idxr.standby()
+		standby <- result{f, w}
+	}()
+
+	select {
+	case <-standby:
+		t.Fatal("standby() returned before acquiring the lock")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if got := idxr.status().Phase; got != phaseStandby {
+		t.Errorf("standby() phase = %s, want %s", got, phaseStandby)
+	}
+
+	close(lockChan)
+	r := <-standby
+
+	r.w.replay(ctx, r.f)
+
+	select {
+	case v := <-r.f.blockHashChan:
+		if _, ok := v.(struct{}); !ok {
+			t.Errorf("replay() block = %v, want tip sync signal", v)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("replay() didn't signal a tip sync")
+	}
+
+	got := []string{}
+	for len(got) < 4 {
+		select {
+		case mTx := <-r.f.mempoolTxChan:
+			got = append(got, mTx.Hash)
+		case <-time.After(time.Second):
+			t.Fatalf("replay() txs = %v, want 4", got)
+		}
+	}
+
+	sort.Strings(got)
+	if want := []string{"1", "2", "3", "4"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("replay() txs = %v, want %v", got, want)
+	}
+
+	close(lockLost)
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("indexer not stopped after losing lock")
+	}
+
+	if errors.Cause(idxr.err) != postgres.ErrNotLeader {
+		t.Errorf("indexer err = %v, want %v", idxr.err, postgres.ErrNotLeader)
+	}
+}
+
+func TestIndexer_standbyCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	idxr := &Indexer{
+		db: newMockPostgres(&mockPostgres{
+			acquireLockFunc: func(ctx context.Context, interval time.Duration) error {
+				<-ctx.Done()
+				return ctx.Err()
+			},
+		}),
+		ctx:        ctx,
+		cancel:     cancel,
+		checkpoint: -1,
+	}
+
+	go cancel()
+
+	if f, w := idxr.standby(); f != nil || w != nil {
+		t.Errorf("standby() = %v, %v, want no feed without syncTip", f, w)
+	}
+
+	if idxr.err != nil {
+		t.Errorf("standby() err = %v, want nil on shutdown", idxr.err)
+	}
+}
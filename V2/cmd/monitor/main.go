@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -14,9 +15,11 @@ import (
 	"github.com/go-chi/render"
 	"github.com/shapeshift-legacy/coinquery/V2/config"
 	"github.com/shapeshift-legacy/coinquery/V2/internal/log"
+	"github.com/shapeshift-legacy/coinquery/V2/internal/metrics"
 	"github.com/shapeshift-legacy/coinquery/V2/internal/middleware"
 	"github.com/shapeshift-legacy/coinquery/V2/pkg/blockchain/utxo"
-	"github.com/shapeshift-legacy/coinquery/V2/pkg/postgres"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/storage"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/storage/backend"
 )
 
 var (
@@ -28,7 +31,7 @@ var port = 8000
 var monitorInterval = 30 * time.Second
 
 type monitor struct {
-	db *postgres.Database
+	db storage.Store
 	bc *utxo.Blockchain
 }
 
@@ -48,7 +51,7 @@ func newMonitor() *monitor {
 		log.Fatal(err, "main")
 	}
 
-	dbConn, err := postgres.New(dbConfig, *coin)
+	dbConn, err := backend.New(dbConfig, *coin)
 	if err != nil {
 		log.Fatal(err, "main")
 	}
@@ -94,6 +97,7 @@ func main() {
 		render.SetContentType(render.ContentTypeJSON), // set content-type headers as application/json
 
 		middleware.Logger,                    // log api request calls
+		middleware.Metrics,                   // record request latency by route
 		chiMiddleware.DefaultCompress,        // compress results, mostly gzipping assets and json
 		chiMiddleware.Recoverer,              // recover from panics without crashing server
 		chiMiddleware.Timeout(3*time.Second), // Stop processing after 3 seconds
@@ -102,6 +106,9 @@ func main() {
 	// Healthcheck endpoint
 	r.Get("/ping", func(w http.ResponseWriter, r *http.Request) { render.JSON(w, r, "pong") })
 
+	// Prometheus scrape endpoint
+	r.Method("GET", "/metrics", metrics.Handler())
+
 	r.Route("/monitor", func(r chi.Router) {
 		r.Route("/{coin}", func(r chi.Router) {
 			r.Route("/notify", func(r chi.Router) {
@@ -134,7 +141,7 @@ func (m *monitor) newBlock(w http.ResponseWriter, r *http.Request) {
 }
 
 func (m *monitor) compareHeights() {
-	lb, err := m.db.LastBlock()
+	lb, err := m.db.LastBlock(context.Background())
 	if err != nil {
 		log.Warn(err, "main", "failed to compare heights")
 		return
@@ -153,7 +160,7 @@ func (m *monitor) compareHeights() {
 }
 
 func (m *monitor) handleOrphans() {
-	value, err := m.db.Get("orphanCount")
+	value, err := m.db.Get(context.Background(), "orphanCount")
 	if err != nil {
 		log.Warn(err, "main", "failed to handle orphans")
 		return
@@ -165,7 +172,7 @@ func (m *monitor) handleOrphans() {
 		return
 	}
 
-	count, err := m.db.GetOrphanCount()
+	count, err := m.db.GetOrphanCount(context.Background())
 	if err != nil {
 		log.Warn(err, "main", "failed to handle orphans")
 		return
@@ -1,8 +1,8 @@
 package main
 
 import (
+	"context"
 	"flag"
-	"fmt"
 	"strconv"
 	"sync"
 	"time"
@@ -10,7 +10,8 @@ import (
 	"github.com/shapeshift-legacy/coinquery/V2/config"
 	"github.com/shapeshift-legacy/coinquery/V2/internal/log"
 	"github.com/shapeshift-legacy/coinquery/V2/pkg/blockchain/utxo"
-	"github.com/shapeshift-legacy/coinquery/V2/pkg/postgres"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/storage"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/storage/backend"
 )
 
 var (
@@ -23,7 +24,7 @@ var (
 
 type txValidator struct {
 	bc        *utxo.Blockchain
-	db        *postgres.Database
+	db        storage.Store
 	dbThreads int
 	mempool   map[string]struct{}
 	rwm       sync.RWMutex
@@ -45,7 +46,7 @@ func newTxValidator() *txValidator {
 		log.Fatal(err, "main")
 	}
 
-	dbConn, err := postgres.New(dbConfig, *coin)
+	dbConn, err := backend.New(dbConfig, *coin)
 	if err != nil {
 		log.Fatal(err, "main")
 	}
@@ -91,7 +92,7 @@ func main() {
 
 	log.Infof("main", "mempool size: %d", len(v.mempool))
 
-	value, err := v.db.Get("validatedTransaction")
+	value, err := v.db.Get(context.Background(), "validatedTransaction")
 	if err != nil {
 		log.Warn(err, "main", "failed to get last validated transaction, starting from 0")
 		value = "0"
@@ -104,9 +105,7 @@ func main() {
 		log.Fatal(err, "main", "failed to convert id")
 	}
 
-	limit := fmt.Sprintf("AND id >= %d", id)
-
-	txs, err := v.db.GetPendingTxs(limit)
+	txs, err := v.db.GetPendingTxs(context.Background(), storage.TxFilter{FromID: id})
 	if err != nil {
 		log.Warn(err, "main", "failed to get pending transactions")
 	}
@@ -158,7 +157,7 @@ func main() {
 	dwg.Wait()
 
 	// transaction id from a block numDays ago
-	id, err = v.db.GetTxAtBlockTime(time.Now().AddDate(0, 0, numDays))
+	id, err = v.db.GetTxAtBlockTime(context.Background(), time.Now().AddDate(0, 0, numDays))
 	if err != nil {
 		log.Warnf(err, "main", "failed to get next highest validated tx, using previous")
 		return
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shapeshift-legacy/coinquery/V2/config"
+	"github.com/shapeshift-legacy/coinquery/V2/internal/log"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/postgres"
+)
+
+var (
+	conf  = flag.String("config", "./config/local.json", "path to configuration json file")
+	coin  = flag.String("coin", "btc", "coin to backfill")
+	name  = flag.String("job", "", "backfill to run: addresses (address_transaction) or spends (output spending columns)")
+	batch = flag.Int("batch", 10000, "number of transaction ids indexed per statement")
+	from  = flag.Int("from", 0, "transaction id to start from, 0 to resume from the last checkpoint")
+)
+
+// job indexes the rows of a range of transaction ids written before a table or column existed
+type job struct {
+	checkpointKey string // holds the last transaction id indexed, so an interrupted backfill resumes where it stopped
+	doneKey       string // set to true once every transaction has been indexed, if readers wait for the backfill
+	index         func(db *postgres.Database, fromID, toID int) (int, error)
+}
+
+var jobs = map[string]job{
+	"addresses": {checkpointKey: "addressTransactionBackfill", index: (*postgres.Database).IndexAddresses},
+	"spends":    {checkpointKey: "outputSpendingBackfill", doneKey: postgres.SpendsIndexedKey, index: (*postgres.Database).IndexSpends},
+}
+
+// Fills tables and columns for transactions written before they existed. The indexer can keep running, new
+// transactions are indexed as they are inserted and indexing a transaction twice is harmless.
+func main() {
+	flag.Parse()
+
+	log.Initialize("coinquery-backfill", *coin)
+
+	j, ok := jobs[*name]
+	if !ok {
+		log.Fatal(errors.Errorf("unknown job: %q", *name), "main")
+	}
+
+	c, err := config.Get(*conf)
+	if err != nil {
+		log.Fatal(err, "main")
+	}
+
+	cc, err := c.GetCoin(*coin)
+	if err != nil {
+		log.Fatal(err, "main")
+	}
+
+	dbConfig, err := c.GetDBConfig(config.ReadWrite, cc)
+	if err != nil {
+		log.Fatal(err, "main")
+	}
+
+	db, err := postgres.New(dbConfig, *coin)
+	if err != nil {
+		log.Fatal(err, "main")
+	}
+	defer db.Close()
+
+	start := *from
+	if start == 0 {
+		if start, err = resume(db, j.checkpointKey); err != nil {
+			log.Fatal(err, "main")
+		}
+	}
+
+	end, err := db.MaxTxID(context.Background())
+	if err != nil {
+		log.Fatal(err, "main")
+	}
+
+	log.Infof("main", "backfilling %s of transactions %d to %d", *name, start, end)
+
+	began := time.Now()
+	rows := 0
+	for id := start; id <= end; id += *batch {
+		last := id + *batch - 1
+		if last > end {
+			last = end
+		}
+
+		n, err := j.index(db, id, last)
+		if err != nil {
+			log.Fatal(err, "main")
+		}
+
+		if err := db.Set(j.checkpointKey, strconv.Itoa(last)); err != nil {
+			log.Fatal(err, "main")
+		}
+
+		rows += n
+		log.Infof("main", "indexed transactions %d to %d (%.2f%%), %d rows", id, last, float64(last)/float64(end)*100, rows)
+	}
+
+	// a run from a later transaction id may have skipped unindexed ones
+	if j.doneKey != "" && *from <= 1 {
+		if err := db.Set(j.doneKey, "true"); err != nil {
+			log.Fatal(err, "main")
+		}
+	}
+
+	log.Infof("main", "backfill of %s complete: %d rows in %s", *name, rows, time.Since(began))
+}
+
+// resume returns the transaction id after the checkpoint at key, or 1 if there is none
+func resume(db *postgres.Database, key string) (int, error) {
+	value, err := db.Get(context.Background(), key)
+	if errors.Cause(err) == sql.ErrNoRows {
+		return 1, nil
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	last, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid checkpoint: %s", value)
+	}
+
+	return last + 1, nil
+}
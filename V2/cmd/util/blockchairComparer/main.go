@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"encoding/csv"
 	"flag"
 	"fmt"
@@ -80,12 +81,12 @@ func main() {
 		wg.Add(1)
 		go func(vout_txid, vin_txid string) {
 			defer wg.Done()
-			_, err := dbConn.GetTxByTxID(vout_txid)
+			_, err := dbConn.GetTxByTxID(context.Background(), vout_txid)
 			if err != nil {
 				fmt.Printf("\t - %s in blockchair csv wasn't found in our database\n", vout_txid)
 			}
 			if vin_txid != "" {
-				_, err = dbConn.GetTxByTxID(vin_txid)
+				_, err = dbConn.GetTxByTxID(context.Background(), vin_txid)
 				if err != nil {
 					fmt.Printf("\t - %s in blockchair csv wasn't found in our database\n", vin_txid)
 				}
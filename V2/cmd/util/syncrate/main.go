@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log"
 	_ "net/http/pprof"
@@ -46,7 +47,7 @@ func main() {
 	for {
 		time.Sleep(waitSec * time.Second)
 
-		txCount, err := dbConn.GetNumTransactions()
+		txCount, err := dbConn.GetNumTransactions(context.Background())
 		if err != nil {
 			log.Fatalf("%+v\n", err)
 		}
@@ -13,6 +13,13 @@ type Config struct {
 	DB    BaseDB  `json:"db"`
 	RPC   BaseRPC `json:"rpc"`
 	Coins []Coin  `json:"coins"`
+	API   API     `json:"api"`
+}
+
+// API type definition for api configuration
+type API struct {
+	MaxAddresses int `json:"maxAddresses"` // per request to the multi address endpoints, defaults to 50
+	XpubGap      int `json:"xpubGap"`      // unused addresses in a row ending the scan of an xpub, defaults to 20
 }
 
 // Coin type definition for coin rpc and zmq config variables
@@ -20,6 +27,7 @@ type Coin struct {
 	Name string  `json:"name"`
 	RPC  CoinRPC `json:"rpc"`
 	ZMQ  ZMQ     `json:"zmq"`
+	Sync Sync    `json:"sync"`
 	DB   CoinDB  `json:"db"`
 }
 
@@ -37,18 +45,24 @@ type BaseDB struct {
 	Threads         int   `json:"threads"`
 	Retry           Retry `json:"retry"`
 	Timeout         int64 `json:"timeout"` // in seconds
+
+	MaxReplicaLag        int   `json:"maxReplicaLag"`        // in blocks behind readwrite before a replica is excluded from reads
+	ReplicaCheckInterval int64 `json:"replicaCheckInterval"` // in seconds
 }
 
 // CoinDB type definition for coin db endpoints
 type CoinDB struct {
-	ReadOnly  string `json:"readonly"`
-	ReadWrite string `json:"readwrite"`
+	ReadOnly  string   `json:"readonly"`
+	ReadWrite string   `json:"readwrite"`
+	Replicas  []string `json:"replicas"` // readonly endpoints to spread reads across, lag is measured against readwrite
 }
 
 // RPC type definition to group BaseRPC and CoinRPC config variables
 type RPC struct {
 	BaseRPC
 	CoinRPC
+	Record string // cassette to record rpc calls to, empty to disable
+	Replay string // cassette to serve rpc calls from instead of the node, empty to disable
 }
 
 // BaseRPC type definition for base rpc configuration
@@ -78,6 +92,14 @@ type ZMQ struct {
 	Subscriptions []string `json:"subs"`
 }
 
+// Sync type definition for the block source used to stay synced with the node
+type Sync struct {
+	Source          string `json:"source"`          // zmq (default) or poll
+	PollInterval    int64  `json:"pollInterval"`    // in seconds
+	FallbackTimeout int64  `json:"fallbackTimeout"` // in seconds, fall back from zmq to polling if no block is received while the node advances
+	BlocksDir       string `json:"blocksDir"`       // node blocks directory to read initial sync blocks from instead of rpc
+}
+
 // Get returns all config variables from the config specified by the path arguement
 func Get(path string) (*Config, error) {
 	if _, err := os.Stat(path); os.IsNotExist(err) {
@@ -120,9 +142,11 @@ func (a DatabaseType) String() string {
 func (c *Config) GetDBConfig(db DatabaseType, cc *Coin) (*DB, error) {
 	switch db {
 	case ReadOnly:
+		// with replicas, readwrite is only connected to as the reference for replica lag
 		return &DB{
 			URI:    cc.DB.ReadOnly,
 			BaseDB: c.DB,
+			CoinDB: CoinDB{ReadWrite: cc.DB.ReadWrite, Replicas: cc.DB.Replicas},
 		}, nil
 	case ReadWrite:
 		return &DB{
@@ -0,0 +1,499 @@
+// Package fakenode simulates a utxo coin node in process for end-to-end tests. A Node has a programmable chain built on
+// top of btc mainnet genesis, serves the JSON-RPC calls coinquery makes over HTTP and publishes hashblock, hashtx,
+// rawblock and rawtx notifications over a local ZMQ socket, so the indexer, monitor, txvalidator and api can be tested
+// against chain events such as deep reorgs without running a regtest node.
+package fakenode
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/pkg/errors"
+	"github.com/shapeshift-legacy/coinquery/V2/config"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/blockchain/utxo"
+)
+
+// Coin is the coin simulated by a Node
+const Coin = "btc"
+
+const (
+	blockReward   = 50 * btcutil.SatoshiPerBitcoin
+	txFee         = 1000
+	blockInterval = 10 * time.Minute
+	blockVersion  = 0x20000000
+	blockBits     = 0x1d00ffff  // minimum difficulty, same as genesis
+	blockWork     = 0x100010001 // expected hashes to mine a block at blockBits
+)
+
+// payScript is the pay to pubkey hash script all coinbase and mempool transaction outputs pay to
+var payScript, _ = hex.DecodeString("76a91462e907b15cbf27d5425399ebf6f0fb50ebb88f1888ac")
+
+// block is a block known to the node, on the main chain or on a stale branch
+type block struct {
+	msg    *wire.MsgBlock
+	hash   chainhash.Hash
+	height int
+	raw    []byte
+}
+
+// Node is an in process utxo node. Blocks are only mined when requested and transactions are not script validated,
+// but inputs must spend outputs of the main chain or mempool that are not already spent.
+type Node struct {
+	decoder *utxo.RawDecoder
+	server  *httptest.Server
+	pub     *publisher
+
+	mu         sync.Mutex                // guards the fields below
+	blocks     map[chainhash.Hash]*block // all blocks, including those of stale branches
+	chain      []*block                  // main chain by height
+	mempool    []*wire.MsgTx             // in order of acceptance
+	extraNonce int64                     // makes every mined block and coinbase unique
+}
+
+// New starts a node with only the genesis block. The node must be closed once done.
+func New() (*Node, error) {
+	decoder, err := utxo.NewRawDecoder(Coin)
+	if err != nil {
+		return nil, err
+	}
+
+	genesis, err := newBlock(chaincfg.MainNetParams.GenesisBlock, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	pub, err := newPublisher()
+	if err != nil {
+		return nil, err
+	}
+
+	n := &Node{
+		decoder: decoder,
+		pub:     pub,
+		blocks:  map[chainhash.Hash]*block{genesis.hash: genesis},
+		chain:   []*block{genesis},
+	}
+
+	n.server = httptest.NewServer(n)
+
+	return n, nil
+}
+
+// Close stops serving rpc calls and closes the notification socket
+func (n *Node) Close() error {
+	n.server.Close()
+
+	return n.pub.close()
+}
+
+// URL returns the url rpc calls are served on
+func (n *Node) URL() string {
+	return n.server.URL
+}
+
+// ZMQURL returns the url notifications are published on
+func (n *Node) ZMQURL() string {
+	return n.pub.url
+}
+
+// Config returns the coin configuration of the node, subscribed to hashblock and hashtx and polling every second
+func (n *Node) Config() *config.Coin {
+	return &config.Coin{
+		Name: Coin,
+		RPC:  config.CoinRPC{URL: n.URL()},
+		ZMQ: config.ZMQ{
+			Timeout:       10,
+			SubURL:        n.ZMQURL(),
+			Subscriptions: []string{"hashblock", "hashtx"},
+		},
+		Sync: config.Sync{PollInterval: 1},
+	}
+}
+
+// RPCConfig returns the rpc configuration of the node
+func (n *Node) RPCConfig() *config.RPC {
+	return &config.RPC{
+		BaseRPC: config.BaseRPC{Threads: 4, Timeout: 10},
+		CoinRPC: config.CoinRPC{URL: n.URL()},
+	}
+}
+
+// WaitSubscribed waits until a subscriber to topic has connected to the notification socket. Notifications published
+// before a subscriber has connected are never received, so tests should wait before changing the chain.
+func (n *Node) WaitSubscribed(topic string, timeout time.Duration) error {
+	return n.pub.waitSubscribed(topic, timeout)
+}
+
+// Height returns the height of the main chain tip
+func (n *Node) Height() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return len(n.chain) - 1
+}
+
+// BlockHash returns the hash of the main chain block at height, or an empty string if there is none
+func (n *Node) BlockHash(height int) string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if height < 0 || height >= len(n.chain) {
+		return ""
+	}
+
+	return n.chain[height].hash.String()
+}
+
+// Mempool returns the txids of the mempool in order of acceptance
+func (n *Node) Mempool() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	txids := make([]string, len(n.mempool))
+	for i, tx := range n.mempool {
+		txids[i] = tx.TxHash().String()
+	}
+
+	return txids
+}
+
+// Mine mines count blocks on top of the main chain tip and returns their hashes. The first block includes all
+// mempool transactions.
+func (n *Node) Mine(count int) []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.mine(count)
+}
+
+// Reorg replaces the last depth blocks of the main chain with count new blocks and returns their hashes. count must be
+// greater than depth for the new branch to have more work. Transactions of the replaced blocks return to the mempool
+// unless they spend outputs no longer on the main chain, and are included in the first new block.
+func (n *Node) Reorg(depth, count int) ([]string, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if depth < 1 || depth >= len(n.chain) {
+		return nil, errors.Errorf("invalid reorg depth %d at height %d", depth, len(n.chain)-1)
+	}
+
+	if count <= depth {
+		return nil, errors.Errorf("branch of %d blocks has no more work than the %d blocks it replaces", count, depth)
+	}
+
+	disconnected := n.chain[len(n.chain)-depth:]
+	n.chain = n.chain[:len(n.chain)-depth]
+
+	txs := []*wire.MsgTx{}
+	for _, b := range disconnected {
+		txs = append(txs, b.msg.Transactions[1:]...)
+	}
+
+	// transactions are accepted again in order, dropping any whose inputs were disconnected
+	pool := append(txs, n.mempool...)
+	n.mempool = nil
+
+	for _, tx := range pool {
+		if err := n.validate(tx); err == nil {
+			n.mempool = append(n.mempool, tx)
+		}
+	}
+
+	return n.mine(count), nil
+}
+
+// NewTx returns a transaction spending the oldest coinbase output of the main chain that is not spent by the chain
+// or the mempool. The same output is spent until the transaction is added to the mempool.
+func (n *Node) NewTx() (*wire.MsgTx, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	unspent := n.unspent()
+
+	for _, b := range n.chain[1:] {
+		prev := wire.OutPoint{Hash: b.msg.Transactions[0].TxHash(), Index: 0}
+		if _, ok := unspent[prev]; !ok {
+			continue
+		}
+
+		tx := wire.NewMsgTx(wire.TxVersion)
+		tx.AddTxIn(wire.NewTxIn(&prev, []byte{txscript.OP_TRUE}, nil))
+		tx.AddTxOut(wire.NewTxOut(blockReward-txFee, payScript))
+
+		return tx, nil
+	}
+
+	return nil, errors.New("no unspent coinbase output, mine a block first")
+}
+
+// AddTx adds tx to the mempool and returns its txid
+func (n *Node) AddTx(tx *wire.MsgTx) (string, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if err := n.accept(tx); err != nil {
+		return "", err
+	}
+
+	return tx.TxHash().String(), nil
+}
+
+// DropTx removes a transaction from the mempool without mining it, as if it was evicted or double spent.
+// Reports if the transaction was in the mempool.
+func (n *Node) DropTx(txid string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for i, tx := range n.mempool {
+		if tx.TxHash().String() == txid {
+			n.mempool = append(n.mempool[:i], n.mempool[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// mine mines count blocks, publishing a notification for each block and its transactions
+func (n *Node) mine(count int) []string {
+	hashes := make([]string, 0, count)
+
+	for i := 0; i < count; i++ {
+		prev := n.chain[len(n.chain)-1]
+		height := prev.height + 1
+
+		n.extraNonce++
+
+		sigScript, _ := txscript.NewScriptBuilder().AddInt64(int64(height)).AddInt64(n.extraNonce).Script()
+
+		coinbase := wire.NewMsgTx(wire.TxVersion)
+		coinbase.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{}, wire.MaxPrevOutIndex), sigScript, nil))
+		coinbase.AddTxOut(wire.NewTxOut(blockReward, payScript))
+
+		txs := append([]*wire.MsgTx{coinbase}, n.mempool...)
+		n.mempool = nil
+
+		msg := &wire.MsgBlock{
+			Header: wire.BlockHeader{
+				Version:    blockVersion,
+				PrevBlock:  prev.hash,
+				MerkleRoot: merkleRoot(txs),
+				Timestamp:  prev.msg.Header.Timestamp.Add(blockInterval),
+				Bits:       blockBits,
+				Nonce:      uint32(n.extraNonce),
+			},
+			Transactions: txs,
+		}
+
+		// serializing a block only fails on writer errors, which a buffer never returns
+		b, _ := newBlock(msg, height)
+
+		n.blocks[b.hash] = b
+		n.chain = append(n.chain, b)
+
+		for _, tx := range txs {
+			n.pub.publishTx(tx)
+		}
+		n.pub.publishBlock(b)
+
+		hashes = append(hashes, b.hash.String())
+	}
+
+	return hashes
+}
+
+// accept validates tx and adds it to the mempool, publishing a notification
+func (n *Node) accept(tx *wire.MsgTx) error {
+	if err := n.validate(tx); err != nil {
+		return err
+	}
+
+	n.mempool = append(n.mempool, tx)
+	n.pub.publishTx(tx)
+
+	return nil
+}
+
+// validate checks that tx is not known yet and only spends unspent outputs of the main chain or mempool
+func (n *Node) validate(tx *wire.MsgTx) error {
+	txid := tx.TxHash()
+
+	if _, _, ok := n.findTx(txid); ok {
+		for _, mtx := range n.mempool {
+			if mtx.TxHash() == txid {
+				return rpcError(errVerifyRejected, "txn-already-in-mempool")
+			}
+		}
+
+		return rpcError(errVerifyAlreadyInChain, "Transaction already in block chain")
+	}
+
+	if len(tx.TxIn) == 0 || len(tx.TxOut) == 0 {
+		return rpcError(errVerifyRejected, "bad-txns-vin-empty")
+	}
+
+	unspent := n.unspent()
+	spent := map[wire.OutPoint]struct{}{}
+
+	for _, in := range tx.TxIn {
+		_, ok := unspent[in.PreviousOutPoint]
+		if _, double := spent[in.PreviousOutPoint]; !ok || double {
+			return rpcError(errVerifyError, "bad-txns-inputs-missingorspent")
+		}
+
+		spent[in.PreviousOutPoint] = struct{}{}
+	}
+
+	return nil
+}
+
+// unspent returns the outputs of the main chain and mempool that are not spent
+func (n *Node) unspent() map[wire.OutPoint]struct{} {
+	unspent := map[wire.OutPoint]struct{}{}
+
+	add := func(tx *wire.MsgTx) {
+		for _, in := range tx.TxIn {
+			delete(unspent, in.PreviousOutPoint)
+		}
+
+		txid := tx.TxHash()
+		for i := range tx.TxOut {
+			unspent[wire.OutPoint{Hash: txid, Index: uint32(i)}] = struct{}{}
+		}
+	}
+
+	// the genesis coinbase can't be spent
+	for _, b := range n.chain[1:] {
+		for _, tx := range b.msg.Transactions {
+			add(tx)
+		}
+	}
+
+	for _, tx := range n.mempool {
+		add(tx)
+	}
+
+	return unspent
+}
+
+// findTx returns a transaction of the mempool or main chain with the block it was mined in, nil if in the mempool
+func (n *Node) findTx(txid chainhash.Hash) (*wire.MsgTx, *block, bool) {
+	for _, tx := range n.mempool {
+		if tx.TxHash() == txid {
+			return tx, nil, true
+		}
+	}
+
+	for _, b := range n.chain {
+		for _, tx := range b.msg.Transactions {
+			if tx.TxHash() == txid {
+				return tx, b, true
+			}
+		}
+	}
+
+	return nil, nil, false
+}
+
+// onMainChain reports if b is a block of the main chain
+func (n *Node) onMainChain(b *block) bool {
+	return b.height < len(n.chain) && n.chain[b.height] == b
+}
+
+// confirmations returns the number of blocks on top of and including b, -1 if b is not on the main chain
+func (n *Node) confirmations(b *block) int {
+	if !n.onMainChain(b) {
+		return -1
+	}
+
+	return len(n.chain) - b.height
+}
+
+// verboseBlock returns b in the format of getblock with verbosity 2
+func (n *Node) verboseBlock(b *block) (*utxo.Block, error) {
+	v, err := n.decoder.DecodeBlock(b.raw)
+	if err != nil {
+		return nil, err
+	}
+
+	v.Height = b.height
+	v.MedianTime = n.medianTime(b)
+	v.Difficulty = "1"
+	v.Chainwork = fmt.Sprintf("%064x", new(big.Int).Mul(big.NewInt(int64(b.height+1)), big.NewInt(blockWork)))
+
+	if b.height == 0 {
+		v.PrevHash = ""
+	}
+
+	if n.onMainChain(b) && b.height+1 < len(n.chain) {
+		v.NextHash = n.chain[b.height+1].hash.String()
+	}
+
+	return v, nil
+}
+
+// medianTime returns the median time of b and up to 10 blocks before it
+func (n *Node) medianTime(b *block) int {
+	times := []int{}
+	for i := 0; b != nil && i < 11; i++ {
+		times = append(times, int(b.msg.Header.Timestamp.Unix()))
+		b = n.blocks[b.msg.Header.PrevBlock]
+	}
+
+	sort.Ints(times)
+
+	return times[len(times)/2]
+}
+
+// newBlock returns the block of msg at height
+func newBlock(msg *wire.MsgBlock, height int) (*block, error) {
+	var buf bytes.Buffer
+	if err := msg.Serialize(&buf); err != nil {
+		return nil, errors.Wrap(err, "failed to serialize block")
+	}
+
+	return &block{
+		msg:    msg,
+		hash:   msg.BlockHash(),
+		height: height,
+		raw:    buf.Bytes(),
+	}, nil
+}
+
+// merkleRoot returns the merkle root of the txids of txs
+func merkleRoot(txs []*wire.MsgTx) chainhash.Hash {
+	hashes := make([]chainhash.Hash, len(txs))
+	for i, tx := range txs {
+		hashes[i] = tx.TxHash()
+	}
+
+	for len(hashes) > 1 {
+		if len(hashes)%2 == 1 {
+			hashes = append(hashes, hashes[len(hashes)-1])
+		}
+
+		next := make([]chainhash.Hash, 0, len(hashes)/2)
+		for i := 0; i < len(hashes); i += 2 {
+			var pair [chainhash.HashSize * 2]byte
+			copy(pair[:chainhash.HashSize], hashes[i][:])
+			copy(pair[chainhash.HashSize:], hashes[i+1][:])
+
+			next = append(next, chainhash.DoubleHashH(pair[:]))
+		}
+
+		hashes = next
+	}
+
+	return hashes[0]
+}
@@ -0,0 +1,297 @@
+// +build unit
+
+package fakenode
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/blockchain/utxo"
+)
+
+const genesisHash = "000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f"
+
+func newNode(t *testing.T) (*Node, *utxo.Blockchain) {
+	n, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return n, utxo.New(n.RPCConfig(), Coin)
+}
+
+func TestNode_Mine(t *testing.T) {
+	n, bc := newNode(t)
+	defer n.Close()
+
+	hashes := n.Mine(3)
+
+	info, err := bc.GetChainInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Blocks != 3 || info.BestBlockHash != hashes[2] || n.Height() != 3 {
+		t.Errorf("GetChainInfo() = %+v, want height 3 and best block %s", info, hashes[2])
+	}
+
+	blocks, err := bc.GetBlocks([]int{0, 1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if blocks[0].Hash != genesisHash || blocks[0].PrevHash != "" || blocks[0].Txs[0].TxID != blocks[0].MerkleRoot {
+		t.Errorf("GetBlocks() genesis = %+v", blocks[0])
+	}
+
+	for i, b := range blocks {
+		if b.Height != i || b.Hash != n.BlockHash(i) {
+			t.Errorf("GetBlocks() block %d = %s at %d, want %s", i, b.Hash, b.Height, n.BlockHash(i))
+		}
+		if i > 0 && (b.PrevHash != blocks[i-1].Hash || b.Time != blocks[i-1].Time+600) {
+			t.Errorf("GetBlocks() block %d prev = %s at %d", i, b.PrevHash, b.Time)
+		}
+		if i < 3 && b.NextHash != blocks[i+1].Hash {
+			t.Errorf("GetBlocks() block %d next = %s, want %s", i, b.NextHash, blocks[i+1].Hash)
+		}
+		if i > 0 && (len(b.Txs) != 1 || b.Txs[0].Vins[0].Coinbase == "" || b.Txs[0].TxID != b.MerkleRoot) {
+			t.Errorf("GetBlocks() block %d txs = %+v", i, b.Txs)
+		}
+	}
+
+	if blocks[2].Chainwork != "0000000000000000000000000000000000000000000000000000000300030003" || blocks[2].Difficulty != "1" {
+		t.Errorf("GetBlocks() chainwork = %s, difficulty = %s", blocks[2].Chainwork, blocks[2].Difficulty)
+	}
+
+	if addrs := blocks[1].Txs[0].Vouts[0].ScriptPubKey.Addresses; len(addrs) != 1 || blocks[1].Txs[0].Vouts[0].Value != "50.00000000" {
+		t.Errorf("GetBlocks() coinbase vout = %+v", blocks[1].Txs[0].Vouts[0])
+	}
+
+	// doge gets verbose blocks from getblock with txids and getrawtransaction
+	doge, err := utxo.New(n.RPCConfig(), "doge").GetBlocks([]string{hashes[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(doge[0], blocks[1]) {
+		t.Errorf("GetBlocksVerboseDoge() = %+v, want %+v", doge[0], blocks[1])
+	}
+
+	if _, err := bc.GetBlockHashes([]int{4}); err == nil || !strings.Contains(err.Error(), "-8: Block height out of range") {
+		t.Errorf("GetBlockHashes() error = %v", err)
+	}
+
+	if _, err := bc.GetBlocks([]string{strings.Repeat("0", 63) + "1"}); err == nil || !strings.Contains(err.Error(), "-5: Block not found") {
+		t.Errorf("GetBlocks() error = %v", err)
+	}
+}
+
+func TestNode_mempool(t *testing.T) {
+	n, bc := newNode(t)
+	defer n.Close()
+
+	if _, err := n.NewTx(); err == nil {
+		t.Error("NewTx() without a spendable output error = nil")
+	}
+
+	n.Mine(3)
+
+	tx, err := n.NewTx()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	added, err := n.AddTx(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := n.AddTx(tx); err == nil {
+		t.Error("AddTx() of a mempool tx error = nil")
+	}
+
+	tx, err = n.NewTx()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := tx.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	sent, err := bc.SendRawTransaction(hex.EncodeToString(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := bc.SendRawTransaction(hex.EncodeToString(buf.Bytes())); err == nil || !strings.Contains(err.Error(), "-26") {
+		t.Errorf("SendRawTransaction() of a mempool tx error = %v", err)
+	}
+
+	mempool, err := bc.GetMempool()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(mempool, []string{added, sent}) {
+		t.Errorf("GetMempool() = %v, want %v", mempool, []string{added, sent})
+	}
+
+	txs, err := bc.GetRawTransactions(mempool)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if txs[0].TxID != added || txs[1].TxID != sent || txs[1].Hex != hex.EncodeToString(buf.Bytes()) {
+		t.Errorf("GetRawTransactions() = %+v", txs)
+	}
+
+	if !n.DropTx(sent) || n.DropTx(sent) {
+		t.Error("DropTx() of a mempool tx more than once")
+	}
+
+	hashes := n.Mine(1)
+
+	blocks, err := bc.GetBlocks(hashes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(blocks[0].Txs) != 2 || blocks[0].Txs[1].TxID != added || len(n.Mempool()) != 0 {
+		t.Errorf("Mine() txs = %+v, mempool = %v", blocks[0].Txs, n.Mempool())
+	}
+
+	if _, err := n.AddTx(tx); err != nil {
+		t.Errorf("AddTx() of a dropped tx error = %v", err)
+	}
+
+	if _, err := bc.GetRawTransactions([]string{added}); err != nil {
+		t.Errorf("GetRawTransactions() of a mined tx error = %v", err)
+	}
+
+	if _, err := bc.SendRawTransaction("00"); err == nil || !strings.Contains(err.Error(), "-22") {
+		t.Errorf("SendRawTransaction() of an invalid tx error = %v", err)
+	}
+}
+
+func TestNode_Reorg(t *testing.T) {
+	n, bc := newNode(t)
+	defer n.Close()
+
+	n.Mine(10)
+
+	// spends the coinbase of block 1, which stays on the main chain
+	kept, err := n.NewTx()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keptID, err := n.AddTx(kept)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old := n.Mine(2)
+
+	// spends the coinbase of block 2, which stays on the main chain, and is only in the mempool
+	pending, err := n.NewTx()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pendingID, err := n.AddTx(pending)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := n.Reorg(13, 14); err == nil {
+		t.Error("Reorg() of genesis error = nil")
+	}
+
+	if _, err := n.Reorg(6, 6); err == nil {
+		t.Error("Reorg() to a branch with the same work error = nil")
+	}
+
+	branch, err := n.Reorg(6, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n.Height() != 13 || n.BlockHash(13) != branch[6] || n.BlockHash(7) != branch[0] {
+		t.Errorf("Reorg() height = %d", n.Height())
+	}
+
+	header, err := bc.GetBlockHeader(old[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if header.Confirmations != -1 || header.Height != 11 || header.NextHash != "" {
+		t.Errorf("GetBlockHeader() of a stale block = %+v", header)
+	}
+
+	header, err = bc.GetBlockHeader(branch[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if header.Confirmations != 7 || header.NextHash != branch[1] {
+		t.Errorf("GetBlockHeader() of a branch block = %+v", header)
+	}
+
+	blocks, err := bc.GetBlocks([]string{branch[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txids := []string{}
+	for _, tx := range blocks[0].Txs[1:] {
+		txids = append(txids, tx.TxID)
+	}
+
+	if !reflect.DeepEqual(txids, []string{keptID, pendingID}) {
+		t.Errorf("Reorg() first branch block txs = %v, want %v", txids, []string{keptID, pendingID})
+	}
+
+	tips, err := bc.GetChainTips()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*utxo.ChainTip{
+		{Height: 13, Hash: branch[6], Branchlen: "0", Status: "active"},
+		{Height: 12, Hash: old[1], Branchlen: "6", Status: "valid-fork"},
+	}
+
+	if !reflect.DeepEqual(tips, want) {
+		t.Errorf("GetChainTips() = %+v, want %+v", tips, want)
+	}
+
+	// a transaction spending the coinbase of block 3 can't return to the mempool once block 3 is replaced
+	n.Mine(1)
+
+	orphaned, err := n.NewTx()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := n.AddTx(orphaned); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := n.Reorg(12, 13); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(n.Mempool()) != 0 {
+		t.Errorf("Reorg() mempool = %v, want empty", n.Mempool())
+	}
+
+	if _, err := bc.GetRawTransactions([]string{orphaned.TxHash().String()}); err == nil {
+		t.Error("GetRawTransactions() of a dropped tx error = nil")
+	}
+}
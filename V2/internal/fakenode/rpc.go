@@ -0,0 +1,387 @@
+package fakenode
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/blockchain/utxo"
+	rpc "github.com/shapeshift-legacy/coinquery/V2/pkg/http"
+)
+
+// rpc error codes of the node
+const (
+	errMisc                 = -1
+	errInvalidAddressOrKey  = -5
+	errInvalidParameter     = -8
+	errDeserialization      = -22
+	errVerifyError          = -25
+	errVerifyRejected       = -26
+	errVerifyAlreadyInChain = -27
+	errInvalidParams        = -32602
+	errMethodNotFound       = -32601
+	errParse                = -32700
+)
+
+// request is a JSON-RPC request
+type request struct {
+	ID     json.RawMessage   `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+// response is a JSON-RPC response
+type response struct {
+	Result interface{}     `json:"result"`
+	Error  *rpc.Status     `json:"error"`
+	ID     json.RawMessage `json:"id"`
+}
+
+// handler serves a rpc method, called with the node locked
+type handler func(n *Node, params []json.RawMessage) (interface{}, error)
+
+var handlers = map[string]handler{
+	"getbestblockhash":   getBestBlockHash,
+	"getblock":           getBlock,
+	"getblockchaininfo":  getBlockchainInfo,
+	"getblockcount":      getBlockCount,
+	"getblockhash":       getBlockHash,
+	"getblockheader":     getBlockHeader,
+	"getchaintips":       getChainTips,
+	"getnetworkinfo":     getNetworkInfo,
+	"getrawmempool":      getRawMempool,
+	"getrawtransaction":  getRawTransaction,
+	"sendrawtransaction": sendRawTransaction,
+}
+
+// rpcError returns a rpc error with code
+func rpcError(code int, message string) *rpc.Status {
+	return &rpc.Status{Code: code, Message: message}
+}
+
+// ServeHTTP serves single and batch JSON-RPC requests. Like the node, a failed single call is answered with status
+// 500 while batches are always answered with status 200.
+func (n *Node) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	body = bytes.TrimSpace(body)
+	batch := len(body) > 0 && body[0] == '['
+
+	reqs := []*request{}
+	if batch {
+		err = json.Unmarshal(body, &reqs)
+	} else {
+		reqs = append(reqs, &request{})
+		err = json.Unmarshal(body, reqs[0])
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(&response{Error: rpcError(errParse, "Parse error")})
+		return
+	}
+
+	responses := make([]*response, len(reqs))
+	for i, req := range reqs {
+		responses[i] = n.call(req)
+	}
+
+	if batch {
+		json.NewEncoder(w).Encode(responses)
+		return
+	}
+
+	if responses[0].Error != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+
+	json.NewEncoder(w).Encode(responses[0])
+}
+
+// call serves a single rpc call
+func (n *Node) call(req *request) *response {
+	res := &response{ID: req.ID}
+
+	h, ok := handlers[req.Method]
+	if !ok {
+		res.Error = rpcError(errMethodNotFound, "Method not found")
+		return res
+	}
+
+	n.mu.Lock()
+	result, err := h(n, req.Params)
+	n.mu.Unlock()
+
+	if err != nil {
+		status, ok := err.(*rpc.Status)
+		if !ok {
+			status = rpcError(errMisc, err.Error())
+		}
+
+		res.Error = status
+		return res
+	}
+
+	res.Result = result
+
+	return res
+}
+
+// param decodes the param at i into v, leaving v as is if the param is missing
+func param(params []json.RawMessage, i int, v interface{}) error {
+	if i >= len(params) {
+		return nil
+	}
+
+	if err := json.Unmarshal(params[i], v); err != nil {
+		return rpcError(errInvalidParams, "Invalid params")
+	}
+
+	return nil
+}
+
+// verbosity decodes the verbosity param at i, which is a bool or a number, defaulting to def
+func verbosity(params []json.RawMessage, i int, def int) (int, error) {
+	var v interface{}
+	if err := param(params, i, &v); err != nil {
+		return 0, err
+	}
+
+	switch t := v.(type) {
+	case nil:
+		return def, nil
+	case bool:
+		if t {
+			return 1, nil
+		}
+		return 0, nil
+	case float64:
+		return int(t), nil
+	default:
+		return 0, rpcError(errInvalidParams, "Invalid params")
+	}
+}
+
+// hashParam decodes the hash param at i
+func hashParam(params []json.RawMessage, i int) (*chainhash.Hash, error) {
+	var s string
+	if err := param(params, i, &s); err != nil {
+		return nil, err
+	}
+
+	h, err := chainhash.NewHashFromStr(s)
+	if err != nil || len(s) != chainhash.MaxHashStringSize {
+		return nil, rpcError(errInvalidParameter, "hash must be of length 64")
+	}
+
+	return h, nil
+}
+
+// findBlock returns the block of the hash param at i
+func (n *Node) findBlock(params []json.RawMessage, i int) (*block, error) {
+	h, err := hashParam(params, i)
+	if err != nil {
+		return nil, err
+	}
+
+	b, ok := n.blocks[*h]
+	if !ok {
+		return nil, rpcError(errInvalidAddressOrKey, "Block not found")
+	}
+
+	return b, nil
+}
+
+func getBestBlockHash(n *Node, params []json.RawMessage) (interface{}, error) {
+	return n.chain[len(n.chain)-1].hash.String(), nil
+}
+
+func getBlockCount(n *Node, params []json.RawMessage) (interface{}, error) {
+	return len(n.chain) - 1, nil
+}
+
+func getBlockchainInfo(n *Node, params []json.RawMessage) (interface{}, error) {
+	return &utxo.BlockchainInfo{
+		Chain:         "main",
+		Blocks:        len(n.chain) - 1,
+		Headers:       len(n.chain) - 1,
+		BestBlockHash: n.chain[len(n.chain)-1].hash.String(),
+		Difficulty:    "1",
+	}, nil
+}
+
+func getNetworkInfo(n *Node, params []json.RawMessage) (interface{}, error) {
+	return &utxo.NetworkInfo{
+		Version:         "210000",
+		Subversion:      "/Satoshi:0.21.0/",
+		ProtocolVersion: "70016",
+	}, nil
+}
+
+func getBlockHash(n *Node, params []json.RawMessage) (interface{}, error) {
+	height := -1
+	if err := param(params, 0, &height); err != nil {
+		return nil, err
+	}
+
+	if height < 0 || height >= len(n.chain) {
+		return nil, rpcError(errInvalidParameter, "Block height out of range")
+	}
+
+	return n.chain[height].hash.String(), nil
+}
+
+func getBlock(n *Node, params []json.RawMessage) (interface{}, error) {
+	b, err := n.findBlock(params, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := verbosity(params, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	if v == 0 {
+		return hex.EncodeToString(b.raw), nil
+	}
+
+	block, err := n.verboseBlock(b)
+	if err != nil {
+		return nil, err
+	}
+
+	if v >= 2 {
+		return block, nil
+	}
+
+	normal := &utxo.BlockNormal{BlockHeader: block.BlockHeader, Txs: make([]string, len(block.Txs))}
+	for i, tx := range block.Txs {
+		normal.Txs[i] = tx.TxID
+	}
+
+	return normal, nil
+}
+
+func getBlockHeader(n *Node, params []json.RawMessage) (interface{}, error) {
+	b, err := n.findBlock(params, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	verbose := true
+	if err := param(params, 1, &verbose); err != nil {
+		return nil, err
+	}
+
+	if !verbose {
+		return hex.EncodeToString(b.raw[:wire.MaxBlockHeaderPayload]), nil
+	}
+
+	block, err := n.verboseBlock(b)
+	if err != nil {
+		return nil, err
+	}
+
+	return &utxo.BlockHeaderVerbose{BlockHeader: block.BlockHeader, Confirmations: n.confirmations(b)}, nil
+}
+
+// getChainTips returns the main chain tip and the tip of each stale branch
+func getChainTips(n *Node, params []json.RawMessage) (interface{}, error) {
+	tip := n.chain[len(n.chain)-1]
+
+	tips := []*utxo.ChainTip{{Height: tip.height, Hash: tip.hash.String(), Branchlen: "0", Status: "active"}}
+
+	parents := map[chainhash.Hash]struct{}{}
+	for _, b := range n.blocks {
+		parents[b.msg.Header.PrevBlock] = struct{}{}
+	}
+
+	for hash, b := range n.blocks {
+		if _, ok := parents[hash]; ok || n.onMainChain(b) {
+			continue
+		}
+
+		fork := b
+		for !n.onMainChain(fork) {
+			fork = n.blocks[fork.msg.Header.PrevBlock]
+		}
+
+		branchlen := json.Number(strconv.Itoa(b.height - fork.height))
+
+		tips = append(tips, &utxo.ChainTip{Height: b.height, Hash: hash.String(), Branchlen: branchlen, Status: "valid-fork"})
+	}
+
+	return tips, nil
+}
+
+func getRawMempool(n *Node, params []json.RawMessage) (interface{}, error) {
+	txids := make([]string, len(n.mempool))
+	for i, tx := range n.mempool {
+		txids[i] = tx.TxHash().String()
+	}
+
+	return txids, nil
+}
+
+func getRawTransaction(n *Node, params []json.RawMessage) (interface{}, error) {
+	h, err := hashParam(params, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := verbosity(params, 1, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, _, ok := n.findTx(*h)
+	if !ok {
+		return nil, rpcError(errInvalidAddressOrKey, "No such mempool or blockchain transaction. Use gettransaction for wallet transactions.")
+	}
+
+	var buf bytes.Buffer
+	if err := tx.Serialize(&buf); err != nil {
+		return nil, err
+	}
+
+	if v == 0 {
+		return hex.EncodeToString(buf.Bytes()), nil
+	}
+
+	return n.decoder.DecodeTx(buf.Bytes())
+}
+
+func sendRawTransaction(n *Node, params []json.RawMessage) (interface{}, error) {
+	var rawtx string
+	if err := param(params, 0, &rawtx); err != nil {
+		return nil, err
+	}
+
+	raw, err := hex.DecodeString(rawtx)
+	if err != nil {
+		return nil, rpcError(errDeserialization, "TX decode failed")
+	}
+
+	tx := &wire.MsgTx{}
+	if err := tx.Deserialize(bytes.NewReader(raw)); err != nil {
+		return nil, rpcError(errDeserialization, "TX decode failed")
+	}
+
+	if err := n.accept(tx); err != nil {
+		return nil, err
+	}
+
+	return tx.TxHash().String(), nil
+}
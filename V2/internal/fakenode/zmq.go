@@ -0,0 +1,137 @@
+package fakenode
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/pebbe/zmq4"
+	"github.com/pkg/errors"
+)
+
+// publisher publishes notifications in the format of the node, [topic, body, sequence number], on a XPUB socket so
+// that connected subscribers can be waited for
+type publisher struct {
+	url string
+
+	mu         sync.Mutex // guards the fields below, the socket is not safe for concurrent use
+	sock       *zmq4.Socket
+	seq        map[string]uint32 // next sequence number per topic
+	subscribed map[string]bool   // topics subscribed to, an empty topic subscribes to all
+}
+
+// newPublisher binds a publisher to a random local port
+func newPublisher() (*publisher, error) {
+	sock, err := zmq4.NewSocket(zmq4.XPUB)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create publish socket")
+	}
+
+	if err := sock.Bind("tcp://127.0.0.1:*"); err != nil {
+		sock.Close()
+		return nil, errors.Wrap(err, "failed to bind publish socket")
+	}
+
+	url, err := sock.GetLastEndpoint()
+	if err != nil {
+		sock.Close()
+		return nil, errors.Wrap(err, "failed to get publish socket endpoint")
+	}
+
+	return &publisher{
+		url:        url,
+		sock:       sock,
+		seq:        make(map[string]uint32),
+		subscribed: make(map[string]bool),
+	}, nil
+}
+
+// publishBlock publishes the hashblock and rawblock notifications of b
+func (p *publisher) publishBlock(b *block) {
+	p.publish("hashblock", reversed(b.hash))
+	p.publish("rawblock", b.raw)
+}
+
+// publishTx publishes the hashtx and rawtx notifications of tx
+func (p *publisher) publishTx(tx *wire.MsgTx) {
+	var buf bytes.Buffer
+	tx.Serialize(&buf)
+
+	p.publish("hashtx", reversed(tx.TxHash()))
+	p.publish("rawtx", buf.Bytes())
+}
+
+// publish sends a notification. The sequence number is used up even if sending fails, so a failed notification shows
+// up to subscribers as a sequence gap like a notification dropped by the node.
+func (p *publisher) publish(topic string, body []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	seq := make([]byte, 4)
+	binary.LittleEndian.PutUint32(seq, p.seq[topic])
+	p.seq[topic]++
+
+	p.sock.SendMessage(topic, body, seq)
+}
+
+// waitSubscribed reads subscription messages until topic is subscribed to or timeout expires
+func (p *publisher) waitSubscribed(topic string, timeout time.Duration) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	deadline := time.Now().Add(timeout)
+
+	for !p.isSubscribed(topic) {
+		if time.Now().After(deadline) {
+			return errors.Errorf("no subscriber to %s after %s", topic, timeout)
+		}
+
+		msg, err := p.sock.RecvBytes(zmq4.DONTWAIT)
+		if err != nil {
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+
+		// subscription messages are a subscribe (1) or unsubscribe (0) byte followed by the topic
+		if len(msg) > 0 {
+			p.subscribed[string(msg[1:])] = msg[0] == 1
+		}
+	}
+
+	return nil
+}
+
+// isSubscribed reports if a subscription matches topic
+func (p *publisher) isSubscribed(topic string) bool {
+	for prefix, ok := range p.subscribed {
+		if ok && strings.HasPrefix(topic, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// close closes the socket, dropping any unsent notifications
+func (p *publisher) close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.sock.SetLinger(0)
+
+	return p.sock.Close()
+}
+
+// reversed returns the bytes of hash in display order, as published by the node
+func reversed(hash chainhash.Hash) []byte {
+	b := make([]byte, chainhash.HashSize)
+	for i := range hash {
+		b[chainhash.HashSize-1-i] = hash[i]
+	}
+
+	return b
+}
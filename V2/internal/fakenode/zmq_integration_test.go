@@ -0,0 +1,90 @@
+// +build integration
+
+package fakenode
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/blockchain/utxo"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/zmq"
+)
+
+func TestNode_publish(t *testing.T) {
+	n, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	conf := n.Config()
+	conf.ZMQ.Subscriptions = []string{"hashblock", "hashtx", "rawblock"}
+
+	z := zmq.New(ctx, conf)
+	if err := z.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	blockChan := make(chan interface{})
+	txChan := make(chan *utxo.MempoolTx)
+	z.Start(blockChan, txChan, make(chan struct{}))
+
+	for _, topic := range conf.ZMQ.Subscriptions {
+		if err := n.WaitSubscribed(topic, 10*time.Second); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hashes := n.Mine(1)
+	coinbase := ""
+
+	// the coinbase notification, then hashblock and rawblock of the block in either order
+	for received := 0; received < 3; received++ {
+		select {
+		case tx := <-txChan:
+			coinbase = tx.Hash
+		case b := <-blockChan:
+			switch v := b.(type) {
+			case []string:
+				if v[0] != hashes[0] {
+					t.Errorf("hashblock = %s, want %s", v[0], hashes[0])
+				}
+			case *utxo.Block:
+				if v.Hash != hashes[0] || len(v.Txs) != 1 {
+					t.Errorf("rawblock = %+v, want %s", v, hashes[0])
+				}
+			default:
+				t.Errorf("unexpected block notification: %v", b)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("timed out waiting for notifications")
+		}
+	}
+
+	tx, err := n.NewTx()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txid, err := n.AddTx(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case mTx := <-txChan:
+		if mTx.Hash != txid || tx.TxIn[0].PreviousOutPoint.Hash.String() != coinbase {
+			t.Errorf("hashtx = %s, want %s spending %s", mTx.Hash, txid, coinbase)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for hashtx")
+	}
+
+	if gaps := z.SequenceGaps(); gaps != 0 {
+		t.Errorf("SequenceGaps() = %d, want 0", gaps)
+	}
+}
@@ -136,13 +136,18 @@ func constructFields(pkg string) logrus.Fields {
 	rwm.RLock()
 	defer rwm.RUnlock()
 
+	return defaultFields(coin, pkg, customFields)
+}
+
+// defaultFields returns the default fields of coin with f added
+func defaultFields(c, pkg string, f Fields) logrus.Fields {
 	fields := logrus.Fields{
 		"service": service,
-		"coin":    coin,
+		"coin":    c,
 		"package": pkg,
 	}
 
-	for k, v := range customFields {
+	for k, v := range f {
 		fields[k] = v
 	}
 
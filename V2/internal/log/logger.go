@@ -0,0 +1,80 @@
+package log
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Logger logs with the coin field set to its own coin instead of the one passed to Initialize,
+// for processes handling more than one coin. The zero value logs with an empty coin.
+// Unlike SetCustomFields, the fields of a Logger never touch global state, so it is safe to share between goroutines.
+type Logger struct {
+	coin   string
+	fields Fields
+}
+
+// New returns a Logger for coin
+func New(c string) Logger {
+	return Logger{coin: c}
+}
+
+// WithFields returns a copy of l that adds f to every log message, leaving l unchanged
+func (l Logger) WithFields(f Fields) Logger {
+	fields := make(Fields, len(l.fields)+len(f))
+	for k, v := range l.fields {
+		fields[k] = v
+	}
+	for k, v := range f {
+		fields[k] = v
+	}
+
+	return Logger{coin: l.coin, fields: fields}
+}
+
+// Debug is a debug level log message
+func (l Logger) Debug(pkg string, args ...interface{}) {
+	logrus.WithFields(l.construct(pkg)).Debug(args...)
+}
+
+// Debugf is a debug level formatted log message
+func (l Logger) Debugf(pkg, format string, args ...interface{}) {
+	logrus.WithFields(l.construct(pkg)).Debugf(format, args...)
+}
+
+// Info is an info level log message
+func (l Logger) Info(pkg string, args ...interface{}) {
+	logrus.WithFields(l.construct(pkg)).Info(args...)
+}
+
+// Infof is an info level formatted log message
+func (l Logger) Infof(pkg, format string, args ...interface{}) {
+	logrus.WithFields(l.construct(pkg)).Infof(format, args...)
+}
+
+// Warn is a warn level error log message with optional annotation
+func (l Logger) Warn(err error, pkg string, args ...interface{}) {
+	msg := constructMessage(args...)
+	logrus.WithFields(l.construct(pkg)).Warnf("%s%+v", msg, err)
+}
+
+// Warnf is a warn level formatted error log message with optional annotation
+func (l Logger) Warnf(err error, pkg, format string, args ...interface{}) {
+	logrus.WithFields(l.construct(pkg)).Warnf("%s: %+v", fmt.Sprintf(format, args...), err)
+}
+
+// Error is a error level error log message with optional annotation
+func (l Logger) Error(err error, pkg string, args ...interface{}) {
+	msg := constructMessage(args...)
+	logrus.WithFields(l.construct(pkg)).Errorf("%s%+v", msg, err)
+}
+
+// Errorf is a error level formatted error log message with optional annotation
+func (l Logger) Errorf(err error, pkg, format string, args ...interface{}) {
+	logrus.WithFields(l.construct(pkg)).Errorf("%s: %+v", fmt.Sprintf(format, args...), err)
+}
+
+// construct adds the fields of l to the default fields
+func (l Logger) construct(pkg string) logrus.Fields {
+	return defaultFields(l.coin, pkg, l.fields)
+}
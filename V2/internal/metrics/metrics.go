@@ -0,0 +1,153 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/shapeshift-legacy/coinquery/V2/internal/log"
+)
+
+const namespace = "coinquery"
+
+// Indexer metrics
+var (
+	IndexedHeight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "indexer",
+		Name:      "indexed_height",
+		Help:      "Height of the last block with all transactions committed to the db.",
+	}, []string{"coin"})
+
+	NodeHeight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "indexer",
+		Name:      "node_height",
+		Help:      "Height of the node's best block.",
+	}, []string{"coin"})
+
+	IndexedBlocks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "indexer",
+		Name:      "blocks_total",
+		Help:      "Number of blocks written to the db.",
+	}, []string{"coin"})
+
+	IndexedTxs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "indexer",
+		Name:      "txs_total",
+		Help:      "Number of block and mempool transactions written to the db.",
+	}, []string{"coin"})
+)
+
+// Node RPC metrics
+var (
+	RPCDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "rpc",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of node rpc requests by method, including retries.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 14),
+	}, []string{"method"})
+
+	RPCErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "rpc",
+		Name:      "errors_total",
+		Help:      "Number of failed node rpc request attempts by method.",
+	}, []string{"method"})
+)
+
+// Database metrics
+var (
+	DBQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "db",
+		Name:      "query_duration_seconds",
+		Help:      "Latency of db queries by postgres.Database method, including waiting for a connection token.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 16),
+	}, []string{"schema", "method"})
+
+	DBTokensInUse = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "db",
+		Name:      "sem_tokens_in_use",
+		Help:      "Number of db connection tokens held by running queries.",
+	}, []string{"schema"})
+
+	DBTokens = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "db",
+		Name:      "sem_tokens",
+		Help:      "Number of db connection tokens available to queries.",
+	}, []string{"schema"})
+
+	DBReplicaLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "db",
+		Name:      "replica_lag_blocks",
+		Help:      "Number of blocks a read replica is behind the primary.",
+	}, []string{"schema", "replica"})
+
+	DBReplicaHealthy = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "db",
+		Name:      "replica_healthy",
+		Help:      "Whether a read replica receives reads (1) or is excluded for failing health checks or lagging (0).",
+	}, []string{"schema", "replica"})
+)
+
+// ZMQ metrics
+var (
+	ZMQMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "zmq",
+		Name:      "messages_total",
+		Help:      "Number of zmq messages received by topic.",
+	}, []string{"coin", "topic"})
+
+	ZMQSequenceGaps = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "zmq",
+		Name:      "sequence_gaps_total",
+		Help:      "Number of gaps detected in zmq message sequence numbers by topic.",
+	}, []string{"coin", "topic"})
+)
+
+// API metrics
+var (
+	HTTPDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of http requests by route.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 12),
+	}, []string{"route", "method", "code"})
+)
+
+// Since observes the seconds elapsed since start on the histogram with labels
+func Since(h *prometheus.HistogramVec, start time.Time, labels ...string) {
+	h.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+}
+
+// Handler returns the http handler serving all registered metrics
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Serve serves metrics at /metrics on addr in the background
+func Serve(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+
+	go func() {
+		log.Infof("metrics", "serving metrics on: %s", addr)
+
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Error(err, "metrics", "error serving metrics")
+		}
+	}()
+}
@@ -6,7 +6,7 @@ import (
 
 func Auth(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path != "/favicon.ico" {
+		if r.URL.Path != "/favicon.ico" && r.URL.Path != "/metrics" {
 			apikey := r.URL.Query().Get("apikey")
 
 			if apikey == "" {
@@ -51,7 +51,7 @@ func Logger(h http.Handler) http.Handler {
 
 		path := r.URL.Path
 
-		if path != "/ping" && path != "/favicon.ico" {
+		if path != "/ping" && path != "/favicon.ico" && path != "/metrics" {
 			log.SetCustomFields(log.Fields{"method": r.Method, "statusCode": sw.status, "responseTime": fmt.Sprintf("%s", time.Since(t))})
 			log.Infof("logger", "%s from %s", r.URL.String(), r.RemoteAddr)
 		}
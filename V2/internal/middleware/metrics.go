@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/shapeshift-legacy/coinquery/V2/internal/metrics"
+)
+
+// Metrics records the latency of each request by its route pattern, so path parameters don't create new series
+func Metrics(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := newStatusWriter(w)
+		start := time.Now()
+
+		h.ServeHTTP(sw, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+
+		metrics.Since(metrics.HTTPDuration, start, route, r.Method, strconv.Itoa(sw.status))
+	})
+}
@@ -1,15 +1,16 @@
 package xpubutil
 
 import (
-	"errors"
-	"log"
-	"sort"
+	"container/list"
+	"context"
 	"strings"
 	"sync"
 
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcutil/hdkeychain"
-	"github.com/shapeshift-legacy/coinquery/V2/pkg/postgres"
+	"github.com/pkg/errors"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/cashaddr"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/storage"
 )
 
 // TODO: move prefixes to exported constants in a table somewhere
@@ -22,128 +23,253 @@ const (
 	dashPrefix       = 0x4c
 	receiveIndex     = 0
 	changeIndex      = 1
+
+	// DefaultGap is the number of unused addresses in a row after which a chain is assumed to have no more used
+	// addresses, as recommended by bip44
+	DefaultGap = 20
 )
 
-// GenerateAddrs generates the addresses for a particular xpub
-func GenerateAddrs(xpub string, ticker string, db *postgres.Database) []string {
-	_, rk, ck := deriveKeys(xpub)
-	prefix := p2pkhPrefix(ticker)
+var (
+	// ErrInvalidXpub is the cause of errors from an xpub that isn't a valid extended public key
+	ErrInvalidXpub = errors.New("invalid xpub")
+
+	// ErrUnsupportedCoin is the cause of errors from a coin without a known address format
+	ErrUnsupportedCoin = errors.New("unsupported coin")
+)
 
-	// Check both the "receiving" bip44 path as well as the "change" bip44 path
-	rkAddrs := deriveAddresses(rk, prefix, db)
-	cdAddrs := deriveAddresses(ck, prefix, db)
+// GenerateAddrs generates the used receive and change addresses of xpub, scanning each chain with DefaultGap
+func GenerateAddrs(ctx context.Context, xpub string, ticker string, db storage.Reader) ([]string, error) {
+	d, err := NewDeriver(xpub, ticker)
+	if err != nil {
+		return nil, err
+	}
 
-	// Combine slices of active addresses
-	addrs := append(rkAddrs, cdAddrs...)
+	w, err := Scan(ctx, d, DefaultGap, db)
+	if err != nil {
+		return nil, err
+	}
 
-	return addrs
+	return w.Used(), nil
 }
 
-func p2pkhPrefix(ticker string) byte {
-	switch strings.ToUpper(ticker) {
-	case "BTC":
-		return btcPrefix
-	case "BCH":
-		return bchPrefix
-	case "LTC":
-		return ltcPrefix
-	case "DOGE":
-		return dogePrefix
-	case "DASH":
-		return dashPrefix
-	default:
-		log.Fatalf("Uknown prefix byte for address derivation for Ticker: %s\n", ticker)
-	}
-	return 0x00
+// Deriver derives the receive and change addresses of an xpub, keeping those derived so far so that each address is
+// only derived once however often the xpub is scanned. It is safe for concurrent use.
+type Deriver struct {
+	mu     sync.Mutex
+	keys   [2]*hdkeychain.ExtendedKey // receive and change keys
+	addrs  [2][]string                // addresses derived so far from each of keys
+	params *chaincfg.Params
+	bch    bool
 }
 
-func deriveAddresses(ek *hdkeychain.ExtendedKey, prefix byte, db *postgres.Database) []string {
-	// Setup prefix byte
-	cnfg := &chaincfg.Params{
-		PubKeyHashAddrID: prefix,
+// NewDeriver returns a Deriver of xpub for ticker, the xpub being the extended public key of the bip44 account path
+// "44'/CoinType'/Acct'"
+func NewDeriver(xpub string, ticker string) (*Deriver, error) {
+	prefix, err := p2pkhPrefix(ticker)
+	if err != nil {
+		return nil, err
 	}
 
-	type result struct {
-		Index  int
-		Active bool
-		Addr   string
-		Err    error
+	_, rk, ck, err := deriveKeys(xpub)
+	if err != nil {
+		return nil, err
 	}
 
-	results := make([]*result, 0)
-	numWorkers := 20
-	currentBatch := numWorkers
-	i := 0
+	return &Deriver{
+		keys:   [2]*hdkeychain.ExtendedKey{rk, ck},
+		params: &chaincfg.Params{PubKeyHashAddrID: prefix},
+		bch:    strings.ToUpper(ticker) == "BCH",
+	}, nil
+}
 
-	for {
-		workerOutput := make(chan *result)
-		hasActive := false
+// Addrs returns the addresses of chain, receiveIndex or changeIndex, from index from up to but not including index to
+func (d *Deriver) Addrs(chain int, from int, to int) ([]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 
-		var wg sync.WaitGroup
-		wg.Add(numWorkers)
+	for n := len(d.addrs[chain]); n < to; n++ {
+		child, err := generateChild(d.keys[chain], n)
+		if err != nil {
+			return nil, err
+		}
 
-		for i < currentBatch {
-			go func(i int) {
-				// Generate children at a specific index and their addresses
-				child := generateChild(ek, i)
-				addr, err := child.Address(cnfg)
-				if err != nil {
-					log.Fatal(err)
-				}
+		addr, err := child.Address(d.params)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to derive address %d of chain %d", n, chain)
+		}
 
-				txids, err := db.GetTxIDsByAddresses([]string{addr.String()}, "", "", "")
+		// bch addresses are indexed as cashaddr
+		encoded := addr.EncodeAddress()
+		if d.bch {
+			encoded = "bitcoincash:" + cashaddr.CheckEncodeCashAddress(addr.ScriptAddress(), "bitcoincash", cashaddr.P2PKH)
+		}
+
+		d.addrs[chain] = append(d.addrs[chain], encoded)
+	}
+
+	addrs := make([]string, to-from)
+	copy(addrs, d.addrs[chain][from:to])
+
+	return addrs, nil
+}
+
+// Chain holds the addresses of one chain of an xpub up to its last used address
+type Chain struct {
+	Addrs []string // addresses up to the last used one, of which some may be unused
+	Used  []string // used addresses in index order
+	Next  string   // first address after the last used one, at index len(Addrs)
+}
+
+// Wallet holds the receive and change chains of an xpub found by Scan
+type Wallet struct {
+	Receive Chain
+	Change  Chain
+}
 
-				// Mark address as either active or inactive
-				addrActive := true
-				if len(txids) == 0 {
-					addrActive = false
-				}
+// Used returns the used addresses of both chains, receive addresses first
+func (w *Wallet) Used() []string {
+	used := make([]string, 0, len(w.Receive.Used)+len(w.Change.Used))
+	used = append(used, w.Receive.Used...)
+
+	return append(used, w.Change.Used...)
+}
+
+// Scan finds the used addresses of d in db, scanning each chain until gap addresses in a row are unused. Every
+// address derived past the last used one is checked in a single query, so a chain takes one query per gap it crosses.
+func Scan(ctx context.Context, d *Deriver, gap int, db storage.Reader) (*Wallet, error) {
+	if gap < 1 {
+		return nil, errors.Errorf("invalid gap: %d, must be at least 1", gap)
+	}
+
+	receive, err := scanChain(ctx, d, receiveIndex, gap, db)
+	if err != nil {
+		return nil, err
+	}
+
+	change, err := scanChain(ctx, d, changeIndex, gap, db)
+	if err != nil {
+		return nil, err
+	}
 
-				// Send result to the workerOutput channel
-				workerOutput <- &result{i, addrActive, addr.String(), err}
+	return &Wallet{Receive: *receive, Change: *change}, nil
+}
 
-				wg.Done()
-			}(i)
+func scanChain(ctx context.Context, d *Deriver, chain int, gap int, db storage.Reader) (*Chain, error) {
+	addrs := []string{}
+	used := make(map[string]bool)
+	last := -1
 
-			i++
+	for len(addrs) < last+1+gap {
+		batch, err := d.Addrs(chain, len(addrs), last+1+gap)
+		if err != nil {
+			return nil, err
 		}
 
-		go func() {
-			wg.Wait()
-			close(workerOutput)
-		}()
+		found, err := db.GetUsedAddresses(ctx, batch)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to scan chain %d", chain)
+		}
 
-		currentBatch += numWorkers
-		count := 0
+		for _, addr := range found {
+			used[addr] = true
+		}
 
-		for o := range workerOutput {
-			if o.Err != nil {
-				log.Fatal(o.Err)
+		for n, addr := range batch {
+			if used[addr] {
+				last = len(addrs) + n
 			}
+		}
 
-			if o.Active {
-				results = append(results, o)
-				hasActive = true
-			}
+		addrs = append(addrs, batch...)
+	}
 
-			count++
+	c := &Chain{Addrs: addrs[:last+1], Used: []string{}, Next: addrs[last+1]}
+	for _, addr := range c.Addrs {
+		if used[addr] {
+			c.Used = append(c.Used, addr)
 		}
+	}
 
-		if !hasActive {
-			break
-		}
+	return c, nil
+}
+
+// Cache holds the derivers of the most recently requested xpubs, so that the addresses of a wallet scanned again are
+// not derived again. It is safe for concurrent use.
+type Cache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // of *cacheEntry, most recently requested first
+	entries map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key     string
+	deriver *Deriver
+}
+
+// NewCache returns a Cache holding the derivers of up to size xpubs
+func NewCache(size int) *Cache {
+	return &Cache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
 	}
+}
+
+// Deriver returns the cached Deriver of xpub for ticker, or a new one evicting the least recently requested xpub
+// once the cache is full
+func (c *Cache) Deriver(xpub string, ticker string) (*Deriver, error) {
+	key := strings.ToUpper(ticker) + ":" + xpub
 
-	sort.Slice(results, func(i, j int) bool {
-		return results[i].Index < results[j].Index
-	})
+	c.mu.Lock()
+	if e, ok := c.entries[key]; ok {
+		c.order.MoveToFront(e)
+		c.mu.Unlock()
 
-	addrs := make([]string, len(results), len(results))
-	for i, r := range results {
-		addrs[i] = r.Addr
+		return e.Value.(*cacheEntry).deriver, nil
+	}
+	c.mu.Unlock()
+
+	d, err := NewDeriver(xpub, ticker)
+	if err != nil {
+		return nil, err
 	}
 
-	return addrs
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// another request may have added the xpub meanwhile
+	if e, ok := c.entries[key]; ok {
+		c.order.MoveToFront(e)
+		return e.Value.(*cacheEntry).deriver, nil
+	}
+
+	c.entries[key] = c.order.PushFront(&cacheEntry{key, d})
+
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+
+	return d, nil
+}
+
+func p2pkhPrefix(ticker string) (byte, error) {
+	switch strings.ToUpper(ticker) {
+	case "BTC":
+		return btcPrefix, nil
+	case "BCH":
+		return bchPrefix, nil
+	case "LTC":
+		return ltcPrefix, nil
+	case "DOGE":
+		return dogePrefix, nil
+	case "DASH":
+		return dashPrefix, nil
+	default:
+		return 0x00, errors.Wrapf(ErrUnsupportedCoin, "unknown prefix byte for address derivation for ticker: %s", ticker)
+	}
 }
 
 // derive keys from an xpub
@@ -152,33 +278,40 @@ func deriveAddresses(ek *hdkeychain.ExtendedKey, prefix byte, db *postgres.Datab
 // accountKey "44'/CoinType'/Acct'"
 // receivingKey "44'/CoinType'/Acct'/0
 // changeKey "44'/CoinType'/Acct'/1
-func deriveKeys(xpub string) (accountKey, receivingKey, changeKey *hdkeychain.ExtendedKey) {
+func deriveKeys(xpub string) (accountKey, receivingKey, changeKey *hdkeychain.ExtendedKey, err error) {
 	ek, err := xpubToEK(xpub)
 	if err != nil {
-		log.Fatal("Unable to parse xpub into extended key", err)
+		return nil, nil, nil, err
 	}
 	// Generate child keys for receiving and change addresses
-	receivingKey = generateChild(ek, receiveIndex)
-	changeKey = generateChild(ek, changeIndex)
+	if receivingKey, err = generateChild(ek, receiveIndex); err != nil {
+		return nil, nil, nil, errors.Wrap(ErrInvalidXpub, err.Error())
+	}
+	if changeKey, err = generateChild(ek, changeIndex); err != nil {
+		return nil, nil, nil, errors.Wrap(ErrInvalidXpub, err.Error())
+	}
 	// The first return parameter would only be needed if this is extended to support eth
 	// as the keepkey has that derivation path at 44'/60'/acct'
-	return ek, receivingKey, changeKey
+	return ek, receivingKey, changeKey, nil
 }
 
-// convert xpub string to extended key
+// convert xpub string to extended key, private keys are refused so they are never used or logged
 func xpubToEK(xpub string) (*hdkeychain.ExtendedKey, error) {
 	ek, err := hdkeychain.NewKeyFromString(xpub)
 	if err != nil {
-		return ek, errors.New("Invalid XPUB: " + err.Error())
+		return nil, errors.Wrap(ErrInvalidXpub, err.Error())
+	}
+	if ek.IsPrivate() {
+		return nil, errors.Wrap(ErrInvalidXpub, "extended private key given")
 	}
 	return ek, nil
 }
 
 // derive child key of a given extended key
-func generateChild(ek *hdkeychain.ExtendedKey, n int) *hdkeychain.ExtendedKey {
+func generateChild(ek *hdkeychain.ExtendedKey, n int) (*hdkeychain.ExtendedKey, error) {
 	child, err := ek.Child(uint32(n))
 	if err != nil {
-		log.Fatal("Error generating child key")
+		return nil, errors.Wrapf(err, "failed to generate child key %d", n)
 	}
-	return child
+	return child, nil
 }
@@ -0,0 +1,203 @@
+// +build unit
+
+package xpubutil
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil/hdkeychain"
+	"github.com/pkg/errors"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/blockchain/utxo"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/storage/memory"
+)
+
+// newKeys returns an account private key and its xpub derived from a fixed seed
+func newKeys(t *testing.T) (*hdkeychain.ExtendedKey, string) {
+	seed := []byte("coinquery xpub test seed, 32 bytes")
+
+	master, err := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pub, err := master.Neuter()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return master, pub.String()
+}
+
+// payTo inserts a mempool tx paying to each of addrs into db
+func payTo(t *testing.T, db *memory.Store, addrs ...string) {
+	txs := []*utxo.Tx{}
+	for i, addr := range addrs {
+		tx := &utxo.Tx{TxID: fmt.Sprintf("%064x", i+1), Locktime: "0"}
+
+		vout := utxo.Vout{Value: "1.0"}
+		vout.ScriptPubKey.Addresses = []string{addr}
+		tx.Vouts = []utxo.Vout{vout}
+
+		txs = append(txs, tx)
+	}
+
+	if err := db.InsertTxs(-1, txs); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewDeriver(t *testing.T) {
+	master, xpub := newKeys(t)
+
+	tests := []struct {
+		xpub   string
+		ticker string
+		want   error
+	}{
+		{xpub, "btc", nil},
+		{xpub, "BCH", nil},
+		{"not an xpub", "btc", ErrInvalidXpub},
+		{xpub[:len(xpub)-1], "btc", ErrInvalidXpub},
+		{master.String(), "btc", ErrInvalidXpub},
+		{xpub, "eth", ErrUnsupportedCoin},
+	}
+
+	for _, tt := range tests {
+		_, err := NewDeriver(tt.xpub, tt.ticker)
+		if errors.Cause(err) != tt.want {
+			t.Errorf("NewDeriver(%.16s, %s) error = %v, want %v", tt.xpub, tt.ticker, err, tt.want)
+		}
+
+		// a private key must not leak into errors, which end up in logs and responses
+		if err != nil && strings.Contains(err.Error(), master.String()) {
+			t.Errorf("NewDeriver() error = %v, contains the private key", err)
+		}
+	}
+}
+
+func TestDeriver_Addrs(t *testing.T) {
+	master, xpub := newKeys(t)
+
+	d, err := NewDeriver(xpub, "btc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	change, err := d.Addrs(changeIndex, 2, 5)
+	if err != nil || len(change) != 3 {
+		t.Fatalf("Addrs(change, 2, 5) = %v, %v, want 3 addresses", change, err)
+	}
+
+	// the public derivation of m/1/3 matches the private one
+	key, _ := master.Child(changeIndex)
+	key, _ = key.Child(3)
+	want, _ := key.Address(&chaincfg.MainNetParams)
+
+	if change[1] != want.EncodeAddress() {
+		t.Errorf("Addrs(change, 2, 5)[1] = %s, want %s", change[1], want)
+	}
+
+	receive, err := d.Addrs(receiveIndex, 0, 1)
+	if err != nil || receive[0] == change[0] {
+		t.Errorf("Addrs(receive, 0, 1) = %v, %v, want an address of the receive chain", receive, err)
+	}
+
+	bch, err := NewDeriver(xpub, "bch")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cash, err := bch.Addrs(receiveIndex, 0, 1)
+	if err != nil || !strings.HasPrefix(cash[0], "bitcoincash:q") {
+		t.Errorf("bch Addrs(receive, 0, 1) = %v, %v, want a cashaddr", cash, err)
+	}
+}
+
+func TestScan(t *testing.T) {
+	_, xpub := newKeys(t)
+
+	d, err := NewDeriver(xpub, "btc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	receive, _ := d.Addrs(receiveIndex, 0, 40)
+	change, _ := d.Addrs(changeIndex, 0, 40)
+
+	db := memory.New("btc")
+	payTo(t, db, receive[0], receive[5], receive[30], change[2])
+
+	tests := []struct {
+		gap        int
+		receive    int
+		used       []string
+		next       string
+		nextChange string
+	}{
+		// address 30 is more than 20 unused addresses past address 5
+		{DefaultGap, 6, []string{receive[0], receive[5], change[2]}, receive[6], change[3]},
+		{25, 31, []string{receive[0], receive[5], receive[30], change[2]}, receive[31], change[3]},
+		{1, 1, []string{receive[0]}, receive[1], change[0]},
+	}
+
+	for _, tt := range tests {
+		w, err := Scan(context.Background(), d, tt.gap, db)
+		if err != nil {
+			t.Fatalf("Scan(gap %d) error = %v", tt.gap, err)
+		}
+
+		if len(w.Receive.Addrs) != tt.receive || w.Receive.Next != tt.next || w.Change.Next != tt.nextChange {
+			t.Errorf("Scan(gap %d) = %d receive addresses, next %s and %s, want %d, next %s and %s",
+				tt.gap, len(w.Receive.Addrs), w.Receive.Next, w.Change.Next, tt.receive, tt.next, tt.nextChange)
+		}
+
+		if fmt.Sprint(w.Used()) != fmt.Sprint(tt.used) {
+			t.Errorf("Scan(gap %d).Used() = %v, want %v", tt.gap, w.Used(), tt.used)
+		}
+	}
+
+	if _, err := Scan(context.Background(), d, 0, db); err == nil {
+		t.Error("Scan(gap 0) error = nil, want an error")
+	}
+
+	used, err := GenerateAddrs(context.Background(), xpub, "btc", db)
+	if err != nil || len(used) != 3 {
+		t.Errorf("GenerateAddrs() = %v, %v, want 3 addresses", used, err)
+	}
+
+	if _, err := GenerateAddrs(context.Background(), "not an xpub", "btc", db); errors.Cause(err) != ErrInvalidXpub {
+		t.Errorf("GenerateAddrs() error = %v, want %v", err, ErrInvalidXpub)
+	}
+}
+
+func TestCache(t *testing.T) {
+	_, xpub := newKeys(t)
+
+	c := NewCache(1)
+
+	d, err := c.Deriver(xpub, "btc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if again, _ := c.Deriver(xpub, "BTC"); again != d {
+		t.Error("Deriver() of a cached xpub returned a new deriver")
+	}
+
+	// the same xpub derives other addresses for bch
+	if bch, _ := c.Deriver(xpub, "bch"); bch == d {
+		t.Error("Deriver() for another coin returned the cached deriver")
+	}
+
+	if evicted, _ := c.Deriver(xpub, "btc"); evicted == d || c.order.Len() != 1 {
+		t.Errorf("Deriver() past the cache size kept %d derivers, want the oldest evicted", c.order.Len())
+	}
+
+	if _, err := c.Deriver("not an xpub", "btc"); errors.Cause(err) != ErrInvalidXpub || c.order.Len() != 1 {
+		t.Errorf("Deriver() of an invalid xpub = %v, want %v and nothing cached", err, ErrInvalidXpub)
+	}
+}
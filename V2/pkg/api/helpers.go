@@ -5,14 +5,14 @@ import (
 	"strconv"
 
 	"github.com/pkg/errors"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/storage"
 )
 
 // Pagination holds pagination info for insight endpoints
 type Pagination struct {
-	LimitClause  string
-	OffsetClause string
-	FromPage     int
-	ToPage       int
+	Page     storage.Page
+	FromPage int
+	ToPage   int
 }
 
 func rangeErr(fromPage int, toPage int, max int) string {
@@ -43,8 +43,7 @@ func TraditionalPagintion(from string, to string, defaultLimit int, maxLimit int
 		toPage = t
 	}
 
-	limitClause := fmt.Sprintf("LIMIT %d", defaultLimit)
-	offsetClause := ""
+	page := storage.Page{Limit: defaultLimit}
 
 	diff := 0
 	if from != "" && to != "" {
@@ -58,11 +57,10 @@ func TraditionalPagintion(from string, to string, defaultLimit int, maxLimit int
 			return nil, errors.New(negativeErr(fromPage, toPage))
 		}
 
-		limitClause = fmt.Sprintf("LIMIT %v", diff)
-		offsetClause = fmt.Sprintf("OFFSET %v", fromPage)
+		page = storage.Page{Limit: diff, Offset: fromPage}
 
 	} else if from != "" {
-		offsetClause = fmt.Sprintf("OFFSET %v", fromPage)
+		page.Offset = fromPage
 		toPage = fromPage + defaultLimit
 
 	} else if to != "" {
@@ -74,13 +72,62 @@ func TraditionalPagintion(from string, to string, defaultLimit int, maxLimit int
 		if toPage == 0 {
 			toPage = defaultLimit
 		}
-		limitClause = fmt.Sprintf("LIMIT %v", toPage)
+		page.Limit = toPage
+	}
+
+	if err := page.Validate(); err != nil {
+		return nil, err
 	}
 
 	return &Pagination{
-		limitClause,
-		offsetClause,
+		page,
 		fromPage,
 		toPage,
 	}, nil
 }
+
+// Cursors holds cursor pagination info for insight endpoints
+type Cursors struct {
+	Limit  int
+	Before *storage.Cursor
+	After  *storage.Cursor
+}
+
+// Filter returns the transaction filter selecting the page of c
+func (c *Cursors) Filter() storage.TxFilter {
+	return storage.TxFilter{Page: storage.Page{Limit: c.Limit}, Before: c.Before, After: c.After}
+}
+
+// CursorPagination creates a cursors struct from the before, after and limit query parameters. Without a cursor the
+// newest page is selected.
+func CursorPagination(before string, after string, limit string, defaultLimit int, maxLimit int) (*Cursors, error) {
+	c := &Cursors{Limit: defaultLimit}
+
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil || l <= 0 || l > maxLimit {
+			return nil, errors.Errorf("'limit' (%s) should be between 1 and %d", limit, maxLimit)
+		}
+
+		c.Limit = l
+	}
+
+	if before != "" && after != "" {
+		return nil, errors.New("'before' and 'after' can't be combined")
+	}
+
+	var err error
+	if before != "" {
+		if c.Before, err = storage.ParseCursor(before); err != nil {
+			return nil, err
+		}
+	}
+
+	if after != "" {
+		if c.After, err = storage.ParseCursor(after); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
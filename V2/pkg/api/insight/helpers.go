@@ -1,155 +1,143 @@
 package insight
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 	"sort"
 	"strings"
-	"sync"
 
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcutil"
+	"github.com/go-chi/chi"
+	easyjson "github.com/mailru/easyjson"
+	"github.com/mailru/easyjson/jwriter"
 	"github.com/shapeshift-legacy/coinquery/V2/pkg/cashaddr"
 
 	_ "net/http/pprof"
 
 	"github.com/pkg/errors"
 	"github.com/shapeshift-legacy/coinquery/V2/internal/convert"
-	"github.com/shapeshift-legacy/coinquery/V2/pkg/postgres"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/storage"
 )
 
-func (i *InsightServer) getTxs(txids []string) ([]*insightTx, error) {
-	errChan := make(chan error, len(txids)*2)
-
-	lb, err := i.db.LastBlock()
+// getTxs resolves txids into insight transactions in the same order. The transactions are loaded with their inputs,
+// outputs and spends in a fixed number of queries, see storage.Reader.GetTxsByTxIDs.
+func (i *InsightServer) getTxs(ctx context.Context, txids []string) ([]*insightTx, error) {
+	lb, err := i.db.LastBlock(ctx)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to get transactions from txids: %s", txids)
 	}
 
-	var txwg sync.WaitGroup
-	txwg.Add(len(txids))
-	txs := make([]*insightTx, len(txids))
-	go func() {
-		for idx, id := range txids {
-			go func(txid string, index int) {
-				defer txwg.Done()
-
-				inputsChan := make(chan *insightVin)
-				outputsChan := make(chan *insightVout)
-
-				defer close(inputsChan)
-				defer close(outputsChan)
-
-				tx, err := i.db.GetTxByTxID(txid)
-				if err != nil {
-					errChan <- errors.Wrapf(err, "failed to get transactions from txids: %v", txids)
-					return
-				}
-
-				for j, _ := range tx.Inputs {
-					go i.processTxInput(&tx.Inputs[j], inputsChan, errChan)
-				}
-
-				for j, _ := range tx.Outputs {
-					go i.processTxOutput(tx.TxID, &tx.Outputs[j], outputsChan, errChan)
-				}
-
-				valueIn := int64(0)
-				valueOut := int64(0)
-				vins := []*insightVin{}
-				vouts := []*insightVout{}
-				for i := 0; i < len(tx.Inputs)+len(tx.Outputs); i++ {
-					select {
-					case vin := <-inputsChan:
-						vins = append(vins, vin)
-						valueIn += vin.ValueSat
-					case vout := <-outputsChan:
-						vouts = append(vouts, vout)
-
-						sats, err := convert.ToSatoshi(vout.Value)
-						if err != nil {
-							errChan <- errors.Wrapf(err, "failed to parse value in transaction: %s\n vout: %v", txid, vout)
-							return
-						}
-
-						valueOut += sats
-					}
-				}
-
-				sort.Slice(vins, func(i, j int) bool {
-					return vins[i].N < vins[j].N
-				})
-
-				sort.Slice(vouts, func(i, j int) bool {
-					return vouts[i].N < vouts[j].N
-				})
-
-				ts, err := convert.ToUnixTimestamp(tx.Time)
-				if err != nil {
-					errChan <- errors.Wrapf(err, "failed to parse timestamp from transaction: %v", txid)
-					return
-				}
-
-				confirmations := 0
-				if tx.BlockHeight != -1 {
-					confirmations = lb.Height - int(tx.BlockHeight) + 1
-				}
-
-				t := &insightTx{
-					TxID:          tx.TxID,
-					Hash:          tx.Hash,
-					Version:       tx.Version,
-					Size:          tx.Size,
-					VSize:         tx.VSize,
-					Weight:        tx.Weight,
-					Locktime:      tx.Locktime,
-					Vin:           vins,
-					Vout:          vouts,
-					BlockHash:     tx.BlockHash,
-					BlockHeight:   tx.BlockHeight,
-					Confirmations: confirmations,
-					Time:          ts,
-					ValueOut:      convert.ToBTC(valueOut),
-				}
-
-				if tx.BlockTime != "" {
-					t.BlockTime = ts
-				}
-
-				if len(vins) == 1 && vins[0].Coinbase != "" {
-					t.IsCoinBase = true
-				} else {
-					t.ValueIn = convert.ToBTC(valueIn)
-					fees := convert.ToBTC(valueIn - valueOut) // converting for precision
-					t.Fees = &fees
-				}
-
-				txs[index] = t
-			}(id, idx)
-		}
+	details, err := i.db.GetTxsByTxIDs(ctx, txids)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get transactions from txids: %v", txids)
+	}
 
-		txwg.Wait()
-		close(errChan)
-	}()
+	// a request cancelled while the transactions were loaded isn't resolved, even by a store ignoring ctx
+	if err := ctx.Err(); err != nil {
+		return nil, errors.Wrapf(err, "failed to get transactions from txids: %v", txids)
+	}
+
+	txs := make([]*insightTx, 0, len(details))
+	for _, tx := range details {
+		t, err := newInsightTx(tx, lb.Height)
+		if err != nil {
+			return nil, err
+		}
 
-	for err := range errChan {
-		return nil, err
+		txs = append(txs, t)
 	}
 
+	return txs, nil
+}
+
+// sortByHeight sorts txs by block height, newest first with mempool txs last
+func sortByHeight(txs []*insightTx) {
 	sort.Slice(txs, func(i, j int) bool {
 		return txs[i].BlockHeight > txs[j].BlockHeight
 	})
-
-	return txs, nil
 }
 
-func (i *InsightServer) processTxInput(vin *postgres.Input, inputsChan chan<- *insightVin, errChan chan<- error) {
-	voutClause := fmt.Sprintf("AND output.vout = %d", vin.SpentVout)
-	output, err := i.db.GetOutputsByTxID(vin.SpentTx, voutClause)
+// newInsightTx returns the insight transaction of tx with height as the last block
+func newInsightTx(tx *storage.TxDetails, height int) (*insightTx, error) {
+	valueIn := int64(0)
+	vins := []*insightVin{}
+	for j := range tx.Inputs {
+		vin, err := newInsightVin(&tx.Inputs[j], tx.PrevOuts[j])
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to process inputs of transaction: %s", tx.TxID)
+		}
+
+		vins = append(vins, vin)
+		valueIn += vin.ValueSat
+	}
+
+	valueOut := int64(0)
+	vouts := []*insightVout{}
+	for j := range tx.Outputs {
+		vout, err := newInsightVout(&tx.Outputs[j], tx.Spends[j])
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to process outputs of transaction: %s", tx.TxID)
+		}
+
+		vouts = append(vouts, vout)
+		valueOut += tx.Outputs[j].SatAmount
+	}
+
+	sort.Slice(vins, func(i, j int) bool {
+		return vins[i].N < vins[j].N
+	})
+
+	sort.Slice(vouts, func(i, j int) bool {
+		return vouts[i].N < vouts[j].N
+	})
+
+	ts, err := convert.ToUnixTimestamp(tx.Time)
 	if err != nil {
-		errChan <- errors.Wrapf(err, "failed to process tx input: %v", vin)
-		return
+		return nil, errors.Wrapf(err, "failed to parse timestamp from transaction: %v", tx.TxID)
+	}
+
+	confirmations := 0
+	if tx.BlockHeight != -1 {
+		confirmations = height - int(tx.BlockHeight) + 1
+	}
+
+	t := &insightTx{
+		TxID:          tx.TxID,
+		Hash:          tx.Hash,
+		Version:       tx.Version,
+		Size:          tx.Size,
+		VSize:         tx.VSize,
+		Weight:        tx.Weight,
+		Locktime:      tx.Locktime,
+		Vin:           vins,
+		Vout:          vouts,
+		BlockHash:     tx.BlockHash,
+		BlockHeight:   tx.BlockHeight,
+		Confirmations: confirmations,
+		Time:          ts,
+		ValueOut:      convert.ToBTC(valueOut),
+		cursor:        tx.Cursor,
 	}
 
+	if tx.BlockTime != "" {
+		t.BlockTime = ts
+	}
+
+	if len(vins) == 1 && vins[0].Coinbase != "" {
+		t.IsCoinBase = true
+	} else {
+		t.ValueIn = convert.ToBTC(valueIn)
+		fees := convert.ToBTC(valueIn - valueOut) // converting for precision
+		t.Fees = &fees
+	}
+
+	return t, nil
+}
+
+// newInsightVin returns the insight input of vin spending prevout, which is nil for a coinbase
+func newInsightVin(vin *storage.Input, prevout *storage.Output) (*insightVin, error) {
 	v := &insightVin{
 		TxID: vin.SpentTx,
 		N:    vin.Vin,
@@ -169,28 +157,23 @@ func (i *InsightServer) processTxInput(vin *postgres.Input, inputsChan chan<- *i
 		v.ScriptSig.Asm = &vin.Asm
 	}
 
-	if len(output) > 0 {
-		sats := output[0].SatAmount
-		btc := convert.ToBTC(sats)
-
-		v.ValueSat = sats
-		v.Value = btc
+	if prevout != nil {
+		v.ValueSat = prevout.SatAmount
+		v.Value = convert.ToBTC(prevout.SatAmount)
 
-		addr, err := normalizeAddrFormat(output[0].Address)
+		addr, err := normalizeAddrFormat(prevout.Address)
 		if err != nil {
-			errChan <- errors.Wrapf(err, "failed to normalize address: %s", output[0].Address)
-			return
+			return nil, errors.Wrapf(err, "failed to normalize address: %s", prevout.Address)
 		}
 
 		v.Address = addr
 	}
 
-	inputsChan <- v
+	return v, nil
 }
 
-func (i *InsightServer) processTxOutput(txid string, vout *postgres.Output, outputsChan chan<- *insightVout, errChan chan<- error) {
-	details := i.db.GetSpentTxDetails(txid, vout.Vout)
-
+// newInsightVout returns the insight output of vout spent by spend, which is nil while unspent
+func newInsightVout(vout *storage.Output, spend *storage.SpentTxDetails) (*insightVout, error) {
 	btc := convert.ToBTC(vout.SatAmount)
 
 	v := &insightVout{
@@ -212,7 +195,7 @@ func (i *InsightServer) processTxOutput(txid string, vout *postgres.Output, outp
 	if vout.Address != "unsupported addr" {
 		addr, err := normalizeAddrFormat(vout.Address)
 		if err != nil {
-			errChan <- errors.Wrapf(err, "failed to normalize address: %s", vout.Address)
+			return nil, errors.Wrapf(err, "failed to normalize address: %s", vout.Address)
 		}
 
 		v.ScriptPubKey.Addresses = []string{addr}
@@ -222,69 +205,45 @@ func (i *InsightServer) processTxOutput(txid string, vout *postgres.Output, outp
 		v.ScriptPubKey.Type = vout.Type
 	}
 
-	if details == nil {
-		v.SpentTxID = nil
-		v.SpentTxIndex = nil
-		v.SpentTxBlockHeight = nil
-	} else {
-		v.SpentTxID = &details.SpentTxID
-		v.SpentTxIndex = &details.SpentIndex
-		v.SpentTxBlockHeight = &details.SpentHeight
+	if spend != nil {
+		v.SpentTxID = &spend.SpentTxID
+		v.SpentTxIndex = &spend.SpentIndex
+		v.SpentTxBlockHeight = &spend.SpentHeight
 	}
 
-	outputsChan <- v
+	return v, nil
 }
 
-func (i *InsightServer) getUtxos(addrs []string) ([]*insightUtxo, error) {
-	lb, err := i.db.LastBlock()
+// newInsightUtxo returns the insight utxo of out with height as the last block
+func newInsightUtxo(out *storage.Utxo, height int) (*insightUtxo, error) {
+	ts, err := convert.ToUnixTimestamp(out.Timestamp)
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to get utxos for addresses: %s", addrs)
+		return nil, errors.Wrapf(err, "failed to parse timestamp from output: %v", out)
 	}
 
-	outputs, err := i.db.GetUtxosByAddrs(addrs)
-	if err != nil {
-		return nil, errors.Wrapf(err, "failed to get utxos for addresses: %s", addrs)
+	confirmations := 0
+	if out.BlockHeight != -1 {
+		confirmations = height - int(out.BlockHeight) + 1
 	}
 
-	utxos := []*insightUtxo{}
-	for _, out := range outputs {
-		ts, err := convert.ToUnixTimestamp(out.Timestamp)
-		if err != nil {
-			return nil, errors.Wrapf(err, "failed to parse timestamp from output: %v", out)
-		}
-
-		confirmations := 0
-		if out.BlockHeight != -1 {
-			confirmations = lb.Height - int(out.BlockHeight) + 1
-		}
-
-		addr, err := normalizeAddrFormat(out.Address)
-		if err != nil {
-			return nil, errors.Wrapf(err, "failed to normalize address: %s", out.Address)
-		}
-
-		utxo := &insightUtxo{
-			Address:       addr,
-			TxID:          out.TxID,
-			Vout:          out.Vout,
-			ScriptPubKey:  out.Hex,
-			ReqSigs:       out.ReqSigs,
-			Type:          out.Type,
-			Amount:        convert.ToBTC(out.SatAmount),
-			Satoshis:      out.SatAmount,
-			Confirmations: confirmations,
-			Timestamp:     ts,
-			BlockHeight:   out.BlockHeight,
-		}
-
-		utxos = append(utxos, utxo)
+	addr, err := normalizeAddrFormat(out.Address)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to normalize address: %s", out.Address)
 	}
 
-	sort.Slice(utxos, func(i, j int) bool {
-		return utxos[i].BlockHeight > utxos[j].BlockHeight
-	})
-
-	return utxos, nil
+	return &insightUtxo{
+		Address:       addr,
+		TxID:          out.TxID,
+		Vout:          out.Vout,
+		ScriptPubKey:  out.Hex,
+		ReqSigs:       out.ReqSigs,
+		Type:          out.Type,
+		Amount:        convert.ToBTC(out.SatAmount),
+		Satoshis:      out.SatAmount,
+		Confirmations: confirmations,
+		Timestamp:     ts,
+		BlockHeight:   out.BlockHeight,
+	}, nil
 }
 
 // normalizeAddrFormat normalize addr format from DB to expected format in API
@@ -305,3 +264,183 @@ func normalizeAddrFormat(addr string) (string, error) {
 
 	return addr, nil
 }
+
+// singleAddr returns the address of an /addr/{addr} request, which unlike /addrs/{addrs} only takes one
+func singleAddr(r *http.Request) (string, error) {
+	addrs := splitAndTrim(r.Context().Value("addrs").(string))
+	if len(addrs) != 1 || addrs[0] == "" {
+		return "", errors.Errorf("expected a single address, got: %s", chi.URLParam(r, "addrs"))
+	}
+
+	return addrs[0], nil
+}
+
+// getAddr resolves the summary of addr into an insight address of addrStr, the address as requested which for bch may
+// be the legacy format of addr
+func (i *InsightServer) getAddr(ctx context.Context, addrStr, addr string) (*insightAddr, error) {
+	s, err := i.db.GetAddressSummary(ctx, addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get address summary: %s", addr)
+	}
+
+	return &insightAddr{AddrStr: addrStr, insightBalance: *newInsightBalance(s)}, nil
+}
+
+// newInsightBalance converts the summary of one or more addresses into an insight balance
+func newInsightBalance(s *storage.AddressSummary) *insightBalance {
+	balance := s.Received - s.Sent
+	unconfirmed := s.UnconfirmedReceived - s.UnconfirmedSent
+
+	return &insightBalance{
+		Balance:                 convert.ToBTC(balance),
+		BalanceSat:              balance,
+		TotalReceived:           convert.ToBTC(s.Received),
+		TotalReceivedSat:        s.Received,
+		TotalSent:               convert.ToBTC(s.Sent),
+		TotalSentSat:            s.Sent,
+		UnconfirmedBalance:      convert.ToBTC(unconfirmed),
+		UnconfirmedBalanceSat:   unconfirmed,
+		UnconfirmedTxApperances: s.UnconfirmedTxs,
+		TxApperances:            s.Txs,
+	}
+}
+
+// jsonStream writes a json response to w as it is encoded instead of buffering it whole. Nothing is sent until the
+// first flush, so a request failing before then can still be answered with an error status.
+type jsonStream struct {
+	jwriter.Writer
+	w     http.ResponseWriter
+	r     *http.Request
+	items int  // items added to the array being written
+	begun bool // whether the response has begun
+}
+
+// newJSONStream returns a stream of the response to r
+func newJSONStream(w http.ResponseWriter, r *http.Request) *jsonStream {
+	return &jsonStream{w: w, r: r}
+}
+
+// add encodes item as the next element of the array being written
+func (s *jsonStream) add(item easyjson.Marshaler) {
+	if s.items > 0 {
+		s.RawByte(',')
+	}
+
+	item.MarshalEasyJSON(&s.Writer)
+	s.items++
+}
+
+// flush sends what has been encoded so far, beginning the response on the first call
+func (s *jsonStream) flush() error {
+	if s.Error != nil {
+		return errors.Wrap(s.Error, "failed to encode response")
+	}
+
+	if !s.begun {
+		s.w.Header().Set("Content-Type", "application/json")
+		if status, ok := s.r.Context().Value("status").(int); ok {
+			s.w.WriteHeader(status)
+		}
+
+		s.begun = true
+	}
+
+	if _, err := s.DumpTo(s.w); err != nil {
+		return errors.Wrap(err, "failed to write response")
+	}
+
+	if flusher, ok := s.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+
+	return nil
+}
+
+// abort closes the connection of a response that has begun, so that the client can't take the partial body for a
+// complete one. Once begun the response can no longer be answered with an error status.
+func (s *jsonStream) abort() {
+	if hijacker, ok := s.w.(http.Hijacker); ok {
+		if conn, _, err := hijacker.Hijack(); err == nil {
+			conn.Close()
+			return
+		}
+	}
+
+	panic(http.ErrAbortHandler)
+}
+
+// streamTxHistory writes the history page h with the txs of txids as its items. The txids are resolved TXS_CHUNK_SIZE at
+// a time, each chunk sent as it is encoded, so that only one chunk of transactions is held in memory. The first chunk is
+// resolved before anything is written, so only a later chunk can fail once the response has begun. The items are
+// written ahead of prev and next, which link is called with the first and last item to set.
+func (i *InsightServer) streamTxHistory(s *jsonStream, h *insightTxHistoryByAddrs, txids []string, link func(first, last *insightTx)) error {
+	chunk := func(start int) ([]*insightTx, error) {
+		end := start + TXS_CHUNK_SIZE
+		if end > len(txids) {
+			end = len(txids)
+		}
+
+		return i.getTxs(s.r.Context(), txids[start:end])
+	}
+
+	var txs []*insightTx
+	if len(txids) > 0 {
+		var err error
+		if txs, err = chunk(0); err != nil {
+			return err
+		}
+	}
+
+	s.RawString(`{"totalItems":`)
+	s.Int(h.TotalItems)
+	s.RawString(`,"from":`)
+	s.Int(h.From)
+	s.RawString(`,"to":`)
+	s.Int(h.To)
+	s.RawString(`,"items":[`)
+
+	var first, last *insightTx
+	for start := 0; len(txs) > 0; {
+		for _, tx := range txs {
+			s.add(tx)
+		}
+
+		if first == nil {
+			first = txs[0]
+		}
+		last = txs[len(txs)-1]
+
+		if err := s.flush(); err != nil {
+			return err
+		}
+
+		if start += TXS_CHUNK_SIZE; start >= len(txids) {
+			break
+		}
+
+		var err error
+		if txs, err = chunk(start); err != nil {
+			return err
+		}
+	}
+
+	s.RawByte(']')
+
+	if first != nil && link != nil {
+		link(first, last)
+	}
+
+	if h.Prev != "" {
+		s.RawString(`,"prev":`)
+		s.String(h.Prev)
+	}
+
+	if h.Next != "" {
+		s.RawString(`,"next":`)
+		s.String(h.Next)
+	}
+
+	s.RawByte('}')
+
+	return s.flush()
+}
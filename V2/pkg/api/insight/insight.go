@@ -18,10 +18,11 @@ import (
 	"github.com/pkg/errors"
 	"github.com/shapeshift-legacy/coinquery/V2/config"
 	"github.com/shapeshift-legacy/coinquery/V2/internal/log"
+	"github.com/shapeshift-legacy/coinquery/V2/internal/xpubutil"
 	"github.com/shapeshift-legacy/coinquery/V2/pkg/api"
 	"github.com/shapeshift-legacy/coinquery/V2/pkg/blockchain/utxo"
 	"github.com/shapeshift-legacy/coinquery/V2/pkg/cashaddr"
-	"github.com/shapeshift-legacy/coinquery/V2/pkg/postgres"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/storage"
 )
 
 type Coin string
@@ -30,6 +31,11 @@ const (
 	DEFAULT_TXS           = 10
 	MAX_TRANSACTIONS      = 50
 	MAX_ADDRESSES         = 50
+	MAX_ADDR_TXIDS        = 1000
+	UTXO_FLUSH_SIZE       = 1000
+	TXS_CHUNK_SIZE        = 10
+	MAX_XPUB_GAP          = 100
+	XPUB_CACHE_SIZE       = 1000
 	BTC              Coin = "btc"
 	BCH              Coin = "bch"
 )
@@ -37,16 +43,18 @@ const (
 // InsightServer is a wrapper around server that holds insight only handlers
 type InsightServer struct {
 	bc     *utxo.Blockchain
-	db     *postgres.Database
+	db     storage.Reader
 	config *config.Config
+	xpubs  *xpubutil.Cache
 }
 
 // New returns a new InsightServer
-func New(bc *utxo.Blockchain, db *postgres.Database, c *config.Config) *InsightServer {
+func New(bc *utxo.Blockchain, db storage.Reader, c *config.Config) *InsightServer {
 	return &InsightServer{
 		bc:     bc,
 		db:     db,
 		config: c,
+		xpubs:  xpubutil.NewCache(XPUB_CACHE_SIZE),
 	}
 }
 
@@ -73,6 +81,62 @@ func (i *InsightServer) AddressesCtx(next http.Handler) http.Handler {
 	})
 }
 
+// AddressesBody decodes addrs, from and to out of the form or json body of a POST request. addrs is placed on the ctx
+// like AddressesCtx, while from and to, or before, after and limit, are placed on the url query so handlers read them
+// the same way as for a GET request.
+func (i *InsightServer) AddressesBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b := struct {
+			Addrs  string      `json:"addrs" schema:"addrs"`
+			From   json.Number `json:"from" schema:"from"`
+			To     json.Number `json:"to" schema:"to"`
+			Before string      `json:"before" schema:"before"`
+			After  string      `json:"after" schema:"after"`
+			Limit  json.Number `json:"limit" schema:"limit"`
+		}{}
+
+		if err := decodeRequest(&b, r); err != nil {
+			log.Warn(err, "insight", "error decoding request")
+			http.Error(w, fmt.Sprintf("error decoding request: %v\n", err), 400)
+			return
+		}
+
+		addrs := splitAndTrim(b.Addrs)
+		if b.Addrs == "" {
+			http.Error(w, "'addrs' is required\n", 422)
+			return
+		}
+
+		if len(addrs) > i.maxAddresses() {
+			http.Error(w, fmt.Sprintf("You have requested %d addresses. Max: %d", len(addrs), i.maxAddresses()), 422)
+			return
+		}
+
+		query := r.URL.Query()
+		params := map[string]string{
+			"from":   b.From.String(),
+			"to":     b.To.String(),
+			"before": b.Before,
+			"after":  b.After,
+			"limit":  b.Limit.String(),
+		}
+
+		for k, v := range params {
+			if v != "" {
+				query.Set(k, v)
+			}
+		}
+
+		r = r.WithContext(context.WithValue(r.Context(), "addrs", strings.Join(addrs, ",")))
+
+		u := *r.URL
+		u.RawQuery = query.Encode()
+		r.URL = &u
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 // BCHInterceptor converts BCH addresses to cashaddr format and replaces
 // the stored context value. It is a noop for any not BCH addresses
 func (i *InsightServer) BCHInterceptor(next http.Handler) http.Handler {
@@ -80,7 +144,7 @@ func (i *InsightServer) BCHInterceptor(next http.Handler) http.Handler {
 		coin, _ := r.Context().Value("coin").(string)
 
 		if Coin(coin) == BCH {
-			addrs := splitAndTrim(chi.URLParam(r, "addrs"))
+			addrs := splitAndTrim(r.Context().Value("addrs").(string))
 			cashAddrs := make([]string, 0)
 			for _, addr := range addrs {
 				decoded, err := btcutil.DecodeAddress(addr, &chaincfg.MainNetParams)
@@ -110,7 +174,7 @@ func (i *InsightServer) Status(w http.ResponseWriter, r *http.Request) {
 
 	switch queryParam {
 	case "getLastBlockHash":
-		dbLastBlock, err := i.db.LastBlock()
+		dbLastBlock, err := i.db.LastBlock(r.Context())
 		if err != nil {
 			log.Error(err, "insight", "error resolving /status/q=getLastBlockHash")
 			http.Error(w, fmt.Sprintf("%v\n", err), 500)
@@ -135,14 +199,14 @@ func (i *InsightServer) Status(w http.ResponseWriter, r *http.Request) {
 func (i *InsightServer) BlockByBlockHash(w http.ResponseWriter, r *http.Request) {
 	blockHash := chi.URLParam(r, "blockHash")
 
-	lb, err := i.db.LastBlock()
+	lb, err := i.db.LastBlock(r.Context())
 	if err != nil {
 		log.Error(err, "insight", "error resolving /block/{blockHash}")
 		http.Error(w, fmt.Sprintf("%v\n", err), 500)
 		return
 	}
 
-	block, err := i.db.GetBlock(blockHash)
+	block, err := i.db.GetBlock(r.Context(), blockHash)
 	if err != nil {
 		log.Error(err, "insight", "error resolving /block/{blockHash}")
 		http.Error(w, fmt.Sprintf("%v\n", err), 500)
@@ -174,7 +238,7 @@ func (i *InsightServer) BlockByBlockHash(w http.ResponseWriter, r *http.Request)
 func (i *InsightServer) TxByTxID(w http.ResponseWriter, r *http.Request) {
 	txid := chi.URLParam(r, "txid")
 
-	txs, err := i.getTxs([]string{txid})
+	txs, err := i.getTxs(r.Context(), []string{txid})
 	if err != nil {
 		log.Error(err, "insight", "error resolving /tx/{txid}")
 		http.Error(w, fmt.Sprintf("%v\n", err), 500)
@@ -188,7 +252,7 @@ func (i *InsightServer) TxByTxID(w http.ResponseWriter, r *http.Request) {
 func (i *InsightServer) RawTxByTxID(w http.ResponseWriter, r *http.Request) {
 	txid := chi.URLParam(r, "txid")
 
-	rawTx, err := i.db.GetRawTxByTxID(txid)
+	rawTx, err := i.db.GetRawTxByTxID(r.Context(), txid)
 	if err != nil {
 		log.Error(err, "insight", "error resolving /rawtx/{txid}")
 		http.Error(w, fmt.Sprintf("%v\n", err), 500)
@@ -210,24 +274,25 @@ func (i *InsightServer) TxsByBlockHash(w http.ResponseWriter, r *http.Request) {
 
 	pageNum, _ := strconv.Atoi(r.URL.Query().Get("pageNum"))
 
-	limitClause := fmt.Sprintf("LIMIT %d", pageSize)
-	offsetClause := fmt.Sprintf("OFFSET %d", pageNum*pageSize)
+	page := storage.Page{Limit: pageSize, Offset: pageNum * pageSize}
 
-	txIds, err := i.db.GetTxHashesByBlockHash(blockHash, limitClause, offsetClause)
+	txIds, err := i.db.GetTxHashesByBlockHash(r.Context(), blockHash, page)
 	if err != nil {
 		log.Error(err, "insight", "error resolving /txs?block={blockHash}&pageNum={pageNum}")
 		http.Error(w, fmt.Sprintf("%v\n", err), 500)
 		return
 	}
 
-	txs, err := i.getTxs(txIds)
+	txs, err := i.getTxs(r.Context(), txIds)
 	if err != nil {
 		log.Error(err, "insight", "error resolving /txs?block={blockHash}&pageNum={pageNum}")
 		http.Error(w, fmt.Sprintf("%v\n", err), 500)
 		return
 	}
 
-	total, err := i.db.GetTotalTxsByBlockHash(blockHash)
+	sortByHeight(txs)
+
+	total, err := i.db.GetTotalTxsByBlockHash(r.Context(), blockHash)
 	totalPages := int(math.Floor(float64(total+pageSize-1)) / float64(pageSize))
 
 	t := &insightTxsByBlock{
@@ -275,11 +340,25 @@ func (i *InsightServer) SendRawTx(w http.ResponseWriter, r *http.Request) {
 	render.Respond(w, r, t)
 }
 
-// TxHistoryByAddrs GET handler for /{coin}/{addrs}/txs/?from={from}&to={to}
+// TxHistoryByAddrs GET handler for /{coin}/{addrs}/txs/?from={from}&to={to}, or
+// /{coin}/{addrs}/txs/?before={cursor}&after={cursor}&limit={limit} to page by cursor. Also the POST handler for
+// /{coin}/addrs/txs with addrs and the pagination in the body.
 func (i *InsightServer) TxHistoryByAddrs(w http.ResponseWriter, r *http.Request) {
-	addrs := r.Context().Value("addrs").(string)
-	from := r.URL.Query().Get("from")
-	to := r.URL.Query().Get("to")
+	i.txHistory(w, r, splitAndTrim(r.Context().Value("addrs").(string)))
+}
+
+// txHistory responds with the page of the history of addrs selected by from and to, or by the before, after and limit
+// query parameters
+func (i *InsightServer) txHistory(w http.ResponseWriter, r *http.Request, splitAddrs []string) {
+	query := r.URL.Query()
+
+	if query.Get("before") != "" || query.Get("after") != "" || query.Get("limit") != "" {
+		i.txHistoryByCursor(w, r, splitAddrs)
+		return
+	}
+
+	from := query.Get("from")
+	to := query.Get("to")
 
 	tp, err := api.TraditionalPagintion(from, to, DEFAULT_TXS, MAX_TRANSACTIONS)
 	if err != nil {
@@ -288,79 +367,369 @@ func (i *InsightServer) TxHistoryByAddrs(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	splitAddrs := splitAndTrim(addrs)
-
-	txids, err := i.db.GetTxIDsByAddresses(splitAddrs, tp.LimitClause, "", tp.OffsetClause)
+	txids, err := i.db.GetTxIDsByAddresses(r.Context(), splitAddrs, storage.TxFilter{Page: tp.Page})
 	if err != nil {
 		log.Error(err, "insight", "error resolving /{addrs}/txs?from={from}&to={to}")
 		http.Error(w, fmt.Sprintf("%v\n", err), 500)
 		return
 	}
 
-	txs, err := i.getTxs(txids)
+	// txids keep the order of the history, mempool first as when paging by cursor
+	if len(txids) < tp.ToPage-tp.FromPage {
+		tp.ToPage = tp.FromPage + len(txids)
+	}
+
+	totalCount, err := i.db.GetTotalTxsByAddresses(r.Context(), splitAddrs)
 	if err != nil {
 		log.Error(err, "insight", "error resolving /{addrs}/txs?from={from}&to={to}")
 		http.Error(w, fmt.Sprintf("%v\n", err), 500)
 		return
 	}
 
-	if len(txs) < tp.ToPage-tp.FromPage {
-		tp.ToPage = tp.FromPage + len(txs)
+	t := &insightTxHistoryByAddrs{
+		TotalItems: totalCount,
+		From:       tp.FromPage,
+		To:         tp.ToPage,
 	}
 
-	totalCount, err := i.db.GetTotalTxsByAddresses(splitAddrs)
-	if err != nil {
+	// Stream with easyjson instead of default marshaller
+	s := newJSONStream(w, r)
+	if err := i.streamTxHistory(s, t, txids, nil); err != nil {
+		if s.begun {
+			log.Error(err, "insight", "error streaming /{addrs}/txs?from={from}&to={to}")
+			s.abort()
+			return
+		}
+
 		log.Error(err, "insight", "error resolving /{addrs}/txs?from={from}&to={to}")
 		http.Error(w, fmt.Sprintf("%v\n", err), 500)
 		return
 	}
+}
+
+// txHistoryByCursor responds with the page of the history of addrs selected by the before, after and limit query
+// parameters. Items are ordered newest first with the mempool ahead of every block, and keep their position as blocks
+// are added, so the pages before a cursor don't shift while the chain advances.
+func (i *InsightServer) txHistoryByCursor(w http.ResponseWriter, r *http.Request, addrs []string) {
+	query := r.URL.Query()
+
+	if query.Get("from") != "" || query.Get("to") != "" {
+		http.Error(w, "'from' and 'to' can't be combined with 'before', 'after' or 'limit'", 422)
+		return
+	}
+
+	cursors, err := api.CursorPagination(query.Get("before"), query.Get("after"), query.Get("limit"), DEFAULT_TXS, MAX_TRANSACTIONS)
+	if err != nil {
+		log.Warn(err, "insight", "error setting cursor pagination")
+		http.Error(w, fmt.Sprintf("%v\n", err), 422)
+		return
+	}
+
+	txids, err := i.db.GetTxIDsByAddresses(r.Context(), addrs, cursors.Filter())
+	if err != nil {
+		log.Error(err, "insight", "error resolving /{addrs}/txs?before={cursor}&after={cursor}&limit={limit}")
+		http.Error(w, fmt.Sprintf("%v\n", err), 500)
+		return
+	}
+
+	totalCount, err := i.db.GetTotalTxsByAddresses(r.Context(), addrs)
+	if err != nil {
+		log.Error(err, "insight", "error resolving /{addrs}/txs?before={cursor}&after={cursor}&limit={limit}")
+		http.Error(w, fmt.Sprintf("%v\n", err), 500)
+		return
+	}
 
 	t := &insightTxHistoryByAddrs{
 		TotalItems: totalCount,
-		From:       tp.FromPage,
-		To:         tp.ToPage,
-		Txs:        txs,
+		To:         len(txids),
 	}
-	// Marshal with easyjson instead of default marshaller
-	if status, ok := r.Context().Value("status").(int); ok {
-		w.WriteHeader(status)
+
+	link := func(first, last *insightTx) {
+		t.Prev = first.cursor
+
+		// a short page read towards older txs reached the start of the history
+		if cursors.After != nil || len(txids) == cursors.Limit {
+			t.Next = last.cursor
+		}
 	}
-	_, _, err = easyjson.MarshalToHTTPResponseWriter(t, w)
-	if err != nil {
-		log.Error(err, "insight", "error marshalling /{addrs}/txs?from={from}&to={to}")
+
+	// Stream with easyjson instead of default marshaller
+	s := newJSONStream(w, r)
+	if err := i.streamTxHistory(s, t, txids, link); err != nil {
+		if s.begun {
+			log.Error(err, "insight", "error streaming /{addrs}/txs?before={cursor}&after={cursor}&limit={limit}")
+			s.abort()
+			return
+		}
+
+		log.Error(err, "insight", "error resolving /{addrs}/txs?before={cursor}&after={cursor}&limit={limit}")
 		http.Error(w, fmt.Sprintf("%v\n", err), 500)
 		return
 	}
 }
 
-// UtxosByAddrs GET handler for /{coin}/{addrs}/utxos
+// UtxosByAddrs GET handler for /{coin}/{addrs}/utxos, or POST handler for /{coin}/addrs/utxo with addrs in the body
 func (i *InsightServer) UtxosByAddrs(w http.ResponseWriter, r *http.Request) {
 	addrs := r.Context().Value("addrs").(string)
 	splitAddrs := splitAndTrim(addrs)
-	if len(splitAddrs) > MAX_ADDRESSES {
-		http.Error(w, fmt.Sprintf("You have requested %d addresses. Max: %d", len(splitAddrs), MAX_ADDRESSES), 422)
+	if len(splitAddrs) > i.maxAddresses() {
+		http.Error(w, fmt.Sprintf("You have requested %d addresses. Max: %d", len(splitAddrs), i.maxAddresses()), 422)
 		return
 	}
 
-	outputs, err := i.getUtxos(splitAddrs)
+	i.utxos(w, r, splitAddrs)
+}
+
+// utxos responds with the utxos of addrs, each written as it is read and flushed every UTXO_FLUSH_SIZE utxos so that a
+// large set isn't held in memory whole
+func (i *InsightServer) utxos(w http.ResponseWriter, r *http.Request, splitAddrs []string) {
+	lb, err := i.db.LastBlock(r.Context())
 	if err != nil {
 		log.Error(err, "insight", "error resolving /{addrs}/utxos")
 		http.Error(w, fmt.Sprintf("%v\n", err), 500)
 		return
 	}
 
-	// Marshal with easyjson instead of default marshaller
-	if status, ok := r.Context().Value("status").(int); ok {
-		w.WriteHeader(status)
+	// Stream with easyjson instead of default marshaller
+	s := newJSONStream(w, r)
+	s.RawByte('[')
+
+	err = i.db.EachUtxoByAddrs(r.Context(), splitAddrs, func(out *storage.Utxo) error {
+		u, err := newInsightUtxo(out, lb.Height)
+		if err != nil {
+			return err
+		}
+
+		s.add(u)
+		if s.items%UTXO_FLUSH_SIZE != 0 {
+			return nil
+		}
+
+		return s.flush()
+	})
+
+	if err == nil {
+		s.RawByte(']')
+		err = s.flush()
 	}
-	_, _, err = easyjson.MarshalToHTTPResponseWriter(insightUtxos(outputs), w)
+
 	if err != nil {
-		log.Error(err, "insight", "error marshalling /{addrs}/utxos")
+		if s.begun {
+			log.Error(err, "insight", "error streaming /{addrs}/utxos")
+			s.abort()
+			return
+		}
+
+		log.Error(err, "insight", "error resolving /{addrs}/utxos")
 		http.Error(w, fmt.Sprintf("%v\n", err), 500)
 		return
 	}
 }
 
+// Addr GET handler for /{coin}/addr/{addr}?noTxList={noTxList}&from={from}&to={to} to get the balances and txids of an
+// address. The txids are left out with noTxList=1.
+func (i *InsightServer) Addr(w http.ResponseWriter, r *http.Request) {
+	addr, err := singleAddr(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%v\n", err), 422)
+		return
+	}
+
+	a, err := i.getAddr(r.Context(), strings.TrimSpace(chi.URLParam(r, "addrs")), addr)
+	if err != nil {
+		log.Error(err, "insight", "error resolving /addr/{addr}")
+		http.Error(w, fmt.Sprintf("%v\n", err), 500)
+		return
+	}
+
+	if noTxList := r.URL.Query().Get("noTxList"); noTxList == "1" || noTxList == "true" {
+		render.Respond(w, r, a)
+		return
+	}
+
+	tp, err := api.TraditionalPagintion(r.URL.Query().Get("from"), r.URL.Query().Get("to"), MAX_ADDR_TXIDS, MAX_ADDR_TXIDS)
+	if err != nil {
+		log.Error(err, "insight", "error setting pagination")
+		http.Error(w, fmt.Sprintf("%v\n", err), 422)
+		return
+	}
+
+	txids, err := i.db.GetTxIDsByAddresses(r.Context(), []string{addr}, storage.TxFilter{Page: tp.Page})
+	if err != nil {
+		log.Error(err, "insight", "error resolving /addr/{addr}")
+		http.Error(w, fmt.Sprintf("%v\n", err), 500)
+		return
+	}
+
+	render.Respond(w, r, &insightAddrTxs{insightAddr: *a, Transactions: txids})
+}
+
+// AddrBalance GET handler for /{coin}/addr/{addr}/balance to get the confirmed balance of an address in satoshis
+func (i *InsightServer) AddrBalance(w http.ResponseWriter, r *http.Request) {
+	i.addrAmount(w, r, "/addr/{addr}/balance", func(a *insightAddr) int64 { return a.BalanceSat })
+}
+
+// AddrTotalReceived GET handler for /{coin}/addr/{addr}/totalReceived to get the satoshis received by an address in
+// confirmed transactions
+func (i *InsightServer) AddrTotalReceived(w http.ResponseWriter, r *http.Request) {
+	i.addrAmount(w, r, "/addr/{addr}/totalReceived", func(a *insightAddr) int64 { return a.TotalReceivedSat })
+}
+
+// AddrTotalSent GET handler for /{coin}/addr/{addr}/totalSent to get the satoshis sent by an address in confirmed
+// transactions
+func (i *InsightServer) AddrTotalSent(w http.ResponseWriter, r *http.Request) {
+	i.addrAmount(w, r, "/addr/{addr}/totalSent", func(a *insightAddr) int64 { return a.TotalSentSat })
+}
+
+// AddrUnconfirmedBalance GET handler for /{coin}/addr/{addr}/unconfirmedBalance to get the change in balance of an
+// address by mempool transactions in satoshis
+func (i *InsightServer) AddrUnconfirmedBalance(w http.ResponseWriter, r *http.Request) {
+	i.addrAmount(w, r, "/addr/{addr}/unconfirmedBalance", func(a *insightAddr) int64 { return a.UnconfirmedBalanceSat })
+}
+
+// addrAmount responds with the amount of the address summary selected by amount
+func (i *InsightServer) addrAmount(w http.ResponseWriter, r *http.Request, path string, amount func(a *insightAddr) int64) {
+	addr, err := singleAddr(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%v\n", err), 422)
+		return
+	}
+
+	a, err := i.getAddr(r.Context(), strings.TrimSpace(chi.URLParam(r, "addrs")), addr)
+	if err != nil {
+		log.Error(err, "insight", "error resolving "+path)
+		http.Error(w, fmt.Sprintf("%v\n", err), 500)
+		return
+	}
+
+	render.Respond(w, r, amount(a))
+}
+
+// XpubCtx scans the receive and change addresses of {xpub} until ?gap={gap} addresses in a row are unused and places
+// the wallet found on the ctx
+func (i *InsightServer) XpubCtx(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gap := i.xpubGap()
+		if g := r.URL.Query().Get("gap"); g != "" {
+			n, err := strconv.Atoi(g)
+			if err != nil || n < 1 || n > MAX_XPUB_GAP {
+				http.Error(w, fmt.Sprintf("invalid gap: %s, must be between 1 and %d\n", g, MAX_XPUB_GAP), 422)
+				return
+			}
+
+			gap = n
+		}
+
+		coin, _ := r.Context().Value("coin").(string)
+
+		d, err := i.xpubs.Deriver(chi.URLParam(r, "xpub"), coin)
+		if err != nil {
+			cause := errors.Cause(err)
+			if cause == xpubutil.ErrInvalidXpub || cause == xpubutil.ErrUnsupportedCoin {
+				http.Error(w, fmt.Sprintf("%v\n", err), 400)
+				return
+			}
+
+			log.Error(err, "insight", "error resolving /xpub/{xpub}")
+			http.Error(w, fmt.Sprintf("%v\n", err), 500)
+			return
+		}
+
+		wallet, err := xpubutil.Scan(r.Context(), d, gap, i.db)
+		if err != nil {
+			log.Error(err, "insight", "error resolving /xpub/{xpub}")
+			http.Error(w, fmt.Sprintf("%v\n", err), 500)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), "xpub", wallet)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// XpubUtxos GET handler for /{coin}/xpub/{xpub}/utxo to get the utxos of the used addresses of an xpub
+func (i *InsightServer) XpubUtxos(w http.ResponseWriter, r *http.Request) {
+	used, ok := i.xpubUsed(w, r)
+	if !ok {
+		return
+	}
+
+	i.utxos(w, r, used)
+}
+
+// XpubTxs GET handler for /{coin}/xpub/{xpub}/txs?from={from}&to={to}, or
+// /{coin}/xpub/{xpub}/txs?before={cursor}&after={cursor}&limit={limit}, to get the history of the used addresses of an
+// xpub
+func (i *InsightServer) XpubTxs(w http.ResponseWriter, r *http.Request) {
+	used, ok := i.xpubUsed(w, r)
+	if !ok {
+		return
+	}
+
+	i.txHistory(w, r, used)
+}
+
+// XpubBalance GET handler for /{coin}/xpub/{xpub}/balance to get the balances of the used addresses of an xpub taken
+// together
+func (i *InsightServer) XpubBalance(w http.ResponseWriter, r *http.Request) {
+	used, ok := i.xpubUsed(w, r)
+	if !ok {
+		return
+	}
+
+	s, err := i.db.GetAddressesSummary(r.Context(), used)
+	if err != nil {
+		log.Error(err, "insight", "error resolving /xpub/{xpub}/balance")
+		http.Error(w, fmt.Sprintf("%v\n", err), 500)
+		return
+	}
+
+	render.Respond(w, r, newInsightBalance(s))
+}
+
+// xpubUsed returns the used addresses of the xpub on the ctx of r. A wallet with more of them than a multi address
+// request may hold is answered with 413 instead, as its queries would be unbounded.
+func (i *InsightServer) xpubUsed(w http.ResponseWriter, r *http.Request) ([]string, bool) {
+	used := r.Context().Value("xpub").(*xpubutil.Wallet).Used()
+	if len(used) > i.maxAddresses() {
+		http.Error(w, fmt.Sprintf("xpub has %d used addresses. Max: %d", len(used), i.maxAddresses()), http.StatusRequestEntityTooLarge)
+		return nil, false
+	}
+
+	return used, true
+}
+
+// XpubNext GET handler for /{coin}/xpub/{xpub}/next to get the first receive and change addresses of an xpub past
+// their last used ones
+func (i *InsightServer) XpubNext(w http.ResponseWriter, r *http.Request) {
+	wallet := r.Context().Value("xpub").(*xpubutil.Wallet)
+
+	render.Respond(w, r, &insightXpubNext{
+		ReceiveAddress: wallet.Receive.Next,
+		ReceiveIndex:   len(wallet.Receive.Addrs),
+		ChangeAddress:  wallet.Change.Next,
+		ChangeIndex:    len(wallet.Change.Addrs),
+	})
+}
+
+// xpubGap returns the number of unused addresses in a row ending the scan of an xpub unless requested otherwise
+func (i *InsightServer) xpubGap() int {
+	if i.config == nil || i.config.API.XpubGap <= 0 {
+		return xpubutil.DefaultGap
+	}
+
+	return i.config.API.XpubGap
+}
+
+// maxAddresses returns the most addresses a request to a multi address endpoint may hold
+func (i *InsightServer) maxAddresses() int {
+	if i.config == nil || i.config.API.MaxAddresses <= 0 {
+		return MAX_ADDRESSES
+	}
+
+	return i.config.API.MaxAddresses
+}
+
 func decodeRequest(b interface{}, r *http.Request) error {
 	if r.Header.Get("Content-type") == "application/x-www-form-urlencoded" {
 		if err := r.ParseForm(); err != nil {
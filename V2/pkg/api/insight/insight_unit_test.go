@@ -4,12 +4,25 @@ package insight
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil/hdkeychain"
 	"github.com/go-chi/chi"
+	"github.com/shapeshift-legacy/coinquery/V2/config"
+	"github.com/shapeshift-legacy/coinquery/V2/internal/fakenode"
+	"github.com/shapeshift-legacy/coinquery/V2/internal/xpubutil"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/blockchain/utxo"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/storage"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/storage/memory"
 )
 
 func TestMain(m *testing.M) {
@@ -81,3 +94,748 @@ func Test_normalizeAddrFormat(t *testing.T) {
 		})
 	}
 }
+
+// newMemoryServer indexes the chain of a fake node with a mined and a mempool transaction into an in-memory store and
+// returns an insight router serving it along with both txids
+func newMemoryServer(t *testing.T, n *fakenode.Node) (http.Handler, string, string) {
+	i, minedID, pendingID := newMemoryInsight(t, n)
+
+	return newRouter(i), minedID, pendingID
+}
+
+// newMemoryInsight returns an insight server of the store described by newMemoryServer along with both txids
+func newMemoryInsight(t *testing.T, n *fakenode.Node) (*InsightServer, string, string) {
+	n.Mine(2)
+
+	mined, err := n.NewTx()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	minedID, err := n.AddTx(mined)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n.Mine(1)
+
+	pending, err := n.NewTx()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pendingID, err := n.AddTx(pending)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bc := utxo.New(n.RPCConfig(), fakenode.Coin)
+	db := memory.New(fakenode.Coin)
+
+	blocks, err := bc.GetBlocks([]int{0, 1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, b := range blocks {
+		id, err := db.InsertBlock(b, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		txs := []*utxo.Tx{}
+		for i := range b.Txs {
+			txs = append(txs, &b.Txs[i])
+		}
+
+		if err := db.InsertTxs(id, txs); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mempool, err := bc.GetRawTransactions([]string{pendingID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.InsertTxs(-1, []*utxo.Tx{mempool[0]}); err != nil {
+		t.Fatal(err)
+	}
+
+	return New(bc, db, &config.Config{Coins: []config.Coin{*n.Config()}}), minedID, pendingID
+}
+
+// newRouter routes the endpoints of i under /{coin}
+func newRouter(i *InsightServer) http.Handler {
+	r := chi.NewRouter()
+	r.Route("/{coin}", func(r chi.Router) {
+		r.Use(i.CoinCtx)
+		r.Get("/tx/{txid}", i.TxByTxID)
+		r.Get("/txs", i.TxsByBlockHash)
+		r.Group(func(r chi.Router) {
+			r.Use(i.AddressesCtx)
+			r.Get("/addrs/{addrs}/txs", i.TxHistoryByAddrs)
+			r.Get("/addrs/{addrs}/utxo", i.UtxosByAddrs)
+			r.Get("/addr/{addrs}", i.Addr)
+			r.Get("/addr/{addrs}/balance", i.AddrBalance)
+			r.Get("/addr/{addrs}/totalReceived", i.AddrTotalReceived)
+			r.Get("/addr/{addrs}/totalSent", i.AddrTotalSent)
+			r.Get("/addr/{addrs}/unconfirmedBalance", i.AddrUnconfirmedBalance)
+		})
+		r.Group(func(r chi.Router) {
+			r.Use(i.AddressesBody)
+			r.Post("/addrs/txs", i.TxHistoryByAddrs)
+			r.Post("/addrs/utxo", i.UtxosByAddrs)
+		})
+		r.Group(func(r chi.Router) {
+			r.Use(i.XpubCtx)
+			r.Get("/xpub/{xpub}/utxo", i.XpubUtxos)
+			r.Get("/xpub/{xpub}/txs", i.XpubTxs)
+			r.Get("/xpub/{xpub}/balance", i.XpubBalance)
+			r.Get("/xpub/{xpub}/next", i.XpubNext)
+		})
+	})
+
+	return r
+}
+
+// get decodes the response of the GET request to path into v
+func get(t *testing.T, h http.Handler, path string, v interface{}) {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET %s = %d: %s", path, w.Code, w.Body)
+	}
+
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+}
+
+func TestInsightServer_memory(t *testing.T) {
+	n, err := fakenode.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	h, minedID, pendingID := newMemoryServer(t, n)
+
+	tx := insightTx{}
+	get(t, h, "/btc/tx/"+minedID, &tx)
+
+	if tx.BlockHash != n.BlockHash(3) || tx.Confirmations != 1 || len(tx.Vin) != 1 || tx.Vin[0].Address == "" || tx.Fees == nil {
+		t.Errorf("GET /tx/%s = %+v, want mined in block 3", minedID, tx)
+	}
+
+	// the coinbase of block 1 is spent by the mined tx
+	spent := insightTx{}
+	get(t, h, "/btc/tx/"+tx.Vin[0].TxID, &spent)
+
+	if !spent.IsCoinBase || spent.Vout[0].SpentTxID == nil || *spent.Vout[0].SpentTxID != minedID {
+		t.Errorf("GET /tx/%s = %+v, want coinbase spent by %s", tx.Vin[0].TxID, spent, minedID)
+	}
+
+	pending := insightTx{}
+	get(t, h, "/btc/tx/"+pendingID, &pending)
+
+	if pending.BlockHeight != -1 || pending.Confirmations != 0 {
+		t.Errorf("GET /tx/%s = %+v, want mempool", pendingID, pending)
+	}
+
+	block := insightTxsByBlock{}
+	get(t, h, "/btc/txs?block="+n.BlockHash(3), &block)
+
+	if block.PagesTotal != 1 || len(block.Txs) != 2 {
+		t.Errorf("GET /txs = %+v, want the coinbase and mined tx", block)
+	}
+
+	// every tx pays to the address of the genesis coinbase
+	addr := tx.Vout[0].ScriptPubKey.Addresses[0]
+
+	// the newest page starts with the mempool, followed by the mined tx
+	history := insightTxHistoryByAddrs{}
+	get(t, h, fmt.Sprintf("/btc/addrs/%s/txs?from=0&to=2", addr), &history)
+
+	if history.TotalItems != 6 || len(history.Txs) != 2 || history.Txs[0].TxID != pendingID || history.Txs[1].TxID != minedID {
+		t.Errorf("GET /addrs/%s/txs = %d items, %+v, want 6 items with %s and %s", addr, history.TotalItems, history.Txs, pendingID, minedID)
+	}
+
+	utxos := []insightUtxo{}
+	get(t, h, fmt.Sprintf("/btc/addrs/%s/utxo", addr), &utxos)
+
+	// the coinbases of blocks 0 and 3 and the outputs of both txs, which spend the coinbases of blocks 1 and 2
+	if len(utxos) != 4 {
+		t.Errorf("GET /addrs/%s/utxo = %+v, want 4 utxos", addr, utxos)
+	}
+}
+
+func TestInsightServer_historyOrder(t *testing.T) {
+	n, err := fakenode.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	h, minedID, _ := newMemoryServer(t, n)
+
+	tx := insightTx{}
+	get(t, h, "/btc/tx/"+minedID, &tx)
+	addr := tx.Vout[0].ScriptPubKey.Addresses[0]
+
+	// the mempool tx and the confirmed txs are returned in the same order whichever way the history is paged
+	byRange := insightTxHistoryByAddrs{}
+	get(t, h, fmt.Sprintf("/btc/addrs/%s/txs?from=0&to=6", addr), &byRange)
+
+	byCursor := insightTxHistoryByAddrs{}
+	get(t, h, fmt.Sprintf("/btc/addrs/%s/txs?limit=6", addr), &byCursor)
+
+	if len(byRange.Txs) != 6 || len(byCursor.Txs) != 6 {
+		t.Fatalf("GET /addrs/%s/txs = %d and %d txs, want 6", addr, len(byRange.Txs), len(byCursor.Txs))
+	}
+
+	if byRange.Txs[0].BlockHeight != -1 {
+		t.Errorf("GET /addrs/%s/txs?from=0&to=6 starts with %+v, want the mempool tx", addr, byRange.Txs[0])
+	}
+
+	for j := range byRange.Txs {
+		if byRange.Txs[j].TxID != byCursor.Txs[j].TxID {
+			t.Errorf("tx %d of the history = %s by range and %s by cursor, want the same", j, byRange.Txs[j].TxID, byCursor.Txs[j].TxID)
+		}
+
+		if j > 1 && byRange.Txs[j].BlockHeight > byRange.Txs[j-1].BlockHeight {
+			t.Errorf("tx %d of the history at height %d follows height %d, want newest first", j, byRange.Txs[j].BlockHeight, byRange.Txs[j-1].BlockHeight)
+		}
+	}
+}
+
+func TestInsightServer_cursors(t *testing.T) {
+	n, err := fakenode.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	h, minedID, pendingID := newMemoryServer(t, n)
+
+	tx := insightTx{}
+	get(t, h, "/btc/tx/"+minedID, &tx)
+	addr := tx.Vout[0].ScriptPubKey.Addresses[0]
+
+	// the newest page starts with the mempool
+	first := insightTxHistoryByAddrs{}
+	get(t, h, fmt.Sprintf("/btc/addrs/%s/txs?limit=4", addr), &first)
+
+	if first.TotalItems != 6 || len(first.Txs) != 4 || first.Txs[0].TxID != pendingID || first.Txs[1].TxID != minedID || first.Prev == "" || first.Next == "" {
+		t.Fatalf("GET /addrs/%s/txs?limit=4 = %+v, want 4 of 6 items starting with %s and %s", addr, first, pendingID, minedID)
+	}
+
+	last := insightTxHistoryByAddrs{}
+	get(t, h, fmt.Sprintf("/btc/addrs/%s/txs?limit=4&before=%s", addr, first.Next), &last)
+
+	if len(last.Txs) != 2 || last.Next != "" || last.Txs[1].BlockHeight != 0 {
+		t.Errorf("GET /addrs/%s/txs?before=%s = %+v, want the 2 oldest items without a next cursor", addr, first.Next, last)
+	}
+
+	seen := map[string]bool{}
+	for _, tx := range append(first.Txs, last.Txs...) {
+		seen[tx.TxID] = true
+	}
+
+	if len(seen) != 6 {
+		t.Errorf("pages hold %d distinct txs, want 6", len(seen))
+	}
+
+	// nothing is newer than the mempool tx, paging back from the last page returns the first page
+	newer := insightTxHistoryByAddrs{}
+	get(t, h, fmt.Sprintf("/btc/addrs/%s/txs?after=%s", addr, first.Prev), &newer)
+
+	if len(newer.Txs) != 0 || newer.Prev != "" {
+		t.Errorf("GET /addrs/%s/txs?after=%s = %+v, want no items", addr, first.Prev, newer)
+	}
+
+	back := insightTxHistoryByAddrs{}
+	get(t, h, fmt.Sprintf("/btc/addrs/%s/txs?limit=4&after=%s", addr, last.Prev), &back)
+
+	if len(back.Txs) != 4 || back.Txs[0].TxID != pendingID || back.Next != first.Next {
+		t.Errorf("GET /addrs/%s/txs?after=%s = %+v, want the first page", addr, last.Prev, back)
+	}
+
+	for _, query := range []string{"before=x", "limit=51", "limit=0", "before=" + first.Next + "&after=" + first.Prev, "limit=2&from=0"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", fmt.Sprintf("/btc/addrs/%s/txs?%s", addr, query), nil))
+
+		if w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("GET /addrs/%s/txs?%s = %d, want %d", addr, query, w.Code, http.StatusUnprocessableEntity)
+		}
+	}
+}
+
+func TestInsightServer_addr(t *testing.T) {
+	n, err := fakenode.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	h, minedID, pendingID := newMemoryServer(t, n)
+
+	tx := insightTx{}
+	get(t, h, "/btc/tx/"+minedID, &tx)
+	addr := tx.Vout[0].ScriptPubKey.Addresses[0]
+
+	summary := insightAddrTxs{}
+	get(t, h, "/btc/addr/"+addr, &summary)
+
+	// the coinbases of blocks 0 to 3 and the mined tx are confirmed, the mempool tx isn't
+	if summary.AddrStr != addr || summary.TxApperances != 5 || summary.UnconfirmedTxApperances != 1 {
+		t.Errorf("GET /addr/%s = %+v, want 5 confirmed and 1 unconfirmed txs", addr, summary)
+	}
+
+	if summary.BalanceSat != summary.TotalReceivedSat-summary.TotalSentSat || summary.TotalSentSat == 0 || summary.Balance == 0 {
+		t.Errorf("GET /addr/%s = %+v, want the balance to be the received amount less the sent amount", addr, summary)
+	}
+
+	if len(summary.Transactions) != 6 || summary.Transactions[0] != pendingID || summary.Transactions[1] != minedID {
+		t.Errorf("GET /addr/%s transactions = %v, want 6 txids starting with %s and %s", addr, summary.Transactions, pendingID, minedID)
+	}
+
+	// the balance and the change in balance by the mempool add up to the unspent outputs
+	utxos := []insightUtxo{}
+	get(t, h, fmt.Sprintf("/btc/addrs/%s/utxo", addr), &utxos)
+
+	var unspent int64
+	for _, u := range utxos {
+		unspent += u.Satoshis
+	}
+
+	if summary.BalanceSat+summary.UnconfirmedBalanceSat != unspent {
+		t.Errorf("GET /addr/%s = %+v, want balances adding up to %d", addr, summary, unspent)
+	}
+
+	page := insightAddrTxs{}
+	get(t, h, fmt.Sprintf("/btc/addr/%s?from=1&to=3", addr), &page)
+
+	if len(page.Transactions) != 2 || page.Transactions[0] != minedID {
+		t.Errorf("GET /addr/%s?from=1&to=3 transactions = %v, want 2 txids starting with %s", addr, page.Transactions, minedID)
+	}
+
+	noTxList := map[string]interface{}{}
+	get(t, h, fmt.Sprintf("/btc/addr/%s?noTxList=1", addr), &noTxList)
+
+	if _, ok := noTxList["transactions"]; ok || noTxList["balanceSat"] != float64(summary.BalanceSat) {
+		t.Errorf("GET /addr/%s?noTxList=1 = %v, want the summary without transactions", addr, noTxList)
+	}
+
+	amounts := map[string]int64{
+		"balance":            summary.BalanceSat,
+		"totalReceived":      summary.TotalReceivedSat,
+		"totalSent":          summary.TotalSentSat,
+		"unconfirmedBalance": summary.UnconfirmedBalanceSat,
+	}
+
+	for path, want := range amounts {
+		var got int64
+		get(t, h, fmt.Sprintf("/btc/addr/%s/%s", addr, path), &got)
+
+		if got != want {
+			t.Errorf("GET /addr/%s/%s = %d, want %d", addr, path, got, want)
+		}
+	}
+
+	for _, path := range []string{"/btc/addr/" + addr + "," + addr, "/btc/addr/" + addr + "," + addr + "/balance"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+
+		if w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("GET %s = %d, want %d", path, w.Code, http.StatusUnprocessableEntity)
+		}
+	}
+}
+
+// post decodes the response of the POST request of body with contentType to path into v
+func post(t *testing.T, h http.Handler, path, contentType, body string, v interface{}) {
+	r := httptest.NewRequest("POST", path, strings.NewReader(body))
+	r.Header.Set("Content-Type", contentType)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST %s %s = %d: %s", path, body, w.Code, w.Body)
+	}
+
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("POST %s %s: %v", path, body, err)
+	}
+}
+
+func TestInsightServer_post(t *testing.T) {
+	n, err := fakenode.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	h, minedID, pendingID := newMemoryServer(t, n)
+
+	tx := insightTx{}
+	get(t, h, "/btc/tx/"+minedID, &tx)
+	addr := tx.Vout[0].ScriptPubKey.Addresses[0]
+
+	want := insightTxHistoryByAddrs{}
+	get(t, h, fmt.Sprintf("/btc/addrs/%s/txs?from=0&to=2", addr), &want)
+
+	bodies := map[string]string{
+		"application/json":                  fmt.Sprintf(`{"addrs": "%s", "from": 0, "to": 2}`, addr),
+		"application/x-www-form-urlencoded": fmt.Sprintf("addrs=%s&from=0&to=2", addr),
+	}
+
+	for contentType, body := range bodies {
+		history := insightTxHistoryByAddrs{}
+		post(t, h, "/btc/addrs/txs", contentType, body, &history)
+
+		if history.TotalItems != want.TotalItems || history.To != 2 || len(history.Txs) != 2 || history.Txs[0].TxID != want.Txs[0].TxID || history.Txs[1].TxID != want.Txs[1].TxID {
+			t.Errorf("POST /addrs/txs %s = %+v, want %+v", body, history, want)
+		}
+	}
+
+	// the pagination may also be by cursor, and the same address twice counts once
+	page := insightTxHistoryByAddrs{}
+	post(t, h, "/btc/addrs/txs", "application/json", fmt.Sprintf(`{"addrs": "%s, %s", "limit": 4}`, addr, addr), &page)
+
+	if page.TotalItems != 6 || len(page.Txs) != 4 || page.Txs[0].TxID != pendingID || page.Next == "" {
+		t.Errorf("POST /addrs/txs with a limit = %+v, want 4 of 6 items starting with %s", page, pendingID)
+	}
+
+	wantUtxos := []insightUtxo{}
+	get(t, h, fmt.Sprintf("/btc/addrs/%s/utxo", addr), &wantUtxos)
+
+	utxos := []insightUtxo{}
+	post(t, h, "/btc/addrs/utxo", "application/json", fmt.Sprintf(`{"addrs": "%s"}`, addr), &utxos)
+
+	if len(utxos) != 4 || len(utxos) != len(wantUtxos) || utxos[0] != wantUtxos[0] {
+		t.Errorf("POST /addrs/utxo = %+v, want %+v", utxos, wantUtxos)
+	}
+
+	tooMany := strings.TrimSuffix(strings.Repeat(addr+",", MAX_ADDRESSES+1), ",")
+
+	invalid := []struct {
+		body string
+		code int
+	}{
+		{`{"addrs": ""}`, http.StatusUnprocessableEntity},
+		{fmt.Sprintf(`{"addrs": "%s"}`, tooMany), http.StatusUnprocessableEntity},
+		{fmt.Sprintf(`{"addrs": "%s", "from": 0, "to": 100}`, addr), http.StatusUnprocessableEntity},
+		{fmt.Sprintf(`{"addrs": "%s"`, addr), http.StatusBadRequest},
+	}
+
+	for _, tt := range invalid {
+		for _, path := range []string{"/btc/addrs/txs", "/btc/addrs/utxo"} {
+			// the pagination only applies to txs
+			if path == "/btc/addrs/utxo" && strings.Contains(tt.body, "from") {
+				continue
+			}
+
+			r := httptest.NewRequest("POST", path, strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.code {
+				t.Errorf("POST %s %.80s = %d, want %d", path, tt.body, w.Code, tt.code)
+			}
+		}
+	}
+}
+
+func Test_jsonStream(t *testing.T) {
+	for _, n := range []int{0, 1, UTXO_FLUSH_SIZE, 2*UTXO_FLUSH_SIZE + 1} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		r = r.WithContext(context.WithValue(r.Context(), "status", 203))
+
+		s := newJSONStream(w, r)
+		s.RawByte('[')
+
+		for i := 0; i < n; i++ {
+			s.add(&insightUtxo{TxID: fmt.Sprint(i), Satoshis: int64(i)})
+
+			// nothing is sent before the first flush, so the request can still fail with an error status
+			if !s.begun && (w.Body.Len() != 0 || w.Flushed) {
+				t.Fatalf("jsonStream with %d items wrote %.80s before flushing", n, w.Body)
+			}
+
+			if s.items%UTXO_FLUSH_SIZE == 0 {
+				if err := s.flush(); err != nil {
+					t.Fatalf("flush() after %d items error = %v", s.items, err)
+				}
+			}
+		}
+
+		s.RawByte(']')
+		if err := s.flush(); err != nil {
+			t.Fatalf("flush() of %d items error = %v", n, err)
+		}
+
+		if w.Code != 203 || w.Header().Get("Content-Type") != "application/json" || !w.Flushed {
+			t.Errorf("jsonStream with %d items = %d %v, want 203 json flushed", n, w.Code, w.Header())
+		}
+
+		got := []insightUtxo{}
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("jsonStream with %d items = %.80s: %v", n, w.Body, err)
+		}
+
+		if len(got) != n || (n > 0 && got[n-1].TxID != fmt.Sprint(n-1)) {
+			t.Errorf("jsonStream = %d items, want %d in order", len(got), n)
+		}
+	}
+}
+
+// failAfter is a store failing GetTxsByTxIDs after n calls, as when a tx is deleted between the two queries of a page
+type failAfter struct {
+	storage.Reader
+	n int
+}
+
+func (f *failAfter) GetTxsByTxIDs(ctx context.Context, txids []string) ([]*storage.TxDetails, error) {
+	if f.n == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	f.n--
+
+	return f.Reader.GetTxsByTxIDs(ctx, txids)
+}
+
+func TestInsightServer_streamTxHistory(t *testing.T) {
+	n, err := fakenode.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	i, minedID, _ := newMemoryInsight(t, n)
+	store := i.db
+
+	// two chunks
+	txids := make([]string, TXS_CHUNK_SIZE+1)
+	for j := range txids {
+		txids[j] = minedID
+	}
+
+	tests := []struct {
+		name     string
+		calls    int
+		code     int
+		complete bool
+	}{
+		{"First chunk fails", 0, http.StatusInternalServerError, false},
+		{"Second chunk fails", 1, http.StatusOK, false},
+		{"Complete", 2, http.StatusOK, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i.db = &failAfter{Reader: store, n: tt.calls}
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				s := newJSONStream(w, r)
+				if err := i.streamTxHistory(s, &insightTxHistoryByAddrs{TotalItems: len(txids), To: len(txids)}, txids, nil); err != nil {
+					if s.begun {
+						s.abort()
+						return
+					}
+
+					http.Error(w, err.Error(), 500)
+				}
+			}))
+			defer srv.Close()
+
+			resp, err := http.Get(srv.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			// a response aborted after it began can't be read whole, so it isn't taken for a complete page
+			body, err := ioutil.ReadAll(resp.Body)
+			history := insightTxHistoryByAddrs{}
+			complete := err == nil && json.Unmarshal(body, &history) == nil && len(history.Txs) == len(txids)
+
+			if resp.StatusCode != tt.code || complete != tt.complete {
+				t.Errorf("streamTxHistory() = %d, complete %v: %.80s, want %d, complete %v", resp.StatusCode, complete, body, tt.code, tt.complete)
+			}
+		})
+	}
+}
+
+func TestInsightServer_maxAddresses(t *testing.T) {
+	tests := []struct {
+		api  config.API
+		want int
+	}{
+		{config.API{}, MAX_ADDRESSES},
+		{config.API{MaxAddresses: -1}, MAX_ADDRESSES},
+		{config.API{MaxAddresses: 500}, 500},
+	}
+
+	for _, tt := range tests {
+		i := New(nil, nil, &config.Config{API: tt.api})
+
+		if got := i.maxAddresses(); got != tt.want {
+			t.Errorf("maxAddresses() with %+v = %d, want %d", tt.api, got, tt.want)
+		}
+	}
+}
+
+func TestInsightServer_xpub(t *testing.T) {
+	n, err := fakenode.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	i, _, _ := newMemoryInsight(t, n)
+
+	master, err := hdkeychain.NewMaster([]byte("coinquery insight xpub test seed"), &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pub, err := master.Neuter()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	xpub := pub.String()
+
+	d, err := xpubutil.NewDeriver(xpub, "btc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	receive, _ := d.Addrs(0, 0, 5)
+	change, _ := d.Addrs(1, 0, 5)
+
+	// pay 1 btc to receive address 0, 2 btc to receive address 3 and 0.5 btc to change address 1 in the mempool
+	payments := []struct {
+		addr  string
+		value string
+	}{{receive[0], "1.0"}, {receive[3], "2.0"}, {change[1], "0.5"}}
+
+	txs := []*utxo.Tx{}
+	for n, p := range payments {
+		vout := utxo.Vout{Value: json.Number(p.value)}
+		vout.ScriptPubKey.Addresses = []string{p.addr}
+
+		txs = append(txs, &utxo.Tx{TxID: fmt.Sprintf("%064x", n+1), Locktime: "0", Vouts: []utxo.Vout{vout}})
+	}
+
+	if err := i.db.(*memory.Store).InsertTxs(-1, txs); err != nil {
+		t.Fatal(err)
+	}
+
+	h := newRouter(i)
+
+	next := insightXpubNext{}
+	get(t, h, fmt.Sprintf("/btc/xpub/%s/next", xpub), &next)
+
+	if next.ReceiveIndex != 4 || next.ReceiveAddress != receive[4] || next.ChangeIndex != 2 || next.ChangeAddress != change[2] {
+		t.Errorf("GET /xpub/%s/next = %+v, want receive address 4 and change address 2", xpub, next)
+	}
+
+	balance := insightBalance{}
+	get(t, h, fmt.Sprintf("/btc/xpub/%s/balance", xpub), &balance)
+
+	if balance.UnconfirmedBalanceSat != 350000000 || balance.UnconfirmedTxApperances != 3 || balance.BalanceSat != 0 {
+		t.Errorf("GET /xpub/%s/balance = %+v, want 3.5 unconfirmed btc in 3 txs", xpub, balance)
+	}
+
+	utxos := []insightUtxo{}
+	get(t, h, fmt.Sprintf("/btc/xpub/%s/utxo", xpub), &utxos)
+
+	if len(utxos) != 3 {
+		t.Errorf("GET /xpub/%s/utxo = %+v, want 3 utxos", xpub, utxos)
+	}
+
+	history := insightTxHistoryByAddrs{}
+	get(t, h, fmt.Sprintf("/btc/xpub/%s/txs?limit=2", xpub), &history)
+
+	if history.TotalItems != 3 || len(history.Txs) != 2 || history.Next == "" {
+		t.Errorf("GET /xpub/%s/txs?limit=2 = %+v, want 2 of 3 items", xpub, history)
+	}
+
+	// with a gap of 2 the scan stops before receive address 3
+	narrow := insightBalance{}
+	get(t, h, fmt.Sprintf("/btc/xpub/%s/balance?gap=2", xpub), &narrow)
+
+	if narrow.UnconfirmedBalanceSat != 150000000 {
+		t.Errorf("GET /xpub/%s/balance?gap=2 = %+v, want 1.5 unconfirmed btc", xpub, narrow)
+	}
+
+	invalid := []struct {
+		path string
+		code int
+	}{
+		{"/btc/xpub/nope/balance", http.StatusBadRequest},
+		{fmt.Sprintf("/btc/xpub/%s/balance", master), http.StatusBadRequest},
+		{fmt.Sprintf("/btc/xpub/%s/balance?gap=0", xpub), http.StatusUnprocessableEntity},
+		{fmt.Sprintf("/btc/xpub/%s/balance?gap=%d", xpub, MAX_XPUB_GAP+1), http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range invalid {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+
+		if w.Code != tt.code {
+			t.Errorf("GET %.40s = %d, want %d", tt.path, w.Code, tt.code)
+		}
+	}
+
+	// the 3 used addresses exceed a cap of 2, the next addresses are still found as they take no query of used ones
+	i.config.API.MaxAddresses = 2
+
+	capped := []struct {
+		path string
+		code int
+	}{
+		{fmt.Sprintf("/btc/xpub/%s/utxo", xpub), http.StatusRequestEntityTooLarge},
+		{fmt.Sprintf("/btc/xpub/%s/txs", xpub), http.StatusRequestEntityTooLarge},
+		{fmt.Sprintf("/btc/xpub/%s/balance", xpub), http.StatusRequestEntityTooLarge},
+		{fmt.Sprintf("/btc/xpub/%s/next", xpub), http.StatusOK},
+	}
+
+	for _, tt := range capped {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+
+		if w.Code != tt.code {
+			t.Errorf("GET %.40s with 2 addresses at most = %d, want %d", tt.path, w.Code, tt.code)
+		}
+	}
+}
+
+func TestInsightServer_cancelled(t *testing.T) {
+	n, err := fakenode.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	h, minedID, _ := newMemoryServer(t, n)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// a request cancelled by the client or the timeout middleware isn't resolved
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/btc/tx/"+minedID, nil).WithContext(ctx))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("GET /tx/%s with a cancelled context = %d: %s, want %d", minedID, w.Code, w.Body, http.StatusInternalServerError)
+	}
+}
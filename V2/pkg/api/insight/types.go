@@ -24,6 +24,7 @@ type insightTx struct {
 	ValueOut      float64        `json:"valueOut"`
 	ValueIn       float64        `json:"valueIn,omitempty"`
 	Fees          *float64       `json:"fees,omitempty"`
+	cursor        string         // position in the address history, see storage.Cursor
 }
 
 //easyjson:json
@@ -91,6 +92,8 @@ type insightTxHistoryByAddrs struct {
 	TotalItems int          `json:"totalItems"`
 	From       int          `json:"from"`
 	To         int          `json:"to"`
+	Prev       string       `json:"prev,omitempty"` // cursor of the newest item, to page newer txs with after
+	Next       string       `json:"next,omitempty"` // cursor of the oldest item, to page older txs with before
 	Txs        []*insightTx `json:"items"`
 }
 
@@ -99,3 +102,39 @@ type insightTxsByBlock struct {
 	PagesTotal int          `json:"pagesTotal"`
 	Txs        []*insightTx `json:"txs"`
 }
+
+// insightBalance holds the amounts and number of transactions of one or more addresses, amounts are confirmed unless
+// stated otherwise
+type insightBalance struct {
+	Balance                 float64 `json:"balance"`
+	BalanceSat              int64   `json:"balanceSat"`
+	TotalReceived           float64 `json:"totalReceived"`
+	TotalReceivedSat        int64   `json:"totalReceivedSat"`
+	TotalSent               float64 `json:"totalSent"`
+	TotalSentSat            int64   `json:"totalSentSat"`
+	UnconfirmedBalance      float64 `json:"unconfirmedBalance"`
+	UnconfirmedBalanceSat   int64   `json:"unconfirmedBalanceSat"`
+	UnconfirmedTxApperances int     `json:"unconfirmedTxApperances"`
+	TxApperances            int     `json:"txApperances"`
+}
+
+// insightAddr is the summary of an address
+type insightAddr struct {
+	AddrStr string `json:"addrStr"`
+	insightBalance
+}
+
+// insightAddrTxs is the summary of an address along with a page of its txids, newest first
+type insightAddrTxs struct {
+	insightAddr
+	Transactions []string `json:"transactions"`
+}
+
+// insightXpubNext holds the first unused receive and change addresses of an xpub past its last used ones, along with
+// their indexes in the receive and change chains
+type insightXpubNext struct {
+	ReceiveAddress string `json:"receiveAddress"`
+	ReceiveIndex   int    `json:"receiveIndex"`
+	ChangeAddress  string `json:"changeAddress"`
+	ChangeIndex    int    `json:"changeIndex"`
+}
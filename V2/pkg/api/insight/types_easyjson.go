@@ -813,6 +813,10 @@ func easyjson6601e8cdDecodeGithubComshapeshift-legacyCoinqueryV2PkgApiInsight5(i
 			out.From = int(in.Int())
 		case "to":
 			out.To = int(in.Int())
+		case "prev":
+			out.Prev = string(in.String())
+		case "next":
+			out.Next = string(in.String())
 		case "items":
 			if in.IsNull() {
 				in.Skip()
@@ -873,6 +877,16 @@ func easyjson6601e8cdEncodeGithubComshapeshift-legacyCoinqueryV2PkgApiInsight5(o
 		out.RawString(prefix)
 		out.Int(int(in.To))
 	}
+	if in.Prev != "" {
+		const prefix string = ",\"prev\":"
+		out.RawString(prefix)
+		out.String(string(in.Prev))
+	}
+	if in.Next != "" {
+		const prefix string = ",\"next\":"
+		out.RawString(prefix)
+		out.String(string(in.Next))
+	}
 	{
 		const prefix string = ",\"items\":"
 		out.RawString(prefix)
@@ -12,18 +12,18 @@ import (
 	"github.com/shapeshift-legacy/coinquery/V2/config"
 	"github.com/shapeshift-legacy/coinquery/V2/internal/log"
 	"github.com/shapeshift-legacy/coinquery/V2/pkg/blockchain/utxo"
-	"github.com/shapeshift-legacy/coinquery/V2/pkg/postgres"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/storage"
 )
 
 // Server will hold connection to the db as well as handlers
 type Server struct {
 	bc     *utxo.Blockchain
-	db     *postgres.Database
+	db     storage.Reader
 	config *config.Config
 }
 
 // New returns a new Server
-func New(bc *utxo.Blockchain, db *postgres.Database, c *config.Config) *Server {
+func New(bc *utxo.Blockchain, db storage.Reader, c *config.Config) *Server {
 	return &Server{
 		bc:     bc,
 		db:     db,
@@ -65,7 +65,7 @@ func (i *Server) Info(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	b, err := i.db.LastBlock()
+	b, err := i.db.LastBlock(r.Context())
 	if err != nil {
 		log.Error(err, "server", "error resolving /info")
 		http.Error(w, fmt.Sprintf("%v\n", err), 404)
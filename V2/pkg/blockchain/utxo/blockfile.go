@@ -0,0 +1,314 @@
+package utxo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/pkg/errors"
+)
+
+// medianTimeSpan is the number of blocks the median time past is taken over
+const medianTimeSpan = 11
+
+// blockFileNets are the network magic prefixing each block record of the block files of coins whose blocks can be
+// decoded with btcd wire
+var blockFileNets = map[string]wire.BitcoinNet{
+	"btc":        wire.MainNet,
+	"btctestnet": wire.TestNet3,
+}
+
+// BlockGetter returns verbose blocks by heights ([]int) or hashes ([]string)
+type BlockGetter interface {
+	GetBlocks(val interface{}) ([]*Block, error)
+}
+
+// BlockFiles reads blocks directly from the blk*.dat files of a bitcoin core blocks directory, avoiding the json
+// encoding of getblock and the node cpu it costs. Blocks of the main chain of the block index are read from the
+// block files, anything else is passed to the fallback.
+type BlockFiles struct {
+	dir      string
+	net      wire.BitcoinNet
+	decoder  *RawDecoder
+	fallback BlockGetter
+	xor      []byte                 // key block files are obfuscated with, nil if not obfuscated
+	chain    []*blockIndexEntry     // main chain of the block index by height
+	heights  map[chainhash.Hash]int // height of main chain blocks by hash
+	mu       sync.Mutex             // guards files
+	files    map[int]*os.File
+}
+
+// NewBlockFiles loads the block index of the blocks directory dir of a coin node. The index is read once, so blocks
+// the node writes afterwards are passed to fallback.
+func NewBlockFiles(dir, coin string, fallback BlockGetter) (*BlockFiles, error) {
+	net, ok := blockFileNets[coin]
+	if !ok {
+		return nil, errors.Errorf("block files not supported for coin: %s", coin)
+	}
+
+	decoder, err := NewRawDecoder(coin)
+	if err != nil {
+		return nil, err
+	}
+
+	// bitcoin core 28+ xors block files with a random key
+	xor, err := ioutil.ReadFile(filepath.Join(dir, "xor.dat"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "failed to read block files xor key")
+	}
+
+	if len(xor) > 0 && len(xor) != 8 {
+		return nil, errors.Errorf("invalid block files xor key length: %d", len(xor))
+	}
+
+	// an all zero key leaves block files as is
+	if bytes.Equal(xor, make([]byte, 8)) {
+		xor = nil
+	}
+
+	entries, err := loadBlockIndex(filepath.Join(dir, "index"))
+	if err != nil {
+		return nil, err
+	}
+
+	chain, err := mainChain(entries)
+	if err != nil {
+		return nil, err
+	}
+
+	heights := make(map[chainhash.Hash]int, len(chain))
+	for _, e := range chain {
+		heights[e.hash] = e.height
+	}
+
+	return &BlockFiles{
+		dir:      dir,
+		net:      net,
+		decoder:  decoder,
+		fallback: fallback,
+		xor:      xor,
+		chain:    chain,
+		heights:  heights,
+		files:    make(map[int]*os.File),
+	}, nil
+}
+
+// Height returns the height of the last block read from the block files. The tip of the block index is passed to
+// the fallback since its next block hash is not known yet.
+func (f *BlockFiles) Height() int {
+	return len(f.chain) - 2
+}
+
+// GetBlocks returns an array of verbose blocks using an array of heights ([]int) or hashes ([]string).
+// Blocks above Height, off the main chain or missing from the block files are fetched from the fallback in a single call.
+func (f *BlockFiles) GetBlocks(val interface{}) ([]*Block, error) {
+	var heights []int
+
+	switch v := val.(type) {
+	case []int:
+		heights = v
+	case []string:
+		heights = make([]int, len(v))
+		for i, hash := range v {
+			heights[i] = -1
+
+			h, err := chainhash.NewHashFromStr(hash)
+			if err != nil {
+				continue
+			}
+
+			if height, ok := f.heights[*h]; ok {
+				heights[i] = height
+			}
+		}
+	default:
+		return nil, fmt.Errorf("Blocks val must be of type []int or []string, instead of %T", v)
+	}
+
+	blocks := make([]*Block, len(heights))
+	missing := []int{}
+
+	for i, height := range heights {
+		if height < 0 || height > f.Height() || !f.chain[height].haveData() {
+			missing = append(missing, i)
+			continue
+		}
+
+		b, err := f.readBlock(height)
+		if err != nil {
+			return nil, err
+		}
+
+		blocks[i] = b
+	}
+
+	if len(missing) == 0 {
+		return blocks, nil
+	}
+
+	var fallbackVal interface{}
+
+	switch v := val.(type) {
+	case []int:
+		vals := make([]int, len(missing))
+		for i, m := range missing {
+			vals[i] = v[m]
+		}
+		fallbackVal = vals
+	case []string:
+		vals := make([]string, len(missing))
+		for i, m := range missing {
+			vals[i] = v[m]
+		}
+		fallbackVal = vals
+	}
+
+	fetched, err := f.fallback.GetBlocks(fallbackVal)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(fetched) != len(missing) {
+		return nil, errors.Errorf("expected %d blocks from fallback, got %d", len(missing), len(fetched))
+	}
+
+	for i, m := range missing {
+		blocks[m] = fetched[i]
+	}
+
+	return blocks, nil
+}
+
+// Close closes the open block files
+func (f *BlockFiles) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var err error
+	for n, file := range f.files {
+		if cerr := file.Close(); cerr != nil && err == nil {
+			err = errors.Wrapf(cerr, "failed to close block file: %d", n)
+		}
+	}
+
+	f.files = make(map[int]*os.File)
+
+	return err
+}
+
+// readBlock reads and decodes the main chain block at height, setting the fields that depend on the rest of the chain
+// from the block index
+func (f *BlockFiles) readBlock(height int) (*Block, error) {
+	e := f.chain[height]
+
+	raw, err := f.readRecord(e.file, e.dataPos)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read block: %s", e.hash)
+	}
+
+	b, err := f.decoder.DecodeBlock(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	if b.Hash != e.hash.String() {
+		return nil, errors.Errorf("block file %d at %d has block %s, expected: %s", e.file, e.dataPos, b.Hash, e.hash)
+	}
+
+	b.Height = height
+	b.MedianTime = f.medianTime(height)
+	b.Difficulty = difficulty(e.header.Bits)
+	b.Chainwork = fmt.Sprintf("%064x", e.chainwork)
+	b.NextHash = f.chain[height+1].hash.String()
+
+	// the node doesn't report a previous block for genesis
+	if height == 0 {
+		b.PrevHash = ""
+	}
+
+	return b, nil
+}
+
+// readRecord reads the serialized block at pos of block file n, checking the network magic and size preceding it
+func (f *BlockFiles) readRecord(n int, pos int64) ([]byte, error) {
+	file, err := f.file(n)
+	if err != nil {
+		return nil, err
+	}
+
+	if pos < 8 {
+		return nil, errors.Errorf("invalid block position: %d", pos)
+	}
+
+	header := make([]byte, 8)
+	if _, err := file.ReadAt(header, pos-8); err != nil {
+		return nil, errors.Wrapf(err, "failed to read block record header of file %d at %d", n, pos)
+	}
+	f.unxor(header, pos-8)
+
+	if magic := wire.BitcoinNet(binary.LittleEndian.Uint32(header[:4])); magic != f.net {
+		return nil, errors.Errorf("unexpected network magic %s in file %d at %d", magic, n, pos)
+	}
+
+	size := binary.LittleEndian.Uint32(header[4:])
+	if size > wire.MaxMessagePayload {
+		return nil, errors.Errorf("block record too large in file %d at %d: %d bytes", n, pos, size)
+	}
+
+	raw := make([]byte, size)
+	if _, err := file.ReadAt(raw, pos); err != nil {
+		return nil, errors.Wrapf(err, "failed to read block record of file %d at %d", n, pos)
+	}
+	f.unxor(raw, pos)
+
+	return raw, nil
+}
+
+// file returns block file n, opening it on first use. Files are read with ReadAt so they can be shared between goroutines.
+func (f *BlockFiles) file(n int) (*os.File, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if file, ok := f.files[n]; ok {
+		return file, nil
+	}
+
+	file, err := os.Open(filepath.Join(f.dir, fmt.Sprintf("blk%05d.dat", n)))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open block file: %d", n)
+	}
+
+	f.files[n] = file
+
+	return file, nil
+}
+
+// unxor removes the obfuscation of b read at offset of a block file
+func (f *BlockFiles) unxor(b []byte, offset int64) {
+	if f.xor == nil {
+		return
+	}
+
+	for i := range b {
+		b[i] ^= f.xor[(offset+int64(i))%int64(len(f.xor))]
+	}
+}
+
+// medianTime returns the median time of the block at height and up to 10 blocks before it
+func (f *BlockFiles) medianTime(height int) int {
+	times := []int{}
+	for h := height; h >= 0 && h > height-medianTimeSpan; h-- {
+		times = append(times, int(f.chain[h].header.Timestamp.Unix()))
+	}
+
+	sort.Ints(times)
+
+	return times[len(times)/2]
+}
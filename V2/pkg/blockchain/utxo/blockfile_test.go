@@ -0,0 +1,293 @@
+// +build unit
+
+package utxo
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// blocksDir is a btc blocks directory of genesis and three blocks on top of it, a stale block at height 2 and a
+// header only block at height 4
+var blocksDir = filepath.Join("testdata", "blocks")
+
+// fallbackBlocks records the values passed to GetBlocks and returns a block for each of them
+type fallbackBlocks struct {
+	vals []interface{}
+}
+
+func (f *fallbackBlocks) GetBlocks(val interface{}) ([]*Block, error) {
+	f.vals = append(f.vals, val)
+
+	blocks := []*Block{}
+
+	switch v := val.(type) {
+	case []int:
+		for _, h := range v {
+			blocks = append(blocks, &Block{BlockHeader: BlockHeader{Height: h}})
+		}
+	case []string:
+		for _, h := range v {
+			blocks = append(blocks, &Block{BlockHeader: BlockHeader{Hash: h}})
+		}
+	}
+
+	return blocks, nil
+}
+
+func TestNewBlockFiles(t *testing.T) {
+	tests := []struct {
+		name       string
+		dir        string
+		coin       string
+		wantHeight int
+		wantErr    bool
+	}{
+		{
+			name:       "Success",
+			dir:        blocksDir,
+			coin:       "btc",
+			wantHeight: 2,
+			wantErr:    false,
+		},
+		{
+			name:    "Unsupported Coin",
+			dir:     blocksDir,
+			coin:    "doge",
+			wantErr: true,
+		},
+		{
+			name:    "Missing Index",
+			dir:     "testdata",
+			coin:    "btc",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewBlockFiles(tt.dir, tt.coin, &fallbackBlocks{})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewBlockFiles() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			defer f.Close()
+
+			if got := f.Height(); got != tt.wantHeight {
+				t.Errorf("BlockFiles.Height() = %d, want %d", got, tt.wantHeight)
+			}
+		})
+	}
+}
+
+func TestBlockFiles_GetBlocks(t *testing.T) {
+	fallback := &fallbackBlocks{}
+
+	f, err := NewBlockFiles(blocksDir, "btc", fallback)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	got, err := f.GetBlocks([]int{0, 1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(fallback.vals) != 0 {
+		t.Errorf("BlockFiles.GetBlocks() fallback called with %v", fallback.vals)
+	}
+
+	// genesis matches getblock of the node other than the next block, which is synthetic in the fixture
+	rpc := []struct {
+		Result *Block `json:"result"`
+	}{}
+	if err := json.Unmarshal(getFixture(t, "blockverbose.fixture"), &rpc); err != nil {
+		t.Fatal(err)
+	}
+
+	want := rpc[0].Result.BlockHeader
+	want.NextHash = got[1].Hash
+
+	if !reflect.DeepEqual(got[0].BlockHeader, want) {
+		t.Errorf("BlockFiles.GetBlocks() genesis = %+v, want %+v", got[0].BlockHeader, want)
+	}
+
+	for i, b := range got {
+		if b.Height != i {
+			t.Errorf("BlockFiles.GetBlocks() height = %d, want %d", b.Height, i)
+		}
+		if i > 0 && b.PrevHash != got[i-1].Hash {
+			t.Errorf("BlockFiles.GetBlocks() block %d prev = %s, want %s", i, b.PrevHash, got[i-1].Hash)
+		}
+		if i < len(got)-1 && b.NextHash != got[i+1].Hash {
+			t.Errorf("BlockFiles.GetBlocks() block %d next = %s, want %s", i, b.NextHash, got[i+1].Hash)
+		}
+	}
+
+	b := got[2]
+	if b.Chainwork != "0000000000000000000000000000000000000000000000000000000300030003" || b.Difficulty != "1" || b.MedianTime != 1231007105 {
+		t.Errorf("BlockFiles.GetBlocks() chainwork = %s, difficulty = %s, mediantime = %d", b.Chainwork, b.Difficulty, b.MedianTime)
+	}
+
+	if len(b.Txs) != 2 || b.Txs[1].Vins[0].TxID != got[1].Txs[0].TxID || len(b.Txs[1].Vins[0].TxInWitness) != 2 || b.Txs[1].Vouts[0].ScriptPubKey.Type != "scripthash" {
+		t.Errorf("BlockFiles.GetBlocks() txs = %+v", b.Txs)
+	}
+
+	if got[1].Txs[0].Vouts[1].ScriptPubKey.Type != "witness_v0_keyhash" {
+		t.Errorf("BlockFiles.GetBlocks() vout = %+v", got[1].Txs[0].Vouts[1])
+	}
+
+	// the tip and blocks off the main chain are fetched from the fallback in block order
+	stale := "0000000000000000000000000000000000000000000000000000000000000001"
+
+	mixed, err := f.GetBlocks([]string{got[1].Hash, stale, got[2].Hash})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if mixed[0].Hash != got[1].Hash || mixed[1].Hash != stale || mixed[2].Hash != got[2].Hash || mixed[2].Height != 2 {
+		t.Errorf("BlockFiles.GetBlocks() = %+v", mixed)
+	}
+
+	tip, err := f.GetBlocks([]int{2, 3, 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tip[0].Hash != got[2].Hash || tip[1].Height != 3 || tip[2].Height != 4 {
+		t.Errorf("BlockFiles.GetBlocks() = %+v", tip)
+	}
+
+	wantVals := []interface{}{[]string{stale}, []int{3, 4}}
+	if !reflect.DeepEqual(fallback.vals, wantVals) {
+		t.Errorf("BlockFiles.GetBlocks() fallback vals = %v, want %v", fallback.vals, wantVals)
+	}
+}
+
+func TestBlockFiles_xor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blocks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key := []byte{0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef}
+
+	raw, err := ioutil.ReadFile(filepath.Join(blocksDir, "blk00000.dat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	xored := make([]byte, len(raw))
+	for i := range raw {
+		xored[i] = raw[i] ^ key[i%len(key)]
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "blk00000.dat"), xored, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "xor.dat"), key, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Mkdir(filepath.Join(dir, "index"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := ioutil.ReadDir(filepath.Join(blocksDir, "index"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, fi := range files {
+		b, err := ioutil.ReadFile(filepath.Join(blocksDir, "index", fi.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(filepath.Join(dir, "index", fi.Name()), b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	plain, err := NewBlockFiles(blocksDir, "btc", &fallbackBlocks{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plain.Close()
+
+	obfuscated, err := NewBlockFiles(dir, "btc", &fallbackBlocks{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer obfuscated.Close()
+
+	want, err := plain.GetBlocks([]int{0, 1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := obfuscated.GetBlocks([]int{0, 1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("BlockFiles.GetBlocks() = %+v, want %+v", got, want)
+	}
+}
+
+func Test_readVarInt(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     []byte
+		want    uint64
+		wantErr bool
+	}{
+		{name: "Zero", raw: []byte{0x00}, want: 0},
+		{name: "One Byte", raw: []byte{0x7f}, want: 127},
+		{name: "Two Bytes", raw: []byte{0x80, 0x00}, want: 128},
+		{name: "Two Bytes Max", raw: []byte{0xff, 0x7f}, want: 16511},
+		{name: "Three Bytes", raw: []byte{0x82, 0xfe, 0x7f}, want: 65535},
+		{name: "Truncated", raw: []byte{0x80}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readVarInt(bytes.NewReader(tt.raw))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("readVarInt() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("readVarInt() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_difficulty(t *testing.T) {
+	tests := []struct {
+		name string
+		bits uint32
+		want string
+	}{
+		{name: "Minimum", bits: 0x1d00ffff, want: "1"},
+		{name: "Block 100000", bits: 0x1b04864c, want: "14484.1623612254"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := difficulty(tt.bits); string(got) != tt.want {
+				t.Errorf("difficulty() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
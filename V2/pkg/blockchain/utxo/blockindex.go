@@ -0,0 +1,286 @@
+package utxo
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math/big"
+	"sort"
+	"strconv"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/pkg/errors"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// block index status flags (bitcoin core chain.h)
+const (
+	blockValidMask    = 0x07
+	blockValidScripts = 5
+	blockHaveData     = 0x08
+	blockHaveUndo     = 0x10
+	blockFailedMask   = 0x60
+)
+
+// obfuscateKey is the leveldb key of the xor key applied to values of an obfuscated bitcoin core database
+var obfuscateKey = []byte("\x0e\x00obfuscate_key")
+
+// blockIndexEntry is a block of the leveldb block index of a bitcoin core node
+type blockIndexEntry struct {
+	hash      chainhash.Hash
+	header    wire.BlockHeader
+	height    int
+	status    uint64
+	file      int
+	dataPos   int64
+	chainwork *big.Int // total work of the chain up to and including this block
+}
+
+// haveData reports if the block is stored in a block file
+func (e *blockIndexEntry) haveData() bool {
+	return e.status&blockHaveData != 0
+}
+
+// valid reports if the block has been fully validated and not marked as failed
+func (e *blockIndexEntry) valid() bool {
+	return e.status&blockValidMask >= blockValidScripts && e.status&blockFailedMask == 0
+}
+
+// loadBlockIndex reads all block entries of the leveldb block index at path. The database is opened read only so the
+// index of a running node can be read, entries the node has not flushed yet are missing.
+func loadBlockIndex(path string) (map[chainhash.Hash]*blockIndexEntry, error) {
+	db, err := leveldb.OpenFile(path, &opt.Options{ReadOnly: true, ErrorIfMissing: true})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open block index: %s", path)
+	}
+	defer db.Close()
+
+	var xor []byte
+	if v, err := db.Get(obfuscateKey, nil); err == nil && len(v) > 1 {
+		xor = v[1:]
+	}
+
+	entries := make(map[chainhash.Hash]*blockIndexEntry)
+
+	iter := db.NewIterator(util.BytesPrefix([]byte{'b'}), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		key := iter.Key()
+		if len(key) != 1+chainhash.HashSize {
+			continue
+		}
+
+		value := append([]byte{}, iter.Value()...)
+		if len(xor) > 0 {
+			for i := range value {
+				value[i] ^= xor[i%len(xor)]
+			}
+		}
+
+		e, err := decodeBlockIndexEntry(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to decode block index entry: %x", key[1:])
+		}
+
+		copy(e.hash[:], key[1:])
+
+		if e.header.BlockHash() != e.hash {
+			return nil, errors.Errorf("block index entry header does not match hash: %s", e.hash)
+		}
+
+		entries[e.hash] = e
+	}
+
+	if err := iter.Error(); err != nil {
+		return nil, errors.Wrapf(err, "failed to read block index: %s", path)
+	}
+
+	return entries, nil
+}
+
+// decodeBlockIndexEntry decodes a serialized CDiskBlockIndex
+func decodeBlockIndexEntry(value []byte) (*blockIndexEntry, error) {
+	r := bytes.NewReader(value)
+	e := &blockIndexEntry{}
+
+	// client version
+	if _, err := readVarInt(r); err != nil {
+		return nil, err
+	}
+
+	height, err := readVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.status, err = readVarInt(r); err != nil {
+		return nil, err
+	}
+
+	// tx count
+	if _, err := readVarInt(r); err != nil {
+		return nil, err
+	}
+
+	if e.status&(blockHaveData|blockHaveUndo) != 0 {
+		file, err := readVarInt(r)
+		if err != nil {
+			return nil, err
+		}
+
+		e.file = int(file)
+	}
+
+	if e.status&blockHaveData != 0 {
+		pos, err := readVarInt(r)
+		if err != nil {
+			return nil, err
+		}
+
+		e.dataPos = int64(pos)
+	}
+
+	if e.status&blockHaveUndo != 0 {
+		if _, err := readVarInt(r); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := e.header.Deserialize(r); err != nil {
+		return nil, errors.Wrap(err, "failed to deserialize block header")
+	}
+
+	e.height = int(height)
+
+	return e, nil
+}
+
+// readVarInt reads a bitcoin core VARINT, a big endian base 128 encoding where each continuation byte adds one so
+// that every number has a single encoding
+func readVarInt(r io.ByteReader) (uint64, error) {
+	var n uint64
+
+	for i := 0; i < 10; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to read varint")
+		}
+
+		n = n<<7 | uint64(b&0x7f)
+
+		if b&0x80 == 0 {
+			return n, nil
+		}
+
+		n++
+	}
+
+	return 0, errors.New("varint too long")
+}
+
+// mainChain returns the blocks of the valid chain with the most work, indexed by height
+func mainChain(entries map[chainhash.Hash]*blockIndexEntry) ([]*blockIndexEntry, error) {
+	sorted := make([]*blockIndexEntry, 0, len(entries))
+	for _, e := range entries {
+		sorted = append(sorted, e)
+	}
+
+	// parents before children so chainwork accumulates from genesis
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].height < sorted[j].height
+	})
+
+	var tip *blockIndexEntry
+
+	for _, e := range sorted {
+		e.chainwork = blockWork(e.header.Bits)
+
+		if parent, ok := entries[e.header.PrevBlock]; ok && parent.chainwork != nil {
+			e.chainwork.Add(e.chainwork, parent.chainwork)
+		}
+
+		if !e.valid() || !e.haveData() {
+			continue
+		}
+
+		if tip == nil || e.chainwork.Cmp(tip.chainwork) > 0 {
+			tip = e
+		}
+	}
+
+	if tip == nil {
+		return nil, errors.New("no valid blocks in block index")
+	}
+
+	chain := make([]*blockIndexEntry, tip.height+1)
+
+	for e := tip; e != nil; e = entries[e.header.PrevBlock] {
+		if e.height < 0 || e.height >= len(chain) || chain[e.height] != nil {
+			return nil, errors.Errorf("inconsistent height in block index: %s", e.hash)
+		}
+
+		chain[e.height] = e
+
+		if e.height == 0 {
+			break
+		}
+	}
+
+	if chain[0] == nil {
+		return nil, errors.Errorf("block index chain does not reach genesis from tip: %s", tip.hash)
+	}
+
+	return chain, nil
+}
+
+// blockWork returns the expected number of hashes to find a block with the target of bits, 2^256 / (target + 1)
+func blockWork(bits uint32) *big.Int {
+	target := compactToBig(bits)
+	if target.Sign() <= 0 {
+		return big.NewInt(0)
+	}
+
+	work := new(big.Int).Lsh(big.NewInt(1), 256)
+
+	return work.Div(work, target.Add(target, big.NewInt(1)))
+}
+
+// compactToBig converts the compact representation of a target to a big integer
+func compactToBig(bits uint32) *big.Int {
+	mantissa := int64(bits & 0x007fffff)
+	exponent := uint(bits >> 24)
+
+	var n *big.Int
+	if exponent <= 3 {
+		n = big.NewInt(mantissa >> (8 * (3 - exponent)))
+	} else {
+		n = new(big.Int).Lsh(big.NewInt(mantissa), 8*(exponent-3))
+	}
+
+	if bits&0x00800000 != 0 {
+		n.Neg(n)
+	}
+
+	return n
+}
+
+// difficulty returns the difficulty of bits relative to the minimum difficulty, computed and formatted the same way
+// as the node
+func difficulty(bits uint32) json.Number {
+	shift := int(bits>>24) & 0xff
+	diff := float64(0x0000ffff) / float64(bits&0x00ffffff)
+
+	for ; shift < 29; shift++ {
+		diff *= 256.0
+	}
+
+	for ; shift > 29; shift-- {
+		diff /= 256.0
+	}
+
+	return json.Number(strconv.FormatFloat(diff, 'g', 16, 64))
+}
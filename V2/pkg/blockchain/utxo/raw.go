@@ -0,0 +1,289 @@
+package utxo
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/pkg/errors"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/cashaddr"
+)
+
+// witnessScaleFactor is the weight of non witness data relative to witness data (BIP141)
+const witnessScaleFactor = 4
+
+// address encoding parameters for coins not defined in chaincfg
+var (
+	ltcParams  = &chaincfg.Params{Name: "ltc", PubKeyHashAddrID: 0x30, ScriptHashAddrID: 0x32, Bech32HRPSegwit: "ltc"}
+	dgbParams  = &chaincfg.Params{Name: "dgb", PubKeyHashAddrID: 0x1e, ScriptHashAddrID: 0x3f, Bech32HRPSegwit: "dgb"}
+	dogeParams = &chaincfg.Params{Name: "doge", PubKeyHashAddrID: 0x1e, ScriptHashAddrID: 0x16}
+	dashParams = &chaincfg.Params{Name: "dash", PubKeyHashAddrID: 0x4c, ScriptHashAddrID: 0x10}
+)
+
+var netParams = map[string]*chaincfg.Params{
+	"btc":        &chaincfg.MainNetParams,
+	"btctestnet": &chaincfg.TestNet3Params,
+	"bch":        &chaincfg.MainNetParams,
+	"ltc":        ltcParams,
+	"dgb":        dgbParams,
+	"doge":       dogeParams,
+	"dash":       dashParams,
+}
+
+// RawDecoder decodes serialized blocks and transactions into the verbose format returned by the node
+type RawDecoder struct {
+	coin   string
+	params *chaincfg.Params
+}
+
+// NewRawDecoder returns a RawDecoder using the address encoding of coin
+func NewRawDecoder(coin string) (*RawDecoder, error) {
+	params, ok := netParams[coin]
+	if !ok {
+		return nil, errors.Errorf("raw decoding not supported for coin: %s", coin)
+	}
+
+	return &RawDecoder{
+		coin:   coin,
+		params: params,
+	}, nil
+}
+
+// BlockHash returns the hash of a serialized block from its 80 byte header
+func BlockHash(raw []byte) (string, error) {
+	if len(raw) < wire.MaxBlockHeaderPayload {
+		return "", errors.Errorf("block too short: %d bytes", len(raw))
+	}
+
+	return chainhash.DoubleHashH(raw[:wire.MaxBlockHeaderPayload]).String(), nil
+}
+
+// TxHash returns the txid of a serialized transaction without decoding its scripts, so that a transaction the decoder
+// doesn't support can still be fetched from the node. The witness of a segwit transaction is left out of the hash.
+func TxHash(raw []byte) (string, error) {
+	if len(raw) < 10 {
+		return "", errors.Errorf("tx too short: %d bytes", len(raw))
+	}
+
+	// a segwit transaction has a 0 marker in place of the input count, followed by a non zero flag
+	if raw[4] != 0 || raw[5] == 0 {
+		return chainhash.DoubleHashH(raw).String(), nil
+	}
+
+	r := bytes.NewReader(raw[6:])
+
+	skip := func(n uint64) error {
+		if n > uint64(r.Len()) {
+			return io.ErrUnexpectedEOF
+		}
+
+		_, err := r.Seek(int64(n), io.SeekCurrent)
+		return err
+	}
+
+	// skip each input's outpoint, script and sequence, then each output's amount and script
+	items := []struct{ before, after uint64 }{{36, 4}, {8, 0}}
+	for _, item := range items {
+		count, err := wire.ReadVarInt(r, 0)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to read tx")
+		}
+
+		for i := uint64(0); i < count; i++ {
+			if err := skip(item.before); err != nil {
+				return "", errors.Wrap(err, "failed to read tx")
+			}
+
+			n, err := wire.ReadVarInt(r, 0)
+			if err != nil {
+				return "", errors.Wrap(err, "failed to read tx")
+			}
+
+			if err := skip(n + item.after); err != nil {
+				return "", errors.Wrap(err, "failed to read tx")
+			}
+		}
+	}
+
+	witness := len(raw) - r.Len()
+	if witness > len(raw)-4 {
+		return "", errors.New("failed to read tx: missing locktime")
+	}
+
+	stripped := make([]byte, 0, witness+2)
+	stripped = append(stripped, raw[:4]...)
+	stripped = append(stripped, raw[6:witness]...)
+	stripped = append(stripped, raw[len(raw)-4:]...)
+
+	return chainhash.DoubleHashH(stripped).String(), nil
+}
+
+// DecodeTx decodes a serialized transaction
+func (d *RawDecoder) DecodeTx(raw []byte) (*Tx, error) {
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	if err := msgTx.Deserialize(bytes.NewReader(raw)); err != nil {
+		return nil, errors.Wrap(err, "failed to deserialize tx")
+	}
+
+	return d.tx(msgTx)
+}
+
+// DecodeBlock decodes a serialized block. Height, MedianTime, Difficulty, Chainwork and NextHash depend on the
+// rest of the chain and are not set.
+func (d *RawDecoder) DecodeBlock(raw []byte) (*Block, error) {
+	msgBlock := &wire.MsgBlock{}
+	if err := msgBlock.Deserialize(bytes.NewReader(raw)); err != nil {
+		return nil, errors.Wrap(err, "failed to deserialize block")
+	}
+
+	h := msgBlock.Header
+	size := msgBlock.SerializeSize()
+	strippedSize := msgBlock.SerializeSizeStripped()
+
+	b := &Block{
+		BlockHeader: BlockHeader{
+			Hash:         h.BlockHash().String(),
+			Time:         int(h.Timestamp.Unix()),
+			Nonce:        int(h.Nonce),
+			PrevHash:     h.PrevBlock.String(),
+			Bits:         fmt.Sprintf("%08x", h.Bits),
+			Version:      int(h.Version),
+			VersionHex:   fmt.Sprintf("%08x", uint32(h.Version)),
+			MerkleRoot:   h.MerkleRoot.String(),
+			Size:         size,
+			StrippedSize: strippedSize,
+			Weight:       strippedSize*(witnessScaleFactor-1) + size,
+			TxCount:      len(msgBlock.Transactions),
+		},
+		Txs: make([]Tx, 0, len(msgBlock.Transactions)),
+	}
+
+	for _, msgTx := range msgBlock.Transactions {
+		tx, err := d.tx(msgTx)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to decode block: %s", b.Hash)
+		}
+
+		b.Txs = append(b.Txs, *tx)
+	}
+
+	return b, nil
+}
+
+// tx converts a wire transaction into the verbose transaction format
+func (d *RawDecoder) tx(msgTx *wire.MsgTx) (*Tx, error) {
+	var buf bytes.Buffer
+	if err := msgTx.Serialize(&buf); err != nil {
+		return nil, errors.Wrap(err, "failed to serialize tx")
+	}
+
+	size := msgTx.SerializeSize()
+	weight := msgTx.SerializeSizeStripped()*(witnessScaleFactor-1) + size
+
+	tx := &Tx{
+		TxID:     msgTx.TxHash().String(),
+		Hash:     msgTx.WitnessHash().String(),
+		Version:  int(msgTx.Version),
+		Size:     size,
+		VSize:    (weight + witnessScaleFactor - 1) / witnessScaleFactor,
+		Weight:   weight,
+		Locktime: json.Number(strconv.FormatUint(uint64(msgTx.LockTime), 10)),
+		Vins:     make([]Vin, 0, len(msgTx.TxIn)),
+		Vouts:    make([]Vout, 0, len(msgTx.TxOut)),
+		Hex:      hex.EncodeToString(buf.Bytes()),
+	}
+
+	coinbase := isCoinbase(msgTx)
+
+	for _, in := range msgTx.TxIn {
+		vin := Vin{Sequence: int(in.Sequence)}
+
+		if coinbase {
+			vin.Coinbase = hex.EncodeToString(in.SignatureScript)
+		} else {
+			vin.TxID = in.PreviousOutPoint.Hash.String()
+			vin.Vout = int(in.PreviousOutPoint.Index)
+			vin.ScriptSig.Asm, _ = txscript.DisasmString(in.SignatureScript)
+			vin.ScriptSig.Hex = hex.EncodeToString(in.SignatureScript)
+		}
+
+		for _, w := range in.Witness {
+			vin.TxInWitness = append(vin.TxInWitness, hex.EncodeToString(w))
+		}
+
+		tx.Vins = append(tx.Vins, vin)
+	}
+
+	for n, out := range msgTx.TxOut {
+		vout := Vout{
+			Value: json.Number(strconv.FormatFloat(btcutil.Amount(out.Value).ToBTC(), 'f', 8, 64)),
+			N:     n,
+		}
+
+		vout.ScriptPubKey.Asm, _ = txscript.DisasmString(out.PkScript)
+		vout.ScriptPubKey.Hex = hex.EncodeToString(out.PkScript)
+
+		class, addrs, reqSigs, err := txscript.ExtractPkScriptAddrs(out.PkScript, d.params)
+		if err != nil {
+			class = txscript.NonStandardTy
+		}
+
+		vout.ScriptPubKey.Type = class.String()
+
+		// the node does not report addresses for scripts it can't spend
+		if class != txscript.NonStandardTy && class != txscript.NullDataTy && len(addrs) > 0 {
+			vout.ScriptPubKey.ReqSigs = reqSigs
+
+			for _, addr := range addrs {
+				vout.ScriptPubKey.Addresses = append(vout.ScriptPubKey.Addresses, d.encodeAddress(addr))
+			}
+		}
+
+		tx.Vouts = append(tx.Vouts, vout)
+	}
+
+	return tx, nil
+}
+
+// encodeAddress encodes addr the same way as the node, which reports pay to pubkey outputs by pubkey hash address
+// and uses cashaddr format for bch
+func (d *RawDecoder) encodeAddress(addr btcutil.Address) string {
+	if pk, ok := addr.(*btcutil.AddressPubKey); ok {
+		addr = pk.AddressPubKeyHash()
+	}
+
+	if d.coin == "bch" {
+		switch a := addr.(type) {
+		case *btcutil.AddressPubKeyHash:
+			if ca, err := cashaddr.NewCashAddressPubKeyHash(a.ScriptAddress(), d.params); err == nil {
+				return cashaddr.Prefixes[d.params.Name] + ":" + ca.EncodeAddress()
+			}
+		case *btcutil.AddressScriptHash:
+			if ca, err := cashaddr.NewCashAddressScriptHashFromHash(a.ScriptAddress(), d.params); err == nil {
+				return cashaddr.Prefixes[d.params.Name] + ":" + ca.EncodeAddress()
+			}
+		}
+	}
+
+	return addr.EncodeAddress()
+}
+
+// isCoinbase reports if msgTx is a coinbase transaction, having a single input with a null previous outpoint
+func isCoinbase(msgTx *wire.MsgTx) bool {
+	if len(msgTx.TxIn) != 1 {
+		return false
+	}
+
+	prev := msgTx.TxIn[0].PreviousOutPoint
+
+	return prev.Index == math.MaxUint32 && prev.Hash == chainhash.Hash{}
+}
@@ -0,0 +1,252 @@
+// +build unit
+
+package utxo
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+func TestNewRawDecoder(t *testing.T) {
+	tests := []struct {
+		name    string
+		coin    string
+		wantErr bool
+	}{
+		{
+			name:    "Supported",
+			coin:    "btc",
+			wantErr: false,
+		},
+		{
+			name:    "Unsupported",
+			coin:    "xyz",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewRawDecoder(tt.coin)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewRawDecoder() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRawDecoder_DecodeTx(t *testing.T) {
+	tests := []struct {
+		name    string
+		coin    string
+		hex     string
+		want    *Tx
+		wantErr bool
+	}{
+		{
+			name: "Coinbase Pay To Pubkey",
+			coin: "btc",
+			hex:  "01000000010000000000000000000000000000000000000000000000000000000000000000ffffffff0704ffff001d0104ffffffff0100f2052a0100000043410496b538e853519c726a2c91e61ec11600ae1390813a627c66fb8be7947be63c52da7589379515d4e0a604f8141781e62294721166bf621e73a82cbf2342c858eeac00000000",
+			want: &Tx{
+				TxID:     "0e3e2357e806b6cdb1f70b54c3a3a17b6714ee1f0e68bebb44a74b1efd512098",
+				Hash:     "0e3e2357e806b6cdb1f70b54c3a3a17b6714ee1f0e68bebb44a74b1efd512098",
+				Version:  1,
+				Size:     134,
+				VSize:    134,
+				Weight:   536,
+				Locktime: json.Number("0"),
+				Vins: []Vin{
+					Vin{
+						Coinbase: "04ffff001d0104",
+						Sequence: 4294967295,
+					},
+				},
+				Vouts: []Vout{
+					func() Vout {
+						v := Vout{Value: json.Number("50.00000000"), N: 0}
+						v.ScriptPubKey.Asm = "0496b538e853519c726a2c91e61ec11600ae1390813a627c66fb8be7947be63c52da7589379515d4e0a604f8141781e62294721166bf621e73a82cbf2342c858ee OP_CHECKSIG"
+						v.ScriptPubKey.Hex = "410496b538e853519c726a2c91e61ec11600ae1390813a627c66fb8be7947be63c52da7589379515d4e0a604f8141781e62294721166bf621e73a82cbf2342c858eeac"
+						v.ScriptPubKey.ReqSigs = 1
+						v.ScriptPubKey.Type = "pubkey"
+						v.ScriptPubKey.Addresses = []string{"12c6DSiU4Rq3P4ZxziKxzrL5LmMBrzjrJX"}
+						return v
+					}(),
+				},
+				Hex: "01000000010000000000000000000000000000000000000000000000000000000000000000ffffffff0704ffff001d0104ffffffff0100f2052a0100000043410496b538e853519c726a2c91e61ec11600ae1390813a627c66fb8be7947be63c52da7589379515d4e0a604f8141781e62294721166bf621e73a82cbf2342c858eeac00000000",
+			},
+			wantErr: false,
+		},
+		{
+			name:    "Invalid",
+			coin:    "btc",
+			hex:     "0100",
+			want:    nil,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := NewRawDecoder(tt.coin)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			raw, err := hex.DecodeString(tt.hex)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := d.DecodeTx(raw)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("RawDecoder.DecodeTx() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RawDecoder.DecodeTx() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTxHash(t *testing.T) {
+	tests := []struct {
+		name    string
+		hex     string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "Legacy",
+			hex:  "01000000010000000000000000000000000000000000000000000000000000000000000000ffffffff0704ffff001d0104ffffffff0100f2052a0100000043410496b538e853519c726a2c91e61ec11600ae1390813a627c66fb8be7947be63c52da7589379515d4e0a604f8141781e62294721166bf621e73a82cbf2342c858eeac00000000",
+			want: "0e3e2357e806b6cdb1f70b54c3a3a17b6714ee1f0e68bebb44a74b1efd512098",
+		},
+		{
+			name: "Segwit",
+			hex:  "010000000001010000000000000000000000000000000000000000000000000000000000000000ffffffff5404ce0b8e00045100625dfabe6d6de636e65e604dbb0dd0525ff6e79bc6ecc931e2876fbb3ddd68be47b1bba791df100000000000000008600802d701000000142f70726f68617368696e672e636f6d62ea06002f000000000267a33e530f0000001976a914d83c560549b5b5e2fec5bfef8ad18764f631f64e88ac0000000000000000266a24aa21a9ede2f61c3f71d1defd3fa999dfa36953755c690689799962b48bebd836974e8cf90120000000000000000000000000000000000000000000000000000000000000000000000000",
+			want: "ab037d12173abc46f653a9f449da6aaf6522106e7ad11a4025128443fa5e5917",
+		},
+		{
+			name:    "Truncated segwit",
+			hex:     "0100000000010100000000000000000000000000",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid",
+			hex:     "0100",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := hex.DecodeString(tt.hex)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := TxHash(raw)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("TxHash() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("TxHash() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRawDecoder_encodeAddress(t *testing.T) {
+	// pay to pubkey hash output script of 1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa
+	script := "76a91462e907b15cbf27d5425399ebf6f0fb50ebb88f1888ac"
+	tests := []struct {
+		name string
+		coin string
+		want string
+	}{
+		{
+			name: "BTC",
+			coin: "btc",
+			want: "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa",
+		},
+		{
+			name: "BCH",
+			coin: "bch",
+			want: "bitcoincash:qp3wjpa3tjlj042z2wv7hahsldgwhwy0rq9sywjpyy",
+		},
+		{
+			name: "LTC",
+			coin: "ltc",
+			want: "LUEweDxDA4WhvWiNXXSxjM9CYzHPJv4QQF",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := NewRawDecoder(tt.coin)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// single output tx paying to script
+			raw, _ := hex.DecodeString("0100000001" + "0000000000000000000000000000000000000000000000000000000000000001" + "00000000" + "00" + "ffffffff" + "01" + "00e1f50500000000" + "19" + script + "00000000")
+
+			tx, err := d.DecodeTx(raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := tx.Vouts[0].ScriptPubKey
+			if got.Type != "pubkeyhash" || !reflect.DeepEqual(got.Addresses, []string{tt.want}) || tx.Vouts[0].Value != "1.00000000" {
+				t.Errorf("RawDecoder.DecodeTx() scriptPubKey = %+v, want pubkeyhash %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRawDecoder_DecodeBlock(t *testing.T) {
+	var buf bytes.Buffer
+	if err := chaincfg.MainNetParams.GenesisBlock.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := NewRawDecoder("btc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := d.DecodeBlock(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := BlockHeader{
+		Hash:         "000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f",
+		Time:         1231006505,
+		Nonce:        2083236893,
+		PrevHash:     "0000000000000000000000000000000000000000000000000000000000000000",
+		Bits:         "1d00ffff",
+		Version:      1,
+		VersionHex:   "00000001",
+		MerkleRoot:   "4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b",
+		Size:         285,
+		StrippedSize: 285,
+		Weight:       1140,
+		TxCount:      1,
+	}
+
+	if !reflect.DeepEqual(got.BlockHeader, want) {
+		t.Errorf("RawDecoder.DecodeBlock() = %+v, want %+v", got.BlockHeader, want)
+	}
+
+	if len(got.Txs) != 1 || got.Txs[0].TxID != want.MerkleRoot || got.Txs[0].Vouts[0].ScriptPubKey.Addresses[0] != "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa" {
+		t.Errorf("RawDecoder.DecodeBlock() txs = %+v", got.Txs)
+	}
+
+	hash, err := BlockHash(buf.Bytes())
+	if err != nil || hash != want.Hash {
+		t.Errorf("BlockHash() = %s, %v, want %s", hash, err, want.Hash)
+	}
+}
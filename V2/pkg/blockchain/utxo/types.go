@@ -67,6 +67,12 @@ type BlockHeader struct {
 	IsOrphan     bool        `json:"isOrphan"`
 }
 
+// BlockHeaderVerbose contains data returned from getblockheader
+type BlockHeaderVerbose struct {
+	BlockHeader
+	Confirmations int `json:"confirmations"` // -1 if the block is not on the main chain
+}
+
 // Block contains the BlockHeader and array of verbose transactions
 type Block struct {
 	BlockHeader
@@ -123,4 +129,5 @@ type Vout struct {
 type MempoolTx struct {
 	Hash  string
 	Fails int // number of times getting tx from blockchain failed
+	Tx    *Tx // decoded transaction if received raw, skips getting tx from blockchain
 }
@@ -97,6 +97,19 @@ func (b *Blockchain) GetChainTips() ([]*ChainTip, error) {
 	return result, nil
 }
 
+// GetBestBlockHash returns the hash of the best (tip) block in the longest blockchain
+func (b *Blockchain) GetBestBlockHash() (string, error) {
+	req := b.client.NewRPCRequest("getbestblockhash")
+
+	var result string
+
+	if err := b.client.CallRPC(req, &result); err != nil {
+		return "", errors.Wrap(err, "error calling GetBestBlockHash")
+	}
+
+	return result, nil
+}
+
 // GetMempool returns an array of transaction hashes in the current mempool
 func (b *Blockchain) GetMempool() ([]string, error) {
 	req := b.client.NewRPCRequest("getrawmempool")
@@ -135,6 +148,19 @@ func (b *Blockchain) GetBlocks(val interface{}) ([]*Block, error) {
 	return r, nil
 }
 
+// GetBlockHeader returns the verbose block header of the block with the provided hash
+func (b *Blockchain) GetBlockHeader(hash string) (*BlockHeaderVerbose, error) {
+	req := b.client.NewRPCRequest("getblockheader", hash, true)
+
+	result := &BlockHeaderVerbose{}
+
+	if err := b.client.CallRPC(req, result); err != nil {
+		return nil, errors.Wrapf(err, "error calling GetBlockHeader(%s)", hash)
+	}
+
+	return result, nil
+}
+
 // GetBlockHashes returns the block hashes of blocks at the specified heights
 func (b *Blockchain) GetBlockHashes(heights []int) ([]string, error) {
 	reqs := []*http.RPCRequest{}
@@ -284,6 +284,55 @@ func TestBlockchain_GetChainTips(t *testing.T) {
 	}
 }
 
+func TestBlockchain_GetBestBlockHash(t *testing.T) {
+	tests := []struct {
+		name     string
+		fixture  string
+		wantReq  *RequestData
+		wantData string
+		wantErr  bool
+	}{
+		{
+			name:    "Success",
+			fixture: "bestblockhash.fixture",
+			wantReq: &RequestData{
+				method: "POST",
+				body:   `{"jsonrpc":"2.0","id":0,"method":"getbestblockhash","params":null}`,
+			},
+			wantData: "000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f",
+			wantErr:  false,
+		},
+		{
+			name:    "Error",
+			fixture: "error.fixture",
+			wantReq: &RequestData{
+				method: "POST",
+				body:   `{"jsonrpc":"2.0","id":0,"method":"getbestblockhash","params":null}`,
+			},
+			wantData: "",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := getFixture(t, tt.fixture)
+			responseBody = string(f)
+			gotData, err := b.GetBestBlockHash()
+			gotReq := <-requestChan
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Blockchain.GetBestBlockHash() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(gotReq, tt.wantReq) {
+				t.Errorf("Blockchain.GetBestBlockHash() = %+v, want %+v", gotReq, tt.wantReq)
+			}
+			if gotData != tt.wantData {
+				t.Errorf("Blockchain.GetBestBlockHash() = %+v, want %+v", gotData, tt.wantData)
+			}
+		})
+	}
+}
+
 func TestBlockchain_GetMempool(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -333,6 +382,72 @@ func TestBlockchain_GetMempool(t *testing.T) {
 	}
 }
 
+func TestBlockchain_GetBlockHeader(t *testing.T) {
+	tests := []struct {
+		name     string
+		fixture  string
+		wantReq  *RequestData
+		wantData *BlockHeaderVerbose
+		wantErr  bool
+	}{
+		{
+			name:    "Success",
+			fixture: "blockheader.fixture",
+			wantReq: &RequestData{
+				method: "POST",
+				body:   `{"jsonrpc":"2.0","id":0,"method":"getblockheader","params":["000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f",true]}`,
+			},
+			wantData: &BlockHeaderVerbose{
+				BlockHeader: BlockHeader{
+					Hash:       "000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f",
+					Height:     0,
+					Time:       1231006505,
+					MedianTime: 1231006505,
+					Nonce:      2083236893,
+					NextHash:   "00000000839a8e6886ab5951d76f411475428afc90947ee320161bbf18eb6048",
+					Bits:       "1d00ffff",
+					Difficulty: json.Number("1"),
+					Chainwork:  "0000000000000000000000000000000000000000000000000000000100010001",
+					Version:    1,
+					VersionHex: "00000001",
+					MerkleRoot: "4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b",
+					TxCount:    1,
+				},
+				Confirmations: 645134,
+			},
+			wantErr: false,
+		},
+		{
+			name:    "Error",
+			fixture: "error.fixture",
+			wantReq: &RequestData{
+				method: "POST",
+				body:   `{"jsonrpc":"2.0","id":0,"method":"getblockheader","params":["000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f",true]}`,
+			},
+			wantData: nil,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := getFixture(t, tt.fixture)
+			responseBody = string(f)
+			gotData, err := b.GetBlockHeader("000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f")
+			gotReq := <-requestChan
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Blockchain.GetBlockHeader() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(gotReq, tt.wantReq) {
+				t.Errorf("Blockchain.GetBlockHeader() = %+v, want %+v", gotReq, tt.wantReq)
+			}
+			if !reflect.DeepEqual(gotData, tt.wantData) {
+				t.Errorf("Blockchain.GetBlockHeader() = %+v, want %+v", gotData, tt.wantData)
+			}
+		})
+	}
+}
+
 func TestBlockchain_GetBlockHashes(t *testing.T) {
 	type args struct {
 		heights []int
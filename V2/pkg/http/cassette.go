@@ -0,0 +1,340 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// maxInteractionSize is the longest line read from a cassette, large enough for a verbose block
+const maxInteractionSize = 256 * 1024 * 1024
+
+// Interaction is a JSON-RPC call recorded in a cassette
+type Interaction struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+	Result json.RawMessage `json:"result"`
+	Error  *Status         `json:"error,omitempty"`
+}
+
+// key identifies the request of an interaction
+func (i *Interaction) key() string {
+	var params bytes.Buffer
+	if len(i.Params) > 0 {
+		json.Compact(&params, i.Params)
+	}
+
+	return i.Method + params.String()
+}
+
+// CassettePath returns the cassette file of coin in dir
+func CassettePath(dir, coin string) string {
+	return filepath.Join(dir, fmt.Sprintf("%s.jsonl", coin))
+}
+
+// Recorder is a http.RoundTripper appending the JSON-RPC calls made through it to a cassette, one interaction per
+// line. Calls of a batch request are recorded individually so they can be replayed in batches of any size.
+type Recorder struct {
+	path string
+	next http.RoundTripper
+	once sync.Once
+	mu   sync.Mutex // guards writes to file
+	file *os.File
+	err  error // error opening the cassette, returned from every round trip
+}
+
+// NewRecorder returns a Recorder passing requests to next and recording them to the cassette at path
+func NewRecorder(path string, next http.RoundTripper) *Recorder {
+	return &Recorder{
+		path: path,
+		next: next,
+	}
+}
+
+// RoundTrip implements http.RoundTripper
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.once.Do(func() {
+		if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+			r.err = errors.Wrapf(err, "failed to create cassette directory: %s", r.path)
+			return
+		}
+
+		r.file, r.err = os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if r.err != nil {
+			r.err = errors.Wrapf(r.err, "failed to open cassette: %s", r.path)
+		}
+	})
+
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	reqBody, err := readBody(&req.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read request body")
+	}
+
+	res, err := r.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resBody, err := readBody(&res.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read response body")
+	}
+
+	interactions, err := pairInteractions(reqBody, resBody)
+	if err != nil {
+		// not a JSON-RPC call, passed through without recording
+		return res, nil
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, i := range interactions {
+		if err := enc.Encode(i); err != nil {
+			return nil, errors.Wrap(err, "failed to encode interaction")
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err := r.file.Write(buf.Bytes()); err != nil {
+		return nil, errors.Wrapf(err, "failed to write cassette: %s", r.path)
+	}
+
+	return res, nil
+}
+
+// Replayer is a http.RoundTripper serving JSON-RPC calls from a cassette instead of a node. Calls recorded more than
+// once are served in recorded order, repeating the last response once the recorded ones are used up.
+type Replayer struct {
+	path   string
+	once   sync.Once
+	mu     sync.Mutex // guards served
+	calls  map[string][]*Interaction
+	served map[string]int
+	err    error // error loading the cassette, returned from every round trip
+}
+
+// NewReplayer returns a Replayer serving the cassette at path
+func NewReplayer(path string) *Replayer {
+	return &Replayer{
+		path:   path,
+		served: make(map[string]int),
+	}
+}
+
+// RoundTrip implements http.RoundTripper
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.once.Do(func() {
+		r.calls, r.err = loadCassette(r.path)
+	})
+
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	body, err := readBody(&req.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read request body")
+	}
+
+	batch, reqs, err := decodeRequests(body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "not a JSON-RPC request: %s", body)
+	}
+
+	responses := make([]*RPCResponse, len(reqs))
+	status := http.StatusOK
+
+	for n, req := range reqs {
+		i, err := r.serve(req)
+		if err != nil {
+			return nil, err
+		}
+
+		responses[n] = &RPCResponse{ID: req.ID, Result: i.Result, Error: i.Error}
+
+		// the node responds to a failed single call with an error status
+		if i.Error != nil && !batch {
+			status = http.StatusInternalServerError
+		}
+	}
+
+	var resBody []byte
+	if batch {
+		resBody, err = json.Marshal(responses)
+	} else {
+		resBody, err = json.Marshal(responses[0])
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode response")
+	}
+
+	return &http.Response{
+		Status:        http.StatusText(status),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          ioutil.NopCloser(bytes.NewReader(resBody)),
+		ContentLength: int64(len(resBody)),
+		Request:       req,
+	}, nil
+}
+
+// serve returns the next recorded interaction of req
+func (r *Replayer) serve(req *rpcCall) (*Interaction, error) {
+	key := (&Interaction{Method: req.Method, Params: req.Params}).key()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	calls, ok := r.calls[key]
+	if !ok {
+		return nil, errors.Errorf("no recorded call in %s for: %s %s", r.path, req.Method, req.Params)
+	}
+
+	n := r.served[key]
+	if n >= len(calls) {
+		n = len(calls) - 1
+	}
+
+	r.served[key]++
+
+	return calls[n], nil
+}
+
+// rpcCall is a JSON-RPC request with its params kept as json
+type rpcCall struct {
+	ID     int             `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// decodeRequests decodes a single or batch JSON-RPC request body, reporting if it was a batch
+func decodeRequests(body []byte) (bool, []*rpcCall, error) {
+	body = bytes.TrimSpace(body)
+
+	if len(body) > 0 && body[0] == '[' {
+		reqs := []*rpcCall{}
+		if err := json.Unmarshal(body, &reqs); err != nil {
+			return true, nil, err
+		}
+
+		return true, reqs, nil
+	}
+
+	req := &rpcCall{}
+	if err := json.Unmarshal(body, req); err != nil {
+		return false, nil, err
+	}
+
+	if req.Method == "" {
+		return false, nil, errors.New("missing method")
+	}
+
+	return false, []*rpcCall{req}, nil
+}
+
+// pairInteractions matches the calls of a JSON-RPC request with the responses of the node, which are in request order
+func pairInteractions(reqBody, resBody []byte) ([]*Interaction, error) {
+	batch, reqs, err := decodeRequests(reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := []*struct {
+		Result json.RawMessage `json:"result"`
+		Error  *Status         `json:"error"`
+	}{}
+
+	if batch {
+		err = json.Unmarshal(resBody, &responses)
+	} else {
+		responses = append(responses, nil)
+		err = json.Unmarshal(resBody, &responses[0])
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(responses) != len(reqs) {
+		return nil, errors.Errorf("%d responses to %d requests", len(responses), len(reqs))
+	}
+
+	interactions := make([]*Interaction, len(reqs))
+	for n, req := range reqs {
+		interactions[n] = &Interaction{
+			Method: req.Method,
+			Params: req.Params,
+			Result: responses[n].Result,
+			Error:  responses[n].Error,
+		}
+	}
+
+	return interactions, nil
+}
+
+// loadCassette reads the interactions of the cassette at path by request
+func loadCassette(path string) (map[string][]*Interaction, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open cassette: %s", path)
+	}
+	defer f.Close()
+
+	calls := make(map[string][]*Interaction)
+
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 64*1024), maxInteractionSize)
+
+	for line := 1; s.Scan(); line++ {
+		if len(bytes.TrimSpace(s.Bytes())) == 0 {
+			continue
+		}
+
+		i := &Interaction{}
+		if err := json.Unmarshal(s.Bytes(), i); err != nil {
+			return nil, errors.Wrapf(err, "failed to decode cassette %s line %d", path, line)
+		}
+
+		calls[i.key()] = append(calls[i.key()], i)
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, errors.Wrapf(err, "failed to read cassette: %s", path)
+	}
+
+	return calls, nil
+}
+
+// readBody reads body and replaces it with a reader of the same content
+func readBody(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil {
+		return nil, nil
+	}
+
+	b, err := ioutil.ReadAll(*body)
+	(*body).Close()
+	if err != nil {
+		return nil, err
+	}
+
+	*body = ioutil.NopCloser(bytes.NewReader(b))
+
+	return b, nil
+}
@@ -0,0 +1,146 @@
+// +build unit
+
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newNode returns a server answering getblockhash with hash-<height>, getblockcount with the number of times it was
+// called and any other method with an error
+func newNode() *httptest.Server {
+	count := 0
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		batch, reqs, err := decodeRequests(mustRead(r))
+		if err != nil {
+			w.WriteHeader(400)
+			return
+		}
+
+		responses := []string{}
+		for _, req := range reqs {
+			switch req.Method {
+			case "getblockhash":
+				params := []int{}
+				json.Unmarshal(req.Params, &params)
+				responses = append(responses, fmt.Sprintf(`{"result":"hash-%d","error":null,"id":0}`, params[0]))
+			case "getblockcount":
+				count++
+				responses = append(responses, fmt.Sprintf(`{"result":%d,"error":null,"id":0}`, count))
+			default:
+				if !batch {
+					w.WriteHeader(500)
+				}
+				responses = append(responses, `{"result":null,"error":{"code":-32601,"message":"Method not found"},"id":0}`)
+			}
+		}
+
+		if batch {
+			fmt.Fprintf(w, "[%s]", strings.Join(responses, ","))
+			return
+		}
+
+		fmt.Fprint(w, responses[0])
+	}))
+}
+
+func mustRead(r *http.Request) []byte {
+	b, _ := ioutil.ReadAll(r.Body)
+	return b
+}
+
+func TestRecorder_Replayer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cassette")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := CassettePath(dir, "btc")
+
+	node := newNode()
+
+	conf := newConf(node.URL, "", "")
+	conf.Record = path
+
+	recorder := NewClient(conf)
+
+	// calls made against the node while recording
+	calls := func(c *Client) ([]string, []int, error, error) {
+		hashes := []string{}
+		reqs := []*RPCRequest{c.NewRPCRequest("getblockhash", 0), c.NewRPCRequest("getblockhash", 1), c.NewRPCRequest("getblockhash", 2)}
+		if err := c.CallRPCBatch(reqs, &hashes); err != nil {
+			t.Fatal(err)
+		}
+
+		counts := []int{}
+		for i := 0; i < 3; i++ {
+			var count int
+			if err := c.CallRPC(c.NewRPCRequest("getblockcount"), &count); err != nil {
+				t.Fatal(err)
+			}
+			counts = append(counts, count)
+		}
+
+		single := c.CallRPC(c.NewRPCRequest("unknown"), nil)
+		batch := c.CallRPCBatch([]*RPCRequest{c.NewRPCRequest("getblockhash", 0), c.NewRPCRequest("unknown")}, &[]string{})
+
+		return hashes, counts, single, batch
+	}
+
+	wantHashes, wantCounts, singleErr, batchErr := calls(recorder)
+	node.Close()
+
+	if singleErr == nil || batchErr == nil {
+		t.Fatalf("recording node errors = %v, %v", singleErr, batchErr)
+	}
+
+	conf = newConf(node.URL, "", "")
+	conf.Replay = path
+
+	replayer := NewClient(conf)
+
+	gotHashes, gotCounts, gotSingleErr, gotBatchErr := calls(replayer)
+
+	if !reflect.DeepEqual(gotHashes, wantHashes) || !reflect.DeepEqual(gotCounts, wantCounts) {
+		t.Errorf("replayed = %v %v, want %v %v", gotHashes, gotCounts, wantHashes, wantCounts)
+	}
+
+	if gotSingleErr == nil || gotSingleErr.Error() != singleErr.Error() || gotBatchErr == nil || gotBatchErr.Error() != batchErr.Error() {
+		t.Errorf("replayed errors = %v, %v, want %v, %v", gotSingleErr, gotBatchErr, singleErr, batchErr)
+	}
+
+	// calls recorded in a batch are served individually, the last of a sequence is repeated
+	var hash string
+	if err := replayer.CallRPC(replayer.NewRPCRequest("getblockhash", 2), &hash); err != nil || hash != "hash-2" {
+		t.Errorf("CallRPC() = %s, %v, want hash-2", hash, err)
+	}
+
+	var count int
+	if err := replayer.CallRPC(replayer.NewRPCRequest("getblockcount"), &count); err != nil || count != 3 {
+		t.Errorf("CallRPC() = %d, %v, want 3", count, err)
+	}
+
+	if err := replayer.CallRPC(replayer.NewRPCRequest("getblockhash", 3), &hash); err == nil {
+		t.Error("CallRPC() of a call not recorded error = nil")
+	}
+}
+
+func TestReplayer_missingCassette(t *testing.T) {
+	conf := newConf("http://localhost", "", "")
+	conf.Replay = filepath.Join("testdata", "missing.jsonl")
+
+	if err := NewClient(conf).CallRPC(&RPCRequest{Method: "getblockcount"}, nil); err == nil {
+		t.Error("CallRPC() error = nil")
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/shapeshift-legacy/coinquery/V2/config"
 	"github.com/shapeshift-legacy/coinquery/V2/internal/log"
+	"github.com/shapeshift-legacy/coinquery/V2/internal/metrics"
 	"github.com/shapeshift-legacy/coinquery/V2/internal/retry"
 )
 
@@ -65,13 +66,24 @@ func NewClient(r *config.RPC) *Client {
 		IdleConnTimeout:     90 * time.Second, // Max time and idle (keep-alive) connection will remain idle before closing (0 = no limit)
 	}
 
+	var rt http.RoundTripper = transport
+
+	switch {
+	case r.Replay != "":
+		log.Infof("http", "replaying rpc calls from: %s", r.Replay)
+		rt = NewReplayer(r.Replay)
+	case r.Record != "":
+		log.Infof("http", "recording rpc calls to: %s", r.Record)
+		rt = NewRecorder(r.Record, transport)
+	}
+
 	u, _ := url.Parse(r.URL)
 
 	log.Info("http", "RPC client connected successfully")
 
 	return &Client{
 		HttpClient: &http.Client{
-			Transport: transport,
+			Transport: rt,
 			Timeout:   time.Duration(r.Timeout) * time.Second, // Time limit for requests made (0 = no limit)
 		},
 		BaseURL:  u,
@@ -97,7 +109,10 @@ func (c *Client) SetApiKey(key string) {
 
 // CallRest will make a rest request with body and decode the response into v
 func (c *Client) CallRest(method, path string, body interface{}, v interface{}) error {
-	return retry.Backoff(c.Retry.Attempts, c.Retry.Sleep, func() error {
+	label := fmt.Sprintf("%s %s", method, path)
+	defer metrics.Since(metrics.RPCDuration, time.Now(), label)
+
+	return retry.Backoff(c.Retry.Attempts, c.Retry.Sleep, countErrors(label, func() error {
 		httpReq, err := c.makeRequest(method, path, body)
 		if err != nil {
 			return errors.New(err.Error())
@@ -132,12 +147,15 @@ func (c *Client) CallRest(method, path string, body interface{}, v interface{})
 		}
 
 		return nil
-	})
+	}))
 }
 
 // CallRPC will make an rpc request with body and decode the response into v
 func (c *Client) CallRPC(body interface{}, v interface{}) error {
-	return retry.Backoff(c.Retry.Attempts, c.Retry.Sleep, func() error {
+	label := rpcMethod(body)
+	defer metrics.Since(metrics.RPCDuration, time.Now(), label)
+
+	return retry.Backoff(c.Retry.Attempts, c.Retry.Sleep, countErrors(label, func() error {
 		httpReq, err := c.makeRequest("POST", "", body)
 		if err != nil {
 			return errors.New(err.Error())
@@ -164,12 +182,15 @@ func (c *Client) CallRPC(body interface{}, v interface{}) error {
 		}
 
 		return nil
-	})
+	}))
 }
 
 // CallRPCBatch will make a batch rpc request with body and decode the response into v
 func (c *Client) CallRPCBatch(body interface{}, v interface{}) error {
-	return retry.Backoff(c.Retry.Attempts, c.Retry.Sleep, func() error {
+	label := rpcMethod(body)
+	defer metrics.Since(metrics.RPCDuration, time.Now(), label)
+
+	return retry.Backoff(c.Retry.Attempts, c.Retry.Sleep, countErrors(label, func() error {
 		httpReq, err := c.makeRequest("POST", "", body)
 		if err != nil {
 			return errors.New(err.Error())
@@ -209,7 +230,7 @@ func (c *Client) CallRPCBatch(body interface{}, v interface{}) error {
 		}
 
 		return nil
-	})
+	}))
 }
 
 // makeRequest will construct the http request for either rest or rpc
@@ -264,3 +285,29 @@ func (c *Client) makeRequest(method, path string, body interface{}) (*http.Reque
 
 	return httpReq, nil
 }
+
+// rpcMethod returns the metrics label of a single or batch rpc request body
+func rpcMethod(body interface{}) string {
+	switch r := body.(type) {
+	case *RPCRequest:
+		return r.Method
+	case []*RPCRequest:
+		if len(r) > 0 {
+			return r[0].Method + "_batch"
+		}
+	}
+
+	return "unknown"
+}
+
+// countErrors wraps fn to count each failed attempt of a request with label
+func countErrors(label string, fn func() error) func() error {
+	return func() error {
+		err := fn()
+		if err != nil {
+			metrics.RPCErrors.WithLabelValues(label).Inc()
+		}
+
+		return err
+	}
+}
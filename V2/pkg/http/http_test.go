@@ -512,3 +512,39 @@ func TestClient_CallRPCBatch(t *testing.T) {
 		})
 	}
 }
+
+func Test_rpcMethod(t *testing.T) {
+	tests := []struct {
+		name string
+		body interface{}
+		want string
+	}{
+		{
+			name: "Request",
+			body: &RPCRequest{Method: "getblock"},
+			want: "getblock",
+		},
+		{
+			name: "Batch",
+			body: []*RPCRequest{{Method: "getrawtransaction"}, {Method: "getrawtransaction"}},
+			want: "getrawtransaction_batch",
+		},
+		{
+			name: "Empty Batch",
+			body: []*RPCRequest{},
+			want: "unknown",
+		},
+		{
+			name: "Unknown",
+			body: "invalid body",
+			want: "unknown",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rpcMethod(tt.body); got != tt.want {
+				t.Errorf("rpcMethod() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
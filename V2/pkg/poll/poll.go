@@ -0,0 +1,123 @@
+package poll
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shapeshift-legacy/coinquery/V2/config"
+	"github.com/shapeshift-legacy/coinquery/V2/internal/log"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/blockchain/utxo"
+)
+
+// DefaultInterval is the polling interval used if none is configured
+const DefaultInterval = 10 * time.Second
+
+// Blockchain is the set of node calls required for polling
+type Blockchain interface {
+	GetBestBlockHash() (string, error)
+	GetMempool() ([]string, error)
+}
+
+// Poller type to hold configuration details
+type Poller struct {
+	interval time.Duration
+	bc       Blockchain
+	ctx      context.Context
+	logger   log.Logger
+}
+
+// New returns a Poller configured for a specific coin which stops polling once ctx is cancelled
+func New(ctx context.Context, c *config.Coin, bc Blockchain) *Poller {
+	interval := time.Duration(c.Sync.PollInterval) * time.Second
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+
+	return &Poller{
+		interval: interval,
+		bc:       bc,
+		ctx:      ctx,
+		logger:   log.New(c.Name),
+	}
+}
+
+// Connect verifies the node can be reached
+func (p *Poller) Connect() error {
+	if _, err := p.bc.GetBestBlockHash(); err != nil {
+		return errors.Wrap(err, "failed to connect to node")
+	}
+
+	p.logger.Infof("poll", "polling every: %s", p.interval)
+
+	return nil
+}
+
+// Start kicks off polling the node for new blocks and mempool transactions
+func (p *Poller) Start(blockHashChan chan<- interface{}, mempoolTxChan chan<- *utxo.MempoolTx, signalMempoolChan chan struct{}) {
+	go p.poll(blockHashChan, mempoolTxChan)
+}
+
+// poll checks the node's best block hash and mempool every interval. A changed best block hash is sent to blockHashChan
+// and any transaction not in the previous mempool is sent to mempoolTxChan. The first poll only records the current
+// state, as the caller is expected to process the initial mempool and chain tip itself.
+func (p *Poller) poll(blockHashChan chan<- interface{}, mempoolTxChan chan<- *utxo.MempoolTx) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	bestHash := ""
+	mempool := map[string]struct{}{}
+	seeded := false
+
+	for {
+		hash, err := p.bc.GetBestBlockHash()
+		if err != nil {
+			p.logger.Warn(err, "poll")
+		} else if hash != bestHash {
+			if seeded {
+				p.logger.Infof("poll", "block received: %s", hash)
+
+				select {
+				case blockHashChan <- []string{hash}:
+				case <-p.ctx.Done():
+					return
+				}
+			}
+
+			bestHash = hash
+		}
+
+		txids, err := p.bc.GetMempool()
+		if err != nil {
+			p.logger.Warn(err, "poll")
+		} else {
+			current := make(map[string]struct{}, len(txids))
+
+			for _, txid := range txids {
+				current[txid] = struct{}{}
+
+				if _, ok := mempool[txid]; ok || !seeded {
+					continue
+				}
+
+				p.logger.Debugf("poll", "tx received: %s", txid)
+
+				select {
+				case mempoolTxChan <- &utxo.MempoolTx{Hash: txid, Fails: 0}:
+				case <-p.ctx.Done():
+					return
+				}
+			}
+
+			mempool = current
+		}
+
+		seeded = true
+
+		select {
+		case <-ticker.C:
+		case <-p.ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,115 @@
+// +build unit
+
+package poll
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shapeshift-legacy/coinquery/V2/config"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/blockchain/utxo"
+)
+
+type mockBlockchain struct {
+	mu      sync.Mutex
+	hashes  []string
+	mempool [][]string
+	polls   int
+}
+
+func (m *mockBlockchain) GetBestBlockHash() (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.polls
+	if i >= len(m.hashes) {
+		i = len(m.hashes) - 1
+	}
+
+	return m.hashes[i], nil
+}
+
+func (m *mockBlockchain) GetMempool() ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.polls
+	if i >= len(m.mempool) {
+		i = len(m.mempool) - 1
+	}
+	m.polls++
+
+	return m.mempool[i], nil
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval int64
+		want     time.Duration
+	}{
+		{
+			name:     "Configured Interval",
+			interval: 30,
+			want:     30 * time.Second,
+		},
+		{
+			name:     "Default Interval",
+			interval: 0,
+			want:     DefaultInterval,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(context.Background(), &config.Coin{Sync: config.Sync{PollInterval: tt.interval}}, &mockBlockchain{})
+
+			if p.interval != tt.want {
+				t.Errorf("New() interval = %v, want %v", p.interval, tt.want)
+			}
+		})
+	}
+}
+
+func TestPoller_poll(t *testing.T) {
+	bc := &mockBlockchain{
+		hashes:  []string{"a", "a", "b", "b"},
+		mempool: [][]string{[]string{"1"}, []string{"1", "2"}, []string{"3"}, []string{"3", "4"}},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	p := &Poller{interval: 10 * time.Millisecond, bc: bc, ctx: ctx}
+
+	blockHashChan := make(chan interface{})
+	mempoolTxChan := make(chan *utxo.MempoolTx)
+	go p.poll(blockHashChan, mempoolTxChan)
+
+	wantHashes := []interface{}{[]string{"b"}}
+	wantTxs := []string{"2", "3", "4"}
+
+	gotHashes := []interface{}{}
+	gotTxs := []string{}
+
+	timeout := time.After(2 * time.Second)
+	for len(gotHashes) < len(wantHashes) || len(gotTxs) < len(wantTxs) {
+		select {
+		case h := <-blockHashChan:
+			gotHashes = append(gotHashes, h)
+		case tx := <-mempoolTxChan:
+			gotTxs = append(gotTxs, tx.Hash)
+		case <-timeout:
+			t.Fatalf("poll() timed out, got hashes %v txs %v", gotHashes, gotTxs)
+		}
+	}
+
+	if !reflect.DeepEqual(wantHashes, gotHashes) {
+		t.Errorf("poll() hashes = %v, want %v", gotHashes, wantHashes)
+	}
+	if !reflect.DeepEqual(wantTxs, gotTxs) {
+		t.Errorf("poll() txs = %v, want %v", gotTxs, wantTxs)
+	}
+}
@@ -0,0 +1,132 @@
+package postgres
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SpendsIndexedKey is the metadata key set to "true" once the spends of every transaction written before output had
+// spending columns are marked, by the spends backfill or by the sqitch deploy of a schema without outputs
+const SpendsIndexedKey = "outputSpendingIndexed"
+
+// spendsIndexed reports if the spending columns of output can be relied on. Until then spends are searched in input,
+// as the columns of older outputs read as unspent. The key is never cleared, so it is only read until found.
+func (d *Database) spendsIndexed(ctx context.Context) bool {
+	if atomic.LoadInt32(&d.spends) == 1 {
+		return true
+	}
+
+	if value, err := d.Get(ctx, SpendsIndexedKey); err != nil || value != "true" {
+		return false
+	}
+
+	atomic.StoreInt32(&d.spends, 1)
+
+	return true
+}
+
+// MaxTxID returns the highest transaction id in the db, or 0 if there are no transactions
+func (d *Database) MaxTxID(ctx context.Context) (int, error) {
+	defer d.observe("MaxTxID", time.Now())
+
+	query := compile(`
+		SELECT
+			COALESCE(MAX(id), 0)
+		FROM
+			_SCHEMA_.transaction;
+	`, d.prefix)
+
+	ctx, cancel := d.deadline(ctx)
+	defer cancel()
+
+	if err := d.acquireContext(ctx); err != nil {
+		return 0, errors.Wrap(err, "failed to get max transaction id")
+	}
+
+	row := d.reader(ctx).QueryRowContext(ctx, query)
+	d.release()
+
+	var id int
+	if err := row.Scan(&id); err != nil {
+		return 0, errors.Wrap(err, "failed to get max transaction id")
+	}
+
+	return id, nil
+}
+
+// IndexAddresses writes the address_transaction rows of the transactions with an id from fromID to toID inclusive and
+// returns the number of rows written. Transactions are indexed as they are inserted, this backfills transactions
+// written before address_transaction existed and is safe to run again on the same range.
+func (d *Database) IndexAddresses(fromID, toID int) (int, error) {
+	defer d.observe("IndexAddresses", time.Now())
+
+	if err := d.checkLock(); err != nil {
+		return 0, err
+	}
+
+	query := compile(`
+		SELECT _SCHEMA_.address_transaction_insert(ARRAY(
+			SELECT
+				id
+			FROM
+				_SCHEMA_.transaction
+			WHERE
+				id BETWEEN $1 AND $2
+		), FALSE);
+	`, d.prefix)
+
+	ctx, cancel := d.defaultDeadline()
+	defer cancel()
+
+	var count int
+
+	d.acquire()
+	err := d.queryRow(ctx, query, []interface{}{fromID, toID}, &count)
+	d.release()
+
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to index addresses of transactions %d to %d", fromID, toID)
+	}
+
+	return count, nil
+}
+
+// IndexSpends marks the outputs spent by the inputs of the transactions with an id from fromID to toID inclusive and
+// returns the number of outputs marked. Spends are marked as transactions are inserted, this backfills transactions
+// written before the output table had spending columns and is safe to run again on the same range.
+func (d *Database) IndexSpends(fromID, toID int) (int, error) {
+	defer d.observe("IndexSpends", time.Now())
+
+	if err := d.checkLock(); err != nil {
+		return 0, err
+	}
+
+	query := compile(`
+		SELECT _SCHEMA_.output_spend(ARRAY(
+			SELECT
+				id
+			FROM
+				_SCHEMA_.transaction
+			WHERE
+				id BETWEEN $1 AND $2
+		), FALSE);
+	`, d.prefix)
+
+	ctx, cancel := d.defaultDeadline()
+	defer cancel()
+
+	var count int
+
+	d.acquire()
+	err := d.queryRow(ctx, query, []interface{}{fromID, toID}, &count)
+	d.release()
+
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to index spends of transactions %d to %d", fromID, toID)
+	}
+
+	return count, nil
+}
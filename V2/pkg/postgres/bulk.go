@@ -0,0 +1,328 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/blockchain/utxo"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/storage"
+)
+
+// ErrBulkConflict is returned by InsertBlocksBulk if any of the rows already exist, e.g. a duplicate txid (BIP30).
+// The blocks should be inserted with InsertBlock and InsertTxs instead.
+var ErrBulkConflict = errors.New("bulk insert conflicts with existing rows")
+
+// uniqueViolation is the postgres error code for a unique constraint violation
+const uniqueViolation = "23505"
+
+// secondaryIndex is a non unique index that is dropped while bulk loading and rebuilt afterwards
+type secondaryIndex struct {
+	name    string
+	table   string
+	columns string
+}
+
+// secondaryIndexes must match the indexes created by the sqitch deploy scripts
+var secondaryIndexes = []secondaryIndex{
+	{name: "idx_block_height", table: "block", columns: "height"},
+	{name: "idx_block_hash", table: "block", columns: "block_hash"},
+	{name: "idx_block_not_ophaned_join", table: "block", columns: "id, is_orphaned"},
+	{name: "idx_transaction_block_id", table: "transaction", columns: "block_id"},
+	{name: "idx_input_transaction_id", table: "input", columns: "transaction_id"},
+	{name: "idx_spent_txid", table: "input", columns: "spent_txid, spent_vout"},
+	{name: "idx_output_transaction_id", table: "output", columns: "transaction_id"},
+	{name: "idx_output_address_id", table: "output", columns: "address"},
+	{name: "idx_output_spending_transaction_id", table: "output", columns: "spending_transaction_id"},
+	{name: "idx_address_transaction_transaction_id", table: "address_transaction", columns: "transaction_id"},
+	{name: "idx_address_transaction_history", table: "address_transaction", columns: "address, (COALESCE(height, 2147483647)) DESC, transaction_id DESC"},
+}
+
+// DropIndexes drops the secondary indexes of the block, transaction, input, output and address_transaction tables to
+// speed up bulk loading.
+// Unique indexes are kept so that duplicates are still rejected.
+func (d *Database) DropIndexes() error {
+	defer d.observe("DropIndexes", time.Now())
+
+	if err := d.checkLock(); err != nil {
+		return err
+	}
+
+	for _, idx := range secondaryIndexes {
+		query := compile(fmt.Sprintf(`DROP INDEX IF EXISTS _SCHEMA_.%s`, idx.name), d.prefix)
+
+		d.acquire()
+		err := d.exec(context.Background(), query)
+		d.release()
+
+		if err != nil {
+			return errors.Wrapf(err, "failed to drop index: %s", idx.name)
+		}
+	}
+
+	return nil
+}
+
+// CreateIndexes creates any missing secondary indexes dropped by DropIndexes. Building the indexes of a fully loaded
+// schema can take hours, so no query timeout is applied.
+func (d *Database) CreateIndexes() error {
+	defer d.observe("CreateIndexes", time.Now())
+
+	if err := d.checkLock(); err != nil {
+		return err
+	}
+
+	for _, idx := range secondaryIndexes {
+		query := compile(fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON _SCHEMA_.%s(%s)`, idx.name, idx.table, idx.columns), d.prefix)
+
+		start := time.Now()
+
+		d.acquire()
+		err := d.exec(context.Background(), query)
+		d.release()
+
+		if err != nil {
+			return errors.Wrapf(err, "failed to create index: %s", idx.name)
+		}
+
+		d.logger.Debugf("postgres", "index %s ready in %s", idx.name, time.Since(start))
+	}
+
+	return nil
+}
+
+// InsertBlocksBulk inserts blocks in ascending order along with all of their transactions, inputs and outputs using COPY
+// in a single db transaction. Blocks are written as the current tip of the chain, skipping the reorg handling of
+// block_insert, so it should only be used for blocks that are far from the tip and not yet in the db.
+// Returns ErrBulkConflict if any of the rows already exist. Large batches can exceed the query timeout, so none is applied.
+func (d *Database) InsertBlocksBulk(blocks []*utxo.Block) error {
+	defer d.observe("InsertBlocksBulk", time.Now())
+
+	if err := d.checkLock(); err != nil {
+		return err
+	}
+
+	if len(blocks) == 0 {
+		return nil
+	}
+
+	d.acquire()
+	defer d.release()
+
+	err := d.write(context.Background(), func(tx *sql.Tx) error {
+		return d.copyBlocks(tx, blocks)
+	})
+
+	if err != nil {
+		if pqErr, ok := errors.Cause(err).(*pq.Error); ok && pqErr.Code == uniqueViolation {
+			return errors.Wrapf(ErrBulkConflict, "blocks %d to %d: %s", blocks[0].Height, blocks[len(blocks)-1].Height, pqErr.Detail)
+		}
+
+		return errors.Wrapf(err, "failed to bulk insert blocks %d to %d", blocks[0].Height, blocks[len(blocks)-1].Height)
+	}
+
+	return nil
+}
+
+// copyBlocks streams the rows of blocks into their tables within tx
+func (d *Database) copyBlocks(tx *sql.Tx, blocks []*utxo.Block) error {
+	numTxs := 0
+	for _, b := range blocks {
+		numTxs += len(b.Txs)
+	}
+
+	// ids are reserved up front so transactions can reference their block, and inputs and outputs their transaction
+	blockID, err := d.reserveIDs(tx, "block", len(blocks))
+	if err != nil {
+		return err
+	}
+
+	txID, err := d.reserveIDs(tx, "transaction", numTxs)
+	if err != nil {
+		return err
+	}
+
+	firstTxID := txID
+
+	// link the parent of the first block, which may have been written as the tip
+	first := blocks[0]
+	query := compile(`
+		UPDATE _SCHEMA_.block
+		SET next_block_hash = $1
+		WHERE block_hash = $2
+		AND height = $3
+		AND is_orphaned = FALSE;
+	`, d.prefix)
+
+	if _, err := tx.Exec(query, first.Hash, first.PrevHash, first.Height-1); err != nil {
+		return errors.Wrapf(err, "failed to set next block hash of block: %s", first.PrevHash)
+	}
+
+	var blockRows, txRows, inputRows, outputRows [][]interface{}
+
+	for _, b := range blocks {
+		blockRows = append(blockRows, []interface{}{
+			blockID,
+			b.Hash,
+			b.Height,
+			time.Unix(int64(b.Time), 0),
+			time.Unix(int64(b.MedianTime), 0),
+			b.Nonce,
+			b.PrevHash,
+			b.NextHash,
+			b.Bits,
+			b.Difficulty.String(),
+			b.Chainwork,
+			b.Version,
+			b.VersionHex,
+			b.MerkleRoot,
+			b.Size,
+			b.StrippedSize,
+			b.Weight,
+			b.TxCount,
+		})
+
+		for i := range b.Txs {
+			t := &b.Txs[i]
+
+			hash := t.Hash
+			if hash == "" {
+				hash = t.TxID
+			}
+
+			locktime, err := t.Locktime.Int64()
+			if err != nil {
+				return errors.Wrapf(err, "invalid locktime: %s, in tx: %s", t.Locktime, t.TxID)
+			}
+
+			txRows = append(txRows, []interface{}{txID, i, blockID, t.TxID, hash, t.Version, t.Size, t.VSize, t.Weight, locktime, t.Hex})
+
+			for _, in := range storage.TxInputs(t) {
+				// stored as a json array to match transaction_insert
+				var witness sql.NullString
+				if in.TxInWitness != nil {
+					w, err := json.Marshal(in.TxInWitness)
+					if err != nil {
+						return errors.Wrapf(err, "failed to marshal witness of vin: %d, in tx: %s", in.Vin, t.TxID)
+					}
+
+					witness = sql.NullString{String: string(w), Valid: true}
+				}
+
+				inputRows = append(inputRows, []interface{}{txID, in.Vin, in.SpentTx, in.SpentVout, in.Asm, in.Hex, in.Sequence, witness, in.Coinbase})
+			}
+
+			outputs, err := storage.TxOutputs(t)
+			if err != nil {
+				return errors.Wrapf(err, "failed to copy tx: %s", t.TxID)
+			}
+
+			for _, out := range outputs {
+				outputRows = append(outputRows, []interface{}{txID, out.Vout, out.SatAmount, out.Asm, out.Hex, out.ReqSigs, out.Type, out.Address, pq.Array(out.Addresses)})
+			}
+
+			txID++
+		}
+
+		blockID++
+	}
+
+	// only one copy can be in progress per connection, tables are loaded in dependency order so foreign keys are satisfied
+	err = d.copyIn(tx, "block", blockRows,
+		"id", "block_hash", "height", "mined_time", "median_time", "nonce", "last_block_hash", "next_block_hash", "bits",
+		"difficulty", "chainwork", "version", "version_hex", "merkle_root", "size", "stripped_size", "weight", "tx_count",
+	)
+	if err != nil {
+		return err
+	}
+
+	err = d.copyIn(tx, "transaction", txRows,
+		"id", "index", "block_id", "txid", "hash", "version", "size", "v_size", "weight", "locktime", "raw_transaction",
+	)
+	if err != nil {
+		return err
+	}
+
+	err = d.copyIn(tx, "input", inputRows,
+		"transaction_id", "vin", "spent_txid", "spent_vout", "asm", "hex", "sequence_num", "tx_in_witness", "coinbase",
+	)
+	if err != nil {
+		return err
+	}
+
+	err = d.copyIn(tx, "output", outputRows,
+		"transaction_id", "vout", "amount", "asm", "hex", "req_sigs", "output_type", "address", "addresses",
+	)
+	if err != nil {
+		return err
+	}
+
+	if numTxs == 0 {
+		return nil
+	}
+
+	// mark spends and index addresses as transactions_insert does, once every output the inputs may spend is loaded.
+	// Blocks are loaded in order, so no earlier input can spend the loaded outputs.
+	query = compile(`
+		WITH ids AS (
+			SELECT ARRAY(SELECT generate_series($1::BIGINT, $2::BIGINT)) AS ids
+		)
+		SELECT
+			_SCHEMA_.output_spend(ids, FALSE),
+			_SCHEMA_.address_transaction_insert(ids, FALSE)
+		FROM
+			ids;
+	`, d.prefix)
+
+	if _, err := tx.Exec(query, firstTxID, txID-1); err != nil {
+		return errors.Wrapf(err, "failed to index spends and addresses of blocks %d to %d", first.Height, blocks[len(blocks)-1].Height)
+	}
+
+	return nil
+}
+
+// copyIn copies rows into columns of table within tx
+func (d *Database) copyIn(tx *sql.Tx, table string, rows [][]interface{}, columns ...string) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	stmt, err := tx.Prepare(pq.CopyInSchema(string(d.prefix), table, columns...))
+	if err != nil {
+		return errors.Wrapf(err, "failed to prepare copy into: %s", table)
+	}
+	defer stmt.Close()
+
+	for _, row := range rows {
+		if _, err := stmt.Exec(row...); err != nil {
+			return errors.Wrapf(err, "failed to copy into: %s", table)
+		}
+	}
+
+	// flush buffered rows
+	if _, err := stmt.Exec(); err != nil {
+		return errors.Wrapf(err, "failed to copy into: %s", table)
+	}
+
+	return nil
+}
+
+// reserveIDs advances the id sequence of table by n and returns the first id of the reserved range
+func (d *Database) reserveIDs(tx *sql.Tx, table string, n int) (int, error) {
+	if n == 0 {
+		return 0, nil
+	}
+
+	query := compile(fmt.Sprintf(`SELECT setval('_SCHEMA_.%[1]s_id_seq', nextval('_SCHEMA_.%[1]s_id_seq') + $1 - 1)`, table), d.prefix)
+
+	var last int
+	if err := tx.QueryRow(query, n).Scan(&last); err != nil {
+		return 0, errors.Wrapf(err, "failed to reserve %d ids for: %s", n, table)
+	}
+
+	return last - n + 1, nil
+}
@@ -0,0 +1,323 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/storage"
+)
+
+// GetTxsByTxIDs returns the details of txids in the same order, loading every transaction, input, prevout, output and
+// spend in three queries whatever the number of transactions. Returns sql.ErrNoRows if any of txids isn't found.
+func (d *Database) GetTxsByTxIDs(ctx context.Context, txids []string) ([]*storage.TxDetails, error) {
+	defer d.observe("GetTxsByTxIDs", time.Now())
+
+	if len(txids) == 0 {
+		return []*storage.TxDetails{}, nil
+	}
+
+	ctx, cancel := d.deadline(ctx)
+	defer cancel()
+
+	db := d.reader(ctx)
+
+	byTxID, err := d.txsByTxIDs(ctx, db, txids)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get transactions from txids: %v", txids)
+	}
+
+	// a replica missing a tx may not have caught up with a write made right before, such as a tx that was just
+	// broadcast, so the txs are read again from the primary along with their inputs and outputs. All three queries
+	// read from the same db so inputs and outputs are never missing from a tx found.
+	if missing(byTxID, txids) && db != d.DB {
+		db = d.DB
+
+		if byTxID, err = d.txsByTxIDs(ctx, d.DB, txids); err != nil {
+			return nil, errors.Wrapf(err, "failed to get transactions from txids: %v", txids)
+		}
+	}
+
+	details := make([]*storage.TxDetails, len(txids))
+	byID := make(map[int]*storage.TxDetails, len(byTxID))
+	ids := make([]int, 0, len(byTxID))
+	for i, txid := range txids {
+		tx, ok := byTxID[txid]
+		if !ok {
+			return nil, errors.Wrapf(sql.ErrNoRows, "failed to get transaction from txid: %s", txid)
+		}
+
+		if _, ok := byID[tx.ID]; !ok {
+			byID[tx.ID] = tx
+			ids = append(ids, tx.ID)
+		}
+
+		details[i] = byID[tx.ID]
+	}
+
+	if err := d.txInputs(ctx, db, ids, byID); err != nil {
+		return nil, errors.Wrapf(err, "failed to get transactions from txids: %v", txids)
+	}
+
+	if err := d.txOutputs(ctx, db, ids, byID); err != nil {
+		return nil, errors.Wrapf(err, "failed to get transactions from txids: %v", txids)
+	}
+
+	return details, nil
+}
+
+// missing reports if any of txids isn't in txs
+func missing(txs map[string]*storage.TxDetails, txids []string) bool {
+	for _, txid := range txids {
+		if _, ok := txs[txid]; !ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// txsByTxIDs returns the transactions of txids found in db by txid, without inputs or outputs
+func (d *Database) txsByTxIDs(ctx context.Context, db DB, txids []string) (map[string]*storage.TxDetails, error) {
+	query := compile(`
+		SELECT
+			transaction.id,
+			transaction.txid,
+			transaction.hash,
+			transaction.version,
+			transaction.size,
+			transaction.v_size,
+			transaction.weight,
+			transaction.locktime,
+			block.height,
+			block.block_hash,
+			block.mined_time
+		FROM
+			_SCHEMA_.transaction
+			LEFT JOIN _SCHEMA_.block ON transaction.block_id = block.id
+			AND block.is_orphaned = FALSE
+		WHERE
+			transaction.txid = ANY($1);
+	`, d.prefix)
+
+	if err := d.acquireContext(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, query, pq.Array(txids))
+	d.release()
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	txs := make(map[string]*storage.TxDetails, len(txids))
+	for rows.Next() {
+		// sql.Null* Types for dealing with NULL refs in SQL
+		var blockHeight sql.NullInt64
+		var blockHash, blockTime sql.NullString
+
+		tx := &storage.Tx{Inputs: []storage.Input{}, Outputs: []storage.Output{}}
+
+		err := rows.Scan(
+			&tx.ID, &tx.TxID, &tx.Hash, &tx.Version, &tx.Size, &tx.VSize, &tx.Weight, &tx.Locktime,
+			&blockHeight, &blockHash, &blockTime,
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan row when retrieving transactions")
+		}
+
+		if blockHeight.Valid {
+			tx.BlockHeight = blockHeight.Int64
+		} else {
+			tx.BlockHeight = -1
+			tx.Mempool = true
+		}
+
+		tx.Cursor = storage.Cursor{Height: int(tx.BlockHeight), ID: tx.ID}.String()
+
+		if blockHash.Valid {
+			tx.BlockHash = blockHash.String
+		}
+
+		if blockTime.Valid {
+			tx.Time = blockTime.String
+			tx.BlockTime = blockTime.String
+		} else {
+			tx.Time = time.Now().Format(time.RFC3339)
+		}
+
+		txs[tx.TxID] = &storage.TxDetails{Tx: tx}
+	}
+
+	return txs, rows.Err()
+}
+
+// txInputs appends the inputs of the transactions ids in db to their details in byID, in vin order, along with the
+// outputs they spend
+func (d *Database) txInputs(ctx context.Context, db DB, ids []int, byID map[int]*storage.TxDetails) error {
+	query := compile(`
+		SELECT
+			input.transaction_id,
+			input.vin,
+			input.spent_txid,
+			input.spent_vout,
+			input.asm,
+			input.hex,
+			input.sequence_num,
+			input.tx_in_witness,
+			input.coinbase,
+			prevout.amount,
+			prevout.address
+		FROM
+			_SCHEMA_.input
+			LEFT JOIN _SCHEMA_.transaction AS spent ON spent.txid = input.spent_txid
+			LEFT JOIN _SCHEMA_.output AS prevout ON prevout.transaction_id = spent.id
+			AND prevout.vout = input.spent_vout
+		WHERE
+			input.transaction_id = ANY($1)
+		ORDER BY
+			input.transaction_id,
+			input.vin;
+	`, d.prefix)
+
+	if err := d.acquireContext(ctx); err != nil {
+		return err
+	}
+
+	rows, err := db.QueryContext(ctx, query, pq.Array(ids))
+	d.release()
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		// sql.Null* Types for dealing with NULL refs in SQL
+		var txInWitness, address sql.NullString
+		var amount sql.NullInt64
+
+		var id int
+		vin := storage.Input{}
+
+		err := rows.Scan(
+			&id, &vin.Vin, &vin.SpentTx, &vin.SpentVout, &vin.Asm, &vin.Hex, &vin.Sequence, &txInWitness, &vin.Coinbase,
+			&amount, &address,
+		)
+		if err != nil {
+			return errors.Wrap(err, "failed to scan row when retrieving inputs")
+		}
+
+		vin.TxInWitness = parseWitness(txInWitness)
+
+		var prevout *storage.Output
+		if amount.Valid {
+			prevout = &storage.Output{Vout: vin.SpentVout, SatAmount: amount.Int64, Address: address.String}
+		}
+
+		tx := byID[id]
+		tx.Inputs = append(tx.Inputs, vin)
+		tx.PrevOuts = append(tx.PrevOuts, prevout)
+	}
+
+	return rows.Err()
+}
+
+// txOutputs appends the outputs of the transactions ids in db to their details in byID, in vout order, along with the
+// inputs spending them
+func (d *Database) txOutputs(ctx context.Context, db DB, ids []int, byID map[int]*storage.TxDetails) error {
+	spend := `output.spending_transaction_id AS transaction_id, output.spending_vin AS vin`
+	if !d.spendsIndexed(ctx) {
+		spend = `input.transaction_id, input.vin
+				FROM
+					_SCHEMA_.transaction AS spent
+					JOIN _SCHEMA_.input ON input.spent_txid = spent.txid
+				WHERE
+					spent.id = output.transaction_id
+					AND input.spent_vout = output.vout
+				ORDER BY
+					input.transaction_id
+				LIMIT 1`
+	}
+
+	query := compile(fmt.Sprintf(`
+		SELECT
+			output.transaction_id,
+			output.vout,
+			output.asm,
+			output.hex,
+			output.address,
+			output.amount,
+			output.output_type,
+			output.req_sigs,
+			spender.txid,
+			spend.vin,
+			block.height
+		FROM
+			_SCHEMA_.output
+			LEFT JOIN LATERAL (
+				SELECT
+					%s
+			) AS spend ON TRUE
+			LEFT JOIN _SCHEMA_.transaction AS spender ON spend.transaction_id = spender.id
+			LEFT JOIN _SCHEMA_.block ON spender.block_id = block.id
+			AND block.is_orphaned = FALSE
+		WHERE
+			output.transaction_id = ANY($1)
+		ORDER BY
+			output.transaction_id,
+			output.vout;
+	`, spend), d.prefix)
+
+	if err := d.acquireContext(ctx); err != nil {
+		return err
+	}
+
+	rows, err := db.QueryContext(ctx, query, pq.Array(ids))
+	d.release()
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		// sql.Null* Types for dealing with NULL refs in SQL
+		var spenderTxID sql.NullString
+		var spendingVin, spenderHeight sql.NullInt64
+
+		var id int
+		vout := storage.Output{}
+
+		err := rows.Scan(
+			&id, &vout.Vout, &vout.Asm, &vout.Hex, &vout.Address, &vout.SatAmount, &vout.Type, &vout.ReqSigs,
+			&spenderTxID, &spendingVin, &spenderHeight,
+		)
+		if err != nil {
+			return errors.Wrap(err, "failed to scan row when retrieving outputs")
+		}
+
+		var spend *storage.SpentTxDetails
+		if spenderTxID.Valid {
+			spend = &storage.SpentTxDetails{SpentTxID: spenderTxID.String, SpentIndex: int(spendingVin.Int64), SpentHeight: -1}
+
+			if spenderHeight.Valid {
+				spend.SpentHeight = spenderHeight.Int64
+			}
+		}
+
+		tx := byID[id]
+		tx.Outputs = append(tx.Outputs, vout)
+		tx.Spends = append(tx.Spends, spend)
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,313 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNotLeader is returned by writes of a Database using leader election that does not hold the schema lock
+var ErrNotLeader = errors.New("schema lock not held")
+
+// termKey is the metadata key of the term claimed by the latest leader of a schema
+const termKey = "leaderTerm"
+
+// schemaLock is a session level advisory lock on the schema, held on a dedicated connection for as long as the session
+// is alive. Writes are refused while leader election is enabled and the lock isn't held.
+//
+// Each leader claims the next term of the schema when it takes the lock, and every write checks the term in its own
+// db transaction, see write. A leader that lost its session can't notice before its next check, so the term is what
+// keeps it from committing writes after a standby took over.
+type schemaLock struct {
+	mu      sync.Mutex
+	enabled bool
+	held    bool
+	term    int64 // term claimed by this leader
+	conn    *sql.Conn
+	lost    chan struct{} // closed once a held lock is lost
+}
+
+// lockKey is hashed into the advisory lock id of a schema
+func (d *Database) lockKey() string {
+	return fmt.Sprintf("coinquery.%s", d.prefix)
+}
+
+// checkLock returns ErrNotLeader if leader election is enabled and the schema lock isn't held
+func (d *Database) checkLock() error {
+	d.lock.mu.Lock()
+	defer d.lock.mu.Unlock()
+
+	if d.lock.enabled && !d.lock.held {
+		return errors.Wrapf(ErrNotLeader, "refusing to write schema: %s", d.prefix)
+	}
+
+	return nil
+}
+
+// write runs fn in a db transaction. With leader election enabled, the transaction first reads the term of the schema
+// with FOR SHARE and fails with ErrNotLeader if a standby claimed a newer term. A standby claiming the next term waits
+// for the row lock, so once it has taken over no write of the previous leader can commit.
+func (d *Database) write(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	d.lock.mu.Lock()
+	enabled, held, term, conn := d.lock.enabled, d.lock.held, d.lock.term, d.lock.conn
+	d.lock.mu.Unlock()
+
+	if enabled && !held {
+		return errors.Wrapf(ErrNotLeader, "refusing to write schema: %s", d.prefix)
+	}
+
+	tx, err := d.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin write")
+	}
+
+	if enabled {
+		if err := d.checkTerm(ctx, tx, term, conn); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "failed to commit write")
+	}
+
+	return nil
+}
+
+// exec runs query as a write, see write
+func (d *Database) exec(ctx context.Context, query string, args ...interface{}) error {
+	return d.write(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, query, args...)
+		return err
+	})
+}
+
+// queryRow runs query as a write and scans its single row into dest, see write
+func (d *Database) queryRow(ctx context.Context, query string, args []interface{}, dest ...interface{}) error {
+	return d.write(ctx, func(tx *sql.Tx) error {
+		return tx.QueryRowContext(ctx, query, args...).Scan(dest...)
+	})
+}
+
+// checkTerm returns ErrNotLeader if the term of the schema isn't term anymore, marking the lock held on conn as lost
+func (d *Database) checkTerm(ctx context.Context, tx *sql.Tx, term int64, conn *sql.Conn) error {
+	query := compile(`SELECT value FROM _SCHEMA_.metadata WHERE key = $1 FOR SHARE`, d.prefix)
+
+	var current string
+	if err := tx.QueryRowContext(ctx, query, termKey).Scan(&current); err != nil {
+		return errors.Wrapf(err, "failed to check schema lock: %s", d.prefix)
+	}
+
+	if current != strconv.FormatInt(term, 10) {
+		err := errors.Wrapf(ErrNotLeader, "term %s of schema: %s claimed by another leader, holding term %d", current, d.prefix, term)
+		d.loseLock(conn, err)
+
+		return err
+	}
+
+	return nil
+}
+
+// AcquireLock enables leader election and blocks until the advisory lock of the schema is held, trying every interval,
+// or ctx is cancelled. Writes fail with ErrNotLeader from the first call until the lock is held, and again once it is
+// lost. The session holding the lock is checked every interval, see LockLost.
+func (d *Database) AcquireLock(ctx context.Context, interval time.Duration) error {
+	d.lock.mu.Lock()
+	if d.lock.held {
+		d.lock.mu.Unlock()
+		return nil
+	}
+	if !d.lock.enabled {
+		// the lock connection is held outside of the semaphore, which also counts the connections to replicas
+		d.SetMaxOpenConns(d.maxConns + 1)
+	}
+	d.lock.enabled = true
+	d.lock.lost = make(chan struct{})
+	d.lock.mu.Unlock()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var conn *sql.Conn
+	var term int64
+
+	for {
+		held, err := d.tryLock(ctx, &conn, interval)
+		if held && err == nil {
+			if term, err = d.claimTerm(ctx, conn, interval); err != nil {
+				d.unlock(conn)
+				held = false
+			}
+		}
+		if err != nil {
+			d.logger.Warn(err, "postgres", "failed to acquire schema lock")
+		}
+
+		if held {
+			break
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			if conn != nil {
+				conn.Close()
+			}
+			return errors.Wrapf(ctx.Err(), "stopped waiting for schema lock: %s", d.prefix)
+		}
+	}
+
+	d.lock.mu.Lock()
+	d.lock.held = true
+	d.lock.term = term
+	d.lock.conn = conn
+	d.lock.mu.Unlock()
+
+	d.logger.Infof("postgres", "acquired schema lock: %s, with term: %d", d.prefix, term)
+
+	go d.watchLock(conn, interval)
+
+	return nil
+}
+
+// LockLost returns a channel closed once the schema lock acquired by AcquireLock is lost. Returns nil, which blocks
+// forever, if AcquireLock hasn't been called.
+func (d *Database) LockLost() <-chan struct{} {
+	d.lock.mu.Lock()
+	defer d.lock.mu.Unlock()
+
+	return d.lock.lost
+}
+
+// tryLock attempts to take the schema lock on conn, opening a new dedicated connection if conn is nil.
+// conn is closed and reset if the connection fails so the next attempt starts a new session.
+func (d *Database) tryLock(ctx context.Context, conn **sql.Conn, timeout time.Duration) (bool, error) {
+	if *conn == nil {
+		c, err := d.Conn(ctx)
+		if err != nil {
+			return false, errors.Wrap(err, "failed to open lock connection")
+		}
+
+		*conn = c
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var held bool
+	if err := (*conn).QueryRowContext(ctx, `SELECT pg_try_advisory_lock(hashtext($1))`, d.lockKey()).Scan(&held); err != nil {
+		(*conn).Close()
+		*conn = nil
+
+		return false, errors.Wrapf(err, "failed to try schema lock: %s", d.prefix)
+	}
+
+	return held, nil
+}
+
+// claimTerm increments the term of the schema on conn holding the lock and returns it. The update waits for the writes
+// of a previous leader still in flight, and makes them fail their term check once committed.
+func (d *Database) claimTerm(ctx context.Context, conn *sql.Conn, timeout time.Duration) (int64, error) {
+	query := compile(`
+		INSERT INTO _SCHEMA_.metadata(key, value)
+		VALUES($1, '1')
+		ON CONFLICT(key) DO UPDATE SET value = (_SCHEMA_.metadata.value::BIGINT + 1)::TEXT
+		RETURNING value::BIGINT
+	`, d.prefix)
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var term int64
+	if err := conn.QueryRowContext(ctx, query, termKey).Scan(&term); err != nil {
+		return 0, errors.Wrapf(err, "failed to claim term of schema: %s", d.prefix)
+	}
+
+	return term, nil
+}
+
+// unlock releases the schema lock held on conn
+func (d *Database) unlock(conn *sql.Conn) {
+	ctx, cancel := d.defaultDeadline()
+	defer cancel()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_unlock(hashtext($1))`, d.lockKey()); err != nil {
+		d.logger.Warnf(err, "postgres", "failed to release schema lock: %s", d.prefix)
+	}
+}
+
+// watchLock checks the session holding the lock every interval. The lock is held for as long as the session is alive,
+// so once the session fails the lock is marked as lost and writes are refused.
+func (d *Database) watchLock(conn *sql.Conn, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		d.lock.mu.Lock()
+		current := d.lock.conn == conn
+		d.lock.mu.Unlock()
+
+		// lock was released
+		if !current {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		_, err := conn.ExecContext(ctx, `SELECT 1`)
+		cancel()
+
+		if err == nil {
+			continue
+		}
+
+		d.loseLock(conn, err)
+
+		return
+	}
+}
+
+// loseLock marks the lock held on conn as lost because of err, so that writes are refused and LockLost is closed
+func (d *Database) loseLock(conn *sql.Conn, err error) {
+	d.lock.mu.Lock()
+	if conn == nil || d.lock.conn != conn {
+		// released or already lost
+		d.lock.mu.Unlock()
+		return
+	}
+	d.lock.held = false
+	d.lock.conn = nil
+	lost := d.lock.lost
+	d.lock.mu.Unlock()
+
+	conn.Close()
+	close(lost)
+
+	d.logger.Errorf(err, "postgres", "lost schema lock: %s", d.prefix)
+}
+
+// releaseLock unlocks the schema so that a standby can take over immediately. Closing the connection only returns it
+// to the pool, which keeps the session and its lock alive until the pool is closed.
+func (d *Database) releaseLock() {
+	d.lock.mu.Lock()
+	defer d.lock.mu.Unlock()
+
+	if d.lock.conn == nil {
+		return
+	}
+
+	d.unlock(d.lock.conn)
+	d.lock.conn.Close()
+	d.lock.conn = nil
+	d.lock.held = false
+}
@@ -11,21 +11,27 @@ import (
 	"github.com/lib/pq"
 	"github.com/pkg/errors"
 	"github.com/shapeshift-legacy/coinquery/V2/config"
-	"github.com/shapeshift-legacy/coinquery/V2/internal/convert"
 	"github.com/shapeshift-legacy/coinquery/V2/internal/log"
+	"github.com/shapeshift-legacy/coinquery/V2/internal/metrics"
 	"github.com/shapeshift-legacy/coinquery/V2/internal/pretty"
 	"github.com/shapeshift-legacy/coinquery/V2/internal/retry"
 	"github.com/shapeshift-legacy/coinquery/V2/pkg/blockchain/utxo"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/storage"
 )
 
 // Database is our sweet database struct. Used for interacting with the database
 type Database struct {
 	DB
-	prefix  schemaPrefix // schema prefix eg. btc, ltc
-	sem     chan struct{}
-	closing chan struct{} // signal monitor to terminate
-	retry   config.Retry
-	timeout time.Duration // timeout for autocancelling long running queries
+	replicas *replicaPool // read replicas, nil if all reads go to DB
+	prefix   schemaPrefix // schema prefix eg. btc, ltc
+	sem      chan struct{}
+	maxConns int           // max open connections of DB, sem also counts those of the replicas
+	closing  chan struct{} // signal monitor to terminate
+	retry    config.Retry
+	timeout  time.Duration // timeout for autocancelling long running queries
+	logger   log.Logger
+	lock     schemaLock // advisory lock on the schema when using leader election
+	spends   int32      // set to 1 once SpendsIndexedKey is found, see spendsIndexed
 }
 
 // schemaPrefix is the table prefix for various coins
@@ -48,92 +54,56 @@ type DB interface {
 	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
 	Query(query string, args ...interface{}) (*sql.Rows, error)
 	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+	Conn(ctx context.Context) (*sql.Conn, error)
+	SetMaxOpenConns(n int)
 	Close() error
 }
 
-// Tx is shape of transaction for return from graphql and API rest interfaces
-type Tx struct {
-	ID          int      `json:"id,string"`
-	TxID        string   `json:"txid"`
-	Hash        string   `json:"hash"`
-	Version     int      `json:"version"`
-	Size        int      `json:"size"`
-	VSize       int      `json:"vsize"`
-	Weight      int      `json:"weight"`
-	Locktime    int      `json:"locktime"`
-	Inputs      []Input  `json:"vin"`
-	Outputs     []Output `json:"vout"`
-	BlockHash   string   `json:"blockhash"`
-	BlockHeight int64    `json:"blockheight"`
-	Time        string   `json:"time"`
-	BlockTime   string   `json:"blocktime"`
-	Cursor      string   `json:"cursor"`
-	Mempool     bool     `json:"mempool"`
+// defaultDeadline returns a context set to expire after the databases default timeout setting.
+// The cancelFunc should always be invoked when done to prevent a context leak
+func (d *Database) defaultDeadline() (context.Context, context.CancelFunc) {
+	return d.deadline(context.Background())
 }
 
-// PendingTx contains data to validate against mempool
-type PendingTx struct {
-	ID   int    `json:"id,string"`
-	TxID string `json:"txid"`
-}
+// deadline returns a context derived from ctx set to expire after the databases default timeout setting, so a query
+// is cancelled along with ctx. The cancelFunc should always be invoked when done to prevent a context leak
+func (d *Database) deadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	if d.timeout > 0 {
+		return context.WithTimeout(ctx, d.timeout)
+	}
 
-// Input is utxo shape
-type Input struct {
-	Vin         int      `json:"vin"`
-	SpentTx     string   `json:"spent_txid"`
-	SpentVout   int      `json:"spent_vout"`
-	Asm         string   `json:"asm"`
-	Hex         string   `json:"hex"`
-	Sequence    int      `json:"sequence"`
-	TxInWitness []string `json:"txinwitness"`
-	Coinbase    string   `json:"coinbase"`
+	return context.WithCancel(ctx)
 }
 
-// Output is utxo shape
-type Output struct {
-	Vout      int      `json:"vout"`
-	SatAmount int64    `json:"amount"`
-	Asm       string   `json:"asm"`
-	Hex       string   `json:"hex"`
-	ReqSigs   int      `json:"reqSigs"`
-	Type      string   `json:"type"`
-	Address   string   `json:"address"`
-	Addresses []string `json:"addresses"`
+// acquire takes a connection token, blocking until one is available
+func (d *Database) acquire() {
+	d.sem <- struct{}{}
+	metrics.DBTokensInUse.WithLabelValues(string(d.prefix)).Inc()
 }
 
-// SpentTxDetails structure
-type SpentTxDetails struct {
-	SpentTxID   string `json:"spentTxId"`
-	SpentIndex  int    `json:"spentIndex"`
-	SpentHeight int64  `json:"spentHeight"`
-}
+// acquireContext takes a connection token like acquire, returning the error of ctx if it is done before a token is
+// available
+func (d *Database) acquireContext(ctx context.Context) error {
+	select {
+	case d.sem <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 
-// Utxo structure
-type Utxo struct {
-	Vout        int    `json:"vout"`
-	Hex         string `json:"hex"`
-	ReqSigs     int    `json:"reqSigs"`
-	Type        string `json:"type"`
-	Address     string `json:"address"`
-	SatAmount   int64  `json:"amount"`
-	TxID        string `json:"txid"`
-	BlockHeight int64  `json:"height"`
-	Timestamp   string `json:"ts"`
+	metrics.DBTokensInUse.WithLabelValues(string(d.prefix)).Inc()
+	return nil
 }
 
-// RawTx structure
-type RawTx struct {
-	Hex string `json:"rawtx"`
+// release returns a connection token taken by acquire
+func (d *Database) release() {
+	<-d.sem
+	metrics.DBTokensInUse.WithLabelValues(string(d.prefix)).Dec()
 }
 
-// defaultDeadline returns a context set to expire after the databases default timeout setting.
-// The cancelFunc should always be invoked when done to prevent a context leak
-func (d *Database) defaultDeadline() (context.Context, context.CancelFunc) {
-	if d.timeout > 0 {
-		return context.WithTimeout(context.Background(), d.timeout)
-	}
-
-	return context.WithCancel(context.Background())
+// observe records the latency of a Database method call started at start
+func (d *Database) observe(method string, start time.Time) {
+	metrics.Since(metrics.DBQueryDuration, start, string(d.prefix), method)
 }
 
 // compile replaces schema prefixes within a given query string
@@ -163,7 +133,7 @@ func schemaFromCoin(coin string) schemaPrefix {
 }
 
 // monitor repeatedly pings the provided db and attempts to reconnect if the connection drops
-func monitor(db *sql.DB, closing chan struct{}) {
+func monitor(db *sql.DB, closing chan struct{}, logger log.Logger) {
 	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
 
@@ -171,7 +141,7 @@ func monitor(db *sql.DB, closing chan struct{}) {
 		select {
 		case <-ticker.C:
 			if err := db.Ping(); err != nil {
-				log.Warn(err, "postgres", "db failed to respond")
+				logger.Warn(err, "postgres", "db failed to respond")
 			}
 		case <-closing:
 			return
@@ -191,38 +161,70 @@ func New(dbConfig *config.DB, coin string) (*Database, error) {
 		return nil, errors.Wrap(fmt.Errorf("Coin: %s is unsupported", coin), "Invalid schema for given coin")
 	}
 
-	log.Info("postgres", "connected to db successfully")
+	logger := log.New(coin)
+	logger.Info("postgres", "connected to db successfully")
 
 	db.SetMaxOpenConns(dbConfig.MaxConns)
 	db.SetMaxIdleConns(dbConfig.MaxConns / 2)
 	db.SetConnMaxLifetime(time.Duration(dbConfig.MaxConnLifetime) * time.Second)
 
 	if err := db.Ping(); err != nil {
+		db.Close()
 		return nil, errors.Wrap(err, "failed to communicate with db")
 	}
 
+	// reads are spread across the replicas, each with its own connection pool
+	var replicas *replicaPool
+	if len(dbConfig.Replicas) > 0 {
+		if replicas, err = newReplicaPool(dbConfig, prefix, db, logger); err != nil {
+			db.Close()
+			return nil, err
+		}
+
+		// find the healthy replicas before serving the first read
+		replicas.check()
+		go replicas.run()
+	}
+
+	tokens := dbConfig.MaxConns * (1 + len(dbConfig.Replicas))
+	metrics.DBTokens.WithLabelValues(string(prefix)).Add(float64(tokens))
+
 	// Start monitor go-routine
 	closing := make(chan struct{})
-	go monitor(db, closing)
+	go monitor(db, closing, logger)
 
 	return &Database{
-		DB:      db,
-		sem:     make(chan struct{}, dbConfig.MaxConns),
-		closing: closing,
-		retry:   dbConfig.Retry,
-		prefix:  prefix,
-		timeout: time.Duration(dbConfig.Timeout) * time.Second,
+		DB:       db,
+		replicas: replicas,
+		sem:      make(chan struct{}, tokens),
+		maxConns: dbConfig.MaxConns,
+		closing:  closing,
+		retry:    dbConfig.Retry,
+		prefix:   prefix,
+		timeout:  time.Duration(dbConfig.Timeout) * time.Second,
+		logger:   logger,
 	}, nil
 }
 
-// Close signals the monitor to stop and closes the underlying db connection
+// Close signals the monitor to stop and closes the underlying db connection along with any replica connections
 func (d *Database) Close() error {
+	metrics.DBTokens.WithLabelValues(string(d.prefix)).Sub(float64(cap(d.sem)))
+	d.releaseLock()
 	d.closing <- struct{}{}
+
+	if d.replicas != nil {
+		if err := d.replicas.close(); err != nil {
+			d.logger.Warn(err, "postgres", "failed to close replicas")
+		}
+	}
+
 	return d.DB.Close()
 }
 
 // Get returns the value of key
-func (d *Database) Get(key string) (string, error) {
+func (d *Database) Get(ctx context.Context, key string) (string, error) {
+	defer d.observe("Get", time.Now())
+
 	query := compile(`
 		SELECT
 			value
@@ -232,9 +234,15 @@ func (d *Database) Get(key string) (string, error) {
 			key = $1;
 		`, d.prefix)
 
-	d.sem <- struct{}{} // Add token
-	row := d.QueryRow(query, key)
-	<-d.sem // Remove token
+	ctx, cancel := d.deadline(ctx)
+	defer cancel()
+
+	if err := d.acquireContext(ctx); err != nil {
+		return "", errors.Wrapf(err, "failed to get value for key: %s", key)
+	}
+
+	row := d.reader(ctx).QueryRowContext(ctx, query, key)
+	d.release()
 
 	var value string
 	if err := row.Scan(&value); err != nil {
@@ -246,15 +254,21 @@ func (d *Database) Get(key string) (string, error) {
 
 // Set inserts or updates key with value
 func (d *Database) Set(key, value string) error {
+	defer d.observe("Set", time.Now())
+
+	if err := d.checkLock(); err != nil {
+		return err
+	}
+
 	query := compile(`
 		INSERT INTO _SCHEMA_.metadata(key, value)
 		VALUES($1, $2)
 		ON CONFLICT(key) DO UPDATE SET value = $2
 	`, d.prefix)
 
-	d.sem <- struct{}{} // Add token
-	_, err := d.Exec(query, key, value)
-	<-d.sem // Remove token
+	d.acquire()
+	err := d.exec(context.Background(), query, key, value)
+	d.release()
 
 	if err != nil {
 		return errors.Wrapf(err, "failed to set key: %s, with value: %s", key, value)
@@ -264,7 +278,9 @@ func (d *Database) Set(key, value string) error {
 }
 
 // GetOrphanCount returns the number of orphaned blocks in the db
-func (d *Database) GetOrphanCount() (int, error) {
+func (d *Database) GetOrphanCount(ctx context.Context) (int, error) {
+	defer d.observe("GetOrphanCount", time.Now())
+
 	query := compile(`
 		SELECT
 			COUNT(*)
@@ -274,9 +290,15 @@ func (d *Database) GetOrphanCount() (int, error) {
 			is_orphaned = TRUE;
 		`, d.prefix)
 
-	d.sem <- struct{}{} // Add token
-	row := d.QueryRow(query)
-	<-d.sem // Remove token
+	ctx, cancel := d.deadline(ctx)
+	defer cancel()
+
+	if err := d.acquireContext(ctx); err != nil {
+		return 0, errors.Wrap(err, "failed to get orphan count")
+	}
+
+	row := d.reader(ctx).QueryRowContext(ctx, query)
+	d.release()
 
 	var count int
 	if err := row.Scan(&count); err != nil {
@@ -288,12 +310,18 @@ func (d *Database) GetOrphanCount() (int, error) {
 
 // DeleteOrphans will delete all orphaned txs and associated inputs and outputs
 func (d *Database) DeleteOrphans() error {
+	defer d.observe("DeleteOrphans", time.Now())
+
+	if err := d.checkLock(); err != nil {
+		return err
+	}
+
 	return retry.Simple(d.retry.Attempts, 3, func() error {
 		query := compile(`SELECT _SCHEMA_.delete_orphans()`, d.prefix)
 
-		d.sem <- struct{}{} // Add token
-		_, err := d.Exec(query)
-		<-d.sem // Remove token
+		d.acquire()
+		err := d.exec(context.Background(), query)
+		d.release()
 
 		if err != nil {
 			return errors.Wrap(err, "failed to delete orphans")
@@ -303,8 +331,40 @@ func (d *Database) DeleteOrphans() error {
 	})
 }
 
+// OrphanBlocks marks all blocks at or above height as orphaned in a single transaction and returns the number of blocks orphaned
+func (d *Database) OrphanBlocks(height int) (int, error) {
+	defer d.observe("OrphanBlocks", time.Now())
+
+	if err := d.checkLock(); err != nil {
+		return 0, err
+	}
+
+	var count int
+
+	err := retry.Simple(d.retry.Attempts, 3, func() error {
+		ctx, cancel := d.defaultDeadline()
+		defer cancel()
+
+		query := compile(`SELECT _SCHEMA_.block_orphan($1)`, d.prefix)
+
+		d.acquire()
+		err := d.queryRow(ctx, query, []interface{}{height}, &count)
+		d.release()
+
+		if err != nil {
+			return errors.Wrapf(err, "failed to orphan blocks from height: %d", height)
+		}
+
+		return nil
+	})
+
+	return count, err
+}
+
 // GetNumTransactions returns the number of transactions in the db
-func (d *Database) GetNumTransactions() (int, error) {
+func (d *Database) GetNumTransactions(ctx context.Context) (int, error) {
+	defer d.observe("GetNumTransactions", time.Now())
+
 	query := compile(`
 		SELECT
 			n_live_tup AS EstimatedCount
@@ -315,12 +375,15 @@ func (d *Database) GetNumTransactions() (int, error) {
 			AND relname = 'transaction';
 	`, d.prefix)
 
-	ctx, cancel := d.defaultDeadline()
+	ctx, cancel := d.deadline(ctx)
 	defer cancel()
 
-	d.sem <- struct{}{} // Add token
-	row := d.QueryRowContext(ctx, query)
-	<-d.sem // Remove token
+	if err := d.acquireContext(ctx); err != nil {
+		return 0, errors.Wrap(err, "failed to get transaction count")
+	}
+
+	row := d.reader(ctx).QueryRowContext(ctx, query)
+	d.release()
 
 	var count int
 	if err := row.Scan(&count); err != nil {
@@ -330,8 +393,23 @@ func (d *Database) GetNumTransactions() (int, error) {
 	return count, nil
 }
 
-// GetPendingTxs returns all pending transactions
-func (d *Database) GetPendingTxs(limitClause string) ([]*PendingTx, error) {
+// GetPendingTxs returns the pending transactions selected by filter in ascending id order. Pending transactions have
+// no block, so filter can't have a height or time range.
+func (d *Database) GetPendingTxs(ctx context.Context, filter storage.TxFilter) ([]*storage.PendingTx, error) {
+	defer d.observe("GetPendingTxs", time.Now())
+
+	if err := filter.Validate(); err != nil {
+		return nil, errors.Wrap(err, "failed to get pending transactions")
+	}
+
+	if filter.Mined() {
+		return nil, errors.Wrap(storage.ErrInvalidFilter, "failed to get pending transactions: pending txs have no block")
+	}
+
+	var args params
+	conditions := strings.Join(txConditions(filter, &args), "\n")
+	page := pageClause(filter.Page, &args)
+
 	query := compile(
 		fmt.Sprintf(`
 		SELECT
@@ -342,20 +420,27 @@ func (d *Database) GetPendingTxs(limitClause string) ([]*PendingTx, error) {
 		WHERE
 			block_id IS NULL
 		%s
-		ORDER BY id ASC;
-	`, limitClause), d.prefix)
+		ORDER BY id ASC
+		%s;
+	`, conditions, page), d.prefix)
+
+	ctx, cancel := d.deadline(ctx)
+	defer cancel()
+
+	if err := d.acquireContext(ctx); err != nil {
+		return nil, errors.Wrap(err, "failed to get pending transactions")
+	}
 
-	d.sem <- struct{}{} // Add token
-	rows, err := d.Query(query)
-	<-d.sem // Remove token
+	rows, err := d.reader(ctx).QueryContext(ctx, query, args...)
+	d.release()
 
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to get pending transactions")
 	}
 
-	txs := []*PendingTx{}
+	txs := []*storage.PendingTx{}
 	for rows.Next() {
-		tx := &PendingTx{}
+		tx := &storage.PendingTx{}
 
 		err := rows.Scan(&tx.ID, &tx.TxID)
 		if err != nil {
@@ -369,7 +454,9 @@ func (d *Database) GetPendingTxs(limitClause string) ([]*PendingTx, error) {
 }
 
 // GetTxAtBlockTime returns the earliest inserted transaction at the block closest to date
-func (d *Database) GetTxAtBlockTime(date time.Time) (int, error) {
+func (d *Database) GetTxAtBlockTime(ctx context.Context, date time.Time) (int, error) {
+	defer d.observe("GetTxAtBlockTime", time.Now())
+
 	query := compile(`
 		SELECT 
 			id
@@ -389,12 +476,15 @@ func (d *Database) GetTxAtBlockTime(date time.Time) (int, error) {
 		LIMIT 1;
 	`, d.prefix)
 
-	ctx, cancel := d.defaultDeadline()
+	ctx, cancel := d.deadline(ctx)
 	defer cancel()
 
-	d.sem <- struct{}{} // Add token
-	row := d.QueryRowContext(ctx, query, date)
-	<-d.sem // Remove token
+	if err := d.acquireContext(ctx); err != nil {
+		return 0, errors.Wrap(err, "failed to get highest validated transaction")
+	}
+
+	row := d.reader(ctx).QueryRowContext(ctx, query, date)
+	d.release()
 
 	var id int
 	if err := row.Scan(&id); err != nil {
@@ -406,12 +496,18 @@ func (d *Database) GetTxAtBlockTime(date time.Time) (int, error) {
 
 // DeleteInvalidTxs removes invalid transactions and associated inputs/outputs
 func (d *Database) DeleteInvalidTxs(ids []int) error {
+	defer d.observe("DeleteInvalidTxs", time.Now())
+
+	if err := d.checkLock(); err != nil {
+		return err
+	}
+
 	return retry.Simple(d.retry.Attempts, 3, func() error {
 		query := compile(`SELECT _SCHEMA_.delete_invalid_txs($1)`, d.prefix)
 
-		d.sem <- struct{}{} // Add token
-		_, err := d.Exec(query, pq.Array(ids))
-		<-d.sem // Remove token
+		d.acquire()
+		err := d.exec(context.Background(), query, pq.Array(ids))
+		d.release()
 
 		if err != nil {
 			return errors.Wrapf(err, "failed to delete invalid txs: %v", ids)
@@ -423,6 +519,12 @@ func (d *Database) DeleteInvalidTxs(ids []int) error {
 
 // InsertBlock inserts a utxo.Block into the database
 func (d *Database) InsertBlock(b *utxo.Block, recover bool) (int, error) {
+	defer d.observe("InsertBlock", time.Now())
+
+	if err := d.checkLock(); err != nil {
+		return 0, err
+	}
+
 	var blockID int
 	return blockID, retry.Simple(d.retry.Attempts, 3, func() error {
 		blockObj := struct {
@@ -456,18 +558,18 @@ func (d *Database) InsertBlock(b *utxo.Block, recover bool) (int, error) {
 		defer cancel()
 
 		query := compile(`SELECT _SCHEMA_.block_insert($1, $2, $3, $4)`, d.prefix)
-		d.sem <- struct{}{} // Add token
-		row := d.QueryRowContext(
-			ctx,
-			query,
+		args := []interface{}{
 			blockBytes,
 			time.Unix(int64(b.Time), 0),
 			time.Unix(int64(b.MedianTime), 0),
 			recover,
-		)
-		<-d.sem // Remove token
+		}
+
+		d.acquire()
+		err = d.queryRow(ctx, query, args, &blockID)
+		d.release()
 
-		if err := row.Scan(&blockID); err != nil {
+		if err != nil {
 			return errors.Wrapf(err, "failed to insert block: %+v", pretty.Print(blockObj))
 		}
 
@@ -476,7 +578,9 @@ func (d *Database) InsertBlock(b *utxo.Block, recover bool) (int, error) {
 }
 
 // LastBlock returns the last block added to the database
-func (d *Database) LastBlock() (*utxo.Block, error) {
+func (d *Database) LastBlock(ctx context.Context) (*utxo.Block, error) {
+	defer d.observe("LastBlock", time.Now())
+
 	query := compile(`
 		SELECT
 			block_hash,
@@ -491,12 +595,15 @@ func (d *Database) LastBlock() (*utxo.Block, error) {
 			1;
 		`, d.prefix)
 
-	ctx, cancel := d.defaultDeadline()
+	ctx, cancel := d.deadline(ctx)
 	defer cancel()
 
-	d.sem <- struct{}{} // Add token
-	row := d.QueryRowContext(ctx, query)
-	<-d.sem // Remove token
+	if err := d.acquireContext(ctx); err != nil {
+		return nil, errors.Wrap(err, "failed to get last block")
+	}
+
+	row := d.reader(ctx).QueryRowContext(ctx, query)
+	d.release()
 
 	b := &utxo.Block{}
 
@@ -512,29 +619,30 @@ func (d *Database) LastBlock() (*utxo.Block, error) {
 }
 
 // GetBlock returns a block at the specified height (int) or hash (string)
-func (d *Database) GetBlock(val interface{}) (*utxo.Block, error) {
-	ctx, cancel := d.defaultDeadline()
+func (d *Database) GetBlock(ctx context.Context, val interface{}) (*utxo.Block, error) {
+	defer d.observe("GetBlock", time.Now())
+
+	ctx, cancel := d.deadline(ctx)
 	defer cancel()
 
-	var row *sql.Row
+	var query string
 
 	switch v := val.(type) {
 	case int:
-		query := compile(`SELECT * FROM _SCHEMA_.block WHERE block.height = $1 AND is_orphaned = FALSE`, d.prefix)
-
-		d.sem <- struct{}{} // Add token
-		row = d.QueryRowContext(ctx, query, val.(int))
-		<-d.sem // Remove token
+		query = compile(`SELECT * FROM _SCHEMA_.block WHERE block.height = $1 AND is_orphaned = FALSE`, d.prefix)
 	case string:
-		query := compile(`SELECT * FROM _SCHEMA_.block WHERE block.block_hash = $1`, d.prefix)
-
-		d.sem <- struct{}{} // Add token
-		row = d.QueryRowContext(ctx, query, val.(string))
-		<-d.sem // Remove token
+		query = compile(`SELECT * FROM _SCHEMA_.block WHERE block.block_hash = $1`, d.prefix)
 	default:
 		return nil, errors.New(fmt.Sprintf("Blocks val must be of type int or string, instead of %T", v))
 	}
 
+	if err := d.acquireContext(ctx); err != nil {
+		return nil, errors.Wrapf(err, "failed to get block: %v", val)
+	}
+
+	row := d.reader(ctx).QueryRowContext(ctx, query, val)
+	d.release()
+
 	var id int
 	var t time.Time
 	var mt time.Time
@@ -554,8 +662,16 @@ func (d *Database) GetBlock(val interface{}) (*utxo.Block, error) {
 	return b, nil
 }
 
-// GetTxHashesByBlockHash gets tx hashes by block hash
-func (d *Database) GetTxHashesByBlockHash(hash, limitClause, offsetClause string) ([]string, error) {
+// GetTxHashesByBlockHash gets a page of tx hashes by block hash in the order they were inserted
+func (d *Database) GetTxHashesByBlockHash(ctx context.Context, hash string, page storage.Page) ([]string, error) {
+	defer d.observe("GetTxHashesByBlockHash", time.Now())
+
+	if err := page.Validate(); err != nil {
+		return nil, errors.Wrapf(err, "failed to get txhashes from block hash: %s", hash)
+	}
+
+	args := params{hash}
+
 	query := compile(
 		fmt.Sprintf(`
 			SELECT
@@ -566,16 +682,19 @@ func (d *Database) GetTxHashesByBlockHash(hash, limitClause, offsetClause string
 			WHERE
 				block_hash = $1
 				AND is_orphaned = FALSE
-			%s
-			%s;`, limitClause, offsetClause),
+			ORDER BY transaction.id ASC
+			%s;`, pageClause(page, &args)),
 		d.prefix)
 
-	ctx, cancel := d.defaultDeadline()
+	ctx, cancel := d.deadline(ctx)
 	defer cancel()
 
-	d.sem <- struct{}{} // Add token
-	rows, err := d.QueryContext(ctx, query, hash)
-	<-d.sem // Remove token
+	if err := d.acquireContext(ctx); err != nil {
+		return nil, errors.Wrapf(err, "failed to get txhashes from block hash: %s", hash)
+	}
+
+	rows, err := d.reader(ctx).QueryContext(ctx, query, args...)
+	d.release()
 
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to get txhashes from block hash: %s", hash)
@@ -598,7 +717,9 @@ func (d *Database) GetTxHashesByBlockHash(hash, limitClause, offsetClause string
 }
 
 // GetTotalTxsByBlockHash gets the total number of txs in a block
-func (d *Database) GetTotalTxsByBlockHash(hash string) (int, error) {
+func (d *Database) GetTotalTxsByBlockHash(ctx context.Context, hash string) (int, error) {
+	defer d.observe("GetTotalTxsByBlockHash", time.Now())
+
 	query := compile(`
 		SELECT
 			COUNT(*)
@@ -610,12 +731,15 @@ func (d *Database) GetTotalTxsByBlockHash(hash string) (int, error) {
 			AND is_orphaned = FALSE;
 	`, d.prefix)
 
-	ctx, cancel := d.defaultDeadline()
+	ctx, cancel := d.deadline(ctx)
 	defer cancel()
 
-	d.sem <- struct{}{} // Add token
-	row := d.QueryRowContext(ctx, query, hash)
-	<-d.sem // Remove token
+	if err := d.acquireContext(ctx); err != nil {
+		return 0, errors.Wrapf(err, "failed to get total transaction count from block: %s", hash)
+	}
+
+	row := d.reader(ctx).QueryRowContext(ctx, query, hash)
+	d.release()
 
 	var txCount int
 	if err := row.Scan(&txCount); err != nil {
@@ -626,33 +750,56 @@ func (d *Database) GetTotalTxsByBlockHash(hash string) (int, error) {
 }
 
 // GetSpentTxDetails returns spent details for a specific vout in a txid
-func (d *Database) GetSpentTxDetails(txid string, vout int) *SpentTxDetails {
+func (d *Database) GetSpentTxDetails(ctx context.Context, txid string, vout int) *storage.SpentTxDetails {
+	defer d.observe("GetSpentTxDetails", time.Now())
+
 	query := compile(`
 		SELECT
 			transaction.txid,
-			input.vin,
+			output.spending_vin,
 			block.height
 		FROM
-			_SCHEMA_.input
-			JOIN _SCHEMA_.transaction ON input.transaction_id = transaction.id
+			_SCHEMA_.transaction AS spent
+			JOIN _SCHEMA_.output ON output.transaction_id = spent.id
+			AND output.vout = $2
+			JOIN _SCHEMA_.transaction ON output.spending_transaction_id = transaction.id
 			LEFT OUTER JOIN _SCHEMA_.block ON transaction.block_id = block.id
 			AND block.is_orphaned = FALSE
 		WHERE
-			input.spent_txid = $1
-			AND input.spent_vout = $2;
+			spent.txid = $1;
 	`, d.prefix)
 
-	ctx, cancel := d.defaultDeadline()
+	if !d.spendsIndexed(ctx) {
+		query = compile(`
+			SELECT
+				transaction.txid,
+				input.vin,
+				block.height
+			FROM
+				_SCHEMA_.input
+				JOIN _SCHEMA_.transaction ON input.transaction_id = transaction.id
+				LEFT OUTER JOIN _SCHEMA_.block ON transaction.block_id = block.id
+				AND block.is_orphaned = FALSE
+			WHERE
+				input.spent_txid = $1
+				AND input.spent_vout = $2;
+		`, d.prefix)
+	}
+
+	ctx, cancel := d.deadline(ctx)
 	defer cancel()
 
-	d.sem <- struct{}{} // Add token
-	row := d.QueryRowContext(ctx, query, txid, vout)
-	<-d.sem // Remove token
+	if err := d.acquireContext(ctx); err != nil {
+		return nil
+	}
+
+	row := d.reader(ctx).QueryRowContext(ctx, query, txid, vout)
+	d.release()
 
 	// sql.Null* Types for dealing with NULL refs in SQL
 	var spentHeight sql.NullInt64
 
-	details := &SpentTxDetails{}
+	details := &storage.SpentTxDetails{}
 
 	if err := row.Scan(&details.SpentTxID, &details.SpentIndex, &spentHeight); err != nil {
 		return nil
@@ -668,8 +815,39 @@ func (d *Database) GetSpentTxDetails(txid string, vout int) *SpentTxDetails {
 }
 
 // GetUtxosByAddrs returns unspent outputs for a given address
-func (d *Database) GetUtxosByAddrs(addrs []string) ([]*Utxo, error) {
-	query := compile(`
+func (d *Database) GetUtxosByAddrs(ctx context.Context, addrs []string) ([]*storage.Utxo, error) {
+	utxos := []*storage.Utxo{}
+
+	err := d.EachUtxoByAddrs(ctx, addrs, func(utxo *storage.Utxo) error {
+		utxos = append(utxos, utxo)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return utxos, nil
+}
+
+// EachUtxoByAddrs calls fn with each unspent output of addrs as its row is read, newest block first with mempool
+// outputs last, so that a large set isn't held in memory whole. Stops at the first error returned by fn.
+func (d *Database) EachUtxoByAddrs(ctx context.Context, addrs []string, fn func(*storage.Utxo) error) error {
+	defer d.observe("EachUtxoByAddrs", time.Now())
+
+	unspent := `output.spending_transaction_id IS NULL`
+	if !d.spendsIndexed(ctx) {
+		unspent = `NOT EXISTS (
+				SELECT
+					*
+				FROM
+					_SCHEMA_.input
+				WHERE
+					input.spent_txid = transaction.txid
+					AND input.spent_vout = output.vout
+			)`
+	}
+
+	query := compile(fmt.Sprintf(`
 		SELECT
 			output.vout,
 			output.hex,
@@ -687,26 +865,26 @@ func (d *Database) GetUtxosByAddrs(addrs []string) ([]*Utxo, error) {
 			AND block.is_orphaned = FALSE
 		WHERE
 			output.address = ANY($1)
-			AND NOT EXISTS (
-				SELECT
-					*
-				FROM
-					_SCHEMA_.input
-				WHERE
-					input.spent_txid = transaction.txid
-					AND input.spent_vout = output.vout
-			);
-	`, d.prefix)
+			AND %s
+		ORDER BY
+			block.height DESC NULLS LAST,
+			output.transaction_id,
+			output.vout;
+	`, unspent), d.prefix)
 
-	ctx, cancel := d.defaultDeadline()
+	ctx, cancel := d.deadline(ctx)
 	defer cancel()
 
-	d.sem <- struct{}{} // Add token
-	rows, err := d.QueryContext(ctx, query, pq.Array(addrs))
-	<-d.sem // Remove token
+	if err := d.acquireContext(ctx); err != nil {
+		return errors.Wrapf(err, "failed to get utxos from addresses: %s", addrs)
+	}
 
+	// the connection is held until every row is read, so it counts against maxConns until then
+	defer d.release()
+
+	rows, err := d.reader(ctx).QueryContext(ctx, query, pq.Array(addrs))
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to get utxos from addresses: %s", addrs)
+		return errors.Wrapf(err, "failed to get utxos from addresses: %s", addrs)
 	}
 
 	defer rows.Close()
@@ -715,16 +893,15 @@ func (d *Database) GetUtxosByAddrs(addrs []string) ([]*Utxo, error) {
 	var blockHeight sql.NullInt64
 	var blockTime sql.NullString
 
-	utxos := []*Utxo{}
 	for rows.Next() {
-		utxo := &Utxo{}
+		utxo := &storage.Utxo{}
 
 		err := rows.Scan(
 			&utxo.Vout, &utxo.Hex, &utxo.ReqSigs, &utxo.Type, &utxo.Address,
 			&utxo.SatAmount, &utxo.TxID, &blockHeight, &blockTime,
 		)
 		if err != nil {
-			return nil, errors.Wrapf(err, "failed to scan row when retrieving utxos from addresses: %s", addrs)
+			return errors.Wrapf(err, "failed to scan row when retrieving utxos from addresses: %s", addrs)
 		}
 
 		if blockHeight.Valid {
@@ -739,15 +916,24 @@ func (d *Database) GetUtxosByAddrs(addrs []string) ([]*Utxo, error) {
 			utxo.Timestamp = time.Now().Format(time.RFC3339)
 		}
 
-		utxos = append(utxos, utxo)
+		if err := fn(utxo); err != nil {
+			return err
+		}
 	}
 
-	return utxos, nil
+	if err := rows.Err(); err != nil {
+		return errors.Wrapf(err, "failed to read utxos from addresses: %s", addrs)
+	}
+
+	return nil
 }
 
-// GetOutputsByTxID returns a list of all transaction outputs from a txid
-// The voutClause can specify searching outputs by vout number
-func (d *Database) GetOutputsByTxID(txid string, voutClause string) ([]Output, error) {
+// GetOutputsByTxID returns a list of the transaction outputs from a txid selected by filter
+func (d *Database) GetOutputsByTxID(ctx context.Context, txid string, filter storage.OutputFilter) ([]storage.Output, error) {
+	defer d.observe("GetOutputsByTxID", time.Now())
+
+	args := params{txid}
+
 	query := compile(fmt.Sprintf(`
 		SELECT
 			output.vout,
@@ -765,14 +951,17 @@ func (d *Database) GetOutputsByTxID(txid string, voutClause string) ([]Output, e
 		WHERE
 			transaction.txid = $1
 			%s;
-	`, voutClause), d.prefix)
+	`, outputConditions(filter, &args)), d.prefix)
 
-	ctx, cancel := d.defaultDeadline()
+	ctx, cancel := d.deadline(ctx)
 	defer cancel()
 
-	d.sem <- struct{}{} // Add token
-	rows, err := d.QueryContext(ctx, query, txid)
-	<-d.sem // Remove token
+	if err := d.acquireContext(ctx); err != nil {
+		return nil, errors.Wrapf(err, "failed to get outputs from txid: %s", txid)
+	}
+
+	rows, err := d.reader(ctx).QueryContext(ctx, query, args...)
+	d.release()
 
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to get outputs from txid: %s", txid)
@@ -780,9 +969,9 @@ func (d *Database) GetOutputsByTxID(txid string, voutClause string) ([]Output, e
 
 	defer rows.Close()
 
-	vouts := []Output{}
+	vouts := []storage.Output{}
 	for rows.Next() {
-		vout := Output{}
+		vout := storage.Output{}
 
 		err := rows.Scan(&vout.Vout, &vout.Asm, &vout.Hex, &vout.Address, &vout.SatAmount, &vout.Type, &vout.ReqSigs)
 		if err != nil {
@@ -795,54 +984,64 @@ func (d *Database) GetOutputsByTxID(txid string, voutClause string) ([]Output, e
 	return vouts, nil
 }
 
-// GetTxIDsByAddresses returns a slice of txids given a slice holding an address or addresses
-func (d *Database) GetTxIDsByAddresses(addrs []string, limitClause, whereClause, offsetClause string) ([]string, error) {
+// GetTxIDsByAddresses returns a slice of txids selected by filter given a slice holding an address or addresses, newest
+// first by height with the mempool ahead of every block, see Cursor. Transactions are looked up in address_transaction,
+// so addresses of transactions written before the table existed are only found once it is backfilled, see
+// IndexAddresses.
+func (d *Database) GetTxIDsByAddresses(ctx context.Context, addrs []string, filter storage.TxFilter) ([]string, error) {
+	defer d.observe("GetTxIDsByAddresses", time.Now())
+
+	if err := filter.Validate(); err != nil {
+		return nil, errors.Wrapf(err, "failed to get tx details from addresses: %v", addrs)
+	}
+
+	args := params{pq.Array(addrs)}
+	conditions := addressConditions(filter, &args)
+	page := pageClause(filter.Page, &args)
+
+	// the block is only needed for its mined time
+	join := ""
+	if filter.Timed() {
+		join = `JOIN _SCHEMA_.block ON block.height = address_transaction.height
+			AND block.is_orphaned = FALSE`
+	}
+
+	order := addressOrder(filter)
+
 	query := compile(fmt.Sprintf(`
 		SELECT
 			transaction.id,
 			transaction.txid
-		FROM
-			_SCHEMA_.transaction
-			JOIN _SCHEMA_.output ON output.transaction_id = transaction.id
-			LEFT JOIN _SCHEMA_.block ON transaction.block_id = block.id
-			AND block.is_orphaned = FALSE
-		WHERE
-			output.address = ANY($1)
-		%s
-		UNION
-		SELECT
-			transaction.id,
-			transaction.txid
-		FROM
-			_SCHEMA_.output
-			JOIN (
-				SELECT
-					input.transaction_id AS vin_txid,
-					input.spent_vout AS spent_vout,
-					transaction.id AS spent_id
-				FROM
-					_SCHEMA_.input
-					JOIN _SCHEMA_.transaction ON input.spent_txid = transaction.txid
-			) AS inputs ON inputs.spent_id = output.transaction_id
-			AND inputs.spent_vout = output.vout
-			JOIN _SCHEMA_.transaction ON inputs.vin_txid = transaction.id
-			LEFT JOIN _SCHEMA_.block ON transaction.block_id = block.id
-			AND block.is_orphaned = FALSE
-		WHERE
-			output.address = ANY($1)
-		%s
+		FROM (
+			SELECT DISTINCT
+				%s AS position,
+				address_transaction.transaction_id
+			FROM
+				_SCHEMA_.address_transaction
+			%s
+			WHERE
+				address_transaction.address = ANY($1)
+			%s
+			ORDER BY
+				position %s,
+				address_transaction.transaction_id %s
+			%s
+		) AS txs
+		JOIN _SCHEMA_.transaction ON transaction.id = txs.transaction_id
 		ORDER BY
-			id DESC
-		%s
-		%s;
-	`, whereClause, whereClause, limitClause, offsetClause), d.prefix)
+			txs.position DESC,
+			transaction.id DESC;
+	`, addressPosition, join, conditions, order, order, page), d.prefix)
 
-	ctx, cancel := d.defaultDeadline()
+	ctx, cancel := d.deadline(ctx)
 	defer cancel()
 
-	d.sem <- struct{}{} // Add token
-	rows, err := d.QueryContext(ctx, query, pq.Array(addrs))
-	<-d.sem // Remove token
+	if err := d.acquireContext(ctx); err != nil {
+		return nil, errors.Wrapf(err, "failed to get tx details from addresses: %v", addrs)
+	}
+
+	rows, err := d.reader(ctx).QueryContext(ctx, query, args...)
+	d.release()
 
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to get tx details from addresses: %v", addrs)
@@ -865,62 +1064,188 @@ func (d *Database) GetTxIDsByAddresses(addrs []string, limitClause, whereClause,
 }
 
 // GetTotalTxsByAddresses gets a total count of txs for a slice of address(es)
-func (d *Database) GetTotalTxsByAddresses(addrs []string) (int, error) {
+func (d *Database) GetTotalTxsByAddresses(ctx context.Context, addrs []string) (int, error) {
+	defer d.observe("GetTotalTxsByAddresses", time.Now())
+
 	query := compile(`
 		SELECT
-			COUNT(*)
+			COUNT(DISTINCT transaction_id)
+		FROM
+			_SCHEMA_.address_transaction
+		WHERE
+			address = ANY($1);
+	`, d.prefix)
+
+	ctx, cancel := d.deadline(ctx)
+	defer cancel()
+
+	if err := d.acquireContext(ctx); err != nil {
+		return 0, errors.Wrapf(err, "failed to get total transaction count from addresses: %s", addrs)
+	}
+
+	row := d.reader(ctx).QueryRowContext(ctx, query, pq.Array(addrs))
+	d.release()
+
+	var txCount int
+
+	if err := row.Scan(&txCount); err != nil {
+		return 0, errors.Wrapf(err, "failed to get total transaction count from addresses: %s", addrs)
+	}
+
+	return txCount, nil
+}
+
+// GetAddressSummary returns the amounts received and sent by addr and its number of transactions, split by whether
+// they are confirmed. An output is sent by the transaction spending it, searched in input until the spends backfill has
+// run. Transactions are counted in address_transaction, which needs its backfill on schemas written before it existed.
+func (d *Database) GetAddressSummary(ctx context.Context, addr string) (*storage.AddressSummary, error) {
+	summary, err := d.GetAddressesSummary(ctx, []string{addr})
+	if err != nil {
+		return nil, err
+	}
+
+	summary.Address = addr
+
+	return summary, nil
+}
+
+// GetAddressesSummary returns the summary of addrs taken together, see GetAddressSummary. A transfer between two of
+// addrs is both received and sent, and a transaction involving several of addrs is counted once.
+func (d *Database) GetAddressesSummary(ctx context.Context, addrs []string) (*storage.AddressSummary, error) {
+	defer d.observe("GetAddressesSummary", time.Now())
+
+	// until the spending columns are backfilled the spenders are searched in input, or sent would read as 0
+	spender := `JOIN _SCHEMA_.transaction ON output.spending_transaction_id = transaction.id`
+	if !d.spendsIndexed(ctx) {
+		spender = `JOIN _SCHEMA_.transaction AS spent ON output.transaction_id = spent.id
+				JOIN LATERAL (
+					SELECT
+						input.transaction_id
+					FROM
+						_SCHEMA_.input
+					WHERE
+						input.spent_txid = spent.txid
+						AND input.spent_vout = output.vout
+					ORDER BY
+						input.transaction_id
+					LIMIT 1
+				) AS spend ON TRUE
+				JOIN _SCHEMA_.transaction ON spend.transaction_id = transaction.id`
+	}
+
+	query := compile(fmt.Sprintf(`
+		SELECT
+			received.confirmed,
+			received.unconfirmed,
+			sent.confirmed,
+			sent.unconfirmed,
+			txs.confirmed,
+			txs.unconfirmed
 		FROM (
 			SELECT
-				transaction.id
+				COALESCE(SUM(output.amount) FILTER (WHERE block.id IS NOT NULL), 0) AS confirmed,
+				COALESCE(SUM(output.amount) FILTER (WHERE block.id IS NULL), 0) AS unconfirmed
 			FROM
-				_SCHEMA_.transaction
-				JOIN _SCHEMA_.output ON output.transaction_id = transaction.id
+				_SCHEMA_.output
+				JOIN _SCHEMA_.transaction ON output.transaction_id = transaction.id
 				LEFT JOIN _SCHEMA_.block ON transaction.block_id = block.id
 				AND block.is_orphaned = FALSE
 			WHERE
 				output.address = ANY($1)
-			UNION
+		) AS received,
+		(
 			SELECT
-				transaction.id
+				COALESCE(SUM(output.amount) FILTER (WHERE block.id IS NOT NULL), 0) AS confirmed,
+				COALESCE(SUM(output.amount) FILTER (WHERE block.id IS NULL), 0) AS unconfirmed
 			FROM
 				_SCHEMA_.output
-				JOIN (
-					SELECT
-						input.transaction_id AS vin_txid,
-						transaction.id AS spent_id,
-						input.spent_vout AS spent_vout
-					FROM
-						_SCHEMA_.input
-						JOIN _SCHEMA_.transaction ON input.spent_txid = transaction.txid
-				) AS inputs ON inputs.spent_id = output.transaction_id
-				AND inputs.spent_vout = output.vout
-				JOIN _SCHEMA_.transaction ON inputs.vin_txid = transaction.id
+				%s
 				LEFT JOIN _SCHEMA_.block ON transaction.block_id = block.id
 				AND block.is_orphaned = FALSE
 			WHERE
 				output.address = ANY($1)
-		) AS COUNT;
+		) AS sent,
+		(
+			SELECT
+				COUNT(DISTINCT transaction_id) FILTER (WHERE height IS NOT NULL) AS confirmed,
+				COUNT(DISTINCT transaction_id) FILTER (WHERE height IS NULL) AS unconfirmed
+			FROM
+				_SCHEMA_.address_transaction
+			WHERE
+				address = ANY($1)
+		) AS txs;
+	`, spender), d.prefix)
+
+	ctx, cancel := d.deadline(ctx)
+	defer cancel()
+
+	if err := d.acquireContext(ctx); err != nil {
+		return nil, errors.Wrapf(err, "failed to get summary of addresses: %s", addrs)
+	}
+
+	summary := &storage.AddressSummary{}
+
+	row := d.reader(ctx).QueryRowContext(ctx, query, pq.Array(addrs))
+	d.release()
+
+	err := row.Scan(
+		&summary.Received, &summary.UnconfirmedReceived, &summary.Sent, &summary.UnconfirmedSent,
+		&summary.Txs, &summary.UnconfirmedTxs,
+	)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get summary of addresses: %s", addrs)
+	}
+
+	return summary, nil
+}
+
+// GetUsedAddresses returns those of addrs with at least one transaction, in no particular order
+func (d *Database) GetUsedAddresses(ctx context.Context, addrs []string) ([]string, error) {
+	defer d.observe("GetUsedAddresses", time.Now())
+
+	query := compile(`
+		SELECT DISTINCT
+			address
+		FROM
+			_SCHEMA_.address_transaction
+		WHERE
+			address = ANY($1);
 	`, d.prefix)
 
-	ctx, cancel := d.defaultDeadline()
+	ctx, cancel := d.deadline(ctx)
 	defer cancel()
 
-	d.sem <- struct{}{} // Add token
-	row := d.QueryRowContext(ctx, query, pq.Array(addrs))
-	<-d.sem // Remove token
+	if err := d.acquireContext(ctx); err != nil {
+		return nil, errors.Wrapf(err, "failed to get used addresses from addresses: %s", addrs)
+	}
 
-	var txCount int
+	rows, err := d.reader(ctx).QueryContext(ctx, query, pq.Array(addrs))
+	d.release()
 
-	if err := row.Scan(&txCount); err != nil {
-		return 0, errors.Wrapf(err, "failed to get total transaction count from addresses: %s", addrs)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get used addresses from addresses: %s", addrs)
 	}
 
-	return txCount, nil
+	defer rows.Close()
+
+	used := []string{}
+	for rows.Next() {
+		var addr string
+		if err := rows.Scan(&addr); err != nil {
+			return nil, errors.Wrap(err, "failed to scan row when retrieving used addresses")
+		}
+
+		used = append(used, addr)
+	}
+
+	return used, rows.Err()
 }
 
 // GetTxByTxID returns transaction full details including vins and vouts
 // Error if more than one tx found for that txid
-func (d *Database) GetTxByTxID(txid string) (*Tx, error) {
+func (d *Database) GetTxByTxID(ctx context.Context, txid string) (*storage.Tx, error) {
+	defer d.observe("GetTxByTxID", time.Now())
+
 	query := compile(`
 		SELECT
 			transaction.id,
@@ -942,22 +1267,25 @@ func (d *Database) GetTxByTxID(txid string) (*Tx, error) {
 			transaction.txid = $1;
 	`, d.prefix)
 
-	ctx, cancel := d.defaultDeadline()
+	ctx, cancel := d.deadline(ctx)
 	defer cancel()
 
-	d.sem <- struct{}{} // Add token
-	row := d.QueryRowContext(ctx, query, txid)
-	<-d.sem // Remove token
+	if err := d.acquireContext(ctx); err != nil {
+		return nil, errors.Wrapf(err, "failed to get transaction from txid: %s", txid)
+	}
 
 	// sql.Null* Types for dealing with NULL refs in SQL
 	var blockHeight sql.NullInt64
 	var blockHash, blockTime sql.NullString
 
-	tx := &Tx{}
-	err := row.Scan(
+	// a tx found on the primary only was just written, so its inputs and outputs are read from the primary as well
+	tx := &storage.Tx{}
+	ctx, err := d.scanRow(ctx, query, []interface{}{txid},
 		&tx.ID, &tx.TxID, &tx.Hash, &tx.Version, &tx.Size, &tx.VSize, &tx.Weight, &tx.Locktime,
 		&blockHeight, &blockHash, &blockTime,
 	)
+	d.release()
+
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to get transaction from txid: %s", txid)
 	}
@@ -969,6 +1297,8 @@ func (d *Database) GetTxByTxID(txid string) (*Tx, error) {
 		tx.Mempool = true
 	}
 
+	tx.Cursor = storage.Cursor{Height: int(tx.BlockHeight), ID: tx.ID}.String()
+
 	if blockHash.Valid {
 		tx.BlockHash = blockHash.String
 	}
@@ -980,12 +1310,12 @@ func (d *Database) GetTxByTxID(txid string) (*Tx, error) {
 		tx.Time = time.Now().Format(time.RFC3339)
 	}
 
-	tx.Inputs, err = d.GetInputsByTxID(tx.TxID)
+	tx.Inputs, err = d.GetInputsByTxID(ctx, tx.TxID)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to get transaction from txid: %s", txid)
 	}
 
-	tx.Outputs, err = d.GetOutputsByTxID(tx.TxID, "")
+	tx.Outputs, err = d.GetOutputsByTxID(ctx, tx.TxID, storage.OutputFilter{})
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to get transaction from txid: %s", txid)
 	}
@@ -994,7 +1324,9 @@ func (d *Database) GetTxByTxID(txid string) (*Tx, error) {
 }
 
 // GetRawTxByTxID gets the raw_transaction from the transaction table
-func (d *Database) GetRawTxByTxID(txid string) (*RawTx, error) {
+func (d *Database) GetRawTxByTxID(ctx context.Context, txid string) (*storage.RawTx, error) {
+	defer d.observe("GetRawTxByTxID", time.Now())
+
 	query := compile(`
 		SELECT
 			raw_transaction
@@ -1004,15 +1336,18 @@ func (d *Database) GetRawTxByTxID(txid string) (*RawTx, error) {
 			txid = $1;
 	`, d.prefix)
 
-	ctx, cancel := d.defaultDeadline()
+	ctx, cancel := d.deadline(ctx)
 	defer cancel()
 
-	d.sem <- struct{}{} // Add token
-	row := d.QueryRowContext(ctx, query, txid)
-	<-d.sem // Remove token
+	if err := d.acquireContext(ctx); err != nil {
+		return nil, errors.Wrapf(err, "failed to get rawTx for txid: %s", txid)
+	}
+
+	rawTx := &storage.RawTx{}
+	_, err := d.scanRow(ctx, query, []interface{}{txid}, &rawTx.Hex)
+	d.release()
 
-	rawTx := &RawTx{}
-	if err := row.Scan(&rawTx.Hex); err != nil {
+	if err != nil {
 		return nil, errors.Wrapf(err, "failed to get rawTx for txid: %s", txid)
 	}
 
@@ -1020,7 +1355,9 @@ func (d *Database) GetRawTxByTxID(txid string) (*RawTx, error) {
 }
 
 // GetInputsByTxID returns a list of transaction inputs
-func (d *Database) GetInputsByTxID(txid string) ([]Input, error) {
+func (d *Database) GetInputsByTxID(ctx context.Context, txid string) ([]storage.Input, error) {
+	defer d.observe("GetInputsByTxID", time.Now())
+
 	query := compile(`
 		SELECT
 			vin,
@@ -1040,12 +1377,15 @@ func (d *Database) GetInputsByTxID(txid string) ([]Input, error) {
 			transaction.txid = $1;
 	`, d.prefix)
 
-	ctx, cancel := d.defaultDeadline()
+	ctx, cancel := d.deadline(ctx)
 	defer cancel()
 
-	d.sem <- struct{}{} // Add token
-	rows, err := d.QueryContext(ctx, query, txid)
-	<-d.sem // Remove token
+	if err := d.acquireContext(ctx); err != nil {
+		return nil, errors.Wrapf(err, "failed to get inputs from txid: %s", txid)
+	}
+
+	rows, err := d.reader(ctx).QueryContext(ctx, query, txid)
+	d.release()
 
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to get inputs from txid: %s", txid)
@@ -1053,29 +1393,18 @@ func (d *Database) GetInputsByTxID(txid string) ([]Input, error) {
 
 	defer rows.Close()
 
-	vins := []Input{}
+	vins := []storage.Input{}
 	for rows.Next() {
 		var txInWitness sql.NullString
 
-		vin := Input{}
+		vin := storage.Input{}
 
 		err := rows.Scan(&vin.Vin, &vin.SpentTx, &vin.SpentVout, &vin.Asm, &vin.Hex, &vin.Sequence, &txInWitness, &vin.Coinbase)
 		if err != nil {
 			return nil, errors.Wrapf(err, "failed to scan row when retrieving inputs from txid: %s", txid)
 		}
 
-		if txInWitness.Valid {
-			witness := []string{}
-			str := txInWitness.String
-
-			if str != "[]" {
-				replacer := strings.NewReplacer("[", "", "]", "", " ", "", `"`, "")
-				str = replacer.Replace(str)
-				witness = strings.Split(str, ",")
-			}
-
-			vin.TxInWitness = witness
-		}
+		vin.TxInWitness = parseWitness(txInWitness)
 
 		vins = append(vins, vin)
 	}
@@ -1083,19 +1412,45 @@ func (d *Database) GetInputsByTxID(txid string) ([]Input, error) {
 	return vins, nil
 }
 
-// InsertTx inserts txs into the database, returns error if something bad happened
-func (d *Database) InsertTx(tx *utxo.Tx, txIndex int, blockID int) error {
-	txObj := struct {
-		TxID     string      `json:"txid"`
-		Hash     string      `json:"hash"`
-		Version  int         `json:"version"`
-		Size     int         `json:"size"`
-		VSize    int         `json:"vsize"`
-		Weight   int         `json:"weight"`
-		Locktime json.Number `json:"locktime"`
-		Inputs   []Input     `json:"inputs"`
-		Outputs  []Output    `json:"outputs"`
-	}{
+// parseWitness returns the items of the tx_in_witness json array of an input, or nil if it has none
+func parseWitness(txInWitness sql.NullString) []string {
+	if !txInWitness.Valid {
+		return nil
+	}
+
+	witness := []string{}
+	str := txInWitness.String
+
+	if str != "[]" {
+		replacer := strings.NewReplacer("[", "", "]", "", " ", "", `"`, "")
+		str = replacer.Replace(str)
+		witness = strings.Split(str, ",")
+	}
+
+	return witness
+}
+
+// txDef is the json transaction definition expected by transaction_insert
+type txDef struct {
+	TxID     string           `json:"txid"`
+	Hash     string           `json:"hash"`
+	Version  int              `json:"version"`
+	Size     int              `json:"size"`
+	VSize    int              `json:"vsize"`
+	Weight   int              `json:"weight"`
+	Locktime json.Number      `json:"locktime"`
+	Inputs   []storage.Input  `json:"inputs"`
+	Outputs  []storage.Output `json:"outputs"`
+}
+
+// newTxDef converts tx into a txDef for insertion
+func newTxDef(tx *utxo.Tx) (*txDef, error) {
+	outputs, err := storage.TxOutputs(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &txDef{
 		TxID:     tx.TxID,
 		Hash:     tx.Hash,
 		Version:  tx.Version,
@@ -1103,70 +1458,100 @@ func (d *Database) InsertTx(tx *utxo.Tx, txIndex int, blockID int) error {
 		VSize:    tx.VSize,
 		Weight:   tx.Weight,
 		Locktime: tx.Locktime,
-		Inputs:   make([]Input, 0),
-		Outputs:  make([]Output, 0),
-	}
-
-	for i, in := range tx.Vins {
-		input := Input{
-			Vin:         i,
-			SpentTx:     in.TxID,
-			SpentVout:   in.Vout,
-			Asm:         in.ScriptSig.Asm,
-			Hex:         in.ScriptSig.Hex,
-			TxInWitness: in.TxInWitness,
-			Sequence:    in.Sequence,
-			Coinbase:    in.Coinbase,
-		}
+		Inputs:   storage.TxInputs(tx),
+		Outputs:  outputs,
+	}, nil
+}
+
+// InsertTxs inserts all txs of a block along with their inputs and outputs in a single statement, so either all or
+// none of them are committed. The index of each tx is its position in txs. Use a blockID of -1 for mempool transactions.
+func (d *Database) InsertTxs(blockID int, txs []*utxo.Tx) error {
+	defer d.observe("InsertTxs", time.Now())
 
-		txObj.Inputs = append(txObj.Inputs, input)
+	if err := d.checkLock(); err != nil {
+		return err
 	}
 
-	for _, out := range tx.Vouts {
-		// check to see if this is a single value address otherwise default to "unsupported addr"
-		addr := "unsupported addr"
-		if len(out.ScriptPubKey.Addresses) == 1 {
-			addr = out.ScriptPubKey.Addresses[0]
-		}
+	if len(txs) == 0 {
+		return nil
+	}
+
+	txsBytes, err := marshalTxs(blockID, txs)
+	if err != nil {
+		return err
+	}
+
+	return retry.Simple(d.retry.Attempts, 3, func() error {
+		query := compile(`SELECT _SCHEMA_.transactions_insert($1, $2)`, d.prefix)
+
+		d.acquire()
+		err := d.exec(context.Background(), query, blockID, txsBytes)
+		d.release()
 
-		sats, err := convert.ToSatoshi(out.Value.String())
 		if err != nil {
-			return errors.Wrapf(err,
-				"failed to insert vout: %+v, in tx: %s, with txIndex: %d, and blockID: %d",
-				pretty.Print(out), tx.TxID, txIndex, blockID,
-			)
+			return errors.Wrapf(err, "failed to insert %d transactions with blockID: %d", len(txs), blockID)
 		}
 
-		output := Output{
-			Vout:      out.N,
-			SatAmount: sats,
-			Asm:       out.ScriptPubKey.Asm,
-			Hex:       out.ScriptPubKey.Hex,
-			ReqSigs:   out.ScriptPubKey.ReqSigs,
-			Type:      out.ScriptPubKey.Type,
-			Address:   addr,
-			Addresses: out.ScriptPubKey.Addresses,
-		}
+		return d.markSpends(txs)
+	})
+}
 
-		txObj.Outputs = append(txObj.Outputs, output)
+// markSpends marks the spends of txs again once they are committed. A spender and the transaction it spends inserted
+// by concurrent workers can't see each other until both commit, so the spend is only found by the pass of whichever
+// commits last. Addresses are indexed again only if a spend was missed, as the sent rows were missed with it.
+func (d *Database) markSpends(txs []*utxo.Tx) error {
+	txids := make([]string, 0, len(txs))
+	for _, tx := range txs {
+		txids = append(txids, tx.TxID)
 	}
 
-	txBytes, err := json.Marshal(txObj)
+	query := compile(`
+		WITH ids AS (
+			SELECT ARRAY(SELECT id FROM _SCHEMA_.transaction WHERE txid = ANY($1)) AS ids
+		), spent AS (
+			SELECT ids, _SCHEMA_.output_spend(ids, TRUE) AS count FROM ids
+		)
+		SELECT
+			_SCHEMA_.address_transaction_insert(ids, TRUE)
+		FROM
+			spent
+		WHERE
+			count > 0;
+	`, d.prefix)
+
+	d.acquire()
+	err := d.exec(context.Background(), query, pq.Array(txids))
+	d.release()
+
 	if err != nil {
-		return errors.Wrapf(err, "failed to marshal object: %+v", txObj)
+		return errors.Wrapf(err, "failed to mark spends of %d transactions", len(txs))
 	}
 
-	return retry.Simple(d.retry.Attempts, 3, func() error {
-		query := compile(`SELECT _SCHEMA_.transaction_insert($1, $2, $3, $4)`, d.prefix)
+	return nil
+}
 
-		d.sem <- struct{}{} // Add token
-		_, err = d.Exec(query, blockID, txBytes, tx.Hex, txIndex)
-		<-d.sem // Remove token
+// marshalTxs returns the json array of txs expected by transactions_insert
+func marshalTxs(blockID int, txs []*utxo.Tx) ([]byte, error) {
+	type txRow struct {
+		Index int    `json:"index"`
+		Raw   string `json:"raw"`
+		Tx    *txDef `json:"tx"`
+	}
 
+	rows := make([]txRow, 0, len(txs))
+	for i, tx := range txs {
+		def, err := newTxDef(tx)
 		if err != nil {
-			return errors.Wrapf(err, "failed to insert transaction: %+v, with txIndex: %d, and blockID: %d", tx.TxID, txIndex, blockID)
+			return nil, errors.Wrapf(err, "failed to insert tx: %s, with txIndex: %d, and blockID: %d", tx.TxID, i, blockID)
 		}
 
-		return nil
-	})
+		rows = append(rows, txRow{Index: i, Raw: tx.Hex, Tx: def})
+	}
+
+	txsBytes, err := json.Marshal(rows)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to marshal txs of blockID: %d", blockID)
+	}
+
+	return txsBytes, nil
 }
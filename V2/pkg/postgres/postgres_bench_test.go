@@ -3,11 +3,13 @@
 package postgres
 
 import (
+	"context"
 	"log"
 	"os"
 	"testing"
 
 	"github.com/shapeshift-legacy/coinquery/V2/config"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/storage"
 )
 
 var db *Database
@@ -36,7 +38,7 @@ func connectDB() (*Database, error) {
 
 func BenchmarkLastBlock(b *testing.B) {
 	for i := 0; i < b.N; i++ {
-		db.LastBlock()
+		db.LastBlock(context.Background())
 	}
 }
 
@@ -69,7 +71,7 @@ func BenchmarkGetBlock(b *testing.B) {
 	for _, bt := range benchmarks {
 		b.Run(bt.name, func(b *testing.B) {
 			for i := 0; i < b.N; i++ {
-				db.GetBlock(bt.blockHash)
+				db.GetBlock(context.Background(), bt.blockHash)
 			}
 		})
 	}
@@ -104,7 +106,7 @@ func BenchmarkGetTxHashesByBlockHash(b *testing.B) {
 	for _, bt := range benchmarks {
 		b.Run(bt.name, func(b *testing.B) {
 			for i := 0; i < b.N; i++ {
-				db.GetTxHashesByBlockHash(bt.blockHash, "", "")
+				db.GetTxHashesByBlockHash(context.Background(), bt.blockHash, storage.Page{})
 			}
 		})
 	}
@@ -139,7 +141,7 @@ func BenchmarkGetTotalTxsByBlockHash(b *testing.B) {
 	for _, bt := range benchmarks {
 		b.Run(bt.name, func(b *testing.B) {
 			for i := 0; i < b.N; i++ {
-				db.GetTotalTxsByBlockHash(bt.blockHash)
+				db.GetTotalTxsByBlockHash(context.Background(), bt.blockHash)
 			}
 		})
 	}
@@ -170,7 +172,7 @@ func BenchmarkGetSpentTxDetails(b *testing.B) {
 	for _, bt := range benchmarks {
 		b.Run(bt.name, func(b *testing.B) {
 			for i := 0; i < b.N; i++ {
-				db.GetSpentTxDetails("bfeee296ede999d0eb04618f19b45393be476fb2660dbbc11d9aaf9aa94f13d2", 1)
+				db.GetSpentTxDetails(context.Background(), "bfeee296ede999d0eb04618f19b45393be476fb2660dbbc11d9aaf9aa94f13d2", 1)
 			}
 		})
 	}
@@ -193,7 +195,7 @@ func BenchmarkGetUtxosByAddrs(b *testing.B) {
 	for _, bt := range benchmarks {
 		b.Run(bt.name, func(b *testing.B) {
 			for i := 0; i < b.N; i++ {
-				db.GetUtxosByAddrs([]string{bt.addrs})
+				db.GetUtxosByAddrs(context.Background(), []string{bt.addrs})
 			}
 		})
 	}
@@ -216,7 +218,7 @@ func BenchmarkGetOutputsByTxID(b *testing.B) {
 	for _, bt := range benchmarks {
 		b.Run(bt.name, func(b *testing.B) {
 			for i := 0; i < b.N; i++ {
-				db.GetOutputsByTxID(bt.txid, "")
+				db.GetOutputsByTxID(context.Background(), bt.txid, storage.OutputFilter{})
 			}
 		})
 	}
@@ -239,7 +241,7 @@ func BenchmarkGetTxIDsByAddresses(b *testing.B) {
 	for _, bt := range benchmarks {
 		b.Run(bt.name, func(b *testing.B) {
 			for i := 0; i < b.N; i++ {
-				db.GetTxIDsByAddresses([]string{bt.addrs}, "", "", "")
+				db.GetTxIDsByAddresses(context.Background(), []string{bt.addrs}, storage.TxFilter{})
 			}
 		})
 	}
@@ -262,7 +264,7 @@ func BenchmarkGetTotalTxsByAddresses(b *testing.B) {
 	for _, bt := range benchmarks {
 		b.Run(bt.name, func(b *testing.B) {
 			for i := 0; i < b.N; i++ {
-				db.GetTotalTxsByAddresses([]string{bt.addrs})
+				db.GetTotalTxsByAddresses(context.Background(), []string{bt.addrs})
 			}
 		})
 	}
@@ -293,7 +295,7 @@ func BenchmarkGetTxByTxID(b *testing.B) {
 	for _, bt := range benchmarks {
 		b.Run(bt.name, func(b *testing.B) {
 			for i := 0; i < b.N; i++ {
-				db.GetTxByTxID(bt.txid)
+				db.GetTxByTxID(context.Background(), bt.txid)
 			}
 		})
 	}
@@ -312,7 +314,7 @@ func BenchmarkGetRawTxByTxID(b *testing.B) {
 	for _, bt := range benchmarks {
 		b.Run(bt.name, func(b *testing.B) {
 			for i := 0; i < b.N; i++ {
-				db.GetRawTxByTxID(bt.txid)
+				db.GetRawTxByTxID(context.Background(), bt.txid)
 			}
 		})
 	}
@@ -335,7 +337,7 @@ func BenchmarkGetInputsByTxID(b *testing.B) {
 	for _, bt := range benchmarks {
 		b.Run(bt.name, func(b *testing.B) {
 			for i := 0; i < b.N; i++ {
-				db.GetInputsByTxID(bt.txid)
+				db.GetInputsByTxID(context.Background(), bt.txid)
 			}
 		})
 	}
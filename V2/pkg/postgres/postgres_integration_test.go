@@ -3,6 +3,7 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -17,6 +18,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/shapeshift-legacy/coinquery/V2/config"
 	"github.com/shapeshift-legacy/coinquery/V2/pkg/blockchain/utxo"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/storage"
 )
 
 var db *Database
@@ -25,6 +27,7 @@ func cleanDatabase() error {
 	db.timeout = 3 * time.Second
 
 	_, err := db.Exec(`
+		DELETE FROM btc.address_transaction;
 		DELETE FROM btc.output;
 		DELETE FROM btc.input;
 		DELETE FROM btc.transaction;
@@ -70,7 +73,7 @@ func TestDatabase_LastBlock(t *testing.T) {
 	cleanDatabase()
 
 	// It should return a nil error and nil block
-	b, err := db.LastBlock()
+	b, err := db.LastBlock(context.Background())
 	if err != nil {
 		t.Errorf("LastBlock() = %v, want %v", err, nil)
 	}
@@ -90,7 +93,7 @@ func TestDatabase_LastBlock(t *testing.T) {
 		t.Fatalf("InsertBlock() = %v, want %v", err, nil)
 	}
 
-	b, err = db.LastBlock()
+	b, err = db.LastBlock(context.Background())
 	if err != nil {
 		t.Fatalf("LastBlock() = %v, want %v", err, nil)
 	}
@@ -113,7 +116,7 @@ func TestDatabase_LastBlock(t *testing.T) {
 		}
 	}
 
-	b, err = db.LastBlock()
+	b, err = db.LastBlock(context.Background())
 	if err != nil {
 		t.Fatalf("LastBlock() = %v, want %v", err, nil)
 	}
@@ -148,7 +151,7 @@ func TestDatabase_GetBlock(t *testing.T) {
 
 	// Test without any data in the database
 	// It should return a sql.ErrNoRows
-	_, err := db.GetBlock(0)
+	_, err := db.GetBlock(context.Background(), 0)
 	if errors.Cause(err) != sql.ErrNoRows {
 		t.Errorf("GetBlock() = %v, want %v", err, sql.ErrNoRows)
 	}
@@ -165,7 +168,7 @@ func TestDatabase_GetBlock(t *testing.T) {
 	}
 
 	// Test with 1 block inserted
-	b, err := db.GetBlock(0)
+	b, err := db.GetBlock(context.Background(), 0)
 	if err != nil {
 		t.Fatalf("GetBlock(%v) = %v, want %v", 0, err, nil)
 	}
@@ -188,7 +191,7 @@ func TestDatabase_GetBlock(t *testing.T) {
 		}
 	}
 
-	b, err = db.GetBlock(3)
+	b, err = db.GetBlock(context.Background(), 3)
 	if err != nil {
 		t.Fatalf("GetBlock(%v) = %v, want %v", 3, err, nil)
 	}
@@ -198,7 +201,7 @@ func TestDatabase_GetBlock(t *testing.T) {
 	}
 
 	// Test using block hash
-	b, err = db.GetBlock("Hash2")
+	b, err = db.GetBlock(context.Background(), "Hash2")
 	if err != nil {
 		t.Fatalf("GetBlock(%v) = %v, want %v", "Hash2", err, nil)
 	}
@@ -212,7 +215,7 @@ func TestDatabase_GetUtxosByAddrs(t *testing.T) {
 	cleanDatabase()
 
 	// Test with nothing in DB
-	outputs, err := db.GetUtxosByAddrs([]string{"nothing in here"})
+	outputs, err := db.GetUtxosByAddrs(context.Background(), []string{"nothing in here"})
 	if err != nil {
 		t.Errorf("GetUtxosByAddrs() = %v, want %v", err, nil)
 	}
@@ -229,13 +232,13 @@ func TestDatabase_GetUtxosByAddrs(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	err = db.InsertTx(&blk.Txs[0], 0, id)
+	err = db.InsertTxs(id, []*utxo.Tx{&blk.Txs[0]})
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	addr := "1EYTGtG4LnFfiMvjJdsU7GMGCQvsRSjYhx"
-	outputs, err = db.GetUtxosByAddrs([]string{addr})
+	outputs, err = db.GetUtxosByAddrs(context.Background(), []string{addr})
 	if err != nil {
 		t.Errorf("GetUtxosByAddrs(%v) = %v, want %v", addr, err, nil)
 	}
@@ -250,7 +253,7 @@ func TestDatabase_GetUtxosByAddrs(t *testing.T) {
 	addr1 := "1EYTGtG4LnFfiMvjJdsU7GMGCQvsRSjYhx"
 	addr2 := "1JqDybm2nWTENrHvMyafbSXXtTk5Uv5QAn"
 
-	outputs, err = db.GetUtxosByAddrs([]string{addr1, addr2})
+	outputs, err = db.GetUtxosByAddrs(context.Background(), []string{addr1, addr2})
 	if err != nil {
 		t.Errorf("GetUtxosByAddrs(%v) = %v, want %v", addr, err, nil)
 	}
@@ -276,13 +279,13 @@ func TestDatabase_GetUtxosByAddrs(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	err = db.InsertTx(&blk.Txs[0], 0, id)
+	err = db.InsertTxs(id, []*utxo.Tx{&blk.Txs[0]})
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	addr = "1EYTGtG4LnFfiMvjJdsU7GMGCQvsRSjYhx"
-	outputs, err = db.GetUtxosByAddrs([]string{addr})
+	outputs, err = db.GetUtxosByAddrs(context.Background(), []string{addr})
 	if err != nil {
 		t.Errorf("GetUtxosByAddrs(%v) = %v, want %v", addr, err, nil)
 	}
@@ -292,11 +295,273 @@ func TestDatabase_GetUtxosByAddrs(t *testing.T) {
 	}
 }
 
+func TestDatabase_SpentOutputs(t *testing.T) {
+	cleanDatabase()
+
+	parent := getBlockFromJSON("./testdata/blk_100000_tx_fff252.json", t)
+	child := getBlockFromJSON("./testdata/blk_100002_tx_220ebc.json", t)
+	addr := "1EYTGtG4LnFfiMvjJdsU7GMGCQvsRSjYhx"
+
+	// The spending tx arrives in the mempool before the tx it spends
+	if err := db.InsertTxs(-1, []*utxo.Tx{&child.Txs[0]}); err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := db.InsertBlock(parent, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.InsertTxs(id, []*utxo.Tx{&parent.Txs[0]}); err != nil {
+		t.Fatal(err)
+	}
+
+	if utxos, err := db.GetUtxosByAddrs(context.Background(), []string{addr}); err != nil || len(utxos) != 0 {
+		t.Errorf("GetUtxosByAddrs(%v) = %d utxos, %v, want 0 with the spender inserted first", addr, len(utxos), err)
+	}
+
+	spender, err := db.GetTxByTxID(context.Background(), child.Txs[0].TxID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vout := spender.Inputs[0].SpentVout
+	details := db.GetSpentTxDetails(context.Background(), parent.Txs[0].TxID, vout)
+	if details == nil || details.SpentTxID != spender.TxID || details.SpentHeight != -1 {
+		t.Errorf("GetSpentTxDetails(%v, %d) = %+v, want mempool tx %v", parent.Txs[0].TxID, vout, details, spender.TxID)
+	}
+
+	// Dropping the spender from the mempool unspends the output
+	if err := db.DeleteInvalidTxs([]int{spender.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	if utxos, err := db.GetUtxosByAddrs(context.Background(), []string{addr}); err != nil || len(utxos) != 1 {
+		t.Errorf("GetUtxosByAddrs(%v) = %d utxos, %v, want 1 after deleting the spender", addr, len(utxos), err)
+	}
+
+	if details := db.GetSpentTxDetails(context.Background(), parent.Txs[0].TxID, vout); details != nil {
+		t.Errorf("GetSpentTxDetails(%v, %d) = %+v, want nil", parent.Txs[0].TxID, vout, details)
+	}
+}
+
+// Blocks are written by concurrent workers, so a spend must be marked whichever of the spent and spending tx commits last
+func TestDatabase_InsertTxs_concurrent(t *testing.T) {
+	cleanDatabase()
+
+	parent := getBlockFromJSON("./testdata/blk_100000_tx_fff252.json", t)
+	child := getBlockFromJSON("./testdata/blk_100002_tx_220ebc.json", t)
+	addr := "1EYTGtG4LnFfiMvjJdsU7GMGCQvsRSjYhx"
+
+	parentID, err := db.InsertBlock(parent, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.InsertBlock(getBlockFromJSON("./testdata/blk_100001_no_txs.json", t), false); err != nil {
+		t.Fatal(err)
+	}
+
+	childID, err := db.InsertBlock(child, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the parent is inserted on a connection of its own in a transaction left open while the child is inserted
+	other, err := New(&config.DB{
+		URI:    "postgres://indexer@localhost:5432/indexer?sslmode=disable",
+		BaseDB: config.BaseDB{MaxConns: 1},
+	}, "btc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	txsBytes, err := marshalTxs(parentID, []*utxo.Tx{&parent.Txs[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := other.BeginTx(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := tx.Exec(`SELECT btc.transactions_insert($1, $2)`, parentID, txsBytes); err != nil {
+		tx.Rollback()
+		t.Fatal(err)
+	}
+
+	// neither insert sees the other, so the spend is left for the pass run once the parent commits
+	if err := db.InsertTxs(childID, []*utxo.Tx{&child.Txs[0]}); err != nil {
+		tx.Rollback()
+		t.Fatal(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := other.markSpends([]*utxo.Tx{&parent.Txs[0]}); err != nil {
+		t.Fatal(err)
+	}
+
+	if utxos, err := db.GetUtxosByAddrs(context.Background(), []string{addr}); err != nil || len(utxos) != 0 {
+		t.Errorf("GetUtxosByAddrs(%v) = %d utxos, %v, want 0 with the spend inserted concurrently", addr, len(utxos), err)
+	}
+
+	var unspent int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM btc.output JOIN btc.transaction ON transaction.id = output.transaction_id WHERE txid = $1 AND address = $2 AND spending_transaction_id IS NULL`, parent.Txs[0].TxID, addr).Scan(&unspent); err != nil || unspent != 0 {
+		t.Errorf("unspent outputs of %v = %d, %v, want the spend marked", addr, unspent, err)
+	}
+
+	if summary, err := db.GetAddressSummary(context.Background(), addr); err != nil || summary.Sent == 0 {
+		t.Errorf("GetAddressSummary(%v) = %+v, %v, want the concurrent spend indexed as sent", addr, summary, err)
+	}
+}
+
+func TestDatabase_GetTxsByTxIDs(t *testing.T) {
+	cleanDatabase()
+
+	parent := getBlockFromJSON("./testdata/blk_100000_tx_fff252.json", t)
+	child := getBlockFromJSON("./testdata/blk_100002_tx_220ebc.json", t)
+
+	id, err := db.InsertBlock(parent, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.InsertTxs(id, []*utxo.Tx{&parent.Txs[0]}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.InsertTxs(-1, []*utxo.Tx{&child.Txs[0]}); err != nil {
+		t.Fatal(err)
+	}
+
+	txids := []string{child.Txs[0].TxID, parent.Txs[0].TxID}
+
+	txs, err := db.GetTxsByTxIDs(context.Background(), txids)
+	if err != nil || len(txs) != 2 || txs[0].TxID != txids[0] || txs[1].TxID != txids[1] {
+		t.Fatalf("GetTxsByTxIDs(%v) = %v, %v, want both in order", txids, txs, err)
+	}
+
+	spender, spent := txs[0], txs[1]
+
+	if len(spender.Inputs) != len(child.Txs[0].Vins) || len(spender.PrevOuts) != len(spender.Inputs) || len(spender.Spends) != len(spender.Outputs) {
+		t.Errorf("GetTxsByTxIDs(%v) = %+v, want a prevout per input and a spend per output", txids, spender)
+	}
+
+	for i, in := range spender.Inputs {
+		prevout := spender.PrevOuts[i]
+		if in.SpentTx == spent.TxID && (prevout == nil || prevout.SatAmount != spent.Outputs[in.SpentVout].SatAmount) {
+			t.Errorf("GetTxsByTxIDs(%v) input %d prevout = %+v, want output %d of %v", txids, i, prevout, in.SpentVout, spent.TxID)
+		}
+
+		if in.SpentTx == spent.TxID && (spent.Spends[in.SpentVout] == nil || spent.Spends[in.SpentVout].SpentTxID != spender.TxID) {
+			t.Errorf("GetTxsByTxIDs(%v) spend of output %d = %+v, want %v", txids, in.SpentVout, spent.Spends[in.SpentVout], spender.TxID)
+		}
+	}
+
+	if _, err := db.GetTxsByTxIDs(context.Background(), []string{"nothing in here"}); errors.Cause(err) != sql.ErrNoRows {
+		t.Errorf("GetTxsByTxIDs() = %v, want %v", err, sql.ErrNoRows)
+	}
+}
+
+func TestDatabase_GetAddressSummary(t *testing.T) {
+	cleanDatabase()
+
+	parent := getBlockFromJSON("./testdata/blk_100000_tx_fff252.json", t)
+	child := getBlockFromJSON("./testdata/blk_100002_tx_220ebc.json", t)
+
+	id, err := db.InsertBlock(parent, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.InsertTxs(id, []*utxo.Tx{&parent.Txs[0]}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the mempool child spends output 1 of the parent and pays its own address
+	if err := db.InsertTxs(-1, []*utxo.Tx{&child.Txs[0]}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []storage.AddressSummary{
+		{Address: "1EYTGtG4LnFfiMvjJdsU7GMGCQvsRSjYhx", Received: 4444000000, UnconfirmedSent: 4444000000, Txs: 1, UnconfirmedTxs: 1},
+		{Address: "145crWADs13RVdAQFz1PHxV8FuifFtPBGi", UnconfirmedReceived: 8888000000, UnconfirmedTxs: 1},
+		{Address: "1JqDybm2nWTENrHvMyafbSXXtTk5Uv5QAn", Received: 556000000, Txs: 1},
+		{Address: "nothing in here"},
+	}
+
+	for _, want := range tests {
+		got, err := db.GetAddressSummary(context.Background(), want.Address)
+		if err != nil || *got != want {
+			t.Errorf("GetAddressSummary(%s) = %+v, %v, want %+v", want.Address, got, err, want)
+		}
+	}
+
+	// the spend of output 1 by the child is both received and sent, and the child is counted once
+	addrs := []string{tests[0].Address, tests[1].Address}
+	want := storage.AddressSummary{Received: 4444000000, UnconfirmedReceived: 8888000000, UnconfirmedSent: 4444000000, Txs: 1, UnconfirmedTxs: 1}
+
+	got, err := db.GetAddressesSummary(context.Background(), addrs)
+	if err != nil || *got != want {
+		t.Errorf("GetAddressesSummary(%v) = %+v, %v, want %+v", addrs, got, err, want)
+	}
+
+	used, err := db.GetUsedAddresses(context.Background(), []string{tests[2].Address, tests[3].Address})
+	if err != nil || len(used) != 1 || used[0] != tests[2].Address {
+		t.Errorf("GetUsedAddresses() = %v, %v, want %s", used, err, tests[2].Address)
+	}
+}
+
+// A mempool tx can be stored before the tx it spends, its sent row is written once the spent tx is
+func TestDatabase_GetAddressSummary_childFirst(t *testing.T) {
+	cleanDatabase()
+
+	parent := getBlockFromJSON("./testdata/blk_100000_tx_fff252.json", t)
+	child := getBlockFromJSON("./testdata/blk_100002_tx_220ebc.json", t)
+	addr := "1EYTGtG4LnFfiMvjJdsU7GMGCQvsRSjYhx"
+
+	if err := db.InsertTxs(-1, []*utxo.Tx{&child.Txs[0]}); err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := db.InsertBlock(parent, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.InsertTxs(id, []*utxo.Tx{&parent.Txs[0]}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := storage.AddressSummary{Address: addr, Received: 4444000000, UnconfirmedSent: 4444000000, Txs: 1, UnconfirmedTxs: 1}
+
+	got, err := db.GetAddressSummary(context.Background(), addr)
+	if err != nil || *got != want {
+		t.Errorf("GetAddressSummary(%s) = %+v, %v, want %+v", addr, got, err, want)
+	}
+
+	// the mempool child is listed ahead of the mined parent
+	txids, err := db.GetTxIDsByAddresses(context.Background(), []string{addr}, storage.TxFilter{})
+	if err != nil || len(txids) != 2 || txids[0] != child.Txs[0].TxID || txids[1] != parent.Txs[0].TxID {
+		t.Errorf("GetTxIDsByAddresses(%s) = %v, %v, want %s then %s", addr, txids, err, child.Txs[0].TxID, parent.Txs[0].TxID)
+	}
+
+	var direction int
+	if err := db.QueryRow(`SELECT direction FROM btc.address_transaction JOIN btc.transaction ON transaction.id = transaction_id WHERE address = $1 AND txid = $2`, addr, child.Txs[0].TxID).Scan(&direction); err != nil || direction != 2 {
+		t.Errorf("direction of %s for the child = %d, %v, want 2", addr, direction, err)
+	}
+}
+
 func TestDatabase_GetOutputsByTxID(t *testing.T) {
 	cleanDatabase()
 
 	// Test without anything in DB
-	outputs, err := db.GetOutputsByTxID("nothing in here", "")
+	outputs, err := db.GetOutputsByTxID(context.Background(), "nothing in here", storage.OutputFilter{})
 	if err != nil {
 		t.Errorf("GetOutputsByTxID() = %v, want %v", err, nil)
 	}
@@ -312,13 +577,13 @@ func TestDatabase_GetOutputsByTxID(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	err = db.InsertTx(&blk.Txs[0], 0, id)
+	err = db.InsertTxs(id, []*utxo.Tx{&blk.Txs[0]})
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	txid := "fff2525b8931402dd09222c50775608f75787bd2b87e56995a7bdd30f79702c4"
-	outputs, err = db.GetOutputsByTxID(txid, "")
+	outputs, err = db.GetOutputsByTxID(context.Background(), txid, storage.OutputFilter{})
 	if err != nil {
 		t.Errorf("GetOutputsByTxID(%v) = %v, want %v", txid, err, nil)
 	}
@@ -332,7 +597,7 @@ func TestDatabase_GetTxIDsByAddresses(t *testing.T) {
 	cleanDatabase()
 
 	// Test with nothing in DB
-	outputs, err := db.GetTxIDsByAddresses([]string{"nothing in here"}, "", "", "")
+	outputs, err := db.GetTxIDsByAddresses(context.Background(), []string{"nothing in here"}, storage.TxFilter{})
 	if err != nil {
 		t.Errorf("GetTxIDsByAddresses() = %v, want %v", err, nil)
 	}
@@ -349,13 +614,13 @@ func TestDatabase_GetTxIDsByAddresses(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	err = db.InsertTx(&blk.Txs[0], 0, id)
+	err = db.InsertTxs(id, []*utxo.Tx{&blk.Txs[0]})
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	addr1 := "1EYTGtG4LnFfiMvjJdsU7GMGCQvsRSjYhx"
-	txs, err := db.GetTxIDsByAddresses([]string{addr1}, "", "", "")
+	txs, err := db.GetTxIDsByAddresses(context.Background(), []string{addr1}, storage.TxFilter{})
 	if err != nil {
 		t.Errorf("GetTxIDsByAddresses(%v) = %v, want %v", addr1, err, nil)
 	}
@@ -378,13 +643,13 @@ func TestDatabase_GetTxIDsByAddresses(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	err = db.InsertTx(&blk.Txs[0], 0, id)
+	err = db.InsertTxs(id, []*utxo.Tx{&blk.Txs[0]})
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	addr2 := "145crWADs13RVdAQFz1PHxV8FuifFtPBGi"
-	txs, err = db.GetTxIDsByAddresses([]string{addr1, addr2}, "", "", "")
+	txs, err = db.GetTxIDsByAddresses(context.Background(), []string{addr1, addr2}, storage.TxFilter{})
 	if err != nil {
 		t.Errorf("GetTxIDsByAddresses(%v, %v) = %v, want %v", addr1, addr2, err, nil)
 	}
@@ -392,13 +657,101 @@ func TestDatabase_GetTxIDsByAddresses(t *testing.T) {
 	if len(txs) != 2 {
 		t.Errorf("GetTxIDsByAddresses(%v, %v) = %v, want %v", addr1, addr2, len(txs), 1)
 	}
+
+	// Page by cursor from the newest tx to the oldest and back
+	newest, err := db.GetTxByTxID(context.Background(), txs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cursor, err := storage.ParseCursor(newest.Cursor)
+	if err != nil || cursor.Height != 100002 {
+		t.Fatalf("ParseCursor(%v) = %v, %v, want height 100002", newest.Cursor, cursor, err)
+	}
+
+	older, err := db.GetTxIDsByAddresses(context.Background(), []string{addr1, addr2}, storage.TxFilter{Page: storage.Page{Limit: 1}, Before: cursor})
+	if err != nil || len(older) != 1 || older[0] != txs[1] {
+		t.Errorf("GetTxIDsByAddresses() before %v = %v, %v, want %v", cursor, older, err, txs[1])
+	}
+
+	oldest, err := db.GetTxByTxID(context.Background(), txs[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cursor, err = storage.ParseCursor(oldest.Cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newer, err := db.GetTxIDsByAddresses(context.Background(), []string{addr1, addr2}, storage.TxFilter{Page: storage.Page{Limit: 1}, After: cursor})
+	if err != nil || len(newer) != 1 || newer[0] != txs[0] {
+		t.Errorf("GetTxIDsByAddresses() after %v = %v, %v, want %v", cursor, newer, err, txs[0])
+	}
+}
+
+func TestDatabase_IndexAddresses(t *testing.T) {
+	cleanDatabase()
+
+	blk := getBlockFromJSON("./testdata/blk_100000_tx_fff252.json", t)
+
+	id, err := db.InsertBlock(blk, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.InsertTxs(id, []*utxo.Tx{&blk.Txs[0]}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Transactions written before address_transaction existed have no rows
+	if _, err := db.Exec(`DELETE FROM btc.address_transaction;`); err != nil {
+		t.Fatal(err)
+	}
+
+	addr := "1EYTGtG4LnFfiMvjJdsU7GMGCQvsRSjYhx"
+	if count, err := db.GetTotalTxsByAddresses(context.Background(), []string{addr}); err != nil || count != 0 {
+		t.Fatalf("GetTotalTxsByAddresses(%v) = %v, %v, want %v, %v", addr, count, err, 0, nil)
+	}
+
+	maxID, err := db.MaxTxID(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Indexing the same range twice writes the same rows
+	for i := 0; i < 2; i++ {
+		if n, err := db.IndexAddresses(0, maxID); err != nil || n == 0 {
+			t.Fatalf("IndexAddresses(0, %d) = %v, %v, want rows", maxID, n, err)
+		}
+	}
+
+	if count, err := db.GetTotalTxsByAddresses(context.Background(), []string{addr}); err != nil || count != 1 {
+		t.Errorf("GetTotalTxsByAddresses(%v) = %v, %v, want %v, %v", addr, count, err, 1, nil)
+	}
+
+	heights := &storage.HeightRange{From: blk.Height, To: blk.Height}
+	txs, err := db.GetTxIDsByAddresses(context.Background(), []string{addr}, storage.TxFilter{Heights: heights})
+	if err != nil || len(txs) != 1 {
+		t.Errorf("GetTxIDsByAddresses(%v) at height %d = %v, %v, want 1 tx", addr, blk.Height, txs, err)
+	}
+
+	// Orphaning the block moves its transactions back to the mempool
+	if _, err := db.OrphanBlocks(blk.Height); err != nil {
+		t.Fatal(err)
+	}
+
+	txs, err = db.GetTxIDsByAddresses(context.Background(), []string{addr}, storage.TxFilter{Mempool: true})
+	if err != nil || len(txs) != 1 {
+		t.Errorf("GetTxIDsByAddresses(%v) in mempool = %v, %v, want 1 tx", addr, txs, err)
+	}
 }
 
 func TestDatabase_GetTxByTxID(t *testing.T) {
 	cleanDatabase()
 
 	// Test with nothing in DB
-	tx, err := db.GetTxByTxID("nothing in here")
+	tx, err := db.GetTxByTxID(context.Background(), "nothing in here")
 	if errors.Cause(err) != sql.ErrNoRows {
 		t.Errorf("GetTXByTXID() = %v, want %v", err, sql.ErrNoRows)
 	}
@@ -411,13 +764,13 @@ func TestDatabase_GetTxByTxID(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	err = db.InsertTx(&blk.Txs[0], 0, id)
+	err = db.InsertTxs(id, []*utxo.Tx{&blk.Txs[0]})
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	txid := "fff2525b8931402dd09222c50775608f75787bd2b87e56995a7bdd30f79702c4"
-	tx, err = db.GetTxByTxID(txid)
+	tx, err = db.GetTxByTxID(context.Background(), txid)
 	if err != nil {
 		t.Errorf("GetTxByTxID(%v) = %v, want %v", txid, err, nil)
 	}
@@ -431,7 +784,7 @@ func TestDatabase_GetRawTxByTxID(t *testing.T) {
 	cleanDatabase()
 
 	// Test with nothing in DB
-	_, err := db.GetRawTxByTxID("nothing in here")
+	_, err := db.GetRawTxByTxID(context.Background(), "nothing in here")
 	if errors.Cause(err) != sql.ErrNoRows {
 		t.Errorf("GetRawTxByTxID() = %v, want %v", err, sql.ErrNoRows)
 	}
@@ -443,14 +796,14 @@ func TestDatabase_GetRawTxByTxID(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	err = db.InsertTx(&blk.Txs[0], 0, id)
+	err = db.InsertTxs(id, []*utxo.Tx{&blk.Txs[0]})
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	txid := "fff2525b8931402dd09222c50775608f75787bd2b87e56995a7bdd30f79702c4"
 	hex := "0100000001032e38e9c0a84c6046d687d10556dcacc41d275ec55fc00779ac88fdf357a187000000008c493046022100c352d3dd993a981beba4a63ad15c209275ca9470abfcd57da93b58e4eb5dce82022100840792bc1f456062819f15d33ee7055cf7b5ee1af1ebcc6028d9cdb1c3af7748014104f46db5e9d61a9dc27b8d64ad23e7383a4e6ca164593c2527c038c0857eb67ee8e825dca65046b82c9331586c82e0fd1f633f25f87c161bc6f8a630121df2b3d3ffffffff0200e32321000000001976a914c398efa9c392ba6013c5e04ee729755ef7f58b3288ac000fe208010000001976a914948c765a6914d43f2a7ac177da2c2f6b52de3d7c88ac00000000"
-	rawTx, err := db.GetRawTxByTxID(txid)
+	rawTx, err := db.GetRawTxByTxID(context.Background(), txid)
 	if err != nil {
 		t.Errorf("GetRawTxByTxID(%v) = %v, want %v", txid, err, nil)
 	}
@@ -474,7 +827,7 @@ func validateBlocks(validate func(b *utxo.Block) bool, blocks []*utxo.Block) []*
 func loadBlocksByHash(t *testing.T, conn *Database, hashes ...string) []*utxo.Block {
 	blocks := make([]*utxo.Block, 0)
 	for _, n := range hashes {
-		b, err := conn.GetBlock(n)
+		b, err := conn.GetBlock(context.Background(), n)
 		if err != nil {
 			t.Fatalf("unable to fetch block %s from db", n)
 			continue
@@ -739,7 +1092,7 @@ func TestDatabase_GetInputsByTxID(t *testing.T) {
 	cleanDatabase()
 
 	// Test with nothing in DB
-	inputs, err := db.GetInputsByTxID("nothing in here")
+	inputs, err := db.GetInputsByTxID(context.Background(), "nothing in here")
 	if err != nil {
 		t.Errorf("GetInputsByTxID() = %v, want %v", err, nil)
 	}
@@ -756,13 +1109,13 @@ func TestDatabase_GetInputsByTxID(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	err = db.InsertTx(&blk.Txs[0], 0, id)
+	err = db.InsertTxs(id, []*utxo.Tx{&blk.Txs[0]})
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	txid := "220ebc64e21abece964927322cba69180ed853bb187fbc6923bac7d010b9d87a"
-	inputs, err = db.GetInputsByTxID(txid)
+	inputs, err = db.GetInputsByTxID(context.Background(), txid)
 	if err != nil {
 		t.Errorf("GetInputsByTxID(%v) = %v, want %v", txid, err, nil)
 	}
@@ -771,3 +1124,190 @@ func TestDatabase_GetInputsByTxID(t *testing.T) {
 		t.Errorf("GetInputsByTxID(%v) = %v, want %v", txid, len(inputs), 2)
 	}
 }
+
+func TestDatabase_InsertBlocksBulk(t *testing.T) {
+	cleanDatabase()
+
+	blk := getBlockFromJSON("./testdata/blk_100000_tx_fff252.json", t)
+
+	if err := db.DropIndexes(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.InsertBlocksBulk([]*utxo.Block{blk}); err != nil {
+		t.Fatalf("InsertBlocksBulk() = %v, want %v", err, nil)
+	}
+
+	if err := db.CreateIndexes(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := db.LastBlock(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b.Hash != blk.Hash {
+		t.Errorf("LastBlock() = %v, want %v", b.Hash, blk.Hash)
+	}
+
+	txid := "fff2525b8931402dd09222c50775608f75787bd2b87e56995a7bdd30f79702c4"
+	tx, err := db.GetTxByTxID(context.Background(), txid)
+	if err != nil {
+		t.Fatalf("GetTxByTxID(%v) = %v, want %v", txid, err, nil)
+	}
+
+	if len(tx.Inputs) != len(blk.Txs[0].Vins) || len(tx.Outputs) != len(blk.Txs[0].Vouts) {
+		t.Errorf("GetTxByTxID(%v) = %d inputs, %d outputs, want %d, %d", txid, len(tx.Inputs), len(tx.Outputs), len(blk.Txs[0].Vins), len(blk.Txs[0].Vouts))
+	}
+
+	// Inserting the same block again conflicts with the existing transactions
+	err = db.InsertBlocksBulk([]*utxo.Block{blk})
+	if errors.Cause(err) != ErrBulkConflict {
+		t.Errorf("InsertBlocksBulk() = %v, want %v", err, ErrBulkConflict)
+	}
+}
+
+func TestDatabase_InsertTxs(t *testing.T) {
+	cleanDatabase()
+
+	blk := getBlockFromJSON("./testdata/blk_100000_tx_fff252.json", t)
+	txid := "fff2525b8931402dd09222c50775608f75787bd2b87e56995a7bdd30f79702c4"
+
+	// Insert as a mempool transaction
+	if err := db.InsertTxs(-1, []*utxo.Tx{&blk.Txs[0]}); err != nil {
+		t.Fatalf("InsertTxs() = %v, want %v", err, nil)
+	}
+
+	tx, err := db.GetTxByTxID(context.Background(), txid)
+	if err != nil {
+		t.Fatalf("GetTxByTxID(%v) = %v, want %v", txid, err, nil)
+	}
+
+	if tx.BlockHeight != -1 {
+		t.Errorf("GetTxByTxID(%v) = block %v, want mempool", txid, tx.BlockHash)
+	}
+
+	// Inserting the mined block updates the existing transaction without duplicating inputs and outputs
+	id, err := db.InsertBlock(blk, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.InsertTxs(id, []*utxo.Tx{&blk.Txs[0]}); err != nil {
+		t.Fatalf("InsertTxs() = %v, want %v", err, nil)
+	}
+
+	tx, err = db.GetTxByTxID(context.Background(), txid)
+	if err != nil {
+		t.Fatalf("GetTxByTxID(%v) = %v, want %v", txid, err, nil)
+	}
+
+	if tx.BlockHash != blk.Hash {
+		t.Errorf("GetTxByTxID(%v) = block %v, want %v", txid, tx.BlockHash, blk.Hash)
+	}
+
+	if len(tx.Inputs) != len(blk.Txs[0].Vins) || len(tx.Outputs) != len(blk.Txs[0].Vouts) {
+		t.Errorf("GetTxByTxID(%v) = %d inputs, %d outputs, want %d, %d", txid, len(tx.Inputs), len(tx.Outputs), len(blk.Txs[0].Vins), len(blk.Txs[0].Vouts))
+	}
+}
+
+func TestDatabase_AcquireLock(t *testing.T) {
+	conf := &config.DB{
+		URI:    "postgres://indexer@localhost:5432/indexer?sslmode=disable",
+		BaseDB: config.BaseDB{MaxConns: 1},
+	}
+
+	leader, err := New(conf, "btc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	standby, err := New(conf, "btc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer standby.Close()
+
+	if err := leader.AcquireLock(context.Background(), 100*time.Millisecond); err != nil {
+		t.Fatalf("AcquireLock() = %v, want nil", err)
+	}
+
+	// leader writes with the lock connection held outside of the semaphore
+	if err := leader.Set("lockTest", "leader"); err != nil {
+		t.Errorf("Set() = %v, want nil", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	if err := standby.AcquireLock(ctx, 100*time.Millisecond); errors.Cause(err) != context.DeadlineExceeded {
+		t.Fatalf("AcquireLock() = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	if err := standby.Set("lockTest", "standby"); errors.Cause(err) != ErrNotLeader {
+		t.Errorf("Set() = %v, want %v", err, ErrNotLeader)
+	}
+
+	leader.Close()
+
+	ctx, cancel = context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := standby.AcquireLock(ctx, 100*time.Millisecond); err != nil {
+		t.Fatalf("AcquireLock() after leader closed = %v, want nil", err)
+	}
+
+	if err := standby.Set("lockTest", "standby"); err != nil {
+		t.Errorf("Set() = %v, want nil", err)
+	}
+}
+
+func TestDatabase_AcquireLock_stale(t *testing.T) {
+	conf := &config.DB{
+		URI:    "postgres://indexer@localhost:5432/indexer?sslmode=disable",
+		BaseDB: config.BaseDB{MaxConns: 1},
+	}
+
+	leader, err := New(conf, "btc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer leader.Close()
+
+	standby, err := New(conf, "btc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer standby.Close()
+
+	// the leader checks its session too rarely to notice it is gone before writing again
+	if err := leader.AcquireLock(context.Background(), time.Hour); err != nil {
+		t.Fatalf("AcquireLock() = %v, want nil", err)
+	}
+
+	if _, err := standby.DB.Exec(`SELECT pg_terminate_backend(pid) FROM pg_locks WHERE locktype = 'advisory' AND pid <> pg_backend_pid()`); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := standby.AcquireLock(ctx, 100*time.Millisecond); err != nil {
+		t.Fatalf("AcquireLock() after leader session ended = %v, want nil", err)
+	}
+
+	if err := leader.Set("lockTest", "stale"); errors.Cause(err) != ErrNotLeader {
+		t.Errorf("stale leader Set() = %v, want %v", err, ErrNotLeader)
+	}
+
+	select {
+	case <-leader.LockLost():
+	default:
+		t.Error("LockLost() of stale leader not closed after a refused write")
+	}
+
+	if err := standby.Set("lockTest", "standby"); err != nil {
+		t.Errorf("Set() = %v, want nil", err)
+	}
+}
@@ -0,0 +1,679 @@
+// +build unit
+
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shapeshift-legacy/coinquery/V2/internal/log"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/storage"
+)
+
+// injection is passed wherever a caller supplies a string, it must only ever reach the db as an argument
+const injection = "x'; DROP TABLE btc.block; --"
+
+// statement is a query run against a recorder along with its arguments
+type statement struct {
+	query string
+	args  []driver.Value
+}
+
+// recorder is a database/sql driver recording every query instead of running it. Queries return the next rows of
+// results while there are any, then rows, no rows by default, or fail with err.
+type recorder struct {
+	mu         sync.Mutex
+	statements []statement
+	results    [][][]driver.Value
+	rows       [][]driver.Value
+	err        error
+}
+
+func (r *recorder) Connect(ctx context.Context) (driver.Conn, error) { return &recorderConn{r}, nil }
+func (r *recorder) Driver() driver.Driver                            { return nil }
+
+// last returns the most recently recorded statement
+func (r *recorder) last(t *testing.T) statement {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.statements) == 0 {
+		t.Fatal("no query was run")
+	}
+
+	return r.statements[len(r.statements)-1]
+}
+
+type recorderConn struct{ r *recorder }
+
+func (c *recorderConn) Prepare(query string) (driver.Stmt, error) { return &recorderStmt{c.r, query}, nil }
+func (c *recorderConn) Close() error                              { return nil }
+func (c *recorderConn) Begin() (driver.Tx, error)                 { return nil, errors.New("not supported") }
+
+type recorderStmt struct {
+	r     *recorder
+	query string
+}
+
+func (s *recorderStmt) Close() error  { return nil }
+func (s *recorderStmt) NumInput() int { return -1 }
+
+func (s *recorderStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+
+func (s *recorderStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+
+	s.r.statements = append(s.r.statements, statement{s.query, args})
+
+	if s.r.err != nil {
+		return nil, s.r.err
+	}
+
+	if len(s.r.results) > 0 {
+		rows := s.r.results[0]
+		s.r.results = s.r.results[1:]
+
+		return &recorderRows{rows: rows}, nil
+	}
+
+	return &recorderRows{rows: s.r.rows}, nil
+}
+
+type recorderRows struct{ rows [][]driver.Value }
+
+func (r *recorderRows) Close() error { return nil }
+
+func (r *recorderRows) Columns() []string {
+	if len(r.rows) == 0 {
+		return nil
+	}
+
+	return make([]string, len(r.rows[0]))
+}
+
+func (r *recorderRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+
+	return nil
+}
+
+func newRecordingDatabase() (*Database, *recorder) {
+	r := &recorder{}
+
+	return &Database{
+		DB:     sql.OpenDB(r),
+		prefix: btc,
+		sem:    make(chan struct{}, 1),
+		logger: log.New("btc"),
+	}, r
+}
+
+var placeholder = regexp.MustCompile(`\$(\d+)`)
+
+// assertParameterized checks that the query of s refers to every argument by placeholder and that no argument value
+// was spliced into the query text
+func assertParameterized(t *testing.T, name string, s statement) {
+	t.Helper()
+
+	highest := 0
+	for _, m := range placeholder.FindAllStringSubmatch(s.query, -1) {
+		n, _ := strconv.Atoi(m[1])
+		if n > highest {
+			highest = n
+		}
+	}
+
+	if highest != len(s.args) {
+		t.Errorf("%s: highest placeholder $%d, want $%d for %d args", name, highest, len(s.args), len(s.args))
+	}
+
+	if strings.Contains(s.query, "DROP") {
+		t.Errorf("%s: caller input spliced into query:\n%s", name, s.query)
+	}
+
+	for _, arg := range s.args {
+		if str, ok := arg.(string); ok && len(str) > 1 && strings.Contains(s.query, str) {
+			t.Errorf("%s: argument %q spliced into query:\n%s", name, str, s.query)
+		}
+	}
+}
+
+// hasArg reports if one of args contains v
+func hasArg(args []driver.Value, v string) bool {
+	for _, arg := range args {
+		if strings.Contains(fmt.Sprint(arg), v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestDatabase_parameterized(t *testing.T) {
+	db, r := newRecordingDatabase()
+
+	since := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	filter := storage.TxFilter{
+		Page:    storage.Page{Limit: 10, Offset: 20},
+		Heights: &storage.HeightRange{From: 100, To: 200},
+		Since:   since,
+		Until:   since.Add(24 * time.Hour),
+		FromID:  5,
+	}
+
+	calls := []struct {
+		name string
+		call func() error
+		args int
+	}{
+		{"GetPendingTxs", func() error {
+			_, err := db.GetPendingTxs(context.Background(), storage.TxFilter{Page: filter.Page, FromID: filter.FromID})
+			return err
+		}, 3},
+		{"GetTxHashesByBlockHash", func() error {
+			_, err := db.GetTxHashesByBlockHash(context.Background(), injection, filter.Page)
+			return err
+		}, 3},
+		{"GetOutputsByTxID", func() error {
+			_, err := db.GetOutputsByTxID(context.Background(), injection, storage.OutputFilter{Vouts: []int{0, 7}})
+			return err
+		}, 2},
+		{"GetTxIDsByAddresses", func() error {
+			_, err := db.GetTxIDsByAddresses(context.Background(), []string{injection, "1EYTGtG4LnFfiMvjJdsU7GMGCQvsRSjYhx"}, filter)
+			return err
+		}, 8},
+		{"GetTxIDsByAddresses after", func() error {
+			_, err := db.GetTxIDsByAddresses(context.Background(), []string{injection}, storage.TxFilter{Page: storage.Page{Limit: 10}, After: &storage.Cursor{Height: 100, ID: 5}})
+			return err
+		}, 4},
+		{"GetUsedAddresses", func() error {
+			_, err := db.GetUsedAddresses(context.Background(), []string{injection, "1EYTGtG4LnFfiMvjJdsU7GMGCQvsRSjYhx"})
+			return err
+		}, 1},
+		{"GetTxIDsByAddresses mempool", func() error {
+			_, err := db.GetTxIDsByAddresses(context.Background(), []string{injection}, storage.TxFilter{Mempool: true})
+			return err
+		}, 1},
+	}
+
+	for _, c := range calls {
+		if err := c.call(); err != nil {
+			t.Errorf("%s() error = %v", c.name, err)
+			continue
+		}
+
+		s := r.last(t)
+		assertParameterized(t, c.name, s)
+
+		if len(s.args) != c.args {
+			t.Errorf("%s: %d args %v, want %d", c.name, len(s.args), s.args, c.args)
+		}
+
+		if c.name != "GetPendingTxs" && !hasArg(s.args, injection) {
+			t.Errorf("%s: caller input missing from args %v", c.name, s.args)
+		}
+	}
+}
+
+func TestDatabase_spendsIndexed(t *testing.T) {
+	db, r := newRecordingDatabase()
+
+	// until the spends backfill has run, spends are searched in input
+	if _, err := db.GetUtxosByAddrs(context.Background(), []string{"addr"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if s := r.last(t); !strings.Contains(s.query, "input.spent_txid") || len(r.statements) != 2 {
+		t.Errorf("GetUtxosByAddrs() before the backfill ran %d queries, last:\n%s\nwant a search of input", len(r.statements), s.query)
+	}
+
+	r.results = [][][]driver.Value{{{"true"}}}
+
+	for i := 0; i < 2; i++ {
+		if _, err := db.GetUtxosByAddrs(context.Background(), []string{"addr"}); err != nil {
+			t.Fatal(err)
+		}
+
+		if s := r.last(t); strings.Contains(s.query, "_SCHEMA_.input") || strings.Contains(s.query, "btc.input") {
+			t.Errorf("GetUtxosByAddrs() after the backfill searched input:\n%s", s.query)
+		}
+	}
+
+	// the key is only read until found
+	if len(r.statements) != 5 {
+		t.Errorf("GetUtxosByAddrs() ran %d queries, want 5", len(r.statements))
+	}
+}
+
+// Queries reading spends fall back to a search of input like GetUtxosByAddrs, their errors on the empty rows of the
+// recorder are ignored
+func TestDatabase_spendsIndexed_queries(t *testing.T) {
+	queries := []struct {
+		name  string
+		query func(db *Database)
+	}{
+		{"txOutputs", func(db *Database) { db.txOutputs(context.Background(), db.DB, []int{1}, map[int]*storage.TxDetails{}) }},
+		{"GetAddressesSummary", func(db *Database) { db.GetAddressesSummary(context.Background(), []string{"addr"}) }},
+	}
+
+	for _, q := range queries {
+		db, r := newRecordingDatabase()
+
+		q.query(db)
+		if s := r.last(t); !strings.Contains(s.query, "input.spent_txid") {
+			t.Errorf("%s() before the backfill:\n%s\nwant a search of input", q.name, s.query)
+		}
+
+		r.results = [][][]driver.Value{{{"true"}}}
+
+		q.query(db)
+		if s := r.last(t); strings.Contains(s.query, "btc.input") {
+			t.Errorf("%s() after the backfill searched input:\n%s", q.name, s.query)
+		}
+	}
+}
+
+// The query text may only depend on which options are set, never on their values
+func TestTxFilter_conditions(t *testing.T) {
+	since := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	filters := []struct {
+		name string
+		a, b storage.TxFilter
+		want string
+	}{
+		{
+			"zero",
+			storage.TxFilter{},
+			storage.TxFilter{},
+			"",
+		},
+		{
+			"heights",
+			storage.TxFilter{Heights: &storage.HeightRange{From: 1, To: 2}},
+			storage.TxFilter{Heights: &storage.HeightRange{From: 500000, To: 600000}},
+			"AND block.height BETWEEN $1 AND $2",
+		},
+		{
+			"time range",
+			storage.TxFilter{Since: since, Until: since.Add(time.Hour)},
+			storage.TxFilter{Since: since.Add(time.Minute), Until: since.Add(time.Hour * 48)},
+			"AND block.mined_time >= $1\nAND block.mined_time < $2",
+		},
+		{
+			"mempool from id",
+			storage.TxFilter{Mempool: true, FromID: 1},
+			storage.TxFilter{Mempool: true, FromID: 99999},
+			"AND transaction.id >= $1\nAND block.id IS NULL",
+		},
+	}
+
+	for _, f := range filters {
+		var argsA, argsB params
+		a, b := txFilterConditions(f.a, &argsA), txFilterConditions(f.b, &argsB)
+
+		if a != f.want || b != f.want {
+			t.Errorf("%s: txFilterConditions() = %q and %q, want %q", f.name, a, b, f.want)
+		}
+
+		if len(argsA) != len(argsB) {
+			t.Errorf("%s: %d and %d args, want the same number", f.name, len(argsA), len(argsB))
+		}
+	}
+
+	addresses := []struct {
+		filter storage.TxFilter
+		want   string
+	}{
+		{storage.TxFilter{FromID: 7, Mempool: true}, "AND address_transaction.transaction_id >= $1\nAND address_transaction.height IS NULL"},
+		{storage.TxFilter{Heights: &storage.HeightRange{From: 1, To: 2}}, "AND address_transaction.height BETWEEN $1 AND $2"},
+		{storage.TxFilter{Since: since}, "AND block.mined_time >= $1"},
+		{storage.TxFilter{Before: &storage.Cursor{Height: -1, ID: 3}}, "AND (COALESCE(address_transaction.height, 2147483647), address_transaction.transaction_id) < ($1, $2)"},
+		{storage.TxFilter{After: &storage.Cursor{Height: 100, ID: 3}}, "AND (COALESCE(address_transaction.height, 2147483647), address_transaction.transaction_id) > ($1, $2)"},
+	}
+
+	for _, a := range addresses {
+		var args params
+		if got := addressConditions(a.filter, &args); got != a.want {
+			t.Errorf("addressConditions() = %q, want %q", got, a.want)
+		}
+	}
+
+	var args params
+	if page := pageClause(storage.Page{Limit: 1, Offset: 2}, &args); page != "LIMIT $1 OFFSET $2" || len(args) != 2 {
+		t.Errorf("pageClause() = %q with args %v, want LIMIT $1 OFFSET $2", page, args)
+	}
+
+	args = nil
+	if vouts := outputConditions(storage.OutputFilter{Vouts: []int{3}}, &args); vouts != "AND output.vout = ANY($1)" || len(args) != 1 {
+		t.Errorf("outputConditions() = %q with args %v, want AND output.vout = ANY($1)", vouts, args)
+	}
+
+	// the nearest page to an after cursor is read oldest first
+	tip := storage.Cursor{Height: 100, ID: 9}
+	if addressOrder(storage.TxFilter{After: &tip}) != "ASC" || addressOrder(storage.TxFilter{Before: &tip}) != "DESC" {
+		t.Error("addressOrder() doesn't read towards the cursor")
+	}
+}
+
+// Invalid filters are rejected before querying
+func TestDatabase_invalidFilters(t *testing.T) {
+	since := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	invalid := []struct {
+		name   string
+		filter storage.TxFilter
+	}{
+		{"negative limit", storage.TxFilter{Page: storage.Page{Limit: -1}}},
+		{"negative offset", storage.TxFilter{Page: storage.Page{Offset: -1}}},
+		{"negative height", storage.TxFilter{Heights: &storage.HeightRange{From: -1, To: 10}}},
+		{"inverted heights", storage.TxFilter{Heights: &storage.HeightRange{From: 10, To: 9}}},
+		{"inverted time range", storage.TxFilter{Since: since, Until: since}},
+		{"mempool with heights", storage.TxFilter{Mempool: true, Heights: &storage.HeightRange{From: 0, To: 1}}},
+		{"mempool with since", storage.TxFilter{Mempool: true, Since: since}},
+		{"negative id", storage.TxFilter{FromID: -1}},
+		{"before and after", storage.TxFilter{Before: &storage.Cursor{Height: 1, ID: 2}, After: &storage.Cursor{Height: 1, ID: 1}}},
+		{"cursor with offset", storage.TxFilter{Page: storage.Page{Limit: 10, Offset: 10}, Before: &storage.Cursor{Height: 1, ID: 2}}},
+	}
+
+	db, r := newRecordingDatabase()
+
+	for _, f := range invalid {
+		if _, err := db.GetTxIDsByAddresses(context.Background(), []string{"addr"}, f.filter); errors.Cause(err) != storage.ErrInvalidFilter {
+			t.Errorf("%s: GetTxIDsByAddresses() = %v, want %v", f.name, err, storage.ErrInvalidFilter)
+		}
+	}
+
+	if _, err := db.GetPendingTxs(context.Background(), storage.TxFilter{Since: since}); errors.Cause(err) != storage.ErrInvalidFilter {
+		t.Errorf("GetPendingTxs() with a time range = %v, want %v", err, storage.ErrInvalidFilter)
+	}
+
+	if len(r.statements) != 0 {
+		t.Errorf("invalid filters ran %d queries, want 0", len(r.statements))
+	}
+}
+
+func TestDatabase_cancelled(t *testing.T) {
+	db, r := newRecordingDatabase()
+
+	// every connection token is taken
+	db.acquire()
+	defer db.release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	done := make(chan error)
+	go func() {
+		_, err := db.GetTxIDsByAddresses(ctx, []string{"addr"}, storage.TxFilter{})
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if errors.Cause(err) != context.DeadlineExceeded {
+			t.Errorf("GetTxIDsByAddresses() waiting for a token = %v, want %v", err, context.DeadlineExceeded)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("GetTxIDsByAddresses() kept waiting for a token after its context expired")
+	}
+
+	if len(r.statements) != 0 {
+		t.Errorf("GetTxIDsByAddresses() without a token ran %d queries, want 0", len(r.statements))
+	}
+
+	if len(db.sem) != 1 {
+		t.Errorf("%d tokens taken, want 1", len(db.sem))
+	}
+}
+
+// newReplicatedDatabase returns a recording database reading from a replica per recorder in replicas
+func newReplicatedDatabase(replicas ...*recorder) (*Database, *recorder) {
+	db, r := newRecordingDatabase()
+
+	db.replicas = &replicaPool{
+		prefix:   btc,
+		writer:   db.DB,
+		maxLag:   1,
+		interval: time.Second,
+		logger:   db.logger,
+	}
+
+	for i, r := range replicas {
+		db.replicas.replicas = append(db.replicas.replicas, &replica{name: fmt.Sprintf("replica-%d", i), db: sql.OpenDB(r)})
+	}
+
+	return db, r
+}
+
+// at returns a recorder at block height
+func at(height int) *recorder {
+	return &recorder{rows: [][]driver.Value{{int64(height)}}}
+}
+
+func TestDatabase_replicas(t *testing.T) {
+	synced, lagging, down := at(100), at(98), &recorder{err: errors.New("connection refused")}
+
+	db, primary := newReplicatedDatabase(synced, lagging, down)
+	primary.rows = [][]driver.Value{{int64(100)}}
+
+	ctx := context.Background()
+
+	// readers returns the distinct dbs read from over n reads
+	readers := func(n int) map[DB]bool {
+		dbs := map[DB]bool{}
+		for i := 0; i < n; i++ {
+			dbs[db.reader(ctx)] = true
+		}
+
+		return dbs
+	}
+
+	replica := func(i int) DB { return db.replicas.replicas[i].db }
+
+	db.replicas.check()
+	if dbs := readers(4); len(dbs) != 1 || !dbs[replica(0)] {
+		t.Errorf("read from %d dbs, want only the synced replica", len(dbs))
+	}
+
+	if db.reader(onPrimary(ctx)) != db.DB {
+		t.Error("reader() of a primary context isn't the primary")
+	}
+
+	// the replica is measured by its latest non orphaned block
+	if s := synced.last(t); !strings.Contains(s.query, "MAX(height)") || !strings.Contains(s.query, "is_orphaned = FALSE") {
+		t.Errorf("replica lag measured with %q, want the height of its latest non orphaned block", s.query)
+	}
+
+	// the lagging replica catches up within the lag
+	lagging.rows = [][]driver.Value{{int64(99)}}
+	db.replicas.check()
+	if dbs := readers(4); len(dbs) != 2 || !dbs[replica(0)] || !dbs[replica(1)] {
+		t.Errorf("read from %d dbs, want both replicas within the lag", len(dbs))
+	}
+
+	// without the writer height replicas are left as they are
+	primary.err = errors.New("connection refused")
+	synced.rows = [][]driver.Value{{int64(0)}}
+	db.replicas.check()
+	if dbs := readers(4); len(dbs) != 2 {
+		t.Errorf("read from %d dbs after a failed primary check, want 2", len(dbs))
+	}
+
+	// new blocks leave every replica behind
+	primary.err = nil
+	primary.rows = [][]driver.Value{{int64(102)}}
+	synced.rows = [][]driver.Value{{int64(100)}}
+	db.replicas.check()
+	if dbs := readers(4); len(dbs) != 1 || !dbs[db.DB] {
+		t.Errorf("read from %d dbs, want only the primary without healthy replicas", len(dbs))
+	}
+
+	if len(down.statements) != 3 {
+		t.Errorf("unreachable replica checked %d times, want 3", len(down.statements))
+	}
+}
+
+// A tx that was just broadcast may not have reached the replicas yet
+func TestDatabase_readYourWrites(t *testing.T) {
+	r := at(100)
+
+	db, primary := newReplicatedDatabase(r)
+	primary.rows = [][]driver.Value{{int64(100)}}
+	db.replicas.check()
+
+	r.rows = nil
+	primary.rows = [][]driver.Value{{"0100"}}
+
+	rawTx, err := db.GetRawTxByTxID(context.Background(), "txid")
+	if err != nil {
+		t.Fatalf("GetRawTxByTxID() error = %v", err)
+	}
+
+	if rawTx.Hex != "0100" {
+		t.Errorf("GetRawTxByTxID() = %q, want the primary's 0100", rawTx.Hex)
+	}
+
+	if !strings.Contains(r.last(t).query, "raw_transaction") {
+		t.Error("GetRawTxByTxID() didn't read from the replica first")
+	}
+
+	var hex string
+	ctx, err := db.scanRow(context.Background(), "SELECT raw_transaction", []interface{}{"txid"}, &hex)
+	if err != nil {
+		t.Fatalf("scanRow() error = %v", err)
+	}
+
+	if db.reader(ctx) != db.DB {
+		t.Error("reads after a row found on the primary only don't go to the primary")
+	}
+
+	// the inputs and outputs of txs found on the primary only are read from the primary as well
+	db.spends = 1
+	primary.statements = nil
+	primary.results = txDetailsResults
+
+	txs, err := db.GetTxsByTxIDs(context.Background(), []string{"a", "b"})
+	if err != nil || len(txs) != 2 {
+		t.Fatalf("GetTxsByTxIDs() = %v, %v, want the primary's a and b", txs, err)
+	}
+
+	if len(primary.statements) != 3 {
+		t.Errorf("GetTxsByTxIDs() ran %d queries on the primary, want 3", len(primary.statements))
+	}
+}
+
+// txDetailsResults are the rows of the transaction, input and output queries of GetTxsByTxIDs for a mined coinbase a
+// spent by mempool tx b
+var txDetailsResults = [][][]driver.Value{
+	{
+		{int64(1), "a", "a", int64(1), int64(100), int64(100), int64(400), int64(0), int64(10), "hash", "2019-01-01T00:00:00Z"},
+		{int64(2), "b", "b", int64(1), int64(100), int64(100), int64(400), int64(0), nil, nil, nil},
+	},
+	{
+		{int64(1), int64(0), "", int64(0), "", "", int64(0), nil, "04ff", nil, nil},
+		{int64(2), int64(0), "a", int64(0), "", "", int64(0), `["00", "01"]`, "", int64(5000), "1EYTGtG4LnFfiMvjJdsU7GMGCQvsRSjYhx"},
+	},
+	{
+		{int64(1), int64(0), "", "", "1EYTGtG4LnFfiMvjJdsU7GMGCQvsRSjYhx", int64(5000), "pubkeyhash", int64(1), "b", int64(0), nil},
+		{int64(2), int64(0), "", "", "1JqDybm2nWTENrHvMyafbSXXtTk5Uv5QAn", int64(4000), "pubkeyhash", int64(1), nil, nil, nil},
+	},
+}
+
+func TestDatabase_GetTxsByTxIDs(t *testing.T) {
+	db, r := newRecordingDatabase()
+	db.spends = 1 // backfilled, see TestDatabase_spendsIndexed_queries
+	r.results = txDetailsResults
+
+	_, err := db.GetTxsByTxIDs(context.Background(), []string{"b", "a", injection})
+	if errors.Cause(err) != sql.ErrNoRows {
+		t.Errorf("GetTxsByTxIDs() with a missing txid error = %v, want %v", err, sql.ErrNoRows)
+	}
+
+	r.statements = nil
+	r.results = txDetailsResults
+
+	txs, err := db.GetTxsByTxIDs(context.Background(), []string{"b", "a"})
+	if err != nil {
+		t.Fatalf("GetTxsByTxIDs() error = %v", err)
+	}
+
+	// one query each for the transactions, their inputs and their outputs
+	if len(r.statements) != 3 {
+		t.Errorf("GetTxsByTxIDs() ran %d queries, want 3", len(r.statements))
+	}
+
+	for _, s := range r.statements {
+		assertParameterized(t, "GetTxsByTxIDs", s)
+	}
+
+	if len(txs) != 2 || txs[0].TxID != "b" || txs[1].TxID != "a" {
+		t.Fatalf("GetTxsByTxIDs() = %+v, want b and a", txs)
+	}
+
+	b, a := txs[0], txs[1]
+
+	if !b.Mempool || b.PrevOuts[0] == nil || b.PrevOuts[0].SatAmount != 5000 || len(b.Inputs[0].TxInWitness) != 2 || b.Spends[0] != nil {
+		t.Errorf("GetTxsByTxIDs() = %+v, want b unspent in mempool spending 5000 sats", b)
+	}
+
+	want := &storage.SpentTxDetails{SpentTxID: "b", SpentIndex: 0, SpentHeight: -1}
+	if a.BlockHeight != 10 || a.PrevOuts[0] != nil || a.Inputs[0].Coinbase == "" || a.Spends[0] == nil || *a.Spends[0] != *want {
+		t.Errorf("GetTxsByTxIDs() = %+v, want coinbase a mined at 10 spent by b", a)
+	}
+
+	r.statements = nil
+	if txs, err := db.GetTxsByTxIDs(context.Background(), nil); err != nil || len(txs) != 0 || len(r.statements) != 0 {
+		t.Errorf("GetTxsByTxIDs() without txids = %v, %v after %d queries, want none", txs, err, len(r.statements))
+	}
+}
+
+func TestDatabase_GetAddressSummary(t *testing.T) {
+	db, r := newRecordingDatabase()
+	db.spends = 1
+	r.rows = [][]driver.Value{{int64(9000), int64(500), int64(4000), int64(1000), int64(3), int64(2)}}
+
+	summary, err := db.GetAddressSummary(context.Background(), injection)
+	if err != nil {
+		t.Fatalf("GetAddressSummary() error = %v", err)
+	}
+
+	s := r.last(t)
+	assertParameterized(t, "GetAddressSummary", s)
+
+	if len(s.args) != 1 || !hasArg(s.args, injection) {
+		t.Errorf("GetAddressSummary: args %v, want the address only", s.args)
+	}
+
+	want := storage.AddressSummary{
+		Address:             injection,
+		Received:            9000,
+		Sent:                4000,
+		UnconfirmedReceived: 500,
+		UnconfirmedSent:     1000,
+		Txs:                 3,
+		UnconfirmedTxs:      2,
+	}
+
+	if *summary != want {
+		t.Errorf("GetAddressSummary() = %+v, want %+v", summary, want)
+	}
+}
@@ -0,0 +1,128 @@
+package postgres
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/storage"
+)
+
+// addressPosition orders the address history, it must match idx_address_transaction_history and
+// storage.Cursor.Position
+const addressPosition = "COALESCE(address_transaction.height, 2147483647)"
+
+// addressOrder returns the direction the address history is read in for f: oldest first to get the page nearest to
+// an After cursor, newest first otherwise
+func addressOrder(f storage.TxFilter) string {
+	if f.After != nil {
+		return "ASC"
+	}
+
+	return "DESC"
+}
+
+// params holds the arguments of a parameterized query. Values are only ever added as arguments, the query text
+// refers to them by placeholder.
+type params []interface{}
+
+// add appends v to the arguments and returns its placeholder
+func (p *params) add(v interface{}) string {
+	*p = append(*p, v)
+	return fmt.Sprintf("$%d", len(*p))
+}
+
+// pageClause returns the LIMIT and OFFSET of pg, or an empty string for the zero value
+func pageClause(pg storage.Page, p *params) string {
+	clauses := []string{}
+
+	if pg.Limit > 0 {
+		clauses = append(clauses, "LIMIT "+p.add(pg.Limit))
+	}
+
+	if pg.Offset > 0 {
+		clauses = append(clauses, "OFFSET "+p.add(pg.Offset))
+	}
+
+	return strings.Join(clauses, " ")
+}
+
+// txConditions returns the conditions of f on the transaction table
+func txConditions(f storage.TxFilter, p *params) []string {
+	conditions := []string{}
+
+	if f.FromID > 0 {
+		conditions = append(conditions, "AND transaction.id >= "+p.add(f.FromID))
+	}
+
+	return conditions
+}
+
+// txFilterConditions returns the conditions of f for a query joining the non orphaned block of each transaction as
+// block
+func txFilterConditions(f storage.TxFilter, p *params) string {
+	conditions := txConditions(f, p)
+
+	if f.Mempool {
+		conditions = append(conditions, "AND block.id IS NULL")
+	}
+
+	if f.Heights != nil {
+		conditions = append(conditions, fmt.Sprintf("AND block.height BETWEEN %s AND %s", p.add(f.Heights.From), p.add(f.Heights.To)))
+	}
+
+	return strings.Join(append(conditions, timeConditions(f, p)...), "\n")
+}
+
+// addressConditions returns the conditions of f for a query on address_transaction, joining the non orphaned block at
+// the height of each transaction as block if f is timed
+func addressConditions(f storage.TxFilter, p *params) string {
+	conditions := []string{}
+
+	if f.FromID > 0 {
+		conditions = append(conditions, "AND address_transaction.transaction_id >= "+p.add(f.FromID))
+	}
+
+	if f.Mempool {
+		conditions = append(conditions, "AND address_transaction.height IS NULL")
+	}
+
+	if f.Heights != nil {
+		conditions = append(conditions, fmt.Sprintf("AND address_transaction.height BETWEEN %s AND %s", p.add(f.Heights.From), p.add(f.Heights.To)))
+	}
+
+	if c := f.Cursor(); c != nil {
+		op := "<"
+		if f.After != nil {
+			op = ">"
+		}
+
+		conditions = append(conditions, fmt.Sprintf("AND (%s, address_transaction.transaction_id) %s (%s, %s)", addressPosition, op, p.add(c.Position()), p.add(c.ID)))
+	}
+
+	return strings.Join(append(conditions, timeConditions(f, p)...), "\n")
+}
+
+// timeConditions returns the mined time conditions of f on the joined block
+func timeConditions(f storage.TxFilter, p *params) []string {
+	conditions := []string{}
+
+	if !f.Since.IsZero() {
+		conditions = append(conditions, "AND block.mined_time >= "+p.add(f.Since.UTC()))
+	}
+
+	if !f.Until.IsZero() {
+		conditions = append(conditions, "AND block.mined_time < "+p.add(f.Until.UTC()))
+	}
+
+	return conditions
+}
+
+// outputConditions returns the conditions of f on the output table
+func outputConditions(f storage.OutputFilter, p *params) string {
+	if len(f.Vouts) == 0 {
+		return ""
+	}
+
+	return "AND output.vout = ANY(" + p.add(pq.Array(f.Vouts)) + ")"
+}
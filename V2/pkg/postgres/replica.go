@@ -0,0 +1,269 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shapeshift-legacy/coinquery/V2/config"
+	"github.com/shapeshift-legacy/coinquery/V2/internal/log"
+	"github.com/shapeshift-legacy/coinquery/V2/internal/metrics"
+)
+
+const (
+	defaultMaxReplicaLag        = 1
+	defaultReplicaCheckInterval = 5 * time.Second
+)
+
+// replica is a read replica of the db
+type replica struct {
+	name    string // host of the replica, used in logs and metrics
+	db      DB
+	healthy bool
+}
+
+// replicaPool spreads reads across the read replicas of a db. A replica receives reads while it answers health checks
+// and its latest block is at most maxLag blocks behind the writer.
+type replicaPool struct {
+	prefix   schemaPrefix
+	replicas []*replica
+	writer   DB      // reference for replica lag, readwrite or else the db reads fall back to
+	conn     *sql.DB // connection to readwrite if opened for writer, closed along with the replicas
+	maxLag   int
+	interval time.Duration
+	logger   log.Logger
+
+	mu      sync.RWMutex
+	healthy []*replica // replicas receiving reads
+	next    uint32     // round robin counter
+
+	closing chan struct{}
+	done    chan struct{}
+}
+
+// primaryKey marks a context whose reads go to the primary, see onPrimary
+type primaryKey struct{}
+
+// onPrimary returns a context sending the reads made with it to the primary instead of a replica, for reads that have
+// to see everything written so far
+func onPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// reader returns the connection to read from: the next healthy replica, or the primary if there are none or ctx is
+// marked by onPrimary
+func (d *Database) reader(ctx context.Context) DB {
+	if d.replicas == nil || ctx.Value(primaryKey{}) != nil {
+		return d.DB
+	}
+
+	if r := d.replicas.pick(); r != nil {
+		return r
+	}
+
+	return d.DB
+}
+
+// scanRow runs a single row query on the reader of ctx and scans it into dest. A replica without the row may not have
+// caught up with a write made right before, such as a tx that was just broadcast, so the query is run again on the
+// primary. The returned context sends later reads to the primary if the row was only found there.
+func (d *Database) scanRow(ctx context.Context, query string, args []interface{}, dest ...interface{}) (context.Context, error) {
+	db := d.reader(ctx)
+
+	err := db.QueryRowContext(ctx, query, args...).Scan(dest...)
+	if err == sql.ErrNoRows && db != d.DB {
+		ctx = onPrimary(ctx)
+		err = d.DB.QueryRowContext(ctx, query, args...).Scan(dest...)
+	}
+
+	return ctx, err
+}
+
+// replicaName returns the host of uri to identify the replica in logs and metrics without its credentials
+func replicaName(uri string, i int) string {
+	if u, err := url.Parse(uri); err == nil && u.Host != "" {
+		return u.Host
+	}
+
+	return fmt.Sprintf("replica-%d", i)
+}
+
+// newReplicaPool opens a connection pool to each replica in dbConfig, along with a single connection to readwrite to
+// measure their lag against. Without readwrite lag is measured against primary.
+func newReplicaPool(dbConfig *config.DB, prefix schemaPrefix, primary DB, logger log.Logger) (*replicaPool, error) {
+	p := &replicaPool{
+		prefix:   prefix,
+		writer:   primary,
+		maxLag:   dbConfig.MaxReplicaLag,
+		interval: time.Duration(dbConfig.ReplicaCheckInterval) * time.Second,
+		logger:   logger,
+		closing:  make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	if p.maxLag <= 0 {
+		p.maxLag = defaultMaxReplicaLag
+	}
+
+	if p.interval <= 0 {
+		p.interval = defaultReplicaCheckInterval
+	}
+
+	if dbConfig.ReadWrite != "" && dbConfig.ReadWrite != dbConfig.URI {
+		conn, err := sql.Open("postgres", dbConfig.ReadWrite)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to open connection to readwrite for replica lag")
+		}
+
+		conn.SetMaxOpenConns(1)
+		conn.SetConnMaxLifetime(time.Duration(dbConfig.MaxConnLifetime) * time.Second)
+
+		p.writer, p.conn = conn, conn
+	}
+
+	for i, uri := range dbConfig.Replicas {
+		db, err := sql.Open("postgres", uri)
+		if err != nil {
+			p.closeReplicas()
+			return nil, errors.Wrapf(err, "failed to open connection to replica: %s", replicaName(uri, i))
+		}
+
+		db.SetMaxOpenConns(dbConfig.MaxConns)
+		db.SetMaxIdleConns(dbConfig.MaxConns / 2)
+		db.SetConnMaxLifetime(time.Duration(dbConfig.MaxConnLifetime) * time.Second)
+
+		p.replicas = append(p.replicas, &replica{name: replicaName(uri, i), db: db})
+	}
+
+	return p, nil
+}
+
+// pick returns the next healthy replica, or nil if there are none
+func (p *replicaPool) pick() DB {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if len(p.healthy) == 0 {
+		return nil
+	}
+
+	n := atomic.AddUint32(&p.next, 1)
+
+	return p.healthy[int(n)%len(p.healthy)].db
+}
+
+// height returns the height of the latest non orphaned block in db, or -1 if there are no blocks
+func (p *replicaPool) height(ctx context.Context, db DB) (int, error) {
+	query := compile(`
+		SELECT
+			COALESCE(MAX(height), -1)
+		FROM
+			_SCHEMA_.block
+		WHERE
+			is_orphaned = FALSE;
+	`, p.prefix)
+
+	var height int
+	if err := db.QueryRowContext(ctx, query).Scan(&height); err != nil {
+		return 0, err
+	}
+
+	return height, nil
+}
+
+// check measures the lag of every replica against the latest block of the writer and updates the replicas receiving
+// reads. If the writer can't be reached the replicas are left as they are, as their lag is unknown.
+func (p *replicaPool) check() {
+	ctx, cancel := context.WithTimeout(context.Background(), p.interval)
+	defer cancel()
+
+	tip, err := p.height(ctx, p.writer)
+	if err != nil {
+		p.logger.Warn(err, "postgres", "failed to get writer height for replica lag")
+		return
+	}
+
+	healthy := []*replica{}
+	for _, r := range p.replicas {
+		height, err := p.height(ctx, r.db)
+		lag := tip - height
+		if lag < 0 {
+			lag = 0
+		}
+
+		ok := err == nil && lag <= p.maxLag
+
+		switch {
+		case err != nil && r.healthy:
+			p.logger.Warnf(err, "postgres", "replica %s failed health check, excluding it from reads", r.name)
+		case err == nil && !ok && r.healthy:
+			p.logger.Infof("postgres", "replica %s is %d blocks behind, excluding it from reads", r.name, lag)
+		case ok && !r.healthy:
+			p.logger.Infof("postgres", "replica %s is %d blocks behind, including it in reads", r.name, lag)
+		}
+
+		if err == nil {
+			metrics.DBReplicaLag.WithLabelValues(string(p.prefix), r.name).Set(float64(lag))
+		}
+
+		r.healthy = ok
+		if ok {
+			metrics.DBReplicaHealthy.WithLabelValues(string(p.prefix), r.name).Set(1)
+			healthy = append(healthy, r)
+		} else {
+			metrics.DBReplicaHealthy.WithLabelValues(string(p.prefix), r.name).Set(0)
+		}
+	}
+
+	p.mu.Lock()
+	p.healthy = healthy
+	p.mu.Unlock()
+}
+
+// run checks the replicas every interval until close is called
+func (p *replicaPool) run() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.check()
+		case <-p.closing:
+			return
+		}
+	}
+}
+
+// close stops the health checks started by run and closes the replica connections
+func (p *replicaPool) close() error {
+	close(p.closing)
+	<-p.done
+
+	return p.closeReplicas()
+}
+
+// closeReplicas closes the replica connections and the one to readwrite, returning the first error
+func (p *replicaPool) closeReplicas() error {
+	var first error
+	if p.conn != nil {
+		if err := p.conn.Close(); err != nil {
+			first = errors.Wrap(err, "failed to close readwrite connection for replica lag")
+		}
+	}
+
+	for _, r := range p.replicas {
+		if err := r.db.Close(); err != nil && first == nil {
+			first = errors.Wrapf(err, "failed to close replica: %s", r.name)
+		}
+	}
+
+	return first
+}
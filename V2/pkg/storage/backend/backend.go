@@ -0,0 +1,43 @@
+// Package backend opens the storage backend selected by the uri of a coin db
+package backend
+
+import (
+	"strings"
+
+	"github.com/shapeshift-legacy/coinquery/V2/config"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/postgres"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/storage"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/storage/memory"
+)
+
+const (
+	// MemoryScheme selects an empty in-memory store only visible to the process opening it, eg. memory://btctestnet
+	MemoryScheme = "memory://"
+
+	// FileScheme selects an in-memory store sharing its writes through the journal file at the path of the uri with
+	// the stores of other processes, eg. file:///var/lib/coinquery/btctestnet.journal
+	FileScheme = "file://"
+)
+
+// New opens the backend selected by the scheme of dbConfig.URI for coin, anything but MemoryScheme and FileScheme is
+// a postgres connection string
+func New(dbConfig *config.DB, coin string) (storage.Store, error) {
+	switch {
+	case strings.HasPrefix(dbConfig.URI, MemoryScheme):
+		return memory.New(coin), nil
+	case strings.HasPrefix(dbConfig.URI, FileScheme):
+		s, err := memory.Open(strings.TrimPrefix(dbConfig.URI, FileScheme), coin)
+		if err != nil {
+			return nil, err
+		}
+
+		return s, nil
+	}
+
+	db, err := postgres.New(dbConfig, coin)
+	if err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
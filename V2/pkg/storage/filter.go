@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidFilter is returned when a Page or filter can't be turned into a query
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// MempoolPosition is the position of mempool txs in the address history, ahead of every block
+const MempoolPosition = 2147483647
+
+// Page limits the rows returned by a query. The zero value returns every row.
+type Page struct {
+	Limit  int // maximum number of rows, 0 for no limit
+	Offset int // number of rows skipped
+}
+
+// HeightRange is an inclusive range of block heights
+type HeightRange struct {
+	From int
+	To   int
+}
+
+// Cursor is the position of a tx in the address history, which is ordered newest first by height, with the mempool
+// ahead of every block, then by tx id. Txs keep their position while blocks are added, so pages read from a cursor
+// don't shift as the chain advances.
+type Cursor struct {
+	Height int // -1 in the mempool
+	ID     int // transaction id
+}
+
+// ParseCursor parses a cursor encoded by Cursor.String, returning ErrInvalidFilter if s isn't one
+func ParseCursor(s string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.Wrapf(ErrInvalidFilter, "cursor %q", s)
+	}
+
+	parts := strings.Split(string(b), ":")
+	if len(parts) != 2 {
+		return nil, errors.Wrapf(ErrInvalidFilter, "cursor %q", s)
+	}
+
+	height, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return nil, errors.Wrapf(ErrInvalidFilter, "cursor %q", s)
+	}
+
+	id, err := strconv.Atoi(parts[1])
+	if err != nil || height < -1 || id <= 0 {
+		return nil, errors.Wrapf(ErrInvalidFilter, "cursor %q", s)
+	}
+
+	return &Cursor{Height: height, ID: id}, nil
+}
+
+// String returns the opaque encoding of c used by the api
+func (c Cursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d", c.Height, c.ID)))
+}
+
+// Position returns the height c is ordered by, MempoolPosition in the mempool
+func (c Cursor) Position() int {
+	if c.Height < 0 {
+		return MempoolPosition
+	}
+
+	return c.Height
+}
+
+// Less reports if c is ordered before o in the address history, that is newer
+func (c Cursor) Less(o Cursor) bool {
+	if c.Position() != o.Position() {
+		return c.Position() > o.Position()
+	}
+
+	return c.ID > o.ID
+}
+
+// TxFilter selects the transactions returned by a query. The zero value selects every transaction.
+type TxFilter struct {
+	Page
+	Heights *HeightRange // only txs mined in a non orphaned block within the range
+	Since   time.Time    // only txs mined at or after Since, zero for no lower bound
+	Until   time.Time    // only txs mined before Until, zero for no upper bound
+	Mempool bool         // only txs without a non orphaned block, can't be combined with Heights, Since or Until
+	FromID  int          // only txs with an id at or above FromID
+	Before  *Cursor      // only txs older than Before in the address history, the page nearest to it
+	After   *Cursor      // only txs newer than After in the address history, the page nearest to it
+}
+
+// OutputFilter selects the outputs returned by a query. The zero value selects every output.
+type OutputFilter struct {
+	Vouts []int // only outputs with one of these indexes, empty for all outputs
+}
+
+// Validate returns ErrInvalidFilter if p has a negative limit or offset
+func (p Page) Validate() error {
+	if p.Limit < 0 || p.Offset < 0 {
+		return errors.Wrapf(ErrInvalidFilter, "limit (%d) and offset (%d) can't be negative", p.Limit, p.Offset)
+	}
+
+	return nil
+}
+
+// Validate returns ErrInvalidFilter if f can't select any transaction or its page is invalid
+func (f TxFilter) Validate() error {
+	if err := f.Page.Validate(); err != nil {
+		return err
+	}
+
+	if f.Heights != nil && (f.Heights.From < 0 || f.Heights.From > f.Heights.To) {
+		return errors.Wrapf(ErrInvalidFilter, "height range %d to %d", f.Heights.From, f.Heights.To)
+	}
+
+	if !f.Since.IsZero() && !f.Until.IsZero() && !f.Since.Before(f.Until) {
+		return errors.Wrapf(ErrInvalidFilter, "time range %s to %s", f.Since, f.Until)
+	}
+
+	if f.Mempool && f.Mined() {
+		return errors.Wrap(ErrInvalidFilter, "mempool can't be combined with a height or time range")
+	}
+
+	if f.FromID < 0 {
+		return errors.Wrapf(ErrInvalidFilter, "from id (%d) can't be negative", f.FromID)
+	}
+
+	if f.Before != nil && f.After != nil {
+		return errors.Wrap(ErrInvalidFilter, "before and after cursors can't be combined")
+	}
+
+	if f.Cursor() != nil && f.Offset > 0 {
+		return errors.Wrap(ErrInvalidFilter, "cursors can't be combined with an offset")
+	}
+
+	return nil
+}
+
+// Mined reports if f only selects txs mined in a block
+func (f TxFilter) Mined() bool {
+	return f.Heights != nil || f.Timed()
+}
+
+// Timed reports if f selects txs by the time their block was mined
+func (f TxFilter) Timed() bool {
+	return !f.Since.IsZero() || !f.Until.IsZero()
+}
+
+// Cursor returns the cursor of f, or nil if it has none
+func (f TxFilter) Cursor() *Cursor {
+	if f.Before != nil {
+		return f.Before
+	}
+
+	return f.After
+}
+
+// Selects reports if the tx at c in the address history is within the cursor of f
+func (f TxFilter) Selects(c Cursor) bool {
+	if f.Before != nil {
+		return f.Before.Less(c)
+	}
+
+	if f.After != nil {
+		return c.Less(*f.After)
+	}
+
+	return true
+}
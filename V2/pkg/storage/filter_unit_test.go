@@ -0,0 +1,74 @@
+// +build unit
+
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestCursor(t *testing.T) {
+	mempool, tip, older := Cursor{Height: -1, ID: 2}, Cursor{Height: 100, ID: 9}, Cursor{Height: 100, ID: 8}
+
+	// newest first, the mempool ahead of every block
+	if !mempool.Less(tip) || !tip.Less(older) || older.Less(tip) || tip.Less(tip) {
+		t.Errorf("Less() doesn't order %v, %v, %v newest first", mempool, tip, older)
+	}
+
+	if mempool.Position() != MempoolPosition || tip.Position() != 100 {
+		t.Errorf("Position() = %d and %d, want %d and 100", mempool.Position(), tip.Position(), MempoolPosition)
+	}
+
+	for _, c := range []Cursor{mempool, tip, older} {
+		if parsed, err := ParseCursor(c.String()); err != nil || *parsed != c {
+			t.Errorf("ParseCursor(%q) = %v, %v, want %v", c.String(), parsed, err, c)
+		}
+	}
+
+	for _, s := range []string{"", "1:2", "eDox", "LTI6MQ", "NTow", "x'; DROP TABLE btc.block; --"} {
+		if _, err := ParseCursor(s); errors.Cause(err) != ErrInvalidFilter {
+			t.Errorf("ParseCursor(%q) = %v, want %v", s, err, ErrInvalidFilter)
+		}
+	}
+
+	// a cursor selects the txs past it in its direction
+	if f := (TxFilter{Before: &tip}); !f.Selects(older) || f.Selects(mempool) || f.Selects(tip) {
+		t.Errorf("Selects() of %v before %v doesn't select only older txs", f, tip)
+	}
+
+	if f := (TxFilter{After: &tip}); !f.Selects(mempool) || f.Selects(older) || f.Selects(tip) {
+		t.Errorf("Selects() of %v after %v doesn't select only newer txs", f, tip)
+	}
+}
+
+func TestTxFilter_Validate(t *testing.T) {
+	since := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	invalid := []struct {
+		name   string
+		filter TxFilter
+	}{
+		{"negative limit", TxFilter{Page: Page{Limit: -1}}},
+		{"negative offset", TxFilter{Page: Page{Offset: -1}}},
+		{"negative height", TxFilter{Heights: &HeightRange{From: -1, To: 10}}},
+		{"inverted heights", TxFilter{Heights: &HeightRange{From: 10, To: 9}}},
+		{"inverted time range", TxFilter{Since: since, Until: since}},
+		{"mempool with heights", TxFilter{Mempool: true, Heights: &HeightRange{From: 0, To: 1}}},
+		{"mempool with since", TxFilter{Mempool: true, Since: since}},
+		{"negative id", TxFilter{FromID: -1}},
+		{"before and after", TxFilter{Before: &Cursor{Height: 1, ID: 2}, After: &Cursor{Height: 1, ID: 1}}},
+		{"cursor with offset", TxFilter{Page: Page{Limit: 10, Offset: 10}, Before: &Cursor{Height: 1, ID: 2}}},
+	}
+
+	for _, f := range invalid {
+		if err := f.filter.Validate(); errors.Cause(err) != ErrInvalidFilter {
+			t.Errorf("%s: Validate() = %v, want %v", f.name, err, ErrInvalidFilter)
+		}
+	}
+
+	if err := (TxFilter{Heights: &HeightRange{From: 5, To: 5}, Since: since, Until: since.Add(time.Second)}).Validate(); err != nil {
+		t.Errorf("Validate() = %v, want nil", err)
+	}
+}
@@ -0,0 +1,210 @@
+package memory
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shapeshift-legacy/coinquery/V2/internal/log"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/blockchain/utxo"
+)
+
+// followInterval is how often a shared Store applies the writes recorded in its journal by other processes
+const followInterval = 100 * time.Millisecond
+
+// writes recorded in a journal
+const (
+	opSet              = "set"
+	opInsertBlock      = "insertBlock"
+	opInsertTxs        = "insertTxs"
+	opOrphanBlocks     = "orphanBlocks"
+	opDeleteOrphans    = "deleteOrphans"
+	opDeleteInvalidTxs = "deleteInvalidTxs"
+)
+
+// entry is a write along with its arguments, recorded in a journal as a line of json
+type entry struct {
+	Op      string      `json:"op"`
+	Key     string      `json:"key,omitempty"`
+	Value   string      `json:"value,omitempty"`
+	Block   *utxo.Block `json:"block,omitempty"`
+	Recover bool        `json:"recover,omitempty"`
+	BlockID int         `json:"blockId,omitempty"`
+	Txs     []*utxo.Tx  `json:"txs,omitempty"`
+	Height  int         `json:"height,omitempty"`
+	IDs     []int       `json:"ids,omitempty"`
+}
+
+// journal is the file recording the writes of the Stores sharing it. A write is recorded while holding an exclusive
+// flock on the file, after applying the writes recorded before it, so every Store applies the same writes in the same
+// order and ends up with the same ids.
+type journal struct {
+	file   *os.File
+	offset int64 // bytes of the file applied to the Store, guarded by the mutex of the Store
+	logger log.Logger
+
+	closing chan struct{}
+	done    chan struct{}
+}
+
+// Open returns a Store for coin sharing its writes with every other Store opened on the journal at path, creating the
+// file if it doesn't exist. The writes already recorded are applied before returning, those recorded later by other
+// processes every followInterval. Everything is held in memory and the journal is applied from the start by each Open,
+// so keep it to regtest or small testnet chains.
+func Open(path, coin string) (*Store, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open journal: %s", path)
+	}
+
+	s := New(coin)
+	s.journal = &journal{
+		file:    file,
+		logger:  log.New(coin),
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	if err := s.catchUp(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	go s.journal.follow(s)
+
+	return s, nil
+}
+
+// catchUp applies the writes recorded in the journal since the last one applied
+func (s *Store) catchUp() error {
+	info, err := s.journal.file.Stat()
+	if err != nil {
+		return errors.Wrap(err, "failed to read journal")
+	}
+
+	s.mu.RLock()
+	current := info.Size() == s.journal.offset
+	s.mu.RUnlock()
+
+	if current {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.journal.lock(syscall.LOCK_SH); err != nil {
+		return err
+	}
+	defer s.journal.unlock()
+
+	return s.journal.replay(s)
+}
+
+// lock takes a flock on the file, shared or exclusive depending on how
+func (j *journal) lock(how int) error {
+	if err := syscall.Flock(int(j.file.Fd()), how); err != nil {
+		return errors.Wrap(err, "failed to lock journal")
+	}
+
+	return nil
+}
+
+// unlock releases the flock taken by lock
+func (j *journal) unlock() {
+	syscall.Flock(int(j.file.Fd()), syscall.LOCK_UN)
+}
+
+// replay applies the entries recorded after offset to s. A write fails when replayed only if it failed when recorded,
+// without changing the Store, so errors of the writes are ignored. s must be locked along with the file.
+func (j *journal) replay(s *Store) error {
+	if _, err := j.file.Seek(j.offset, io.SeekStart); err != nil {
+		return errors.Wrap(err, "failed to read journal")
+	}
+
+	r := bufio.NewReader(j.file)
+
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			// an incomplete last line was left by a process failing while recording it, the next write replaces it
+			return nil
+		}
+
+		if err != nil {
+			return errors.Wrap(err, "failed to read journal")
+		}
+
+		e := &entry{}
+		if err := json.Unmarshal(line, e); err != nil {
+			return errors.Wrapf(err, "failed to decode journal entry at offset: %d", j.offset)
+		}
+
+		s.apply(e)
+		j.offset += int64(len(line))
+	}
+}
+
+// record appends e to the journal after replaying the writes recorded by other Stores. The write is only applied to s
+// once recorded, so s must be locked until then.
+func (j *journal) record(s *Store, e *entry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrapf(err, "failed to encode journal entry: %s", e.Op)
+	}
+
+	if err := j.lock(syscall.LOCK_EX); err != nil {
+		return err
+	}
+	defer j.unlock()
+
+	if err := j.replay(s); err != nil {
+		return err
+	}
+
+	// drops an incomplete last line left by a failed write
+	if err := j.file.Truncate(j.offset); err != nil {
+		return errors.Wrap(err, "failed to record write in journal")
+	}
+
+	line = append(line, '\n')
+	if _, err := j.file.WriteAt(line, j.offset); err != nil {
+		j.file.Truncate(j.offset)
+		return errors.Wrap(err, "failed to record write in journal")
+	}
+
+	j.offset += int64(len(line))
+
+	return nil
+}
+
+// follow applies the writes recorded by other processes every followInterval until close is called
+func (j *journal) follow(s *Store) {
+	defer close(j.done)
+
+	ticker := time.NewTicker(followInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.catchUp(); err != nil {
+				j.logger.Warn(err, "memory", "failed to apply journal")
+			}
+		case <-j.closing:
+			return
+		}
+	}
+}
+
+// close stops follow and closes the file
+func (j *journal) close() error {
+	close(j.closing)
+	<-j.done
+
+	return j.file.Close()
+}
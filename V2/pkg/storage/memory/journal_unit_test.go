@@ -0,0 +1,115 @@
+// +build unit
+
+package memory
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Stores opened on the same journal share their writes, as the indexer, api and validators running as separate
+// processes would
+func TestOpen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "btc.journal")
+	ctx := context.Background()
+
+	indexer, err := Open(path, "btc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer indexer.Close()
+
+	api, err := Open(path, "btc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer api.Close()
+
+	blocks := loadChain(t)
+	insert(t, indexer, blocks...)
+
+	if err := api.catchUp(); err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := indexer.GetTxByTxID(ctx, txid100002)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := api.GetTxByTxID(ctx, txid100002); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("GetTxByTxID() of the api = %+v, %v, want the indexer's %+v", got, err, want)
+	}
+
+	// a write made by another process is applied before recording the next one
+	if _, err := api.OrphanBlocks(blocks[2].Height); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := indexer.Set("key", "value"); err != nil {
+		t.Fatal(err)
+	}
+
+	if orphans, err := indexer.GetOrphanCount(ctx); err != nil || orphans != 1 {
+		t.Errorf("GetOrphanCount() of the indexer = %d, %v, want 1", orphans, err)
+	}
+
+	// an incomplete entry left by a failed write is skipped, then replaced by the next write
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.WriteString(`{"op":"set","key":"broken"`); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	reopened, err := Open(path, "btc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+
+	if value, err := reopened.Get(ctx, "key"); err != nil || value != "value" {
+		t.Errorf("Get() after reopening = %s, %v, want value", value, err)
+	}
+
+	if got, err := reopened.GetTxByTxID(ctx, txid100000); err != nil || got.ID != 1 {
+		t.Errorf("GetTxByTxID() after reopening = %+v, %v, want id 1", got, err)
+	}
+
+	if err := reopened.Set("other", "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the api follows without writing
+	deadline := time.Now().Add(10 * followInterval)
+	for {
+		value, err := api.Get(ctx, "other")
+		if err == nil && value == "1" {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("Get() of the api = %s, %v, want the value set by another store", value, err)
+		}
+
+		time.Sleep(followInterval)
+	}
+
+	if _, err := api.Get(ctx, "broken"); err == nil {
+		t.Error("Get() of an incomplete entry error = nil")
+	}
+}
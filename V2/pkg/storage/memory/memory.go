@@ -0,0 +1,1078 @@
+// Package memory is an in-memory storage backend following the semantics of the postgres schema functions, to run the
+// services for a regtest or small testnet coin without postgres and to unit test storage users. A Store created by New
+// is only visible to the process creating it, Stores opened by Open on the same journal file share their writes with
+// each other, so the indexer, api, monitor and validators can run as separate processes.
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/blockchain/utxo"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/storage"
+)
+
+// block is a stored block, ids start at 1
+type block struct {
+	id int
+	utxo.BlockHeader
+}
+
+// tx is a stored transaction, ids start at 1
+type tx struct {
+	id       int
+	blockID  int // 0 for mempool transactions
+	index    int // position in the block, -1 for mempool transactions
+	txid     string
+	hash     string
+	version  int
+	size     int
+	vsize    int
+	weight   int
+	locktime int
+	raw      string
+	inputs   []storage.Input
+	outputs  []storage.Output
+}
+
+// Store holds the blocks, transactions and metadata of a coin. It is safe for concurrent use. Reads never block on
+// anything but the Store itself, so the contexts passed to them are ignored.
+type Store struct {
+	coin    string
+	journal *journal // writes shared with the other Stores opened on the same file, nil if the Store isn't shared
+
+	mu       sync.RWMutex
+	metadata map[string]string
+	blocks   []*block // ordered by id
+	byHash   map[string]*block
+	txs      []*tx // ordered by id
+	byTxID   map[string]*tx
+	nextTxID int
+}
+
+// New returns an empty Store for coin
+func New(coin string) *Store {
+	return &Store{
+		coin:     coin,
+		metadata: make(map[string]string),
+		byHash:   make(map[string]*block),
+		byTxID:   make(map[string]*tx),
+		nextTxID: 1,
+	}
+}
+
+// Close stops following the journal of a shared Store and closes it. The contents of the Store are kept until it is
+// garbage collected.
+func (s *Store) Close() error {
+	if s.journal == nil {
+		return nil
+	}
+
+	return s.journal.close()
+}
+
+// write makes the write of e, recording it in the journal first if the Store is shared. Returns the id of an inserted
+// block or the number of orphaned blocks.
+func (s *Store) write(e *entry) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.journal != nil {
+		if err := s.journal.record(s, e); err != nil {
+			return 0, err
+		}
+	}
+
+	return s.apply(e)
+}
+
+// apply makes the write of e, the Store must be locked
+func (s *Store) apply(e *entry) (int, error) {
+	switch e.Op {
+	case opSet:
+		s.metadata[e.Key] = e.Value
+		return 0, nil
+	case opInsertBlock:
+		return s.insertBlock(e.Block, e.Recover)
+	case opInsertTxs:
+		return 0, s.insertTxs(e.BlockID, e.Txs)
+	case opOrphanBlocks:
+		return s.orphanBlocks(e.Height), nil
+	case opDeleteOrphans:
+		s.deleteOrphans()
+		return 0, nil
+	case opDeleteInvalidTxs:
+		s.deleteInvalidTxs(e.IDs)
+		return 0, nil
+	default:
+		return 0, errors.Errorf("unknown write: %s", e.Op)
+	}
+}
+
+// Get returns the value of key
+func (s *Store) Get(ctx context.Context, key string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	value, ok := s.metadata[key]
+	if !ok {
+		return "", errors.Errorf("failed to get value for key: %s: not found", key)
+	}
+
+	return value, nil
+}
+
+// Set inserts or updates key with value
+func (s *Store) Set(key, value string) error {
+	_, err := s.write(&entry{Op: opSet, Key: key, Value: value})
+	return err
+}
+
+// mainBlock returns the non orphaned block at height, or nil if there is none
+func (s *Store) mainBlock(height int) *block {
+	for i := len(s.blocks) - 1; i >= 0; i-- {
+		if b := s.blocks[i]; b.Height == height && !b.IsOrphan {
+			return b
+		}
+	}
+
+	return nil
+}
+
+// lastBlock returns the highest non orphaned block, or nil if there is none
+func (s *Store) lastBlock() *block {
+	var last *block
+	for _, b := range s.blocks {
+		if !b.IsOrphan && (last == nil || b.Height > last.Height) {
+			last = b
+		}
+	}
+
+	return last
+}
+
+// block returns the block with id, or nil if there is none
+func (s *Store) block(id int) *block {
+	if id < 1 || id > len(s.blocks) {
+		return nil
+	}
+
+	return s.blocks[id-1]
+}
+
+// mainBlockOf returns the block of t if it is not orphaned, otherwise nil like the left joins of the postgres queries
+func (s *Store) mainBlockOf(t *tx) *block {
+	if b := s.block(t.blockID); b != nil && !b.IsOrphan {
+		return b
+	}
+
+	return nil
+}
+
+// orphanAt orphans all blocks at height except the block with hash
+func (s *Store) orphanAt(height int, hash string) {
+	for _, b := range s.blocks {
+		if b.Height == height && b.Hash != hash {
+			b.IsOrphan = true
+		}
+	}
+}
+
+// InsertBlock inserts the header of b as the tip of the chain and returns its id. Inserting a stored block makes it
+// the block at its height again. Like block_insert, orphaned ancestors of b are restored and b along with its
+// descendants is orphaned if an ancestor is missing.
+func (s *Store) InsertBlock(b *utxo.Block, recover bool) (int, error) {
+	return s.write(&entry{Op: opInsertBlock, Block: b, Recover: recover})
+}
+
+// insertBlock inserts b, the Store must be locked
+func (s *Store) insertBlock(b *utxo.Block, recover bool) (int, error) {
+	last := s.lastBlock()
+	if last != nil && b.Height < last.Height && !recover {
+		return 0, errors.Errorf("failed to insert block: received block hash: %s is less than current last block height: %d", b.Hash, last.Height)
+	}
+
+	if b.Height > 0 {
+		if prev := s.mainBlock(b.Height - 1); prev != nil {
+			prev.NextHash = b.Hash
+		}
+	}
+
+	if existing, ok := s.byHash[b.Hash]; ok && existing.Height == b.Height {
+		existing.NextHash = b.NextHash
+		existing.IsOrphan = false
+		s.orphanAt(b.Height, b.Hash)
+
+		return existing.id, nil
+	}
+
+	s.orphanAt(b.Height, b.Hash)
+
+	header := b.BlockHeader
+	header.IsOrphan = false
+	inserted := &block{id: len(s.blocks) + 1, BlockHeader: header}
+
+	s.blocks = append(s.blocks, inserted)
+	s.byHash[b.Hash] = inserted
+
+	if last != nil {
+		s.restoreAncestors(inserted)
+	}
+
+	return inserted.id, nil
+}
+
+// restoreAncestors walks up from b restoring orphaned ancestors to the main chain. If an ancestor is missing, b and all
+// of its descendants are orphaned along with the blocks at the height of the missing ancestor.
+func (s *Store) restoreAncestors(b *block) {
+	current := b
+
+	for {
+		parent, ok := s.byHash[current.PrevHash]
+		if !ok || parent.Height != current.Height-1 {
+			break
+		}
+
+		parent.NextHash = current.Hash
+
+		if !parent.IsOrphan {
+			return
+		}
+
+		for _, sibling := range s.blocks {
+			if sibling.Height == parent.Height && sibling != parent {
+				sibling.NextHash = ""
+				sibling.IsOrphan = true
+			}
+		}
+
+		parent.IsOrphan = false
+		current = parent
+	}
+
+	for _, m := range s.blocks {
+		if m.Height == current.Height-1 {
+			m.IsOrphan = true
+		}
+	}
+
+	children := []string{current.Hash}
+	for len(children) > 0 {
+		hash := children[0]
+		children = children[1:]
+
+		s.byHash[hash].IsOrphan = true
+
+		for _, child := range s.blocks {
+			if child.PrevHash == hash {
+				children = append(children, child.Hash)
+			}
+		}
+	}
+}
+
+// OrphanBlocks marks all blocks at or above height as orphaned and returns the number of blocks orphaned
+func (s *Store) OrphanBlocks(height int) (int, error) {
+	return s.write(&entry{Op: opOrphanBlocks, Height: height})
+}
+
+// orphanBlocks orphans the blocks at or above height, the Store must be locked
+func (s *Store) orphanBlocks(height int) int {
+	count := 0
+	for _, b := range s.blocks {
+		if b.Height >= height && !b.IsOrphan {
+			b.NextHash = ""
+			b.IsOrphan = true
+			count++
+		}
+	}
+
+	if parent := s.mainBlock(height - 1); parent != nil {
+		parent.NextHash = ""
+	}
+
+	return count
+}
+
+// GetOrphanCount returns the number of orphaned blocks
+func (s *Store) GetOrphanCount(ctx context.Context) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	count := 0
+	for _, b := range s.blocks {
+		if b.IsOrphan {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// LastBlock returns the highest non orphaned block, or nil if there are no blocks
+func (s *Store) LastBlock(ctx context.Context) (*utxo.Block, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	last := s.lastBlock()
+	if last == nil {
+		return nil, nil
+	}
+
+	return &utxo.Block{BlockHeader: last.BlockHeader}, nil
+}
+
+// GetBlock returns the non orphaned block at the specified height (int) or the block with hash (string)
+func (s *Store) GetBlock(ctx context.Context, val interface{}) (*utxo.Block, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var b *block
+
+	switch v := val.(type) {
+	case int:
+		b = s.mainBlock(v)
+	case string:
+		b = s.byHash[v]
+	default:
+		return nil, errors.New(fmt.Sprintf("Blocks val must be of type int or string, instead of %T", v))
+	}
+
+	if b == nil {
+		return nil, errors.Errorf("failed to get block: %v: not found", val)
+	}
+
+	return &utxo.Block{BlockHeader: b.BlockHeader}, nil
+}
+
+// newTx converts t into a stored transaction
+func newTx(t *utxo.Tx, blockID, index int) (*tx, error) {
+	if t.TxID == "" {
+		return nil, errors.New("no txid supplied")
+	}
+
+	locktime, err := t.Locktime.Int64()
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid locktime: %s, in tx: %s", t.Locktime, t.TxID)
+	}
+
+	outputs, err := storage.TxOutputs(t)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := t.Hash
+	if hash == "" {
+		hash = t.TxID
+	}
+
+	return &tx{
+		blockID:  blockID,
+		index:    index,
+		txid:     t.TxID,
+		hash:     hash,
+		version:  t.Version,
+		size:     t.Size,
+		vsize:    t.VSize,
+		weight:   t.Weight,
+		locktime: int(locktime),
+		raw:      t.Hex,
+		inputs:   storage.TxInputs(t),
+		outputs:  outputs,
+	}, nil
+}
+
+// add stores t with the next transaction id
+func (s *Store) add(t *tx) {
+	t.id = s.nextTxID
+	s.nextTxID++
+
+	s.txs = append(s.txs, t)
+	s.byTxID[t.txid] = t
+}
+
+// remove deletes the transactions for which drop returns true
+func (s *Store) remove(drop func(t *tx) bool) {
+	kept := s.txs[:0]
+	for _, t := range s.txs {
+		if drop(t) {
+			delete(s.byTxID, t.txid)
+			continue
+		}
+
+		kept = append(kept, t)
+	}
+
+	s.txs = kept
+}
+
+// InsertTxs inserts all txs of a block, or none of them if any is invalid. The index of each tx is its position in txs.
+// Use a blockID of -1 for mempool transactions. Stored transactions are moved to the block, mempool transactions that
+// are already stored are left as is.
+func (s *Store) InsertTxs(blockID int, txs []*utxo.Tx) error {
+	_, err := s.write(&entry{Op: opInsertTxs, BlockID: blockID, Txs: txs})
+	return err
+}
+
+// insertTxs inserts txs, the Store must be locked
+func (s *Store) insertTxs(blockID int, txs []*utxo.Tx) error {
+	if blockID < 0 {
+		blockID = 0
+	}
+
+	rows := make([]*tx, 0, len(txs))
+	for i, t := range txs {
+		index := i
+		if blockID == 0 {
+			index = -1
+		}
+
+		row, err := newTx(t, blockID, index)
+		if err != nil {
+			return errors.Wrapf(err, "failed to insert tx: %s, with txIndex: %d, and blockID: %d", t.TxID, i, blockID)
+		}
+
+		rows = append(rows, row)
+	}
+
+	for _, row := range rows {
+		existing, ok := s.byTxID[row.txid]
+		if !ok {
+			s.add(row)
+			continue
+		}
+
+		if blockID != 0 {
+			existing.blockID = blockID
+			existing.index = row.index
+		}
+	}
+
+	return nil
+}
+
+// DeleteOrphans deletes all transactions of orphaned blocks
+func (s *Store) DeleteOrphans() error {
+	_, err := s.write(&entry{Op: opDeleteOrphans})
+	return err
+}
+
+// deleteOrphans deletes the transactions of orphaned blocks, the Store must be locked
+func (s *Store) deleteOrphans() {
+	s.remove(func(t *tx) bool {
+		b := s.block(t.blockID)
+		return b != nil && b.IsOrphan
+	})
+}
+
+// DeleteInvalidTxs deletes the mempool transactions with ids
+func (s *Store) DeleteInvalidTxs(ids []int) error {
+	_, err := s.write(&entry{Op: opDeleteInvalidTxs, IDs: ids})
+	return err
+}
+
+// deleteInvalidTxs deletes the mempool transactions with ids, the Store must be locked
+func (s *Store) deleteInvalidTxs(ids []int) {
+	invalid := make(map[int]bool)
+	for _, id := range ids {
+		invalid[id] = true
+	}
+
+	s.remove(func(t *tx) bool {
+		return invalid[t.id] && t.blockID == 0
+	})
+}
+
+// GetNumTransactions returns the number of transactions
+func (s *Store) GetNumTransactions(ctx context.Context) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.txs), nil
+}
+
+// GetPendingTxs returns the mempool transactions selected by filter in ascending id order
+func (s *Store) GetPendingTxs(ctx context.Context, filter storage.TxFilter) ([]*storage.PendingTx, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, errors.Wrap(err, "failed to get pending transactions")
+	}
+
+	if filter.Mined() {
+		return nil, errors.Wrap(storage.ErrInvalidFilter, "failed to get pending transactions: pending txs have no block")
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	txs := []*storage.PendingTx{}
+	for _, t := range s.txs {
+		if t.blockID == 0 && t.id >= filter.FromID {
+			txs = append(txs, &storage.PendingTx{ID: t.id, TxID: t.txid})
+		}
+	}
+
+	start, end := bounds(len(txs), filter.Page)
+
+	return txs[start:end], nil
+}
+
+// GetTxAtBlockTime returns the id of the earliest inserted transaction of the earliest inserted block mined at or
+// after date
+func (s *Store) GetTxAtBlockTime(ctx context.Context, date time.Time) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, b := range s.blocks {
+		if int64(b.Time) < date.Unix() {
+			continue
+		}
+
+		for _, t := range s.txs {
+			if t.blockID == b.id {
+				return t.id, nil
+			}
+		}
+
+		break
+	}
+
+	return 0, errors.New("failed to get highest validated transaction: not found")
+}
+
+// GetTxHashesByBlockHash returns a page of the txids of a non orphaned block
+func (s *Store) GetTxHashesByBlockHash(ctx context.Context, hash string, page storage.Page) ([]string, error) {
+	if err := page.Validate(); err != nil {
+		return nil, errors.Wrapf(err, "failed to get txhashes from block hash: %s", hash)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	txids := []string{}
+	for _, t := range s.blockTxs(hash) {
+		txids = append(txids, t.txid)
+	}
+
+	return paginate(txids, page), nil
+}
+
+// GetTotalTxsByBlockHash returns the number of transactions of a non orphaned block
+func (s *Store) GetTotalTxsByBlockHash(ctx context.Context, hash string) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.blockTxs(hash)), nil
+}
+
+// blockTxs returns the transactions of the block with hash, or none if it is orphaned
+func (s *Store) blockTxs(hash string) []*tx {
+	b, ok := s.byHash[hash]
+	if !ok || b.IsOrphan {
+		return nil
+	}
+
+	txs := []*tx{}
+	for _, t := range s.txs {
+		if t.blockID == b.id {
+			txs = append(txs, t)
+		}
+	}
+
+	return txs
+}
+
+// height returns the height of the block of t, or -1 if t is in the mempool or its block is orphaned
+func (s *Store) height(t *tx) int64 {
+	if b := s.mainBlockOf(t); b != nil {
+		return int64(b.Height)
+	}
+
+	return -1
+}
+
+// minedTime returns the time of the block of t as formatted by postgres, or false if t has no non orphaned block
+func (s *Store) minedTime(t *tx) (string, bool) {
+	b := s.mainBlockOf(t)
+	if b == nil {
+		return "", false
+	}
+
+	return time.Unix(int64(b.Time), 0).UTC().Format(time.RFC3339Nano), true
+}
+
+// GetSpentTxDetails returns the transaction spending vout of txid, or nil if it is unspent
+func (s *Store) GetSpentTxDetails(ctx context.Context, txid string, vout int) *storage.SpentTxDetails {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, t := range s.txs {
+		for _, in := range t.inputs {
+			if in.SpentTx == txid && in.SpentVout == vout && in.Coinbase == "" {
+				return &storage.SpentTxDetails{SpentTxID: t.txid, SpentIndex: in.Vin, SpentHeight: s.height(t)}
+			}
+		}
+	}
+
+	return nil
+}
+
+// outpoint identifies an output
+type outpoint struct {
+	txid string
+	vout int
+}
+
+// spent returns the outputs spent by any stored transaction
+func (s *Store) spent() map[outpoint]bool {
+	spent := make(map[outpoint]bool)
+	for _, t := range s.txs {
+		for _, in := range t.inputs {
+			if in.Coinbase == "" {
+				spent[outpoint{in.SpentTx, in.SpentVout}] = true
+			}
+		}
+	}
+
+	return spent
+}
+
+// GetUtxosByAddrs returns unspent outputs of addrs
+func (s *Store) GetUtxosByAddrs(ctx context.Context, addrs []string) ([]*storage.Utxo, error) {
+	wanted := set(addrs)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	spent := s.spent()
+
+	utxos := []*storage.Utxo{}
+	for _, t := range s.txs {
+		for _, out := range t.outputs {
+			if !wanted[out.Address] || spent[outpoint{t.txid, out.Vout}] {
+				continue
+			}
+
+			timestamp, ok := s.minedTime(t)
+			if !ok {
+				timestamp = time.Now().Format(time.RFC3339)
+			}
+
+			utxos = append(utxos, &storage.Utxo{
+				Vout:        out.Vout,
+				Hex:         out.Hex,
+				ReqSigs:     out.ReqSigs,
+				Type:        out.Type,
+				Address:     out.Address,
+				SatAmount:   out.SatAmount,
+				TxID:        t.txid,
+				BlockHeight: s.height(t),
+				Timestamp:   timestamp,
+			})
+		}
+	}
+
+	return utxos, nil
+}
+
+// EachUtxoByAddrs calls fn with each unspent output of addrs, newest block first with mempool outputs last. Stops at the
+// first error returned by fn.
+func (s *Store) EachUtxoByAddrs(ctx context.Context, addrs []string, fn func(*storage.Utxo) error) error {
+	utxos, err := s.GetUtxosByAddrs(ctx, addrs)
+	if err != nil {
+		return err
+	}
+
+	// mempool outputs are at height -1, below every block
+	sort.SliceStable(utxos, func(i, j int) bool {
+		return utxos[i].BlockHeight > utxos[j].BlockHeight
+	})
+
+	for _, utxo := range utxos {
+		if err := fn(utxo); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetOutputsByTxID returns the outputs of txid selected by filter
+func (s *Store) GetOutputsByTxID(ctx context.Context, txid string, filter storage.OutputFilter) ([]storage.Output, error) {
+	vouts := make(map[int]bool, len(filter.Vouts))
+	for _, vout := range filter.Vouts {
+		vouts[vout] = true
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	outputs := []storage.Output{}
+
+	t, ok := s.byTxID[txid]
+	if !ok {
+		return outputs, nil
+	}
+
+	for _, out := range t.outputs {
+		if len(vouts) == 0 || vouts[out.Vout] {
+			out.Addresses = nil
+			outputs = append(outputs, out)
+		}
+	}
+
+	return outputs, nil
+}
+
+// GetInputsByTxID returns the inputs of txid
+func (s *Store) GetInputsByTxID(ctx context.Context, txid string) ([]storage.Input, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	inputs := []storage.Input{}
+	if t, ok := s.byTxID[txid]; ok {
+		inputs = append(inputs, t.inputs...)
+	}
+
+	return inputs, nil
+}
+
+// addressTxs returns the transactions with an output to or an input spending an output of addrs in descending id order
+func (s *Store) addressTxs(addrs []string) []*tx {
+	wanted := set(addrs)
+
+	funded := make(map[outpoint]bool)
+	for _, t := range s.txs {
+		for _, out := range t.outputs {
+			if wanted[out.Address] {
+				funded[outpoint{t.txid, out.Vout}] = true
+			}
+		}
+	}
+
+	txs := []*tx{}
+	for _, t := range s.txs {
+		if s.involves(t, wanted, funded) {
+			txs = append(txs, t)
+		}
+	}
+
+	sort.Slice(txs, func(i, j int) bool { return txs[i].id > txs[j].id })
+
+	return txs
+}
+
+// involves reports if t pays to one of wanted or spends one of funded
+func (s *Store) involves(t *tx, wanted map[string]bool, funded map[outpoint]bool) bool {
+	for _, out := range t.outputs {
+		if wanted[out.Address] {
+			return true
+		}
+	}
+
+	for _, in := range t.inputs {
+		if funded[outpoint{in.SpentTx, in.SpentVout}] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GetTxIDsByAddresses returns the txids of transactions involving addrs selected by filter, newest first by height
+// with the mempool ahead of every block, see storage.Cursor
+func (s *Store) GetTxIDsByAddresses(ctx context.Context, addrs []string, filter storage.TxFilter) ([]string, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, errors.Wrapf(err, "failed to get tx details from addresses: %v", addrs)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	txs := []*tx{}
+	for _, t := range s.addressTxs(addrs) {
+		if s.selects(filter, t) && filter.Selects(s.cursor(t)) {
+			txs = append(txs, t)
+		}
+	}
+
+	sort.SliceStable(txs, func(i, j int) bool { return s.cursor(txs[i]).Less(s.cursor(txs[j])) })
+
+	txids := []string{}
+	for _, t := range txs {
+		txids = append(txids, t.txid)
+	}
+
+	// the page nearest to an after cursor is the oldest of the newer txs
+	if filter.After != nil && filter.Limit > 0 && len(txids) > filter.Limit {
+		return txids[len(txids)-filter.Limit:], nil
+	}
+
+	return paginate(txids, filter.Page), nil
+}
+
+// cursor returns the position of t in the address history
+func (s *Store) cursor(t *tx) storage.Cursor {
+	return storage.Cursor{Height: int(s.height(t)), ID: t.id}
+}
+
+// selects reports if t matches the conditions of filter, like the postgres queries t is in the mempool if it has no
+// non orphaned block
+func (s *Store) selects(filter storage.TxFilter, t *tx) bool {
+	if t.id < filter.FromID {
+		return false
+	}
+
+	b := s.mainBlockOf(t)
+	if b == nil {
+		return !filter.Mined()
+	}
+
+	if filter.Mempool {
+		return false
+	}
+
+	if filter.Heights != nil && (b.Height < filter.Heights.From || b.Height > filter.Heights.To) {
+		return false
+	}
+
+	minedAt := time.Unix(int64(b.Time), 0)
+	if !filter.Since.IsZero() && minedAt.Before(filter.Since) {
+		return false
+	}
+
+	if !filter.Until.IsZero() && !minedAt.Before(filter.Until) {
+		return false
+	}
+
+	return true
+}
+
+// GetTotalTxsByAddresses returns the number of transactions involving addrs
+func (s *Store) GetTotalTxsByAddresses(ctx context.Context, addrs []string) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.addressTxs(addrs)), nil
+}
+
+// GetAddressSummary returns the amounts received and sent by addr and its number of transactions, split by whether
+// they are confirmed
+func (s *Store) GetAddressSummary(ctx context.Context, addr string) (*storage.AddressSummary, error) {
+	summary, err := s.GetAddressesSummary(ctx, []string{addr})
+	if err != nil {
+		return nil, err
+	}
+
+	summary.Address = addr
+
+	return summary, nil
+}
+
+// GetAddressesSummary returns the summary of addrs taken together, counting a transaction involving several of them
+// once
+func (s *Store) GetAddressesSummary(ctx context.Context, addrs []string) (*storage.AddressSummary, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	wanted := set(addrs)
+	summary := &storage.AddressSummary{}
+	spenders := s.spenders()
+
+	for _, t := range s.txs {
+		for _, out := range t.outputs {
+			if !wanted[out.Address] {
+				continue
+			}
+
+			if s.mainBlockOf(t) != nil {
+				summary.Received += out.SatAmount
+			} else {
+				summary.UnconfirmedReceived += out.SatAmount
+			}
+
+			spender, ok := spenders[outpoint{t.txid, out.Vout}]
+			switch {
+			case !ok:
+			case spender.SpentHeight != -1:
+				summary.Sent += out.SatAmount
+			default:
+				summary.UnconfirmedSent += out.SatAmount
+			}
+		}
+	}
+
+	for _, t := range s.addressTxs(addrs) {
+		if s.mainBlockOf(t) != nil {
+			summary.Txs++
+		} else {
+			summary.UnconfirmedTxs++
+		}
+	}
+
+	return summary, nil
+}
+
+// GetUsedAddresses returns those of addrs with at least one transaction
+func (s *Store) GetUsedAddresses(ctx context.Context, addrs []string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	used := []string{}
+	for _, addr := range addrs {
+		if len(s.addressTxs([]string{addr})) > 0 {
+			used = append(used, addr)
+		}
+	}
+
+	return used, nil
+}
+
+// GetTxByTxID returns transaction full details including vins and vouts
+func (s *Store) GetTxByTxID(ctx context.Context, txid string) (*storage.Tx, error) {
+	s.mu.RLock()
+	t, ok := s.byTxID[txid]
+	if !ok {
+		s.mu.RUnlock()
+		return nil, errors.Errorf("failed to get transaction from txid: %s: not found", txid)
+	}
+
+	result := &storage.Tx{
+		ID:          t.id,
+		TxID:        t.txid,
+		Hash:        t.hash,
+		Version:     t.version,
+		Size:        t.size,
+		VSize:       t.vsize,
+		Weight:      t.weight,
+		Locktime:    t.locktime,
+		BlockHeight: s.height(t),
+		Cursor:      s.cursor(t).String(),
+	}
+
+	if b := s.mainBlockOf(t); b != nil {
+		result.BlockHash = b.Hash
+		result.Time, _ = s.minedTime(t)
+		result.BlockTime = result.Time
+	} else {
+		result.Mempool = true
+		result.Time = time.Now().Format(time.RFC3339)
+	}
+	s.mu.RUnlock()
+
+	var err error
+
+	result.Inputs, err = s.GetInputsByTxID(ctx, txid)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Outputs, err = s.GetOutputsByTxID(ctx, txid, storage.OutputFilter{})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// GetTxsByTxIDs returns the details of txids in the same order, along with the outputs spent by their inputs and the
+// spends of their outputs
+func (s *Store) GetTxsByTxIDs(ctx context.Context, txids []string) ([]*storage.TxDetails, error) {
+	details := make([]*storage.TxDetails, 0, len(txids))
+	for _, txid := range txids {
+		tx, err := s.GetTxByTxID(ctx, txid)
+		if err != nil {
+			return nil, err
+		}
+
+		details = append(details, &storage.TxDetails{Tx: tx})
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	spenders := s.spenders()
+
+	for _, d := range details {
+		for _, in := range d.Inputs {
+			var prevout *storage.Output
+			if t, ok := s.byTxID[in.SpentTx]; ok && in.Coinbase == "" {
+				for _, out := range t.outputs {
+					if out.Vout == in.SpentVout {
+						prevout = &storage.Output{Vout: out.Vout, SatAmount: out.SatAmount, Address: out.Address}
+					}
+				}
+			}
+
+			d.PrevOuts = append(d.PrevOuts, prevout)
+		}
+
+		for _, out := range d.Outputs {
+			d.Spends = append(d.Spends, spenders[outpoint{d.TxID, out.Vout}])
+		}
+	}
+
+	return details, nil
+}
+
+// spenders returns the first stored transaction spending each spent output
+func (s *Store) spenders() map[outpoint]*storage.SpentTxDetails {
+	spenders := make(map[outpoint]*storage.SpentTxDetails)
+	for _, t := range s.txs {
+		for _, in := range t.inputs {
+			op := outpoint{in.SpentTx, in.SpentVout}
+			if _, ok := spenders[op]; !ok && in.Coinbase == "" {
+				spenders[op] = &storage.SpentTxDetails{SpentTxID: t.txid, SpentIndex: in.Vin, SpentHeight: s.height(t)}
+			}
+		}
+	}
+
+	return spenders
+}
+
+// GetRawTxByTxID returns the raw transaction of txid
+func (s *Store) GetRawTxByTxID(ctx context.Context, txid string) (*storage.RawTx, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t, ok := s.byTxID[txid]
+	if !ok {
+		return nil, errors.Errorf("failed to get rawTx for txid: %s: not found", txid)
+	}
+
+	return &storage.RawTx{Hex: t.raw}, nil
+}
+
+// bounds returns the start and end of page within n values
+func bounds(n int, page storage.Page) (int, int) {
+	if page.Offset >= n {
+		return n, n
+	}
+
+	end := n
+	if page.Limit > 0 && page.Offset+page.Limit < n {
+		end = page.Offset + page.Limit
+	}
+
+	return page.Offset, end
+}
+
+// paginate returns page of values
+func paginate(values []string, page storage.Page) []string {
+	start, end := bounds(len(values), page)
+
+	return values[start:end]
+}
+
+// set returns a set of values
+func set(values []string) map[string]bool {
+	s := make(map[string]bool, len(values))
+	for _, v := range values {
+		s[v] = true
+	}
+
+	return s
+}
@@ -0,0 +1,389 @@
+// +build unit
+
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/blockchain/utxo"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/storage"
+)
+
+// the blocks used by the postgres integration tests, so both backends are held to the same behavior
+const testdata = "../../postgres/testdata"
+
+const (
+	txid100000 = "fff2525b8931402dd09222c50775608f75787bd2b87e56995a7bdd30f79702c4"
+	txid100002 = "220ebc64e21abece964927322cba69180ed853bb187fbc6923bac7d010b9d87a"
+	addr1      = "1EYTGtG4LnFfiMvjJdsU7GMGCQvsRSjYhx"
+	addr2      = "1JqDybm2nWTENrHvMyafbSXXtTk5Uv5QAn"
+)
+
+func loadBlock(t *testing.T, name string) *utxo.Block {
+	file, err := ioutil.ReadFile(filepath.Join(testdata, name+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := &utxo.Block{}
+	if err := json.Unmarshal(file, b); err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+// insert inserts blocks along with their transactions and returns their hashes
+func insert(t *testing.T, s *Store, blocks ...*utxo.Block) []string {
+	hashes := []string{}
+	for _, b := range blocks {
+		id, err := s.InsertBlock(b, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		txs := []*utxo.Tx{}
+		for i := range b.Txs {
+			txs = append(txs, &b.Txs[i])
+		}
+
+		if err := s.InsertTxs(id, txs); err != nil {
+			t.Fatal(err)
+		}
+
+		hashes = append(hashes, b.Hash)
+	}
+
+	return hashes
+}
+
+// insertNamed inserts the testdata blocks names
+func insertNamed(t *testing.T, s *Store, names ...string) {
+	for _, name := range names {
+		insert(t, s, loadBlock(t, name))
+	}
+}
+
+// loadChain returns blocks 100000 to 100002, linking 100001 to its parent as the testdata previous hash is made up
+func loadChain(t *testing.T) []*utxo.Block {
+	blocks := []*utxo.Block{
+		loadBlock(t, "blk_100000_tx_fff252"),
+		loadBlock(t, "blk_100001_no_txs"),
+		loadBlock(t, "blk_100002_tx_220ebc"),
+	}
+
+	blocks[1].PrevHash = blocks[0].Hash
+
+	return blocks
+}
+
+// assertChain checks that exactly the blocks named in main are not orphaned
+func assertChain(t *testing.T, s *Store, main ...string) {
+	t.Helper()
+
+	want := map[string]bool{}
+	for _, name := range main {
+		want[loadBlock(t, name).Hash] = true
+	}
+
+	for _, b := range s.blocks {
+		if b.IsOrphan == want[b.Hash] {
+			t.Errorf("block %d %s orphaned = %v, want %v", b.Height, b.Hash, b.IsOrphan, !want[b.Hash])
+		}
+	}
+}
+
+func TestStore_InsertBlock(t *testing.T) {
+	tests := []struct {
+		name   string
+		blocks []string
+		main   []string
+	}{
+		{
+			name:   "same height",
+			blocks: []string{"blk_reorg_10", "blk_reorg_11", "blk_reorg_11a"},
+			main:   []string{"blk_reorg_10", "blk_reorg_11a"},
+		},
+		{
+			name:   "fork new tip",
+			blocks: []string{"blk_reorg_10", "blk_reorg_11", "blk_reorg_12a", "blk_reorg_11a", "blk_reorg_13a"},
+			main:   []string{"blk_reorg_10", "blk_reorg_11a", "blk_reorg_12a", "blk_reorg_13a"},
+		},
+		{
+			name:   "missing ancestor",
+			blocks: []string{"blk_reorg_10", "blk_reorg_12", "blk_reorg_13", "blk_reorg_11"},
+			main:   []string{"blk_reorg_10", "blk_reorg_11"},
+		},
+		{
+			name:   "missing ancestor filled",
+			blocks: []string{"blk_reorg_10", "blk_reorg_12", "blk_reorg_13", "blk_reorg_11", "blk_reorg_14"},
+			main:   []string{"blk_reorg_10", "blk_reorg_11", "blk_reorg_12", "blk_reorg_13", "blk_reorg_14"},
+		},
+		{
+			name: "triple fork",
+			blocks: []string{
+				"blk_reorg_10", "blk_reorg_11", "blk_reorg_12", "blk_reorg_12a", "blk_reorg_11a", "blk_reorg_12b",
+				"blk_reorg_11b", "blk_reorg_13a", "blk_reorg_13",
+			},
+			main: []string{"blk_reorg_10", "blk_reorg_11", "blk_reorg_12", "blk_reorg_13"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New("btc")
+			insertNamed(t, s, tt.blocks...)
+			assertChain(t, s, tt.main...)
+		})
+	}
+
+	s := New("btc")
+	insertNamed(t, s, "blk_reorg_10", "blk_reorg_11", "blk_reorg_12")
+
+	if _, err := s.InsertBlock(loadBlock(t, "blk_reorg_11a"), false); err == nil {
+		t.Error("InsertBlock() below the tip error = nil")
+	}
+
+	id, err := s.InsertBlock(loadBlock(t, "blk_reorg_11a"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// blocks above a recovered block are left as is
+	assertChain(t, s, "blk_reorg_10", "blk_reorg_11a", "blk_reorg_12")
+
+	// reinserting a stored block returns its id and makes it the block at its height again
+	if again, err := s.InsertBlock(loadBlock(t, "blk_reorg_11"), true); err != nil || again != 2 || id != 4 {
+		t.Errorf("InsertBlock() = %d, %v, want 2 after %d", again, err, id)
+	}
+
+	assertChain(t, s, "blk_reorg_10", "blk_reorg_11", "blk_reorg_12")
+
+	last, err := s.LastBlock(context.Background())
+	if err != nil || last.Hash != loadBlock(t, "blk_reorg_12").Hash {
+		t.Errorf("LastBlock() = %+v, %v", last, err)
+	}
+}
+
+func TestStore_OrphanBlocks(t *testing.T) {
+	s := New("btc")
+
+	if last, err := s.LastBlock(context.Background()); last != nil || err != nil {
+		t.Errorf("LastBlock() of an empty store = %+v, %v, want nil", last, err)
+	}
+
+	hashes := insert(t, s, loadChain(t)...)
+
+	count, err := s.OrphanBlocks(100001)
+	if err != nil || count != 2 {
+		t.Fatalf("OrphanBlocks() = %d, %v, want 2", count, err)
+	}
+
+	if b, err := s.GetBlock(context.Background(), 100000); err != nil || b.Hash != hashes[0] || b.NextHash != "" {
+		t.Errorf("GetBlock() = %+v, %v, want %s without next block", b, err, hashes[0])
+	}
+
+	if _, err := s.GetBlock(context.Background(), 100001); err == nil {
+		t.Error("GetBlock() of an orphaned height error = nil")
+	}
+
+	if b, err := s.GetBlock(context.Background(), hashes[2]); err != nil || !b.IsOrphan {
+		t.Errorf("GetBlock() = %+v, %v, want orphaned block", b, err)
+	}
+
+	if orphans, err := s.GetOrphanCount(context.Background()); err != nil || orphans != 2 {
+		t.Errorf("GetOrphanCount() = %d, %v, want 2", orphans, err)
+	}
+
+	if tx, err := s.GetTxByTxID(context.Background(), txid100002); err != nil || !tx.Mempool || tx.BlockHeight != -1 {
+		t.Errorf("GetTxByTxID() of an orphaned tx = %+v, %v, want mempool", tx, err)
+	}
+
+	if err := s.DeleteOrphans(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.GetTxByTxID(context.Background(), txid100002); err == nil {
+		t.Error("GetTxByTxID() of a deleted orphaned tx error = nil")
+	}
+
+	if n, err := s.GetNumTransactions(context.Background()); err != nil || n != 1 {
+		t.Errorf("GetNumTransactions() = %d, %v, want 1", n, err)
+	}
+}
+
+func TestStore_addresses(t *testing.T) {
+	s := New("btc")
+	blocks := loadChain(t)
+	insert(t, s, blocks[0])
+
+	utxos, err := s.GetUtxosByAddrs(context.Background(), []string{addr1, addr2})
+	if err != nil || len(utxos) != 2 || utxos[0].TxID != txid100000 || utxos[0].BlockHeight != 100000 {
+		t.Fatalf("GetUtxosByAddrs() = %+v, %v, want 2 utxos of %s", utxos, err, txid100000)
+	}
+
+	// iteration stops at the first error of fn
+	stop, calls := errors.New("stop"), 0
+	err = s.EachUtxoByAddrs(context.Background(), []string{addr1, addr2}, func(*storage.Utxo) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Errorf("EachUtxoByAddrs() with fn failing = %v after %d calls, want %v after 1", err, calls, stop)
+	}
+
+	if spent := s.GetSpentTxDetails(context.Background(), txid100000, 1); spent != nil {
+		t.Errorf("GetSpentTxDetails() of an unspent output = %+v, want nil", spent)
+	}
+
+	insert(t, s, blocks[1:]...)
+
+	utxos, err = s.GetUtxosByAddrs(context.Background(), []string{addr1})
+	if err != nil || len(utxos) != 0 {
+		t.Errorf("GetUtxosByAddrs() of a spent output = %+v, %v, want none", utxos, err)
+	}
+
+	spent := s.GetSpentTxDetails(context.Background(), txid100000, 1)
+	if want := (&storage.SpentTxDetails{SpentTxID: txid100002, SpentIndex: 0, SpentHeight: 100002}); !reflect.DeepEqual(spent, want) {
+		t.Errorf("GetSpentTxDetails() = %+v, want %+v", spent, want)
+	}
+
+	mined := time.Unix(int64(blocks[2].Time), 0)
+
+	filters := []struct {
+		name   string
+		filter storage.TxFilter
+		want   []string
+	}{
+		{"all", storage.TxFilter{}, []string{txid100002, txid100000}},
+		{"page", storage.TxFilter{Page: storage.Page{Limit: 1, Offset: 1}}, []string{txid100000}},
+		{"offset past the end", storage.TxFilter{Page: storage.Page{Offset: 2}}, []string{}},
+		{"heights", storage.TxFilter{Heights: &storage.HeightRange{From: 100001, To: 100002}}, []string{txid100002}},
+		{"since", storage.TxFilter{Since: mined}, []string{txid100002}},
+		{"until", storage.TxFilter{Until: mined}, []string{txid100000}},
+		{"from id", storage.TxFilter{FromID: 2}, []string{txid100002}},
+		{"mempool", storage.TxFilter{Mempool: true}, []string{}},
+		{"before", storage.TxFilter{Before: &storage.Cursor{Height: 100002, ID: 2}}, []string{txid100000}},
+		{"after", storage.TxFilter{Page: storage.Page{Limit: 1}, After: &storage.Cursor{Height: 100000, ID: 1}}, []string{txid100002}},
+		{"after the mempool", storage.TxFilter{After: &storage.Cursor{Height: -1, ID: 1}}, []string{}},
+	}
+
+	for _, f := range filters {
+		txids, err := s.GetTxIDsByAddresses(context.Background(), []string{addr1}, f.filter)
+		if err != nil || !reflect.DeepEqual(txids, f.want) {
+			t.Errorf("GetTxIDsByAddresses() %s = %v, %v, want %v", f.name, txids, err, f.want)
+		}
+	}
+
+	invalid := storage.TxFilter{Mempool: true, Heights: &storage.HeightRange{From: 0, To: 1}}
+	if _, err := s.GetTxIDsByAddresses(context.Background(), []string{addr1}, invalid); errors.Cause(err) != storage.ErrInvalidFilter {
+		t.Errorf("GetTxIDsByAddresses() with an invalid filter error = %v, want %v", err, storage.ErrInvalidFilter)
+	}
+
+	if total, err := s.GetTotalTxsByAddresses(context.Background(), []string{addr1, addr2}); err != nil || total != 2 {
+		t.Errorf("GetTotalTxsByAddresses() = %d, %v, want 2", total, err)
+	}
+
+	outputs, err := s.GetOutputsByTxID(context.Background(), txid100000, storage.OutputFilter{Vouts: []int{0}})
+	if err != nil || len(outputs) != 1 || outputs[0].Vout != 0 || outputs[0].Address != addr2 {
+		t.Errorf("GetOutputsByTxID() = %+v, %v, want vout 0 to %s", outputs, err, addr2)
+	}
+}
+
+func TestStore_txs(t *testing.T) {
+	s := New("btc")
+	blk := loadBlock(t, "blk_100000_tx_fff252")
+
+	if err := s.InsertTxs(-1, []*utxo.Tx{&blk.Txs[0]}); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := s.GetTxByTxID(context.Background(), txid100000)
+	if err != nil || !tx.Mempool || tx.BlockHeight != -1 {
+		t.Fatalf("GetTxByTxID() = %+v, %v, want mempool", tx, err)
+	}
+
+	pending, err := s.GetPendingTxs(context.Background(), storage.TxFilter{FromID: 1})
+	if want := []*storage.PendingTx{{ID: 1, TxID: txid100000}}; err != nil || !reflect.DeepEqual(pending, want) {
+		t.Errorf("GetPendingTxs() = %+v, %v, want %+v", pending, err, want)
+	}
+
+	id, err := s.InsertBlock(blk, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.InsertTxs(id, []*utxo.Tx{&blk.Txs[0]}); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err = s.GetTxByTxID(context.Background(), txid100000)
+	if err != nil || tx.BlockHash != blk.Hash || tx.Mempool || len(tx.Inputs) != len(blk.Txs[0].Vins) || len(tx.Outputs) != len(blk.Txs[0].Vouts) {
+		t.Fatalf("GetTxByTxID() = %+v, %v, want mined in %s", tx, err, blk.Hash)
+	}
+
+	// a mined transaction isn't deleted as invalid
+	if err := s.DeleteInvalidTxs([]int{tx.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	if hashes, err := s.GetTxHashesByBlockHash(context.Background(), blk.Hash, storage.Page{Limit: 10}); err != nil || !reflect.DeepEqual(hashes, []string{txid100000}) {
+		t.Errorf("GetTxHashesByBlockHash() = %v, %v, want %s", hashes, err, txid100000)
+	}
+
+	if total, err := s.GetTotalTxsByBlockHash(context.Background(), blk.Hash); err != nil || total != 1 {
+		t.Errorf("GetTotalTxsByBlockHash() = %d, %v, want 1", total, err)
+	}
+
+	if raw, err := s.GetRawTxByTxID(context.Background(), txid100000); err != nil || raw.Hex != blk.Txs[0].Hex {
+		t.Errorf("GetRawTxByTxID() = %+v, %v", raw, err)
+	}
+
+	if at, err := s.GetTxAtBlockTime(context.Background(), time.Unix(int64(blk.Time), 0)); err != nil || at != tx.ID {
+		t.Errorf("GetTxAtBlockTime() = %d, %v, want %d", at, err, tx.ID)
+	}
+
+	if _, err := s.GetTxAtBlockTime(context.Background(), time.Unix(int64(blk.Time)+1, 0)); err == nil {
+		t.Error("GetTxAtBlockTime() after the last block error = nil")
+	}
+
+	mempool := loadBlock(t, "blk_100002_tx_220ebc").Txs[0]
+	if err := s.InsertTxs(-1, []*utxo.Tx{&mempool}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.DeleteInvalidTxs([]int{2}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.GetPendingTxs(context.Background(), storage.TxFilter{Heights: &storage.HeightRange{From: 0, To: 1}}); errors.Cause(err) != storage.ErrInvalidFilter {
+		t.Errorf("GetPendingTxs() with a height range error = %v, want %v", err, storage.ErrInvalidFilter)
+	}
+
+	if pending, err := s.GetPendingTxs(context.Background(), storage.TxFilter{}); err != nil || len(pending) != 0 {
+		t.Errorf("GetPendingTxs() after DeleteInvalidTxs() = %+v, %v, want none", pending, err)
+	}
+}
+
+func TestStore_metadata(t *testing.T) {
+	s := New("btc")
+
+	if err := s.Set("key", "value"); err != nil {
+		t.Fatal(err)
+	}
+
+	if value, err := s.Get(context.Background(), "key"); err != nil || value != "value" {
+		t.Errorf("Get() = %s, %v, want value", value, err)
+	}
+
+	if _, err := s.Get(context.Background(), "missing"); err == nil {
+		t.Error("Get() of a missing key error = nil")
+	}
+}
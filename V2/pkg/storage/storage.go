@@ -0,0 +1,66 @@
+// Package storage defines the storage of indexed blocks and transactions shared by the indexer, api, monitor and
+// validators, along with the types read from it. The backends implementing it are opened with backend.New.
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/blockchain/utxo"
+)
+
+// Reader defines the queries used by the api, monitor and validators. Queries are cancelled along with ctx.
+type Reader interface {
+	Get(ctx context.Context, key string) (string, error)
+	LastBlock(ctx context.Context) (*utxo.Block, error)
+	GetBlock(ctx context.Context, val interface{}) (*utxo.Block, error)
+	GetTxHashesByBlockHash(ctx context.Context, hash string, page Page) ([]string, error)
+	GetTotalTxsByBlockHash(ctx context.Context, hash string) (int, error)
+	GetTxByTxID(ctx context.Context, txid string) (*Tx, error)
+	GetTxsByTxIDs(ctx context.Context, txids []string) ([]*TxDetails, error)
+	GetRawTxByTxID(ctx context.Context, txid string) (*RawTx, error)
+	GetInputsByTxID(ctx context.Context, txid string) ([]Input, error)
+	GetOutputsByTxID(ctx context.Context, txid string, filter OutputFilter) ([]Output, error)
+	GetSpentTxDetails(ctx context.Context, txid string, vout int) *SpentTxDetails
+	EachUtxoByAddrs(ctx context.Context, addrs []string, fn func(*Utxo) error) error
+	GetTxIDsByAddresses(ctx context.Context, addrs []string, filter TxFilter) ([]string, error)
+	GetTotalTxsByAddresses(ctx context.Context, addrs []string) (int, error)
+	GetAddressSummary(ctx context.Context, addr string) (*AddressSummary, error)
+	GetAddressesSummary(ctx context.Context, addrs []string) (*AddressSummary, error)
+	GetUsedAddresses(ctx context.Context, addrs []string) ([]string, error)
+	GetNumTransactions(ctx context.Context) (int, error)
+	GetOrphanCount(ctx context.Context) (int, error)
+	GetPendingTxs(ctx context.Context, filter TxFilter) ([]*PendingTx, error)
+	GetTxAtBlockTime(ctx context.Context, date time.Time) (int, error)
+}
+
+// Writer defines the writes used by the indexer, monitor and validators
+type Writer interface {
+	Set(key, value string) error
+	InsertBlock(b *utxo.Block, recover bool) (int, error)
+	InsertTxs(blockID int, txs []*utxo.Tx) error
+	OrphanBlocks(height int) (int, error)
+	DeleteOrphans() error
+	DeleteInvalidTxs(ids []int) error
+}
+
+// Store defines the interface that a storage backend must implement
+type Store interface {
+	Reader
+	Writer
+	Close() error
+}
+
+// BulkLoader is implemented by backends able to load the blocks of an initial sync faster than InsertBlock and
+// InsertTxs, with their secondary indexes dropped until the load is done
+type BulkLoader interface {
+	InsertBlocksBulk(blocks []*utxo.Block) error
+	DropIndexes() error
+	CreateIndexes() error
+}
+
+// Locker is implemented by backends shared by redundant indexers, of which only the one holding the lock writes
+type Locker interface {
+	AcquireLock(ctx context.Context, interval time.Duration) error
+	LockLost() <-chan struct{}
+}
@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"github.com/pkg/errors"
+	"github.com/shapeshift-legacy/coinquery/V2/internal/convert"
+	"github.com/shapeshift-legacy/coinquery/V2/internal/pretty"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/blockchain/utxo"
+)
+
+// Tx is shape of transaction for return from graphql and API rest interfaces
+type Tx struct {
+	ID          int      `json:"id,string"`
+	TxID        string   `json:"txid"`
+	Hash        string   `json:"hash"`
+	Version     int      `json:"version"`
+	Size        int      `json:"size"`
+	VSize       int      `json:"vsize"`
+	Weight      int      `json:"weight"`
+	Locktime    int      `json:"locktime"`
+	Inputs      []Input  `json:"vin"`
+	Outputs     []Output `json:"vout"`
+	BlockHash   string   `json:"blockhash"`
+	BlockHeight int64    `json:"blockheight"`
+	Time        string   `json:"time"`
+	BlockTime   string   `json:"blocktime"`
+	Cursor      string   `json:"cursor"`
+	Mempool     bool     `json:"mempool"`
+}
+
+// PendingTx contains data to validate against mempool
+type PendingTx struct {
+	ID   int    `json:"id,string"`
+	TxID string `json:"txid"`
+}
+
+// Input is utxo shape
+type Input struct {
+	Vin         int      `json:"vin"`
+	SpentTx     string   `json:"spent_txid"`
+	SpentVout   int      `json:"spent_vout"`
+	Asm         string   `json:"asm"`
+	Hex         string   `json:"hex"`
+	Sequence    int      `json:"sequence"`
+	TxInWitness []string `json:"txinwitness"`
+	Coinbase    string   `json:"coinbase"`
+}
+
+// Output is utxo shape
+type Output struct {
+	Vout      int      `json:"vout"`
+	SatAmount int64    `json:"amount"`
+	Asm       string   `json:"asm"`
+	Hex       string   `json:"hex"`
+	ReqSigs   int      `json:"reqSigs"`
+	Type      string   `json:"type"`
+	Address   string   `json:"address"`
+	Addresses []string `json:"addresses"`
+}
+
+// SpentTxDetails structure
+type SpentTxDetails struct {
+	SpentTxID   string `json:"spentTxId"`
+	SpentIndex  int    `json:"spentIndex"`
+	SpentHeight int64  `json:"spentHeight"`
+}
+
+// Utxo structure
+type Utxo struct {
+	Vout        int    `json:"vout"`
+	Hex         string `json:"hex"`
+	ReqSigs     int    `json:"reqSigs"`
+	Type        string `json:"type"`
+	Address     string `json:"address"`
+	SatAmount   int64  `json:"amount"`
+	TxID        string `json:"txid"`
+	BlockHeight int64  `json:"height"`
+	Timestamp   string `json:"ts"`
+}
+
+// AddressSummary holds the amounts in satoshis and number of transactions of an address. Unconfirmed amounts and
+// transactions are those without a non orphaned block.
+type AddressSummary struct {
+	Address             string `json:"address"`
+	Received            int64  `json:"received"`
+	Sent                int64  `json:"sent"`
+	UnconfirmedReceived int64  `json:"unconfirmedReceived"`
+	UnconfirmedSent     int64  `json:"unconfirmedSent"`
+	Txs                 int    `json:"txs"`
+	UnconfirmedTxs      int    `json:"unconfirmedTxs"`
+}
+
+// RawTx structure
+type RawTx struct {
+	Hex string `json:"rawtx"`
+}
+
+// TxDetails is a transaction along with the outputs spent by its inputs and the spends of its outputs
+type TxDetails struct {
+	*Tx
+	PrevOuts []*Output         // output spent by each of Inputs, nil for a coinbase or an output that isn't indexed
+	Spends   []*SpentTxDetails // spend of each of Outputs, nil while unspent
+}
+
+// TxInputs converts the vins of tx into inputs for insertion
+func TxInputs(tx *utxo.Tx) []Input {
+	inputs := make([]Input, 0, len(tx.Vins))
+
+	for i, in := range tx.Vins {
+		input := Input{
+			Vin:         i,
+			SpentTx:     in.TxID,
+			SpentVout:   in.Vout,
+			Asm:         in.ScriptSig.Asm,
+			Hex:         in.ScriptSig.Hex,
+			TxInWitness: in.TxInWitness,
+			Sequence:    in.Sequence,
+			Coinbase:    in.Coinbase,
+		}
+
+		inputs = append(inputs, input)
+	}
+
+	return inputs
+}
+
+// TxOutputs converts the vouts of tx into outputs for insertion
+func TxOutputs(tx *utxo.Tx) ([]Output, error) {
+	outputs := make([]Output, 0, len(tx.Vouts))
+
+	for _, out := range tx.Vouts {
+		// check to see if this is a single value address otherwise default to "unsupported addr"
+		addr := "unsupported addr"
+		if len(out.ScriptPubKey.Addresses) == 1 {
+			addr = out.ScriptPubKey.Addresses[0]
+		}
+
+		sats, err := convert.ToSatoshi(out.Value.String())
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to convert value of vout: %+v", pretty.Print(out))
+		}
+
+		output := Output{
+			Vout:      out.N,
+			SatAmount: sats,
+			Asm:       out.ScriptPubKey.Asm,
+			Hex:       out.ScriptPubKey.Hex,
+			ReqSigs:   out.ScriptPubKey.ReqSigs,
+			Type:      out.ScriptPubKey.Type,
+			Address:   addr,
+			Addresses: out.ScriptPubKey.Addresses,
+		}
+
+		outputs = append(outputs, output)
+	}
+
+	return outputs, nil
+}
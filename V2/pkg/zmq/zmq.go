@@ -1,43 +1,87 @@
 package zmq
 
 import (
+	"context"
 	"encoding/binary"
 	"encoding/hex"
+	"sync/atomic"
 	"time"
 
 	"github.com/pebbe/zmq4"
 	"github.com/pkg/errors"
 	"github.com/shapeshift-legacy/coinquery/V2/config"
 	"github.com/shapeshift-legacy/coinquery/V2/internal/log"
+	"github.com/shapeshift-legacy/coinquery/V2/internal/metrics"
 	"github.com/shapeshift-legacy/coinquery/V2/pkg/blockchain/utxo"
 )
 
-var (
-	txChan    = make(chan string)
-	blockChan = make(chan string)
-)
-
 // ZMQ type to hold configuration details
 type ZMQ struct {
-	timeout  int64
-	subURL   string
-	subs     []string
-	sub      *zmq4.Socket
-	doneChan chan struct{}
-	errChan  chan error
+	gaps    uint64 // total sequence gaps detected, accessed atomically (first field for 64-bit alignment)
+	timeout int64
+	coin    string
+	decoder *utxo.RawDecoder // decodes rawblock and rawtx topics
+	subURL  string
+	subs    []string
+	sub     *zmq4.Socket
+	ctx     context.Context
+	seq     *sequence
+	logger  log.Logger
+
+	txChan    chan *utxo.MempoolTx
+	blockChan chan interface{} // block hash ([]string) or decoded block (*utxo.Block)
+}
+
+// sequence tracks the last sequence number received per topic
+type sequence struct {
+	last map[string]uint32
 }
 
-// New returns a ZMQ object configured for a specific coin
-func New(c *config.Coin, doneChan chan struct{}, errChan chan error) *ZMQ {
+func newSequence() *sequence {
+	return &sequence{last: make(map[string]uint32)}
+}
+
+// check records seq for topic and returns the expected sequence number and whether messages were skipped.
+// The first message of a topic is never a gap as there is nothing to compare against.
+func (s *sequence) check(topic string, seq uint32) (uint32, bool) {
+	last, ok := s.last[topic]
+	s.last[topic] = seq
+
+	if !ok {
+		return seq, false
+	}
+
+	expected := last + 1
+
+	return expected, seq != expected
+}
+
+// reset clears all tracked sequence numbers
+func (s *sequence) reset() {
+	s.last = make(map[string]uint32)
+}
+
+// New returns a ZMQ object configured for a specific coin which stops listening once ctx is cancelled
+func New(ctx context.Context, c *config.Coin) *ZMQ {
 	return &ZMQ{
-		timeout:  c.ZMQ.Timeout,
-		subURL:   c.ZMQ.SubURL,
-		subs:     c.ZMQ.Subscriptions,
-		doneChan: doneChan,
-		errChan:  errChan,
+		timeout: c.ZMQ.Timeout,
+		coin:    c.Name,
+		subURL:  c.ZMQ.SubURL,
+		subs:    c.ZMQ.Subscriptions,
+		ctx:     ctx,
+		seq:     newSequence(),
+		logger:  log.New(c.Name),
+
+		txChan:    make(chan *utxo.MempoolTx),
+		blockChan: make(chan interface{}),
 	}
 }
 
+// SequenceGaps returns the total number of sequence gaps detected across all topics
+func (z *ZMQ) SequenceGaps() uint64 {
+	return atomic.LoadUint64(&z.gaps)
+}
+
 // Connect will create a new ZMQ socket, connect to the endpoint and subscribe to the desired topics
 func (z *ZMQ) Connect() error {
 	sub, err := zmq4.NewSocket(zmq4.SUB)
@@ -54,14 +98,21 @@ func (z *ZMQ) Connect() error {
 	if err != nil {
 		return errors.Wrapf(err, "failed to connect to subscription url: %s", z.subURL)
 	}
-	log.Infof("zmq", "connected to: %s", z.subURL)
+	z.logger.Infof("zmq", "connected to: %s", z.subURL)
 
 	for _, s := range z.subs {
+		if (s == "rawblock" || s == "rawtx") && z.decoder == nil {
+			z.decoder, err = utxo.NewRawDecoder(z.coin)
+			if err != nil {
+				return errors.Wrapf(err, "failed to subscribe to topic: %s", s)
+			}
+		}
+
 		err = sub.SetSubscribe(s)
 		if err != nil {
 			return errors.Wrapf(err, "failed to subscribe to topic: %s", s)
 		}
-		log.Infof("zmq", "subscribed to: %s", s)
+		z.logger.Infof("zmq", "subscribed to: %s", s)
 	}
 
 	z.sub = sub
@@ -74,19 +125,28 @@ func (z *ZMQ) Start(blockHashChan chan<- interface{}, mempoolTxChan chan<- *utxo
 	go func() {
 		for {
 			select {
-			case hash := <-blockChan:
-				go func(hash string) {
-					log.Infof("zmq", "block received: %s", hash)
-					blockHashChan <- []string{hash}
-				}(hash)
-			case hash := <-txChan:
-				go func(hash string) {
-					log.Debugf("zmq", "tx received: %s", hash)
-					mempoolTxChan <- &utxo.MempoolTx{Hash: hash, Fails: 0}
-				}(hash)
-			case <-z.doneChan:
-				close(blockHashChan)
-				close(mempoolTxChan)
+			case block := <-z.blockChan:
+				go func(block interface{}) {
+					if b, ok := block.(*utxo.Block); ok {
+						z.logger.Infof("zmq", "raw block received: %s", b.Hash)
+					} else {
+						z.logger.Infof("zmq", "block received: %s", block.([]string)[0])
+					}
+
+					select {
+					case blockHashChan <- block:
+					case <-z.ctx.Done():
+					}
+				}(block)
+			case mTx := <-z.txChan:
+				go func(mTx *utxo.MempoolTx) {
+					z.logger.Debugf("zmq", "tx received: %s", mTx.Hash)
+					select {
+					case mempoolTxChan <- mTx:
+					case <-z.ctx.Done():
+					}
+				}(mTx)
+			case <-z.ctx.Done():
 				return
 			}
 		}
@@ -97,33 +157,148 @@ func (z *ZMQ) Start(blockHashChan chan<- interface{}, mempoolTxChan chan<- *utxo
 
 // listen is responsible for listening to subscription messages, decode them and fill the ingestion channels accordingly.
 // If RecvMessageBytes receives an error, connect to a new socket, subscribe and begin listening again.
-// To ensure no data was missed during reconnect, signal mempool to process again as well.
+// To ensure no data was missed during reconnect, or when a gap in a topic's sequence numbers shows notifications
+// were dropped, signal mempool and block sync to process again.
+// The socket is closed once ctx is cancelled, checked at least once every receive timeout.
 func (z *ZMQ) listen(blockHashChan chan<- interface{}, signalMempoolChan chan<- struct{}) {
+	defer func() {
+		if err := z.sub.Close(); err != nil {
+			z.logger.Warn(err, "zmq", "failed to close subscription socket")
+		}
+	}()
+
 	for {
+		if z.ctx.Err() != nil {
+			return
+		}
+
 		msg, err := z.sub.RecvMessageBytes(0)
 		if err != nil {
-			log.Warn(err, "zmq", "reconnecting")
+			if z.ctx.Err() != nil {
+				return
+			}
+
+			z.logger.Warn(err, "zmq", "reconnecting")
+			z.sub.Close()
 			z.Connect()
-			signalMempoolChan <- struct{}{}
-			blockHashChan <- struct{}{}
+			z.seq.reset()
+
+			if !z.resync(blockHashChan, signalMempoolChan) {
+				return
+			}
+			continue
+		}
+
+		if len(msg) < 3 {
+			z.logger.Warnf(errors.Errorf("expected 3 message parts, got %d", len(msg)), "zmq", "invalid message")
 			continue
 		}
 
 		topic := string(msg[0])
-		body := hex.EncodeToString(msg[1])
-		_ = binary.LittleEndian.Uint32(msg[2]) // sequence number
-
-		select {
-		case <-z.doneChan:
-			close(blockChan)
-			close(txChan)
-		default:
-			switch topic {
-			case "hashblock":
-				blockChan <- body
-			case "hashtx":
-				txChan <- body
+		seq := binary.LittleEndian.Uint32(msg[2])
+
+		metrics.ZMQMessages.WithLabelValues(z.coin, topic).Inc()
+
+		if expected, gap := z.seq.check(topic, seq); gap {
+			gaps := atomic.AddUint64(&z.gaps, 1)
+			metrics.ZMQSequenceGaps.WithLabelValues(z.coin, topic).Inc()
+
+			z.logger.WithFields(log.Fields{
+				"event":    "zmqSequenceGap",
+				"topic":    topic,
+				"expected": expected,
+				"received": seq,
+				"gaps":     gaps,
+			}).Warnf(errors.Errorf("expected sequence %d, received %d", expected, seq), "zmq", "sequence gap on topic %s, resyncing", topic)
+
+			if !z.resync(blockHashChan, signalMempoolChan) {
+				return
+			}
+		}
+
+		var block interface{}
+		var tx *utxo.MempoolTx
+
+		switch topic {
+		case "hashblock":
+			block = []string{hex.EncodeToString(msg[1])}
+		case "hashtx":
+			tx = &utxo.MempoolTx{Hash: hex.EncodeToString(msg[1]), Fails: 0}
+		case "rawblock":
+			block = z.decodeBlock(msg[1])
+		case "rawtx":
+			tx = z.decodeTx(msg[1])
+		}
+
+		if block != nil {
+			select {
+			case z.blockChan <- block:
+			case <-z.ctx.Done():
+				return
+			}
+		}
+
+		if tx != nil {
+			select {
+			case z.txChan <- tx:
+			case <-z.ctx.Done():
+				return
 			}
 		}
 	}
 }
+
+// decodeBlock decodes a rawblock message, falling back to the block hash if the block can't be decoded
+// so that it is fetched from the node instead. Returns nil if the message is invalid.
+func (z *ZMQ) decodeBlock(raw []byte) interface{} {
+	b, err := z.decoder.DecodeBlock(raw)
+	if err == nil {
+		return b
+	}
+
+	hash, herr := utxo.BlockHash(raw)
+	if herr != nil {
+		z.logger.Warn(herr, "zmq", "invalid rawblock message")
+		return nil
+	}
+
+	z.logger.Warnf(err, "zmq", "failed to decode raw block: %s, fetching from node", hash)
+
+	return []string{hash}
+}
+
+// decodeTx decodes a rawtx message, falling back to the txid if the transaction can't be decoded
+// so that it is fetched from the node instead. Returns nil if the message is invalid.
+func (z *ZMQ) decodeTx(raw []byte) *utxo.MempoolTx {
+	tx, err := z.decoder.DecodeTx(raw)
+	if err == nil {
+		return &utxo.MempoolTx{Hash: tx.TxID, Fails: 0, Tx: tx}
+	}
+
+	txid, herr := utxo.TxHash(raw)
+	if herr != nil {
+		z.logger.Warn(herr, "zmq", "invalid rawtx message")
+		return nil
+	}
+
+	z.logger.Warnf(err, "zmq", "failed to decode raw tx: %s, fetching from node", txid)
+
+	return &utxo.MempoolTx{Hash: txid, Fails: 0}
+}
+
+// resync signals a full mempool process and a sync to tip. Returns false if ctx was cancelled before signaling.
+func (z *ZMQ) resync(blockHashChan chan<- interface{}, signalMempoolChan chan<- struct{}) bool {
+	select {
+	case signalMempoolChan <- struct{}{}:
+	case <-z.ctx.Done():
+		return false
+	}
+
+	select {
+	case blockHashChan <- struct{}{}:
+	case <-z.ctx.Done():
+		return false
+	}
+
+	return true
+}
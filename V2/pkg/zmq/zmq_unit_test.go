@@ -0,0 +1,92 @@
+// +build unit
+
+package zmq
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/shapeshift-legacy/coinquery/V2/internal/log"
+	"github.com/shapeshift-legacy/coinquery/V2/pkg/blockchain/utxo"
+)
+
+func TestSequence_check(t *testing.T) {
+	type message struct {
+		topic string
+		seq   uint32
+	}
+	tests := []struct {
+		name     string
+		messages []message
+		wantGaps []bool
+	}{
+		{
+			name:     "Consecutive",
+			messages: []message{{"hashtx", 4}, {"hashtx", 5}, {"hashtx", 6}},
+			wantGaps: []bool{false, false, false},
+		},
+		{
+			name:     "Gap",
+			messages: []message{{"hashtx", 4}, {"hashtx", 6}, {"hashtx", 7}},
+			wantGaps: []bool{false, true, false},
+		},
+		{
+			name:     "Per Topic",
+			messages: []message{{"hashtx", 4}, {"hashblock", 0}, {"hashtx", 5}, {"hashblock", 1}},
+			wantGaps: []bool{false, false, false, false},
+		},
+		{
+			name:     "Wraparound",
+			messages: []message{{"hashtx", 4294967295}, {"hashtx", 0}},
+			wantGaps: []bool{false, false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSequence()
+
+			for i, m := range tt.messages {
+				if _, gap := s.check(m.topic, m.seq); gap != tt.wantGaps[i] {
+					t.Errorf("check(%s, %d) gap = %v, want %v", m.topic, m.seq, gap, tt.wantGaps[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSequence_reset(t *testing.T) {
+	s := newSequence()
+	s.check("hashtx", 4)
+	s.reset()
+
+	if _, gap := s.check("hashtx", 10); gap {
+		t.Error("check() after reset() reported a gap")
+	}
+}
+
+func TestZMQ_decodeTx(t *testing.T) {
+	d, err := utxo.NewRawDecoder("btc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	z := &ZMQ{decoder: d, logger: log.New("btc")}
+
+	coinbase, _ := hex.DecodeString("01000000010000000000000000000000000000000000000000000000000000000000000000ffffffff0704ffff001d0104ffffffff0100f2052a0100000043410496b538e853519c726a2c91e61ec11600ae1390813a627c66fb8be7947be63c52da7589379515d4e0a604f8141781e62294721166bf621e73a82cbf2342c858eeac00000000")
+	if tx := z.decodeTx(coinbase); tx == nil || tx.Tx == nil || tx.Hash != "0e3e2357e806b6cdb1f70b54c3a3a17b6714ee1f0e68bebb44a74b1efd512098" {
+		t.Errorf("decodeTx() = %+v, want the decoded coinbase", tx)
+	}
+
+	// a tx the decoder doesn't support is fetched from the node by its txid instead of being dropped
+	unsupported := bytes.Repeat([]byte{1}, 10)
+	want, _ := utxo.TxHash(unsupported)
+
+	if tx := z.decodeTx(unsupported); tx == nil || tx.Tx != nil || tx.Hash != want {
+		t.Errorf("decodeTx() of an unsupported tx = %+v, want txid %s to fetch", tx, want)
+	}
+
+	if tx := z.decodeTx([]byte{1, 0}); tx != nil {
+		t.Errorf("decodeTx() of an invalid message = %+v, want nil", tx)
+	}
+}